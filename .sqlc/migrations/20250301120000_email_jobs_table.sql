@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS email_jobs (
+    id TEXT NOT NULL PRIMARY KEY DEFAULT (gen_random_uuid()),
+    payload TEXT NOT NULL CHECK (payload != ''),
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'processing', 'sent', 'dead')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    max_attempts INTEGER NOT NULL CHECK (max_attempts > 0),
+    last_error TEXT,
+    message_id TEXT,
+    run_at TEXT NOT NULL CHECK (run_at != ''),
+    locked_until TEXT,
+    created_at TEXT NOT NULL CHECK (created_at != ''),
+    updated_at TEXT NOT NULL CHECK (updated_at != '')
+);
+
+CREATE INDEX IF NOT EXISTS idx_email_jobs_status_run_at ON email_jobs (status, run_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_email_jobs_status_run_at;
+DROP TABLE IF EXISTS email_jobs;
+-- +goose StatementEnd
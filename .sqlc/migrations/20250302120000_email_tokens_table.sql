@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS email_tokens (
+    id TEXT NOT NULL PRIMARY KEY DEFAULT (gen_random_uuid()),
+    user_id TEXT NOT NULL CHECK (user_id != ''),
+    created_at TEXT NOT NULL CHECK (created_at != ''),
+    expires_at TEXT NOT NULL CHECK (expires_at != ''),
+    used_at TEXT,
+
+    CONSTRAINT fk_user_id FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_email_tokens_expires_at ON email_tokens(expires_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_email_tokens_expires_at;
+DROP TABLE IF EXISTS email_tokens;
+-- +goose StatementEnd
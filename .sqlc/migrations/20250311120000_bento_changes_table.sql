@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS bento_changes (
+    id TEXT NOT NULL PRIMARY KEY DEFAULT (gen_random_uuid()),
+    bento_id TEXT NOT NULL CHECK (bento_id != ''),
+    revision INTEGER NOT NULL,
+    user_id TEXT NOT NULL CHECK (user_id != ''),
+    action TEXT NOT NULL CHECK (action IN ('add', 'replace', 'remove')),
+    ingredients TEXT NOT NULL,
+    created_at TEXT NOT NULL CHECK (created_at != ''),
+    CONSTRAINT unique_bento_change_revision UNIQUE (bento_id, revision),
+    CONSTRAINT fk_bento_id FOREIGN KEY (bento_id) REFERENCES bentos(id) ON DELETE CASCADE
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS bento_changes;
+-- +goose StatementEnd
@@ -0,0 +1,54 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS webhooks (
+    id TEXT NOT NULL PRIMARY KEY DEFAULT (gen_random_uuid()),
+    user_id TEXT NOT NULL CHECK (user_id != ''),
+    bento_id TEXT,
+    group_id TEXT,
+    url TEXT NOT NULL CHECK (url != ''),
+    -- encrypted with the AES key, deliveries are signed with it
+    secret BLOB NOT NULL,
+    events TEXT NOT NULL CHECK (events != ''),
+    created_at TEXT NOT NULL CHECK (created_at != ''),
+    updated_at TEXT NOT NULL CHECK (updated_at != ''),
+    CONSTRAINT webhook_scope CHECK ((bento_id IS NULL) != (group_id IS NULL)),
+    CONSTRAINT fk_user_id FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT fk_bento_id FOREIGN KEY (bento_id) REFERENCES bentos(id) ON DELETE CASCADE,
+    CONSTRAINT fk_group_id FOREIGN KEY (group_id) REFERENCES groups(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhooks_bento_id ON webhooks (bento_id);
+CREATE INDEX IF NOT EXISTS idx_webhooks_group_id ON webhooks (group_id);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id TEXT NOT NULL PRIMARY KEY DEFAULT (gen_random_uuid()),
+    webhook_id TEXT NOT NULL CHECK (webhook_id != ''),
+    event_id TEXT NOT NULL CHECK (event_id != ''),
+    event_type TEXT NOT NULL CHECK (event_type != ''),
+    payload TEXT NOT NULL CHECK (payload != ''),
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'processing', 'delivered', 'dead')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    max_attempts INTEGER NOT NULL CHECK (max_attempts > 0),
+    response_status INTEGER,
+    last_error TEXT,
+    run_at TEXT NOT NULL CHECK (run_at != ''),
+    locked_until TEXT,
+    delivered_at TEXT,
+    created_at TEXT NOT NULL CHECK (created_at != ''),
+    updated_at TEXT NOT NULL CHECK (updated_at != ''),
+    CONSTRAINT fk_webhook_id FOREIGN KEY (webhook_id) REFERENCES webhooks(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_status_run_at ON webhook_deliveries (status, run_at);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook_id ON webhook_deliveries (webhook_id, created_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_webhook_deliveries_webhook_id;
+DROP INDEX IF EXISTS idx_webhook_deliveries_status_run_at;
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP INDEX IF EXISTS idx_webhooks_group_id;
+DROP INDEX IF EXISTS idx_webhooks_bento_id;
+DROP TABLE IF EXISTS webhooks;
+-- +goose StatementEnd
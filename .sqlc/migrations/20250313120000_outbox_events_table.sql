@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS outbox_events (
+    id TEXT NOT NULL PRIMARY KEY DEFAULT (gen_random_uuid()),
+    event_id TEXT NOT NULL CHECK (event_id != ''),
+    name TEXT NOT NULL CHECK (name != ''),
+    subscriber TEXT NOT NULL CHECK (subscriber != ''),
+    payload TEXT NOT NULL CHECK (payload != ''),
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'processing', 'done', 'dead')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    max_attempts INTEGER NOT NULL CHECK (max_attempts > 0),
+    last_error TEXT,
+    run_at TEXT NOT NULL CHECK (run_at != ''),
+    locked_until TEXT,
+    created_at TEXT NOT NULL CHECK (created_at != ''),
+    updated_at TEXT NOT NULL CHECK (updated_at != ''),
+
+    UNIQUE (event_id, subscriber)
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_events_status_run_at ON outbox_events (status, run_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_outbox_events_status_run_at;
+DROP TABLE IF EXISTS outbox_events;
+-- +goose StatementEnd
@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+-- no foreign key on bento_id, the audit log must outlive the bento
+CREATE TABLE IF NOT EXISTS bento_reveals (
+    id TEXT NOT NULL PRIMARY KEY DEFAULT (gen_random_uuid()),
+    bento_id TEXT NOT NULL CHECK (bento_id != ''),
+    user_id TEXT NOT NULL CHECK (user_id != ''),
+    ingredients TEXT NOT NULL,
+    ip TEXT NOT NULL,
+    user_agent TEXT NOT NULL,
+    created_at TEXT NOT NULL CHECK (created_at != '')
+);
+
+CREATE INDEX IF NOT EXISTS idx_bento_reveals_bento_id_created_at ON bento_reveals (bento_id, created_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_bento_reveals_bento_id_created_at;
+DROP TABLE IF EXISTS bento_reveals;
+-- +goose StatementEnd
@@ -3,7 +3,7 @@ SELECT EXISTS(SELECT 1 FROM bentos WHERE name = ? AND user_id = ?);
 
 -- name: NewBento :one
 INSERT INTO bentos (user_id, name, created_at, updated_at)
-VALUES (?, ?, ?, ?) RETURNING id;
+VALUES (?, ?, ?, ?) RETURNING id, revision;
 
 -- name: GetBentoByIDWithPermissions :one
 SELECT b.*, p.bytes FROM bentos b
@@ -17,8 +17,9 @@ SELECT * FROM bentos WHERE id = ? AND user_id = ?;
 INSERT INTO bento_ingredients (bento_id, name, value, created_at, updated_at)
 VALUES (?, ?, ?, ?, ?);
 
--- name: RemoveIngredientFromBento :execrows
-DELETE FROM bento_ingredients WHERE bento_id = ? AND id = ?;
+-- name: RemoveIngredientFromBento :one
+DELETE FROM bento_ingredients WHERE bento_id = ? AND id = ?
+RETURNING name;
 
 -- name: SetBentoIngredient :exec
 INSERT INTO bento_ingredients (bento_id, name, value, created_at, updated_at)
@@ -31,6 +32,10 @@ ON CONFLICT DO UPDATE SET
 SELECT id, name, CAST(value AS TEXT) FROM bento_ingredients
 WHERE bento_id = ?;
 
+-- name: GetBentoIngredientNames :many
+SELECT id, name FROM bento_ingredients
+WHERE bento_id = ?;
+
 -- name: GetBentoIngredientIDsInBento :many
 SELECT id FROM bento_ingredients WHERE bento_id = ?;
 
@@ -40,3 +45,34 @@ LEFT JOIN bento_permissions p ON p.bento_id = b.id AND p.user_id = ?1
 LEFT JOIN users_groups ug ON  ug.user_id = ?1
 LEFT JOIN group_permissions g ON g.bento_id = b.id AND g.group_id = ug.group_id
 WHERE b.user_id = ?1;
+
+-- name: IncrementBentoRevision :one
+UPDATE bentos SET revision = revision + 1, updated_at = ?
+WHERE id = ? RETURNING revision;
+
+-- name: IncrementBentoRevisionIfMatch :one
+UPDATE bentos SET revision = revision + 1, updated_at = ?
+WHERE id = ? AND revision = ? RETURNING revision;
+
+-- name: NewBentoChange :exec
+INSERT INTO bento_changes (bento_id, revision, user_id, action, ingredients, created_at)
+VALUES (?, ?, ?, ?, ?, ?);
+
+-- name: ListBentoChangesSince :many
+SELECT * FROM bento_changes
+WHERE bento_id = ? AND revision > ?
+ORDER BY revision
+LIMIT ?;
+
+-- name: DeleteBento :exec
+DELETE FROM bentos WHERE id = ?;
+
+-- name: NewBentoReveal :exec
+INSERT INTO bento_reveals (bento_id, user_id, ingredients, ip, user_agent, created_at)
+VALUES (?, ?, ?, ?, ?, ?);
+
+-- name: ListBentoReveals :many
+SELECT * FROM bento_reveals
+WHERE bento_id = ?
+ORDER BY created_at DESC
+LIMIT ?;
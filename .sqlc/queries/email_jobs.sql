@@ -0,0 +1,60 @@
+-- name: NewEmailJob :one
+INSERT INTO email_jobs (payload, max_attempts, run_at, created_at, updated_at)
+VALUES (?, ?, ?, ?, ?)
+RETURNING id;
+
+-- name: ClaimEmailJob :one
+UPDATE email_jobs SET
+    status = 'processing',
+    attempts = attempts + 1,
+    locked_until = sqlc.arg(locked_until),
+    updated_at = sqlc.arg(updated_at)
+WHERE id = (
+    SELECT j.id FROM email_jobs j
+    WHERE (j.status = 'pending' AND j.run_at <= sqlc.arg(now))
+       OR (j.status = 'processing' AND j.locked_until <= sqlc.arg(now))
+    ORDER BY j.run_at
+    LIMIT 1
+)
+RETURNING *;
+
+-- name: CompleteEmailJob :execrows
+UPDATE email_jobs SET
+    status = 'sent',
+    message_id = ?,
+    last_error = NULL,
+    locked_until = NULL,
+    updated_at = ?
+WHERE id = ? AND status = 'processing' AND locked_until = ?;
+
+-- name: RetryEmailJob :execrows
+UPDATE email_jobs SET
+    status = 'pending',
+    last_error = ?,
+    run_at = ?,
+    locked_until = NULL,
+    updated_at = ?
+WHERE id = ? AND status = 'processing' AND locked_until = ?;
+
+-- name: BuryEmailJob :execrows
+UPDATE email_jobs SET
+    status = 'dead',
+    last_error = ?,
+    locked_until = NULL,
+    updated_at = ?
+WHERE id = ? AND status = 'processing' AND locked_until = ?;
+
+-- name: ListEmailJobsByStatus :many
+SELECT * FROM email_jobs
+WHERE status = ?
+ORDER BY created_at DESC
+LIMIT ?;
+
+-- name: RedriveEmailJob :execrows
+UPDATE email_jobs SET
+    status = 'pending',
+    attempts = 0,
+    last_error = NULL,
+    run_at = ?,
+    updated_at = ?
+WHERE id = ? AND status = 'dead';
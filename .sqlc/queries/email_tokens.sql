@@ -0,0 +1,18 @@
+-- name: NewEmailToken :one
+INSERT INTO email_tokens
+(user_id, created_at, expires_at)
+VALUES
+(?, ?, ?)
+RETURNING *;
+
+-- name: GetEmailTokenByID :one
+SELECT * FROM email_tokens WHERE id = ?;
+
+-- name: UseEmailToken :execrows
+UPDATE email_tokens
+SET used_at = ?
+WHERE id = ? AND used_at IS NULL;
+
+-- name: DeleteStaleEmailTokens :execrows
+DELETE FROM email_tokens
+WHERE expires_at <= sqlc.arg(now) OR used_at IS NOT NULL;
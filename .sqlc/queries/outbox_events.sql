@@ -0,0 +1,48 @@
+-- name: NewOutboxEvent :one
+INSERT INTO outbox_events (event_id, name, subscriber, payload, max_attempts, run_at, created_at, updated_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+RETURNING id;
+
+-- name: ClaimOutboxEvent :one
+UPDATE outbox_events SET
+    status = 'processing',
+    attempts = attempts + 1,
+    locked_until = sqlc.arg(locked_until),
+    updated_at = sqlc.arg(updated_at)
+WHERE id = (
+    SELECT o.id FROM outbox_events o
+    WHERE (o.status = 'pending' AND o.run_at <= sqlc.arg(now))
+       OR (o.status = 'processing' AND o.locked_until <= sqlc.arg(now))
+    ORDER BY o.run_at
+    LIMIT 1
+)
+RETURNING *;
+
+-- name: CompleteOutboxEvent :execrows
+UPDATE outbox_events SET
+    status = 'done',
+    last_error = NULL,
+    locked_until = NULL,
+    updated_at = ?
+WHERE id = ? AND status = 'processing' AND locked_until = ?;
+
+-- name: RetryOutboxEvent :execrows
+UPDATE outbox_events SET
+    status = 'pending',
+    last_error = ?,
+    run_at = ?,
+    locked_until = NULL,
+    updated_at = ?
+WHERE id = ? AND status = 'processing' AND locked_until = ?;
+
+-- name: BuryOutboxEvent :execrows
+UPDATE outbox_events SET
+    status = 'dead',
+    last_error = ?,
+    locked_until = NULL,
+    updated_at = ?
+WHERE id = ? AND status = 'processing' AND locked_until = ?;
+
+-- name: DeleteDoneOutboxEvents :execrows
+DELETE FROM outbox_events
+WHERE status = 'done' AND updated_at < ?;
@@ -0,0 +1,86 @@
+-- name: NewWebhook :one
+INSERT INTO webhooks (user_id, bento_id, group_id, url, secret, events, created_at, updated_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+RETURNING id;
+
+-- name: ListBentoWebhooks :many
+SELECT * FROM webhooks WHERE bento_id = ? ORDER BY created_at;
+
+-- name: ListGroupWebhooks :many
+SELECT * FROM webhooks WHERE group_id = ? ORDER BY created_at;
+
+-- name: ListWebhooksOfUserGroups :many
+SELECT w.* FROM webhooks w
+WHERE w.group_id IN (
+    SELECT ug.group_id FROM users_groups ug WHERE ug.user_id = sqlc.arg(user_id)
+    UNION
+    SELECT g.id FROM groups g WHERE g.owner_id = sqlc.arg(user_id)
+)
+ORDER BY w.created_at;
+
+-- name: GetWebhookManagedByUser :one
+SELECT w.* FROM webhooks w
+LEFT JOIN bentos b ON b.id = w.bento_id
+LEFT JOIN groups g ON g.id = w.group_id
+WHERE w.id = sqlc.arg(id) AND (b.user_id = sqlc.arg(user_id) OR g.owner_id = sqlc.arg(user_id));
+
+-- name: GetWebhookByID :one
+SELECT * FROM webhooks WHERE id = ?;
+
+-- name: DeleteWebhook :exec
+DELETE FROM webhooks WHERE id = ?;
+
+-- name: NewWebhookDelivery :one
+INSERT INTO webhook_deliveries (webhook_id, event_id, event_type, payload, max_attempts, run_at, created_at, updated_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+RETURNING id;
+
+-- name: ClaimWebhookDelivery :one
+UPDATE webhook_deliveries SET
+    status = 'processing',
+    attempts = attempts + 1,
+    locked_until = sqlc.arg(locked_until),
+    updated_at = sqlc.arg(updated_at)
+WHERE id = (
+    SELECT d.id FROM webhook_deliveries d
+    WHERE (d.status = 'pending' AND d.run_at <= sqlc.arg(now))
+       OR (d.status = 'processing' AND d.locked_until <= sqlc.arg(now))
+    ORDER BY d.run_at
+    LIMIT 1
+)
+RETURNING *;
+
+-- name: CompleteWebhookDelivery :execrows
+UPDATE webhook_deliveries SET
+    status = 'delivered',
+    response_status = ?,
+    last_error = NULL,
+    locked_until = NULL,
+    delivered_at = ?,
+    updated_at = ?
+WHERE id = ? AND status = 'processing' AND locked_until = ?;
+
+-- name: RetryWebhookDelivery :execrows
+UPDATE webhook_deliveries SET
+    status = 'pending',
+    response_status = ?,
+    last_error = ?,
+    run_at = ?,
+    locked_until = NULL,
+    updated_at = ?
+WHERE id = ? AND status = 'processing' AND locked_until = ?;
+
+-- name: BuryWebhookDelivery :execrows
+UPDATE webhook_deliveries SET
+    status = 'dead',
+    response_status = ?,
+    last_error = ?,
+    locked_until = NULL,
+    updated_at = ?
+WHERE id = ? AND status = 'processing' AND locked_until = ?;
+
+-- name: ListWebhookDeliveries :many
+SELECT * FROM webhook_deliveries
+WHERE webhook_id = ?
+ORDER BY created_at DESC
+LIMIT ?;
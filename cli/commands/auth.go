@@ -0,0 +1,313 @@
+package command
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/juancwu/konbini/cli/config"
+	"github.com/juancwu/konbini/cli/services"
+	"github.com/juancwu/konbini/common/api"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// sessionOutput is the output of register, login and logout.
+type sessionOutput struct {
+	Profile   string `json:"profile"`
+	Email     string `json:"email,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+}
+
+func newRegisterCmd() *cobra.Command {
+	var email, nickname string
+
+	cmd := &cobra.Command{
+		Use:   "register",
+		Short: "Create a new account",
+		Long: `Register creates a new account and signs in with it. The password is read from stdin,
+or prompted for when stdin is a terminal. A verification email is sent to the address.`,
+		Example: `  konbi register --email me@mail.com --nickname me
+  printf '%s' "$PASSWORD" | konbi register --email me@mail.com --nickname me`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			email, err := accountEmail(email)
+			if err != nil {
+				return err
+			}
+			password, err := readPassword(cmd, "Password: ")
+			if err != nil {
+				return err
+			}
+
+			res, err := services.Register(email, nickname, password)
+			if err != nil {
+				return err
+			}
+			if err := services.SaveToken(res.AuthToken); err != nil {
+				return err
+			}
+
+			out := sessionOutput{Profile: config.ProfileName(), Email: email, TokenType: res.TokenType}
+			return printOutput(cmd, out, func(w io.Writer) {
+				fmt.Fprintf(w, "Registered %s. Verify your email and setup TOTP by running konbi without arguments.\n", email)
+			})
+		},
+	}
+
+	cmd.Flags().StringVar(&email, "email", "", "email of the account, defaults to the account of the profile")
+	cmd.Flags().StringVar(&nickname, "nickname", "", "nickname of the account")
+	cmd.MarkFlagRequired("nickname")
+
+	return cmd
+}
+
+func newLoginCmd() *cobra.Command {
+	var email, totpCode, recoveryCode string
+
+	cmd := &cobra.Command{
+		Use:   "login",
+		Short: "Sign in and store the token",
+		Long: `Login signs in with email and password and stores the token in the credential store. The password is
+read from stdin, or prompted for when stdin is a terminal. Accounts with TOTP need --totp or --recovery-code.`,
+		Example: `  konbi login --email me@mail.com --totp 123456
+  printf '%s' "$PASSWORD" | konbi login --email me@mail.com --recovery-code "$RECOVERY_CODE"`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			email, err := accountEmail(email)
+			if err != nil {
+				return err
+			}
+			password, err := readPassword(cmd, "Password: ")
+			if err != nil {
+				return err
+			}
+
+			code := totpCode
+			if recoveryCode != "" {
+				code = recoveryCode
+			}
+			res, err := services.Login(email, password, code)
+			if err != nil {
+				if api.IsErrorCode(err, api.ErrorCodeTOTPRequired) {
+					return errors.New("The account has TOTP setup, login again with --totp or --recovery-code.")
+				}
+				return err
+			}
+			if err := services.SaveToken(res.Token); err != nil {
+				return err
+			}
+
+			if res.Type != "full_token" {
+				fmt.Fprintln(cmd.ErrOrStderr(), "The token is partial until the email is verified and TOTP is setup, run konbi without arguments to finish.")
+			}
+			out := sessionOutput{Profile: config.ProfileName(), Email: email, TokenType: res.Type}
+			return printOutput(cmd, out, func(w io.Writer) {
+				fmt.Fprintf(w, "Logged in as %s with profile %s.\n", email, out.Profile)
+			})
+		},
+	}
+
+	cmd.Flags().StringVar(&email, "email", "", "email of the account, defaults to the account of the profile")
+	cmd.Flags().StringVar(&totpCode, "totp", "", "code from the authenticator app")
+	cmd.Flags().StringVar(&recoveryCode, "recovery-code", "", "recovery code, used instead of a TOTP code")
+	cmd.MarkFlagsMutuallyExclusive("totp", "recovery-code")
+
+	return cmd
+}
+
+func newLogoutCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "logout",
+		Short: "Revoke the token and remove it from the credential store",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			token, err := services.LoadToken()
+			if err != nil {
+				if errors.Is(err, services.ErrNotLoggedIn) {
+					return printOutput(cmd, sessionOutput{Profile: config.ProfileName()}, func(w io.Writer) {
+						fmt.Fprintln(w, "Not logged in.")
+					})
+				}
+				return err
+			}
+
+			ctx, cancel := context.WithTimeout(cmd.Context(), time.Second*10)
+			defer cancel()
+
+			config.SetAuth(config.Auth{Token: token})
+			revokeErr := services.NewClient().Logout(ctx)
+			if revokeErr != nil && services.IsAuthError(revokeErr) {
+				// the token was already revoked or expired
+				revokeErr = nil
+			}
+
+			// the token is removed even if the server could not be reached
+			if err := services.DeleteToken(); err != nil {
+				return err
+			}
+			if revokeErr != nil {
+				return fmt.Errorf("Removed the stored token but failed to revoke it: %w", revokeErr)
+			}
+
+			return printOutput(cmd, sessionOutput{Profile: config.ProfileName()}, func(w io.Writer) {
+				fmt.Fprintln(w, "Logged out.")
+			})
+		},
+	}
+}
+
+func newWhoamiCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "whoami",
+		Short: "Show the signed in account",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := context.WithTimeout(cmd.Context(), time.Second*10)
+			defer cancel()
+
+			res, err := services.Authenticate(ctx)
+			if err != nil {
+				return err
+			}
+
+			out := struct {
+				Profile       string `json:"profile"`
+				Server        string `json:"server"`
+				Email         string `json:"email"`
+				EmailVerified bool   `json:"email_verified"`
+				TOTP          bool   `json:"totp"`
+				TokenType     string `json:"token_type"`
+			}{config.ProfileName(), config.BackendUrl(""), res.Email, res.EmailVerified, res.TOTP, res.TokenType}
+			return printOutput(cmd, out, func(w io.Writer) {
+				fmt.Fprintf(w, "Email:\t%s\n", res.Email)
+				fmt.Fprintf(w, "Email verified:\t%t\n", res.EmailVerified)
+				fmt.Fprintf(w, "TOTP:\t%t\n", res.TOTP)
+				fmt.Fprintf(w, "Token type:\t%s\n", res.TokenType)
+				fmt.Fprintf(w, "Profile:\t%s\n", config.ProfileName())
+				fmt.Fprintf(w, "Server:\t%s\n", config.BackendUrl(""))
+			})
+		},
+	}
+}
+
+func newAuthCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "auth",
+		Short: "Inspect how konbi stores credentials",
+	}
+	cmd.AddCommand(newAuthStatusCmd())
+	return cmd
+}
+
+// authStatus is the output of konbi auth status.
+type authStatus struct {
+	Profile  string `json:"profile"`
+	Server   string `json:"server"`
+	Store    string `json:"store"`
+	Location string `json:"location"`
+	// KeyringError is why the OS keyring is not used when the file store is the fallback.
+	KeyringError string `json:"keyring_error,omitempty"`
+	LoggedIn     bool   `json:"logged_in"`
+	Email        string `json:"email,omitempty"`
+	TokenType    string `json:"token_type,omitempty"`
+	// Error is why the stored token could not be checked.
+	Error string `json:"error,omitempty"`
+}
+
+func newAuthStatusCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "status",
+		Short: "Show the credential store in use and whether the profile is logged in",
+		Long: `Status shows where the token of the profile is stored. The OS keyring is used when it is available,
+otherwise the token is kept in a file encrypted with a passphrase derived with Argon2id. The passphrase is read
+from $KONBINI_CREDENTIALS_PASSPHRASE or prompted for. Set $KONBINI_CREDENTIAL_STORE to keyring or file to
+choose the store.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, err := services.Credentials()
+			if err != nil {
+				return err
+			}
+			status := authStatus{
+				Profile:  config.ProfileName(),
+				Server:   config.BackendUrl(""),
+				Store:    store.Name(),
+				Location: store.Location(),
+			}
+			if err := services.KeyringUnavailable(); err != nil {
+				status.KeyringError = err.Error()
+			}
+
+			ctx, cancel := context.WithTimeout(cmd.Context(), time.Second*10)
+			defer cancel()
+			res, err := services.Authenticate(ctx)
+			switch {
+			case err == nil:
+				status.LoggedIn = true
+				status.Email = res.Email
+				status.TokenType = res.TokenType
+			case !errors.Is(err, services.ErrNotLoggedIn):
+				status.Error = err.Error()
+			}
+
+			return printOutput(cmd, status, func(w io.Writer) {
+				fmt.Fprintf(w, "Profile:\t%s\n", status.Profile)
+				fmt.Fprintf(w, "Server:\t%s\n", status.Server)
+				fmt.Fprintf(w, "Credential store:\t%s (%s)\n", status.Store, status.Location)
+				if status.KeyringError != "" {
+					fmt.Fprintf(w, "Keyring unavailable:\t%s\n", status.KeyringError)
+				}
+				switch {
+				case status.LoggedIn:
+					fmt.Fprintf(w, "Logged in:\tyes, as %s (%s)\n", status.Email, status.TokenType)
+				case status.Error != "":
+					fmt.Fprintf(w, "Logged in:\tunknown, %s\n", status.Error)
+				default:
+					fmt.Fprintf(w, "Logged in:\tno\n")
+				}
+			})
+		},
+	}
+}
+
+// accountEmail returns the email of the --email flag, or the account of the profile when it is not given.
+func accountEmail(email string) (string, error) {
+	if email == "" {
+		email = config.CurrentProfile().Account
+	}
+	if email == "" {
+		return "", fmt.Errorf("Missing --email, or set the account of the profile with konbi profile set %s --account EMAIL", config.ProfileName())
+	}
+	return email, nil
+}
+
+// readPassword prompts for a password without echo when stdin is a terminal, otherwise it
+// reads the first line of stdin so that it can be piped in.
+func readPassword(cmd *cobra.Command, prompt string) (string, error) {
+	if f, ok := cmd.InOrStdin().(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		fmt.Fprint(cmd.ErrOrStderr(), prompt)
+		b, err := term.ReadPassword(int(f.Fd()))
+		fmt.Fprintln(cmd.ErrOrStderr())
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	}
+
+	line, err := bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		return "", errors.New("Missing password, pipe it to stdin.")
+	}
+	return password, nil
+}
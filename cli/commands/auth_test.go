@@ -0,0 +1,42 @@
+package command
+
+import (
+	"os"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadPassword(t *testing.T) {
+	// pipe returns a command whose stdin is the read end of a pipe with input written to it
+	pipe := func(t *testing.T, input string) *cobra.Command {
+		r, w, err := os.Pipe()
+		require.NoError(t, err)
+		t.Cleanup(func() { r.Close() })
+		_, err = w.WriteString(input)
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+
+		cmd := &cobra.Command{}
+		cmd.SetIn(r)
+		return cmd
+	}
+
+	t.Run("reads the first line of a pipe", func(t *testing.T) {
+		password, err := readPassword(pipe(t, "secret password\r\nsecond line\n"), "Password: ")
+		require.NoError(t, err)
+		require.Equal(t, "secret password", password)
+	})
+
+	t.Run("reads a pipe without a trailing newline", func(t *testing.T) {
+		password, err := readPassword(pipe(t, "secret"), "Password: ")
+		require.NoError(t, err)
+		require.Equal(t, "secret", password)
+	})
+
+	t.Run("rejects an empty pipe", func(t *testing.T) {
+		_, err := readPassword(pipe(t, ""), "Password: ")
+		require.Error(t, err)
+	})
+}
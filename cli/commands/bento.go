@@ -0,0 +1,297 @@
+package command
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/juancwu/konbini/cli/services"
+	"github.com/juancwu/konbini/common/api"
+
+	"github.com/spf13/cobra"
+)
+
+func newBentoCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "bento",
+		Short: "Manage bentos and their ingredients",
+		Long: `Bento commands list, show, create and change bentos. A bento is referenced by its id or by its name,
+names must be unique among the bentos you have access to.`,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			_, err := services.Authenticate(cmd.Context())
+			return err
+		},
+	}
+	cmd.AddCommand(
+		newBentoListCmd(),
+		newBentoShowCmd(),
+		newBentoNewCmd(),
+		newBentoSetCmd(),
+		newBentoUnsetCmd(),
+		newBentoRemoveCmd(),
+	)
+	return cmd
+}
+
+func newBentoListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:     "ls",
+		Aliases: []string{"list"},
+		Short:   "List the bentos you have access to",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := bentoContext(cmd)
+			defer cancel()
+
+			bentos, err := services.NewClient().ListBentos(ctx)
+			if err != nil {
+				return err
+			}
+			if bentos == nil {
+				bentos = []api.ListBentosResponse{}
+			}
+
+			return printOutput(cmd, bentos, func(w io.Writer) {
+				fmt.Fprintln(w, "ID\tNAME\tPERMISSIONS\tUPDATED")
+				for _, b := range bentos {
+					perms := b.UserPerms
+					if perms == "" {
+						perms = b.GroupPerms
+					}
+					fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", b.BentoID, b.BentoName, perms, b.UpdatedAt)
+				}
+			})
+		},
+	}
+}
+
+func newBentoShowCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:     "show BENTO",
+		Aliases: []string{"get"},
+		Short:   "Show a bento and the values of its ingredients",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := bentoContext(cmd)
+			defer cancel()
+
+			bento, err := services.RevealBento(ctx, services.NewClient(), args[0])
+			if err != nil {
+				return err
+			}
+
+			return printOutput(cmd, bentoOutput{bento}, func(w io.Writer) {
+				fmt.Fprintf(w, "# %s (%s) revision %d\n", bento.Name, bento.BentoID, bento.Revision)
+				fmt.Fprintln(w, "NAME\tVALUE")
+				for _, ing := range bento.Ingredients {
+					fmt.Fprintf(w, "%s\t%s\n", ing.Name, ing.Value)
+				}
+			})
+		},
+	}
+}
+
+func newBentoNewCmd() *cobra.Command {
+	sources := services.IngredientSources{}
+
+	cmd := &cobra.Command{
+		Use:   "new NAME [KEY=VALUE...]",
+		Short: "Create a bento, optionally with ingredients",
+		Example: `  konbi bento new prod API_KEY=secret
+  konbi bento new prod --file TLS_KEY=./tls.key
+  vault read -field=key secret/prod | konbi bento new prod --stdin API_KEY`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			sources.Args = args[1:]
+			values, err := services.ReadIngredients(sources, cmd.InOrStdin())
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := bentoContext(cmd)
+			defer cancel()
+
+			req := api.NewBentoRequest{Name: args[0]}
+			for _, name := range sortedNames(values) {
+				req.Ingredients = append(req.Ingredients, api.Ingredient{Name: name, Value: values[name]})
+			}
+			res, err := services.NewClient().NewBento(ctx, req)
+			if err != nil {
+				return err
+			}
+
+			return printOutput(cmd, res, func(w io.Writer) {
+				fmt.Fprintf(w, "Created bento %s (%s) with %d ingredients.\n", args[0], res.BentoID, len(values))
+			})
+		},
+	}
+
+	addIngredientSourceFlags(cmd, &sources)
+	return cmd
+}
+
+func newBentoSetCmd() *cobra.Command {
+	sources := services.IngredientSources{}
+	var replace bool
+
+	cmd := &cobra.Command{
+		Use:   "set BENTO KEY=VALUE...",
+		Short: "Add ingredients to a bento",
+		Long: `Set adds ingredients to a bento. Ingredients that already exist are only overwritten with --replace.
+Use --file or --stdin for multi-line values so that they don't end up in the shell history.`,
+		Example: `  konbi bento set prod API_KEY=secret DEBUG=false
+  konbi bento set prod --replace --file TLS_KEY=./tls.key
+  pbpaste | konbi bento set prod --stdin API_KEY`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			sources.Args = args[1:]
+			values, err := services.ReadIngredients(sources, cmd.InOrStdin())
+			if err != nil {
+				return err
+			}
+			if len(values) == 0 {
+				return errors.New("Nothing to set, give KEY=VALUE pairs, --file or --stdin.")
+			}
+
+			err = changeBento(cmd, args[0], services.BentoChange{Set: values, Replace: replace}, sources.Stdin != "")
+			if api.IsErrorCode(err, api.ErrorCodeIngredientExists) {
+				return fmt.Errorf("%w Run again with --replace to overwrite it.", err)
+			}
+			return err
+		},
+	}
+
+	addIngredientSourceFlags(cmd, &sources)
+	cmd.Flags().BoolVar(&replace, "replace", false, "overwrite ingredients that already exist")
+	return cmd
+}
+
+func newBentoUnsetCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "unset BENTO KEY...",
+		Short: "Remove ingredients from a bento",
+		Args:  cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return changeBento(cmd, args[0], services.BentoChange{Unset: args[1:]}, false)
+		},
+	}
+}
+
+func newBentoRemoveCmd() *cobra.Command {
+	var yes bool
+
+	cmd := &cobra.Command{
+		Use:     "rm BENTO",
+		Aliases: []string{"delete"},
+		Short:   "Delete a bento and its ingredients",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := bentoContext(cmd)
+			defer cancel()
+
+			client := services.NewClient()
+			bento, err := services.ResolveBento(ctx, client, args[0])
+			if err != nil {
+				return err
+			}
+			if !yes {
+				ok, err := confirm(cmd, fmt.Sprintf("Delete bento %q and its %d ingredients?", bento.Name, len(bento.Ingredients)))
+				if err != nil {
+					return err
+				}
+				if !ok {
+					return errors.New("Aborted.")
+				}
+			}
+			if err := client.DeleteBento(ctx, bento.BentoID); err != nil {
+				return err
+			}
+
+			return printOutput(cmd, map[string]string{"bento_id": bento.BentoID}, func(w io.Writer) {
+				fmt.Fprintf(w, "Deleted bento %s (%s).\n", bento.Name, bento.BentoID)
+			})
+		},
+	}
+
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "delete without asking for confirmation")
+	return cmd
+}
+
+// bentoOutput is a bento that is written as a .env file with -o env.
+type bentoOutput struct {
+	*api.GetBentoResponse
+}
+
+func (b bentoOutput) envVars() []api.BentoIngredient {
+	return b.Ingredients
+}
+
+// changeBento applies the change to the bento and prints its new revision. When the bento changed
+// in the meantime the user is asked whether to apply the change on top, which is not possible
+// when stdin was used for a value.
+func changeBento(cmd *cobra.Command, ref string, change services.BentoChange, stdinUsed bool) error {
+	ctx, cancel := bentoContext(cmd)
+	defer cancel()
+
+	// the values are needed to show what someone else modified in a conflict
+	client := services.NewClient()
+	bento, err := services.RevealBento(ctx, client, ref)
+	if err != nil {
+		return err
+	}
+
+	resolve := services.PromptRebase(cmd.InOrStdin(), cmd.ErrOrStderr())
+	if stdinUsed {
+		resolve = func(conflict services.BentoConflict) (bool, error) {
+			services.PrintBentoConflict(cmd.ErrOrStderr(), conflict)
+			return false, nil
+		}
+	}
+	revision, err := services.ApplyBentoChange(ctx, client, bento, change, resolve)
+	if err != nil {
+		return err
+	}
+
+	res := struct {
+		BentoID  string `json:"bento_id"`
+		Revision int64  `json:"revision"`
+	}{bento.BentoID, revision}
+	return printOutput(cmd, res, func(w io.Writer) {
+		fmt.Fprintf(w, "Bento %s is at revision %d.\n", bento.Name, revision)
+	})
+}
+
+// bentoContext bounds the requests of a bento command.
+func bentoContext(cmd *cobra.Command) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(cmd.Context(), time.Second*30)
+}
+
+func addIngredientSourceFlags(cmd *cobra.Command, sources *services.IngredientSources) {
+	cmd.Flags().StringArrayVar(&sources.Files, "file", nil, "read the value of an ingredient from a file, KEY=PATH")
+	cmd.Flags().StringVar(&sources.Stdin, "stdin", "", "read the value of this ingredient from stdin")
+}
+
+// confirm asks a yes/no question on stderr and reads the answer from stdin.
+func confirm(cmd *cobra.Command, question string) (bool, error) {
+	fmt.Fprintf(cmd.ErrOrStderr(), "%s [y/N] ", question)
+	answer, err := bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
+
+func sortedNames(values map[string]string) []string {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
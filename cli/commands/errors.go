@@ -0,0 +1,141 @@
+package command
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/juancwu/konbini/cli/services"
+	"github.com/juancwu/konbini/common/api"
+)
+
+// Exit codes of konbi. konbi run exits with the code of the command it runs instead.
+const (
+	EXIT_OK                = 0
+	EXIT_ERROR             = 1
+	EXIT_USAGE             = 2
+	EXIT_AUTH              = 3
+	EXIT_NOT_FOUND         = 4
+	EXIT_PERMISSION_DENIED = 5
+	EXIT_RATE_LIMITED      = 6
+)
+
+// exitCodesHelp documents the exit codes in the help of the root command.
+const exitCodesHelp = `Exit codes:
+  0  success
+  1  any other error
+  2  invalid flags or arguments
+  3  not logged in, or the token or the credentials were rejected
+  4  not found
+  5  permission denied
+  6  rate limited, retry later
+konbi run exits with the exit code of the command it runs.`
+
+// ExitError makes konbi exit with Code without printing an error, i.e. to pass on the exit
+// code of a command run by konbi run.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// usageError is an error caused by invalid flags or arguments.
+type usageError struct {
+	error
+}
+
+func (e usageError) Unwrap() error {
+	return e.error
+}
+
+// ExitCode returns the code konbi exits with after Execute returns err.
+func ExitCode(err error) int {
+	if err == nil {
+		return EXIT_OK
+	}
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.Code
+	}
+	if errors.As(err, &usageError{}) {
+		return EXIT_USAGE
+	}
+	if errors.Is(err, services.ErrNotLoggedIn) {
+		return EXIT_AUTH
+	}
+
+	var errRes *api.ErrorResponse
+	if !errors.As(err, &errRes) {
+		return EXIT_ERROR
+	}
+	switch {
+	case errRes.Code == http.StatusUnauthorized || isAuthErrorCode(errRes.ErrorCode):
+		return EXIT_AUTH
+	case errRes.Code == http.StatusForbidden || errRes.ErrorCode == api.ErrorCodeForbidden:
+		return EXIT_PERMISSION_DENIED
+	case errRes.Code == http.StatusNotFound || strings.HasSuffix(string(errRes.ErrorCode), "not_found"):
+		return EXIT_NOT_FOUND
+	case errRes.Code == http.StatusTooManyRequests || errRes.ErrorCode == api.ErrorCodeRateLimited:
+		return EXIT_RATE_LIMITED
+	}
+	return EXIT_ERROR
+}
+
+func isAuthErrorCode(code api.ErrorCode) bool {
+	switch code {
+	case api.ErrorCodeUnauthorized,
+		api.ErrorCodeInvalidToken,
+		api.ErrorCodeTokenExpired,
+		api.ErrorCodeInvalidCredentials,
+		api.ErrorCodeEmailUnverified,
+		api.ErrorCodeTOTPRequired,
+		api.ErrorCodeInvalidTOTPCode,
+		api.ErrorCodeInvalidRecoveryCode,
+		api.ErrorCodeRecoveryCodeUsed:
+		return true
+	}
+	return false
+}
+
+// jsonError is the error written to stderr with -o json.
+type jsonError struct {
+	Error struct {
+		Message   string           `json:"message"`
+		ExitCode  int              `json:"exit_code"`
+		Code      int              `json:"code,omitempty"`
+		ErrorCode api.ErrorCode    `json:"error_code,omitempty"`
+		RequestID string           `json:"request_id,omitempty"`
+		Errors    []api.FieldError `json:"errors,omitempty"`
+	} `json:"error"`
+}
+
+// printError writes err to w, as JSON with -o json. API errors include the request id so that
+// they can be looked up in the server logs.
+func printError(w io.Writer, err error) {
+	var errRes *api.ErrorResponse
+	errors.As(err, &errRes)
+
+	if outputFormat == outputJSON {
+		var out jsonError
+		out.Error.Message = err.Error()
+		out.Error.ExitCode = ExitCode(err)
+		if errRes != nil {
+			out.Error.Code = errRes.Code
+			out.Error.ErrorCode = errRes.ErrorCode
+			out.Error.RequestID = errRes.RequestId
+			out.Error.Errors = errRes.Errors
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+
+	fmt.Fprintln(w, "Error:", err)
+	if errRes != nil && errRes.RequestId != "" {
+		fmt.Fprintln(w, "Request ID:", errRes.RequestId)
+	}
+}
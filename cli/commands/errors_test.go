@@ -0,0 +1,49 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/juancwu/konbini/cli/services"
+	"github.com/juancwu/konbini/common/api"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExitCodes(t *testing.T) {
+	apiErr := func(code int, errorCode api.ErrorCode) error {
+		return fmt.Errorf("Failed to get bento: %w", &api.ErrorResponse{Code: code, ErrorCode: errorCode, RequestId: "req-1"})
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		code int
+	}{
+		{"success", nil, EXIT_OK},
+		{"other error", errors.New("boom"), EXIT_ERROR},
+		{"exit error of konbi run", &ExitError{Code: 42}, 42},
+		{"not logged in", fmt.Errorf("whoami: %w", services.ErrNotLoggedIn), EXIT_AUTH},
+		{"unauthorized", apiErr(http.StatusUnauthorized, api.ErrorCodeUnauthorized), EXIT_AUTH},
+		{"expired token", apiErr(http.StatusUnauthorized, api.ErrorCodeTokenExpired), EXIT_AUTH},
+		{"totp required", apiErr(http.StatusForbidden, api.ErrorCodeTOTPRequired), EXIT_AUTH},
+		{"forbidden", apiErr(http.StatusForbidden, api.ErrorCodeForbidden), EXIT_PERMISSION_DENIED},
+		{"bento not found", apiErr(http.StatusNotFound, api.ErrorCodeBentoNotFound), EXIT_NOT_FOUND},
+		{"rate limited", apiErr(http.StatusTooManyRequests, api.ErrorCodeRateLimited), EXIT_RATE_LIMITED},
+		{"server error", apiErr(http.StatusInternalServerError, api.ErrorCodeInternal), EXIT_ERROR},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.code, ExitCode(tt.err))
+		})
+	}
+
+	// the codes are documented in the help, they must not change meaning
+	codes := map[int]bool{}
+	for _, code := range []int{EXIT_OK, EXIT_ERROR, EXIT_USAGE, EXIT_AUTH, EXIT_NOT_FOUND, EXIT_PERMISSION_DENIED, EXIT_RATE_LIMITED} {
+		require.False(t, codes[code], "exit code %d is used twice", code)
+		codes[code] = true
+	}
+}
@@ -0,0 +1,165 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+
+	"github.com/juancwu/konbini/cli/services"
+	"github.com/juancwu/konbini/common/api"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// Output formats of the --output flag.
+const (
+	outputTable    = "table"
+	outputJSON     = "json"
+	outputYAML     = "yaml"
+	outputEnv      = "env"
+	outputTemplate = "template"
+)
+
+var outputFormats = []string{outputTable, outputJSON, outputYAML, outputEnv, outputTemplate}
+
+var (
+	// outputFormat is set by the --output flag of the root command.
+	outputFormat = outputTable
+	// outputTemplateText is set by the --template flag, or by -o template=TEMPLATE.
+	outputTemplateText string
+	outputTmpl         *template.Template
+)
+
+func validateOutputFormat() error {
+	if text, ok := strings.CutPrefix(outputFormat, outputTemplate+"="); ok {
+		outputFormat, outputTemplateText = outputTemplate, text
+	}
+	found := false
+	for _, f := range outputFormats {
+		found = found || outputFormat == f
+	}
+	if !found {
+		return usageError{fmt.Errorf("Unknown output format %q, expecting one of %s", outputFormat, strings.Join(outputFormats, ", "))}
+	}
+
+	if outputFormat != outputTemplate {
+		return nil
+	}
+	if outputTemplateText == "" {
+		return usageError{fmt.Errorf("Missing --template for -o template")}
+	}
+	tmpl, err := template.New("output").Option("missingkey=error").Parse(outputTemplateText)
+	if err != nil {
+		return usageError{fmt.Errorf("Invalid --template: %w", err)}
+	}
+	outputTmpl = tmpl
+	return nil
+}
+
+// envOutput is implemented by outputs that have their own form in -o env.
+type envOutput interface {
+	envVars() []api.BentoIngredient
+}
+
+// printOutput writes v in the selected output format. The table format calls table with a
+// tabwriter that is flushed afterwards. The other formats use the JSON form of v, so the
+// keys of yaml, env and templates are the same as in json.
+func printOutput(cmd *cobra.Command, v any, table func(w io.Writer)) error {
+	out := cmd.OutOrStdout()
+	switch outputFormat {
+	case outputJSON:
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case outputYAML:
+		data, err := jsonValue(v)
+		if err != nil {
+			return err
+		}
+		enc := yaml.NewEncoder(out)
+		enc.SetIndent(2)
+		if err := enc.Encode(data); err != nil {
+			return err
+		}
+		return enc.Close()
+	case outputEnv:
+		if e, ok := v.(envOutput); ok {
+			_, err := io.WriteString(out, services.FormatEnvFile(e.envVars()))
+			return err
+		}
+		data, err := jsonValue(v)
+		if err != nil {
+			return err
+		}
+		vars := []api.BentoIngredient{}
+		flattenEnv("", data, &vars)
+		_, err = io.WriteString(out, services.FormatEnvFile(vars))
+		return err
+	case outputTemplate:
+		data, err := jsonValue(v)
+		if err != nil {
+			return err
+		}
+		return outputTmpl.Execute(out, data)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	table(w)
+	return w.Flush()
+}
+
+// jsonValue converts v to the generic value of its JSON form.
+func jsonValue(v any) (any, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var data any
+	if err := json.Unmarshal(b, &data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// flattenEnv turns a JSON value into variables, the names of nested keys and list indexes are
+// joined with underscores and uppercased, i.e. {"changes":[{"name":"A"}]} is CHANGES_0_NAME=A.
+func flattenEnv(prefix string, v any, vars *[]api.BentoIngredient) {
+	name := func(key string) string {
+		key = strings.ToUpper(strings.NewReplacer("-", "_", ".", "_", " ", "_").Replace(key))
+		if prefix == "" {
+			return key
+		}
+		return prefix + "_" + key
+	}
+
+	switch value := v.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(value))
+		for k := range value {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			flattenEnv(name(k), value[k], vars)
+		}
+	case []any:
+		if prefix == "" {
+			prefix = "ITEM"
+		}
+		for i, item := range value {
+			flattenEnv(name(strconv.Itoa(i)), item, vars)
+		}
+	case nil:
+		*vars = append(*vars, api.BentoIngredient{Name: prefix})
+	case string:
+		*vars = append(*vars, api.BentoIngredient{Name: prefix, Value: value})
+	default:
+		*vars = append(*vars, api.BentoIngredient{Name: prefix, Value: fmt.Sprint(value)})
+	}
+}
@@ -0,0 +1,184 @@
+package command
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/juancwu/konbini/common/api"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+// setOutputFormat selects the output format like the --output flag, it is reset after the test.
+func setOutputFormat(t *testing.T, format string, templateText string) error {
+	t.Cleanup(func() {
+		outputFormat, outputTemplateText, outputTmpl = outputTable, "", nil
+	})
+	outputFormat, outputTemplateText = format, templateText
+	return validateOutputFormat()
+}
+
+// runPrintOutput returns what printOutput writes for v in the given format.
+func runPrintOutput(t *testing.T, format string, templateText string, v any) string {
+	require.NoError(t, setOutputFormat(t, format, templateText))
+	var out bytes.Buffer
+	cmd := &cobra.Command{}
+	cmd.SetOut(&out)
+	require.NoError(t, printOutput(cmd, v, func(w io.Writer) {
+		fmt.Fprintln(w, "NAME\tVALUE")
+	}))
+	return out.String()
+}
+
+func TestPrintOutput(t *testing.T) {
+	type item struct {
+		Name  string   `json:"name"`
+		Count int      `json:"count"`
+		Tags  []string `json:"tags"`
+	}
+	v := item{Name: "prod", Count: 2, Tags: []string{"a", "b"}}
+
+	t.Run("table", func(t *testing.T) {
+		require.Equal(t, "NAME  VALUE\n", runPrintOutput(t, outputTable, "", v))
+	})
+
+	t.Run("json", func(t *testing.T) {
+		require.Equal(t, "{\n  \"name\": \"prod\",\n  \"count\": 2,\n  \"tags\": [\n    \"a\",\n    \"b\"\n  ]\n}\n", runPrintOutput(t, outputJSON, "", v))
+	})
+
+	t.Run("yaml uses the json keys", func(t *testing.T) {
+		require.Equal(t, "count: 2\nname: prod\ntags:\n  - a\n  - b\n", runPrintOutput(t, outputYAML, "", v))
+	})
+
+	t.Run("env flattens the json form", func(t *testing.T) {
+		require.Equal(t, "COUNT=\"2\"\nNAME=\"prod\"\nTAGS_0=\"a\"\nTAGS_1=\"b\"\n", runPrintOutput(t, outputEnv, "", v))
+	})
+
+	t.Run("env writes bentos as a .env file", func(t *testing.T) {
+		bento := bentoOutput{&api.GetBentoResponse{BentoID: "b1", Ingredients: []api.BentoIngredient{
+			{Name: "B", Value: "two"},
+			{Name: "A", Value: "one"},
+		}}}
+		require.Equal(t, "A=\"one\"\nB=\"two\"\n", runPrintOutput(t, outputEnv, "", bento))
+	})
+
+	t.Run("template uses the json keys", func(t *testing.T) {
+		require.Equal(t, "prod has 2 tags", runPrintOutput(t, outputTemplate, "{{.name}} has {{len .tags}} tags", v))
+	})
+
+	t.Run("template fails on missing keys", func(t *testing.T) {
+		require.NoError(t, setOutputFormat(t, outputTemplate, "{{.missing}}"))
+		cmd := &cobra.Command{}
+		cmd.SetOut(io.Discard)
+		require.Error(t, printOutput(cmd, v, nil))
+	})
+}
+
+func TestValidateOutputFormat(t *testing.T) {
+	t.Run("parses -o template=", func(t *testing.T) {
+		require.NoError(t, setOutputFormat(t, "template={{.name}}", ""))
+		require.Equal(t, outputTemplate, outputFormat)
+		require.Equal(t, "{{.name}}", outputTemplateText)
+		require.NotNil(t, outputTmpl)
+	})
+
+	t.Run("parses a template with an equal sign", func(t *testing.T) {
+		require.NoError(t, setOutputFormat(t, "template={{.name}}={{.count}}", ""))
+		require.Equal(t, "{{.name}}={{.count}}", outputTemplateText)
+	})
+
+	tests := []struct {
+		name         string
+		format       string
+		templateText string
+	}{
+		{"unknown format", "xml", ""},
+		{"template without text", outputTemplate, ""},
+		{"empty template=", "template=", ""},
+		{"invalid template", outputTemplate, "{{.name"},
+	}
+	for _, tt := range tests {
+		t.Run("rejects "+tt.name, func(t *testing.T) {
+			err := setOutputFormat(t, tt.format, tt.templateText)
+			require.Error(t, err)
+			require.Equal(t, EXIT_USAGE, ExitCode(err))
+		})
+	}
+}
+
+func TestFlattenEnv(t *testing.T) {
+	flatten := func(t *testing.T, data string) []api.BentoIngredient {
+		var v any
+		require.NoError(t, json.Unmarshal([]byte(data), &v))
+		vars := []api.BentoIngredient{}
+		flattenEnv("", v, &vars)
+		return vars
+	}
+
+	t.Run("joins nested keys and indexes", func(t *testing.T) {
+		require.Equal(t, []api.BentoIngredient{
+			{Name: "CHANGES_0_NAME", Value: "A"},
+			{Name: "CHANGES_1_NAME", Value: "B"},
+			{Name: "REVISION", Value: "3"},
+		}, flatten(t, `{"revision":3,"changes":[{"name":"A"},{"name":"B"}]}`))
+	})
+
+	t.Run("replaces characters that are not valid in names", func(t *testing.T) {
+		require.Equal(t, []api.BentoIngredient{
+			{Name: "A_B_C_D", Value: "true"},
+			{Name: "EMPTY", Value: ""},
+		}, flatten(t, `{"a-b.c d":true,"empty":null}`))
+	})
+
+	t.Run("names the items of a top level list", func(t *testing.T) {
+		require.Equal(t, []api.BentoIngredient{
+			{Name: "ITEM_0", Value: "x"},
+			{Name: "ITEM_1_ID", Value: "1.5"},
+		}, flatten(t, `["x",{"id":1.5}]`))
+	})
+}
+
+func TestPrintError(t *testing.T) {
+	errRes := &api.ErrorResponse{
+		Code:      http.StatusBadRequest,
+		ErrorCode: api.ErrorCodeValidationFailed,
+		Message:   "Request body failed validation.",
+		RequestId: "req-1",
+		Errors:    []api.FieldError{{Field: "name", Rule: "required", Message: "is required"}},
+	}
+	err := fmt.Errorf("Failed to create bento: %w", errRes)
+
+	t.Run("json", func(t *testing.T) {
+		require.NoError(t, setOutputFormat(t, outputJSON, ""))
+		var out bytes.Buffer
+		printError(&out, err)
+		require.JSONEq(t, `{"error":{
+			"message":"`+err.Error()+`",
+			"exit_code":1,
+			"code":400,
+			"error_code":"validation_failed",
+			"request_id":"req-1",
+			"errors":[{"field":"name","rule":"required","message":"is required"}]
+		}}`, out.String())
+	})
+
+	t.Run("json without an api error", func(t *testing.T) {
+		require.NoError(t, setOutputFormat(t, outputJSON, ""))
+		var out bytes.Buffer
+		printError(&out, errors.New("boom"))
+		require.JSONEq(t, `{"error":{"message":"boom","exit_code":1}}`, out.String())
+	})
+
+	t.Run("text", func(t *testing.T) {
+		require.NoError(t, setOutputFormat(t, outputTable, ""))
+		var out bytes.Buffer
+		printError(&out, err)
+		require.Equal(t, "Error: "+err.Error()+"\nRequest ID: req-1\n", out.String())
+	})
+}
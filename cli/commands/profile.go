@@ -0,0 +1,226 @@
+package command
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/juancwu/konbini/cli/config"
+	"github.com/juancwu/konbini/cli/services"
+
+	"github.com/spf13/cobra"
+)
+
+func newProfileCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "profile",
+		Short: "Manage the profiles of the config file",
+		Long: `A profile is a server, an account and defaults for the commands. Profiles are stored in
+konbini/config.yaml under the XDG config directory and each one has its own token in the credential store.
+The profile is selected with --profile, then $KONBINI_PROFILE, then the current profile.`,
+		Example: `  konbi profile set staging --server https://staging.example.com/api/v1 --account me@mail.com
+  konbi --profile staging login
+  konbi profile use staging`,
+	}
+	cmd.AddCommand(
+		newProfileListCmd(),
+		newProfileSetCmd(),
+		newProfileUseCmd(),
+		newProfileRemoveCmd(),
+	)
+	return cmd
+}
+
+// isProfileCmd reports whether the command manages profiles.
+func isProfileCmd(cmd *cobra.Command) bool {
+	for c := cmd; c != nil; c = c.Parent() {
+		if c.Name() == "profile" && c.HasParent() && !c.Parent().HasParent() {
+			return true
+		}
+	}
+	return false
+}
+
+// profileEntry is the JSON output of a profile.
+type profileEntry struct {
+	Name     string `json:"name"`
+	Selected bool   `json:"selected"`
+	config.Profile
+}
+
+func newProfileListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:     "ls",
+		Aliases: []string{"list"},
+		Short:   "List the profiles",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			f, err := config.ReadFile()
+			if err != nil {
+				return err
+			}
+
+			names := f.ProfileNames()
+			if _, ok := f.Profiles[config.DefaultProfile]; !ok {
+				names = append([]string{config.DefaultProfile}, names...)
+			}
+			entries := make([]profileEntry, len(names))
+			for i, name := range names {
+				p := config.Profile{}
+				if f.Profiles[name] != nil {
+					p = *f.Profiles[name]
+				}
+				if p.Server == "" {
+					p.Server = config.DefaultServer
+				}
+				entries[i] = profileEntry{Name: name, Selected: name == config.ProfileName(), Profile: p}
+			}
+
+			return printOutput(cmd, entries, func(w io.Writer) {
+				fmt.Fprintln(w, "\tNAME\tSERVER\tACCOUNT\tOUTPUT\tBENTO")
+				for _, e := range entries {
+					mark := ""
+					if e.Selected {
+						mark = "*"
+					}
+					fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", mark, e.Name, e.Server, e.Account, e.Output, e.Bento)
+				}
+			})
+		},
+	}
+}
+
+func newProfileSetCmd() *cobra.Command {
+	var p config.Profile
+
+	cmd := &cobra.Command{
+		Use:   "set NAME",
+		Short: "Add a profile or change some of its settings",
+		Long:  `Set adds the profile if it doesn't exist and changes the settings given as flags. Pass an empty value to unset one.`,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if cmd.Flags().Changed("output") {
+				// the root --output flag is reused for the default output format
+				p.Output = outputFormat
+			}
+
+			f, err := config.ReadFile()
+			if err != nil {
+				return err
+			}
+			if f.Profiles == nil {
+				f.Profiles = map[string]*config.Profile{}
+			}
+			existing := f.Profiles[args[0]]
+			if existing == nil {
+				existing = &config.Profile{}
+				f.Profiles[args[0]] = existing
+			}
+			oldServer := existing.Server
+			if cmd.Flags().Changed("server") {
+				existing.Server = p.Server
+			}
+			if cmd.Flags().Changed("account") {
+				existing.Account = p.Account
+			}
+			if cmd.Flags().Changed("output") {
+				existing.Output = p.Output
+			}
+			if cmd.Flags().Changed("bento") {
+				existing.Bento = p.Bento
+			}
+			if err := f.Save(); err != nil {
+				return err
+			}
+			// the token was issued by the old server, it must not be sent to the new one
+			serverChanged := serverOrDefault(oldServer) != serverOrDefault(existing.Server)
+			if serverChanged {
+				if err := services.DeleteProfileToken(args[0], oldServer); err != nil {
+					return err
+				}
+			}
+
+			path, _ := config.Path()
+			out := profileEntry{Name: args[0], Selected: args[0] == config.ProfileName(), Profile: *existing}
+			return printOutput(cmd, out, func(w io.Writer) {
+				fmt.Fprintf(w, "Saved profile %s in %s.\n", args[0], path)
+				if serverChanged {
+					fmt.Fprintf(w, "The server changed, run konbi login --profile %s to login again.\n", args[0])
+				}
+			})
+		},
+	}
+
+	cmd.Flags().StringVar(&p.Server, "server", "", "base url of the API, i.e. https://konbini.example.com/api/v1")
+	cmd.Flags().StringVar(&p.Account, "account", "", "email used by konbi login when --email is not given")
+	cmd.Flags().StringVar(&p.Bento, "bento", "", "bento of konbi run when there is no --bento and no project")
+	return cmd
+}
+
+func newProfileUseCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "use NAME",
+		Short: "Make a profile the current one",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			f, err := config.ReadFile()
+			if err != nil {
+				return err
+			}
+			if _, ok := f.Profiles[args[0]]; !ok && args[0] != config.DefaultProfile {
+				return fmt.Errorf("Unknown profile %q, add it with konbi profile set %s --server URL", args[0], args[0])
+			}
+			f.CurrentProfile = args[0]
+			if err := f.Save(); err != nil {
+				return err
+			}
+			return printOutput(cmd, map[string]string{"current_profile": args[0]}, func(w io.Writer) {
+				fmt.Fprintf(w, "Using profile %s.\n", args[0])
+			})
+		},
+	}
+}
+
+func newProfileRemoveCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:     "rm NAME",
+		Aliases: []string{"delete"},
+		Short:   "Remove a profile and its stored token",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			f, err := config.ReadFile()
+			if err != nil {
+				return err
+			}
+			existing, ok := f.Profiles[args[0]]
+			if !ok {
+				return fmt.Errorf("Unknown profile %q", args[0])
+			}
+			server := ""
+			if existing != nil {
+				server = existing.Server
+			}
+			delete(f.Profiles, args[0])
+			if f.CurrentProfile == args[0] {
+				f.CurrentProfile = ""
+			}
+			if err := f.Save(); err != nil {
+				return err
+			}
+			// the token is not revoked, konbi logout does that
+			if err := services.DeleteProfileToken(args[0], server); err != nil {
+				return err
+			}
+			return printOutput(cmd, map[string]string{"removed_profile": args[0]}, func(w io.Writer) {
+				fmt.Fprintf(w, "Removed profile %s.\n", args[0])
+			})
+		},
+	}
+}
+
+// serverOrDefault returns the server used by a profile with the given server setting.
+func serverOrDefault(server string) string {
+	if server == "" {
+		return config.DefaultServer
+	}
+	return server
+}
@@ -2,15 +2,81 @@ package command
 
 import (
 	"context"
+	"errors"
+
+	"github.com/juancwu/konbini/cli/config"
 
 	"github.com/spf13/cobra"
 )
 
+// profileName is set by the --profile flag of the root command.
+var profileName string
+
 func Execute() error {
+	// run the hooks of the root command along with the ones of subcommands
+	cobra.EnableTraverseRunHooks = true
+
 	rootCmd := &cobra.Command{
 		Use:   "konbi",
 		Short: "CLI to manage project secrets in .env form and stored in Konbini.",
+		Long:  "CLI to manage project secrets in .env form and stored in Konbini.\n\n" + exitCodesHelp,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := config.Load(profileName); err != nil {
+				// profiles can be managed even if the selected one does not exist
+				if !isProfileCmd(cmd) {
+					return err
+				}
+			}
+			if !cmd.Flags().Changed("output") && config.CurrentProfile().Output != "" {
+				outputFormat = config.CurrentProfile().Output
+			}
+			return validateOutputFormat()
+		},
+		SilenceUsage:  true,
+		SilenceErrors: true,
 	}
+	rootCmd.PersistentFlags().StringVar(&profileName, "profile", "", "profile of the config file to use, defaults to $"+config.ProfileEnv)
+	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", outputTable, "output format: table, json, yaml, env or template")
+	rootCmd.PersistentFlags().StringVar(&outputTemplateText, "template", "", "Go text/template for -o template, with the keys of the json output, i.e. '{{.bento_id}}'")
+	rootCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return usageError{err}
+	})
+	rootCmd.AddCommand(
+		newRegisterCmd(),
+		newLoginCmd(),
+		newLogoutCmd(),
+		newWhoamiCmd(),
+		newAuthCmd(),
+		newProfileCmd(),
+		newWatchCmd(),
+		newBentoCmd(),
+		newInitCmd(),
+		newPullCmd(),
+		newPushCmd(),
+		newRunCmd(),
+	)
 
-	return rootCmd.ExecuteContext(context.Background())
+	wrapArgsErrors(rootCmd)
+
+	err := rootCmd.ExecuteContext(context.Background())
+	var exitErr *ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		printError(rootCmd.ErrOrStderr(), err)
+	}
+	return err
+}
+
+// wrapArgsErrors makes the argument validation errors of the commands usage errors.
+func wrapArgsErrors(cmd *cobra.Command) {
+	if args := cmd.Args; args != nil {
+		cmd.Args = func(cmd *cobra.Command, a []string) error {
+			if err := args(cmd, a); err != nil {
+				return usageError{err}
+			}
+			return nil
+		}
+	}
+	for _, c := range cmd.Commands() {
+		wrapArgsErrors(c)
+	}
 }
@@ -0,0 +1,87 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/juancwu/konbini/cli/config"
+	"github.com/juancwu/konbini/cli/services"
+	"github.com/juancwu/konbini/common/api"
+
+	"github.com/spf13/cobra"
+)
+
+func newRunCmd() *cobra.Command {
+	var refs []string
+	var redact bool
+
+	cmd := &cobra.Command{
+		Use:   "run [--bento BENTO]... -- COMMAND [ARGS...]",
+		Short: "Run a command with the ingredients of bentos in its environment",
+		Long: `Run fetches the ingredients of the bentos and runs the command with them added to its environment,
+nothing is written to disk. When a variable is in several bentos the last --bento wins, and bentos win
+over the environment of konbi. Without --bento the bento of the project in .konbini.yaml is used, or
+else the default bento of the profile.
+
+Signals are forwarded to the command and konbi exits with its exit code. With --redact the values of
+the ingredients are replaced with [REDACTED] in the output of the command, values shorter than 4
+characters are left as is.`,
+		Example: `  konbi run --bento prod -- ./server
+  konbi run --bento shared --bento prod --redact -- npm test`,
+		Args: cobra.MinimumNArgs(1),
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if cmd.ArgsLenAtDash() != 0 {
+				return usageError{errors.New("Missing -- before the command, i.e. konbi run --bento prod -- ./server")}
+			}
+			_, err := services.Authenticate(cmd.Context())
+			return err
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(refs) == 0 {
+				project, err := services.FindProject(".")
+				switch {
+				case err == nil:
+					refs = []string{project.Bento}
+				case errors.Is(err, services.ErrNoProject) && config.CurrentProfile().Bento != "":
+					refs = []string{config.CurrentProfile().Bento}
+				case errors.Is(err, services.ErrNoProject):
+					return fmt.Errorf("No --bento given and %w", err)
+				default:
+					return err
+				}
+			}
+
+			ctx, cancel := bentoContext(cmd)
+			client := services.NewClient()
+			bentos := make([]*api.GetBentoResponse, len(refs))
+			for i, ref := range refs {
+				bento, err := services.RevealBento(ctx, client, ref)
+				if err != nil {
+					cancel()
+					return err
+				}
+				bentos[i] = bento
+			}
+			cancel()
+
+			code, err := services.RunWithBentos(cmd.Context(), args, services.MergeIngredients(bentos), services.RunOptions{
+				Redact: redact,
+				Stdin:  os.Stdin,
+				Stdout: os.Stdout,
+				Stderr: os.Stderr,
+			})
+			if err != nil {
+				return err
+			}
+			if code != 0 {
+				return &ExitError{Code: code}
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringArrayVar(&refs, "bento", nil, "id or name of a bento, can be repeated, later bentos take precedence")
+	cmd.Flags().BoolVar(&redact, "redact", false, "replace the values of the ingredients in the output of the command")
+	return cmd
+}
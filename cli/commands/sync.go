@@ -0,0 +1,236 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/juancwu/konbini/cli/services"
+
+	"github.com/spf13/cobra"
+)
+
+func newInitCmd() *cobra.Command {
+	var envFile string
+
+	cmd := &cobra.Command{
+		Use:   "init BENTO",
+		Short: "Bind the current directory to a bento",
+		Long: `Init writes a .konbini.yaml file that binds the current directory, and its subdirectories, to a bento.
+konbi pull and konbi push use it to sync the .env file of the project with the bento.`,
+		Example: `  konbi init prod
+  konbi init prod --env-file .env.production`,
+		Args: cobra.ExactArgs(1),
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			_, err := services.Authenticate(cmd.Context())
+			return err
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir, err := os.Getwd()
+			if err != nil {
+				return err
+			}
+			project := &services.Project{EnvFile: envFile, Dir: dir}
+			path, err := project.EnvFilePath()
+			if err != nil {
+				return usageError{err}
+			}
+
+			ctx, cancel := bentoContext(cmd)
+			defer cancel()
+
+			bento, err := services.ResolveBento(ctx, services.NewClient(), args[0])
+			if err != nil {
+				return err
+			}
+
+			project.Bento = bento.BentoID
+			if err := services.SaveProject(project); err != nil {
+				return err
+			}
+
+			out := map[string]string{"dir": dir, "bento_id": bento.BentoID, "env_file": path}
+			return printOutput(cmd, out, func(w io.Writer) {
+				fmt.Fprintf(w, "Bound %s to bento %s (%s). Add %s to .gitignore if it isn't yet.\n",
+					dir, bento.Name, bento.BentoID, filepath.Base(path))
+			})
+		},
+	}
+
+	cmd.Flags().StringVar(&envFile, "env-file", "", "path of the .env file relative to the directory (default .env)")
+	return cmd
+}
+
+func newPullCmd() *cobra.Command {
+	var dryRun, yes bool
+
+	cmd := &cobra.Command{
+		Use:   "pull",
+		Short: "Write the ingredients of the project bento to its .env file",
+		Long: `Pull replaces the .env file of the project with the ingredients of the bento in .konbini.yaml.
+The file is only readable by you. Pull asks for confirmation before it replaces or removes variables of the
+file, use --yes to skip it. Use --dry-run to see what would change without writing it.`,
+		Args: cobra.NoArgs,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			_, err := services.Authenticate(cmd.Context())
+			return err
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			project, err := services.FindProject(".")
+			if err != nil {
+				return err
+			}
+			path, err := project.EnvFilePath()
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := bentoContext(cmd)
+			defer cancel()
+
+			bento, diff, err := services.PullBento(ctx, services.NewClient(), project)
+			if err != nil {
+				return err
+			}
+
+			res := syncResult{BentoID: bento.BentoID, Revision: bento.Revision, EnvFile: path, DryRun: dryRun, Changes: syncChanges(diff)}
+			if dryRun {
+				return printOutput(cmd, res, func(w io.Writer) {
+					services.PrintEnvDiff(w, diff, ".env", "bento")
+					fmt.Fprintln(w, "Dry run, nothing was written.")
+				})
+			}
+
+			// local values that are not in the bento are lost once the file is replaced
+			printed := false
+			if modified, removed := services.PullOverwrites(diff); !yes && (modified > 0 || removed > 0) {
+				services.PrintEnvDiff(cmd.ErrOrStderr(), diff, ".env", "bento")
+				printed = true
+				ok, err := confirm(cmd, fmt.Sprintf("Replace %d and remove %d variables of %s?", modified, removed, path))
+				if err != nil {
+					return err
+				}
+				if !ok {
+					return errors.New("Aborted.")
+				}
+			}
+
+			if err := services.WriteEnvFile(path, bento.Ingredients); err != nil {
+				return err
+			}
+			return printOutput(cmd, res, func(w io.Writer) {
+				if !printed {
+					services.PrintEnvDiff(w, diff, ".env", "bento")
+				}
+				fmt.Fprintf(w, "Wrote revision %d of %s to %s.\n", bento.Revision, bento.Name, path)
+			})
+		},
+	}
+
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "show what would change without writing the file")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "replace local values without asking for confirmation")
+	return cmd
+}
+
+func newPushCmd() *cobra.Command {
+	var dryRun, prune, yes bool
+
+	cmd := &cobra.Command{
+		Use:   "push",
+		Short: "Upload the changes of the project .env file to its bento",
+		Long: `Push compares the .env file of the project with the bento in .konbini.yaml and, after confirmation,
+adds the new variables and replaces the modified ones. Ingredients that are not in the file are only
+removed with --prune. Values are never printed.`,
+		Args: cobra.NoArgs,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			_, err := services.Authenticate(cmd.Context())
+			return err
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			project, err := services.FindProject(".")
+			if err != nil {
+				return err
+			}
+			path, err := project.EnvFilePath()
+			if err != nil {
+				return err
+			}
+			vars, err := services.ReadEnvFile(path)
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := bentoContext(cmd)
+			defer cancel()
+
+			client := services.NewClient()
+			bento, err := services.RevealBento(ctx, client, project.Bento)
+			if err != nil {
+				return err
+			}
+			diff := services.DiffEnv(bento, vars)
+			change := services.PushChange(diff, vars, prune)
+
+			res := syncResult{BentoID: bento.BentoID, Revision: bento.Revision, EnvFile: path, DryRun: dryRun, Changes: syncChanges(diff)}
+			if dryRun || (len(change.Set) == 0 && len(change.Unset) == 0) {
+				return printOutput(cmd, res, func(w io.Writer) {
+					services.PrintEnvDiff(w, diff, "bento", ".env")
+					if len(change.Unset) == 0 && len(diff) > len(change.Set) {
+						fmt.Fprintln(w, "Ingredients only in the bento are kept, use --prune to remove them.")
+					}
+					if dryRun {
+						fmt.Fprintln(w, "Dry run, nothing was uploaded.")
+					}
+				})
+			}
+
+			if !yes {
+				services.PrintEnvDiff(cmd.ErrOrStderr(), diff, "bento", ".env")
+				ok, err := confirm(cmd, fmt.Sprintf("Upload %d and remove %d ingredients of %s?", len(change.Set), len(change.Unset), bento.Name))
+				if err != nil {
+					return err
+				}
+				if !ok {
+					return errors.New("Aborted.")
+				}
+			}
+
+			res.Revision, err = services.ApplyBentoChange(ctx, client, bento, change, services.PromptRebase(cmd.InOrStdin(), cmd.ErrOrStderr()))
+			if err != nil {
+				return err
+			}
+			return printOutput(cmd, res, func(w io.Writer) {
+				fmt.Fprintf(w, "Pushed %s to %s, now at revision %d.\n", path, bento.Name, res.Revision)
+			})
+		},
+	}
+
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "show what would change without uploading it")
+	cmd.Flags().BoolVar(&prune, "prune", false, "remove the ingredients that are not in the .env file")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "upload without asking for confirmation")
+	return cmd
+}
+
+// syncResult is the JSON output of pull and push.
+type syncResult struct {
+	BentoID  string       `json:"bento_id"`
+	Revision int64        `json:"revision"`
+	EnvFile  string       `json:"env_file"`
+	DryRun   bool         `json:"dry_run"`
+	Changes  []syncChange `json:"changes"`
+}
+
+type syncChange struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+}
+
+func syncChanges(diff []services.IngredientDiff) []syncChange {
+	changes := make([]syncChange, len(diff))
+	for i, d := range diff {
+		changes[i] = syncChange{Name: d.Name, Kind: d.Kind.String()}
+	}
+	return changes
+}
@@ -0,0 +1,50 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/juancwu/konbini/cli/services"
+	"github.com/juancwu/konbini/common/api"
+
+	"github.com/spf13/cobra"
+)
+
+func newWatchCmd() *cobra.Command {
+	opts := services.WatchOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "watch BENTO_ID",
+		Short: "Re-export a bento or run a hook every time it changes",
+		Long: `Watch streams the changes of a bento. The bento is exported right away and again after every change:
+the --env-file is rewritten and the --exec hook runs with the ingredients in its environment,
+along with KONBI_BENTO_ID and KONBI_BENTO_REVISION.`,
+		Example: `  konbi watch 4c1f... --env-file .env
+  konbi watch 4c1f... --exec "systemctl reload my-service"`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if opts.EnvFile == "" && opts.Hook == "" {
+				return fmt.Errorf("Nothing to do on change, set --env-file or --exec.")
+			}
+			if _, err := services.Authenticate(cmd.Context()); err != nil {
+				return err
+			}
+			opts.OnChange = func(change api.BentoChange) {
+				if outputFormat == outputTable {
+					fmt.Fprintf(cmd.ErrOrStderr(), "revision %d: %s %s\n", change.Revision, change.Action, strings.Join(change.Ingredients, ", "))
+					return
+				}
+				// changes are written to stdout as they come, one per line with -o json
+				if err := printOutput(cmd, change, nil); err != nil {
+					fmt.Fprintln(cmd.ErrOrStderr(), err)
+				}
+			}
+			return services.WatchBento(cmd.Context(), services.NewClient(), args[0], opts)
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.EnvFile, "env-file", "", "rewrite this .env file with the ingredients on change")
+	cmd.Flags().StringVar(&opts.Hook, "exec", "", "shell command to run on change")
+
+	return cmd
+}
@@ -1,21 +1,153 @@
 package config
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
 
-var backendUrl string
+	"gopkg.in/yaml.v3"
+)
 
-func Init() {
-	if backendUrl == "" {
-		backendUrl = "http://localhost:3000/api/v1"
+const (
+	// DefaultServer is the server of profiles that don't set one.
+	DefaultServer = "http://localhost:3000/api/v1"
+	// DefaultProfile is the profile used when none is selected.
+	DefaultProfile = "default"
+	// ProfileEnv selects the profile when the --profile flag is not given.
+	ProfileEnv = "KONBINI_PROFILE"
+)
+
+// Profile is a server and account to work with.
+type Profile struct {
+	// Server is the base url of the API, including the version prefix.
+	Server string `json:"server" yaml:"server,omitempty"`
+	// Account is the email used to login when --email is not given.
+	Account string `json:"account" yaml:"account,omitempty"`
+	// Output is the default output format of the commands.
+	Output string `json:"output" yaml:"output,omitempty"`
+	// Bento is the default bento of konbi run when there is no project.
+	Bento string `json:"bento" yaml:"bento,omitempty"`
+}
+
+// File is the config file of the CLI.
+type File struct {
+	// CurrentProfile is used when neither --profile nor KONBINI_PROFILE are set.
+	CurrentProfile string              `yaml:"current_profile,omitempty"`
+	Profiles       map[string]*Profile `yaml:"profiles,omitempty"`
+}
+
+// Path returns the path of the config file, konbini/config.yaml under the XDG config
+// directory ($XDG_CONFIG_HOME or ~/.config on Linux).
+func Path() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "konbini", "config.yaml"), nil
+}
+
+// ReadFile reads the config file. A missing file is an empty config.
+func ReadFile() (*File, error) {
+	path, err := Path()
+	if err != nil {
+		return nil, err
+	}
+	f := &File{}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(b, f); err != nil {
+		return nil, fmt.Errorf("Invalid config file %s: %w", path, err)
+	}
+	return f, nil
+}
+
+// Save writes the config file, creating its directory if needed.
+func (f *File) Save() error {
+	path, err := Path()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	b, err := yaml.Marshal(f)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0600)
+}
+
+// ProfileNames returns the names of the profiles in the file, sorted.
+func (f *File) ProfileNames() []string {
+	names := make([]string, 0, len(f.Profiles))
+	for name := range f.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+var (
+	profileName = DefaultProfile
+	profile     = Profile{Server: DefaultServer}
+)
+
+// Load selects the profile used by the CLI. The name is the --profile flag, when it is empty
+// KONBINI_PROFILE, the current profile of the config file and "default" are tried in order.
+// A named profile must exist in the config file, except for "default".
+func Load(name string) error {
+	f, err := ReadFile()
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		name = os.Getenv(ProfileEnv)
+	}
+	if name == "" {
+		name = f.CurrentProfile
+	}
+	if name == "" {
+		name = DefaultProfile
 	}
+
+	p, ok := f.Profiles[name]
+	if !ok && name != DefaultProfile {
+		return fmt.Errorf("Unknown profile %q, add it with konbi profile set %s --server URL", name, name)
+	}
+	profileName = name
+	profile = Profile{}
+	if p != nil {
+		profile = *p
+	}
+	if profile.Server == "" {
+		profile.Server = DefaultServer
+	}
+	return nil
+}
+
+// ProfileName returns the name of the selected profile.
+func ProfileName() string {
+	return profileName
+}
+
+// CurrentProfile returns the selected profile.
+func CurrentProfile() Profile {
+	return profile
 }
 
 func BackendUrl(path string) string {
 	if path == "" {
-		return backendUrl
+		return profile.Server
 	}
 
-	return fmt.Sprintf("%s%s", backendUrl, path)
+	return fmt.Sprintf("%s%s", profile.Server, path)
 }
 
 type Auth struct {
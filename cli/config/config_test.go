@@ -0,0 +1,53 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfiles(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv(ProfileEnv, "")
+	defer Load(DefaultProfile)
+
+	t.Run("defaults without a config file", func(t *testing.T) {
+		require.NoError(t, Load(""))
+		require.Equal(t, DefaultProfile, ProfileName())
+		require.Equal(t, DefaultServer+"/bento", BackendUrl("/bento"))
+	})
+
+	t.Run("selects the profile by flag, env and current profile", func(t *testing.T) {
+		f := &File{
+			CurrentProfile: "staging",
+			Profiles: map[string]*Profile{
+				"staging": {Server: "https://staging.example.com/api/v1", Account: "me@mail.com"},
+				"prod":    {Server: "https://example.com/api/v1", Output: "json", Bento: "app"},
+			},
+		}
+		require.NoError(t, f.Save())
+		path, err := Path()
+		require.NoError(t, err)
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+		require.Equal(t, "config.yaml", filepath.Base(path))
+
+		require.NoError(t, Load(""))
+		require.Equal(t, "staging", ProfileName())
+		require.Equal(t, "me@mail.com", CurrentProfile().Account)
+
+		t.Setenv(ProfileEnv, "prod")
+		require.NoError(t, Load(""))
+		require.Equal(t, "prod", ProfileName())
+		require.Equal(t, "https://example.com/api/v1/bentos", BackendUrl("/bentos"))
+		require.Equal(t, "json", CurrentProfile().Output)
+
+		require.NoError(t, Load("default"))
+		require.Equal(t, DefaultServer, BackendUrl(""))
+
+		require.EqualError(t, Load("dev"), `Unknown profile "dev", add it with konbi profile set dev --server URL`)
+	})
+}
@@ -0,0 +1,254 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/juancwu/konbini/common/api"
+)
+
+var (
+	ErrBentoChangeAborted error = errors.New("Bento change aborted")
+)
+
+// Kinds of differences between two revisions of a bento.
+const (
+	IngredientAdded DiffKind = iota
+	IngredientRemoved
+	IngredientModified
+)
+
+type DiffKind int
+
+func (k DiffKind) String() string {
+	switch k {
+	case IngredientAdded:
+		return "added"
+	case IngredientRemoved:
+		return "removed"
+	case IngredientModified:
+		return "modified"
+	}
+	return "unknown"
+}
+
+// BentoChange is a change to the ingredients of a bento by name.
+type BentoChange struct {
+	// Set has the values of the ingredients to add.
+	Set map[string]string
+	// Replace overwrites the value of ingredients in Set that already exist.
+	Replace bool
+	// Unset has the names of the ingredients to remove.
+	Unset []string
+}
+
+// IngredientDiff is the difference of one ingredient between two revisions of a bento.
+// Values are left out so that a diff can be printed without leaking secrets.
+type IngredientDiff struct {
+	Name string
+	Kind DiffKind
+	// Overlaps is true when the local change also touches the ingredient.
+	Overlaps bool
+}
+
+// BentoConflict happens when a bento changes between reading it and applying a change to it.
+type BentoConflict struct {
+	Base   *api.GetBentoResponse
+	Latest *api.GetBentoResponse
+	Change BentoChange
+	// Diff lists what changed from Base to Latest.
+	Diff []IngredientDiff
+}
+
+// ConflictResolver decides whether a change is applied again on top of the latest revision of the bento.
+type ConflictResolver func(conflict BentoConflict) (bool, error)
+
+// ApplyBentoChange applies the change to the bento at the revision of base. When someone else
+// changed the bento in the meantime, resolve is called with what changed and the change is rebased
+// on the latest revision if it returns true. It returns the revision of the bento after the change.
+func ApplyBentoChange(ctx context.Context, client *api.Client, base *api.GetBentoResponse, change BentoChange, resolve ConflictResolver) (int64, error) {
+	revision := base.Revision
+
+	steps := []func(etag string) (int64, error){}
+	if len(change.Set) > 0 {
+		steps = append(steps, func(etag string) (int64, error) {
+			req := api.AddIngredientsToBentoRequest{BentoID: base.BentoID}
+			for _, name := range sortedKeys(change.Set) {
+				req.Ingredients = append(req.Ingredients, api.Ingredient{Name: name, Value: change.Set[name]})
+			}
+			res, err := client.AddIngredientsToBento(api.WithIfMatch(ctx, etag), req, change.Replace)
+			if err != nil {
+				return 0, err
+			}
+			return res.Revision, nil
+		})
+	}
+	if len(change.Unset) > 0 {
+		steps = append(steps, func(etag string) (int64, error) {
+			ids, err := ingredientIDs(base, change.Unset)
+			if err != nil {
+				return 0, err
+			}
+			res, err := client.RemoveIngredientsFromBento(api.WithIfMatch(ctx, etag), api.RemoveIngredientsFromBentoRequest{
+				BentoID:     base.BentoID,
+				Ingredients: ids,
+			})
+			if err != nil {
+				return 0, err
+			}
+			return res.Revision, nil
+		})
+	}
+
+	for _, step := range steps {
+		for {
+			next, err := step(api.BentoETag(revision))
+			if err == nil {
+				revision = next
+				break
+			}
+			if !api.IsErrorCode(err, api.ErrorCodeBentoChanged) {
+				return revision, err
+			}
+
+			// the latest revision is read the same way as base so that they can be diffed
+			var latest *api.GetBentoResponse
+			if base.Masked {
+				latest, err = client.GetBento(ctx, base.BentoID)
+			} else {
+				latest, err = client.RevealIngredients(ctx, base.BentoID, nil)
+			}
+			if err != nil {
+				return revision, err
+			}
+			rebase, err := resolve(BentoConflict{
+				Base:   base,
+				Latest: latest,
+				Change: change,
+				Diff:   DiffBentos(base, latest, change),
+			})
+			if err != nil {
+				return revision, err
+			}
+			if !rebase {
+				return revision, ErrBentoChangeAborted
+			}
+			base = latest
+			revision = latest.Revision
+		}
+	}
+
+	return revision, nil
+}
+
+// DiffBentos lists the ingredients that differ between two revisions of a bento sorted by name.
+// Modified values are only found when neither revision is masked.
+func DiffBentos(base *api.GetBentoResponse, latest *api.GetBentoResponse, change BentoChange) []IngredientDiff {
+	touched := map[string]bool{}
+	for name := range change.Set {
+		touched[name] = true
+	}
+	for _, name := range change.Unset {
+		touched[name] = true
+	}
+
+	before := ingredientValues(base)
+	after := ingredientValues(latest)
+
+	diff := []IngredientDiff{}
+	for name, value := range after {
+		old, ok := before[name]
+		if !ok {
+			diff = append(diff, IngredientDiff{Name: name, Kind: IngredientAdded, Overlaps: touched[name]})
+		} else if old != value && !base.Masked && !latest.Masked {
+			diff = append(diff, IngredientDiff{Name: name, Kind: IngredientModified, Overlaps: touched[name]})
+		}
+	}
+	for name := range before {
+		if _, ok := after[name]; !ok {
+			diff = append(diff, IngredientDiff{Name: name, Kind: IngredientRemoved, Overlaps: touched[name]})
+		}
+	}
+	sort.Slice(diff, func(i, j int) bool {
+		return diff[i].Name < diff[j].Name
+	})
+	return diff
+}
+
+// PrintBentoConflict writes the diff of a conflict, ingredients also touched by the change are flagged.
+func PrintBentoConflict(w io.Writer, conflict BentoConflict) {
+	fmt.Fprintf(w, "Bento %q changed from revision %d to %d since it was read:\n", conflict.Latest.Name, conflict.Base.Revision, conflict.Latest.Revision)
+	if len(conflict.Diff) == 0 {
+		fmt.Fprintln(w, "  no ingredient changed")
+	}
+	for _, d := range conflict.Diff {
+		sign := "~"
+		switch d.Kind {
+		case IngredientAdded:
+			sign = "+"
+		case IngredientRemoved:
+			sign = "-"
+		}
+		line := fmt.Sprintf("  %s %s (%s)", sign, d.Name, d.Kind)
+		if d.Overlaps {
+			line += "  <- also in your change"
+		}
+		fmt.Fprintln(w, line)
+	}
+}
+
+// PromptRebase prints the conflict and asks the user whether to rebase the change on the latest revision.
+func PromptRebase(in io.Reader, out io.Writer) ConflictResolver {
+	reader := bufio.NewReader(in)
+	return func(conflict BentoConflict) (bool, error) {
+		PrintBentoConflict(out, conflict)
+		fmt.Fprint(out, "Apply your change on top of the latest revision? [y/N] ")
+		answer, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return false, err
+		}
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		return answer == "y" || answer == "yes", nil
+	}
+}
+
+// ingredientIDs gets the ids of the ingredients with the given names.
+func ingredientIDs(bento *api.GetBentoResponse, names []string) ([]string, error) {
+	ids := make([]string, 0, len(names))
+	for _, name := range names {
+		found := false
+		for _, ing := range bento.Ingredients {
+			if ing.Name == name {
+				ids = append(ids, ing.ID)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("Ingredient %q not found in bento %q", name, bento.Name)
+		}
+	}
+	return ids, nil
+}
+
+func ingredientValues(bento *api.GetBentoResponse) map[string]string {
+	values := make(map[string]string, len(bento.Ingredients))
+	for _, ing := range bento.Ingredients {
+		values[ing.Name] = ing.Value
+	}
+	return values
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
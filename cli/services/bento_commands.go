@@ -0,0 +1,127 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/juancwu/konbini/common/api"
+
+	"github.com/google/uuid"
+)
+
+// ResolveBento gets a bento by id or by name, the values of its ingredients are masked. Names are
+// looked up in the bentos the user has access to and must match a single bento.
+func ResolveBento(ctx context.Context, client *api.Client, ref string) (*api.GetBentoResponse, error) {
+	id, err := resolveBentoID(ctx, client, ref)
+	if err != nil {
+		return nil, err
+	}
+	return client.GetBento(ctx, id)
+}
+
+// RevealBento gets a bento by id or by name like ResolveBento, with the values of all its
+// ingredients. The server records the reveal in the audit log of the bento.
+func RevealBento(ctx context.Context, client *api.Client, ref string) (*api.GetBentoResponse, error) {
+	id, err := resolveBentoID(ctx, client, ref)
+	if err != nil {
+		return nil, err
+	}
+	return client.RevealIngredients(ctx, id, nil)
+}
+
+func resolveBentoID(ctx context.Context, client *api.Client, ref string) (string, error) {
+	if _, err := uuid.Parse(ref); err == nil {
+		return ref, nil
+	}
+
+	bentos, err := client.ListBentos(ctx)
+	if err != nil {
+		return "", err
+	}
+	var ids []string
+	for _, b := range bentos {
+		if b.BentoName == ref {
+			ids = append(ids, b.BentoID)
+		}
+	}
+	switch len(ids) {
+	case 0:
+		return "", &api.ErrorResponse{
+			Code:      http.StatusNotFound,
+			ErrorCode: api.ErrorCodeBentoNotFound,
+			Message:   fmt.Sprintf("No bento named %q", ref),
+		}
+	case 1:
+		return ids[0], nil
+	}
+	return "", fmt.Errorf("There are %d bentos named %q, use the id instead: %s", len(ids), ref, strings.Join(ids, ", "))
+}
+
+// IngredientSources are the values of ingredients given to a command.
+type IngredientSources struct {
+	// Args are KEY=VALUE pairs.
+	Args []string
+	// Files are KEY=PATH pairs, the value is the content of the file.
+	Files []string
+	// Stdin is the name of an ingredient whose value is read from stdin.
+	Stdin string
+}
+
+// ReadIngredients collects the values of the sources by name. A name can only be given once.
+// Values read from files and stdin are kept as is, except for a single trailing newline.
+func ReadIngredients(sources IngredientSources, stdin io.Reader) (map[string]string, error) {
+	values := map[string]string{}
+	set := func(name string, value string) error {
+		if name == "" {
+			// the value is left out of the error since it is likely a secret
+			return fmt.Errorf("Missing ingredient name, expecting KEY=VALUE")
+		}
+		if _, ok := values[name]; ok {
+			return fmt.Errorf("Ingredient %q is given more than once", name)
+		}
+		values[name] = value
+		return nil
+	}
+
+	for i, arg := range sources.Args {
+		name, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			return nil, fmt.Errorf("Invalid ingredient argument %d, expecting KEY=VALUE", i+1)
+		}
+		if err := set(name, value); err != nil {
+			return nil, err
+		}
+	}
+	for _, arg := range sources.Files {
+		name, path, ok := strings.Cut(arg, "=")
+		if !ok {
+			return nil, fmt.Errorf("Invalid file %q, expecting KEY=PATH", arg)
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := set(name, trimNewline(string(b))); err != nil {
+			return nil, err
+		}
+	}
+	if sources.Stdin != "" {
+		b, err := io.ReadAll(stdin)
+		if err != nil {
+			return nil, err
+		}
+		if err := set(sources.Stdin, trimNewline(string(b))); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+func trimNewline(s string) string {
+	s = strings.TrimSuffix(s, "\n")
+	return strings.TrimSuffix(s, "\r")
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/juancwu/konbini/common/api"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadIngredients(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tls.key")
+	require.NoError(t, os.WriteFile(path, []byte("-----BEGIN KEY-----\nabc\n-----END KEY-----\n"), 0600))
+
+	values, err := ReadIngredients(IngredientSources{
+		Args:  []string{"A=1", "B=x=y", "EMPTY="},
+		Files: []string{"TLS_KEY=" + path},
+		Stdin: "TOKEN",
+	}, strings.NewReader("line 1\nline 2\n"))
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"A":       "1",
+		"B":       "x=y",
+		"EMPTY":   "",
+		"TLS_KEY": "-----BEGIN KEY-----\nabc\n-----END KEY-----",
+		"TOKEN":   "line 1\nline 2",
+	}, values)
+
+	_, err = ReadIngredients(IngredientSources{Args: []string{"A=1"}, Stdin: "A"}, strings.NewReader("2"))
+	require.EqualError(t, err, `Ingredient "A" is given more than once`)
+
+	_, err = ReadIngredients(IngredientSources{Args: []string{"A=1", "secret"}}, nil)
+	require.EqualError(t, err, "Invalid ingredient argument 2, expecting KEY=VALUE")
+
+	_, err = ReadIngredients(IngredientSources{Args: []string{"=secret"}}, nil)
+	require.Error(t, err)
+	require.NotContains(t, err.Error(), "secret")
+}
+
+func TestResolveBento(t *testing.T) {
+	const id = "7f0c3a4e-1f0c-4c52-9f3b-3f6c3b1f6a10"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case api.UriBentos:
+			json.NewEncoder(w).Encode([]api.ListBentosResponse{
+				{BentoID: id, BentoName: "prod"},
+				{BentoID: "b2", BentoName: "dup"},
+				{BentoID: "b3", BentoName: "dup"},
+			})
+		case api.UriBento:
+			json.NewEncoder(w).Encode(api.GetBentoResponse{BentoID: r.URL.Query().Get("bento_id"), Name: "prod", Masked: true})
+		case "/bento/" + id + "/reveals":
+			json.NewEncoder(w).Encode(api.GetBentoResponse{
+				BentoID:     id,
+				Name:        "prod",
+				Ingredients: []api.BentoIngredient{{ID: "i1", Name: "API_KEY", Value: "secret"}},
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	client := api.NewClient(srv.URL)
+
+	bento, err := ResolveBento(context.Background(), client, "prod")
+	require.NoError(t, err)
+	require.Equal(t, id, bento.BentoID)
+
+	require.True(t, bento.Masked)
+
+	bento, err = ResolveBento(context.Background(), client, id)
+	require.NoError(t, err)
+	require.Equal(t, id, bento.BentoID)
+
+	// revealing a bento by name gets its values from the reveal endpoint
+	bento, err = RevealBento(context.Background(), client, "prod")
+	require.NoError(t, err)
+	require.False(t, bento.Masked)
+	require.Equal(t, "secret", bento.Ingredients[0].Value)
+
+	_, err = ResolveBento(context.Background(), client, "staging")
+	require.True(t, api.IsErrorCode(err, api.ErrorCodeBentoNotFound))
+
+	_, err = ResolveBento(context.Background(), client, "dup")
+	require.EqualError(t, err, `There are 2 bentos named "dup", use the id instead: b2, b3`)
+}
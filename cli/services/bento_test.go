@@ -0,0 +1,209 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/juancwu/konbini/common/api"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeBentoServer keeps one bento in memory and honors If-Match like the bento handlers.
+type fakeBentoServer struct {
+	mu    sync.Mutex
+	bento api.GetBentoResponse
+	// beforeChange runs once before the next change is applied, i.e. to simulate a concurrent edit.
+	beforeChange func(b *api.GetBentoResponse)
+	ifMatch      []string
+	reveals      int
+}
+
+func (s *fakeBentoServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.Method == http.MethodGet {
+		masked := s.bento
+		masked.Masked = true
+		masked.Ingredients = make([]api.BentoIngredient, len(s.bento.Ingredients))
+		for i, ing := range s.bento.Ingredients {
+			masked.Ingredients[i] = api.BentoIngredient{ID: ing.ID, Name: ing.Name}
+		}
+		w.Header().Set(api.HeaderETag, api.BentoETag(s.bento.Revision))
+		json.NewEncoder(w).Encode(masked)
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/reveals") {
+		s.reveals++
+		w.Header().Set(api.HeaderETag, api.BentoETag(s.bento.Revision))
+		json.NewEncoder(w).Encode(s.bento)
+		return
+	}
+
+	if s.beforeChange != nil {
+		s.beforeChange(&s.bento)
+		s.beforeChange = nil
+	}
+	s.ifMatch = append(s.ifMatch, r.Header.Get(api.HeaderIfMatch))
+	if revision, err := api.ParseBentoETag(r.Header.Get(api.HeaderIfMatch)); err == nil && revision != s.bento.Revision {
+		w.WriteHeader(http.StatusPreconditionFailed)
+		json.NewEncoder(w).Encode(api.ErrorResponse{Code: http.StatusPreconditionFailed, ErrorCode: api.ErrorCodeBentoChanged, Message: "changed"})
+		return
+	}
+
+	s.bento.Revision++
+	switch r.Method {
+	case http.MethodPost:
+		var body api.AddIngredientsToBentoRequest
+		json.NewDecoder(r.Body).Decode(&body)
+		for _, ing := range body.Ingredients {
+			s.bento.Ingredients = append(s.bento.Ingredients, api.BentoIngredient{ID: "id-" + ing.Name, Name: ing.Name, Value: ing.Value})
+		}
+		json.NewEncoder(w).Encode(api.AddIngredientsToBentoResponse{Revision: s.bento.Revision})
+	case http.MethodDelete:
+		var body api.RemoveIngredientsFromBentoRequest
+		json.NewDecoder(r.Body).Decode(&body)
+		kept := []api.BentoIngredient{}
+		for _, ing := range s.bento.Ingredients {
+			removed := false
+			for _, id := range body.Ingredients {
+				removed = removed || ing.ID == id
+			}
+			if !removed {
+				kept = append(kept, ing)
+			}
+		}
+		s.bento.Ingredients = kept
+		json.NewEncoder(w).Encode(api.RemoveIngredientsFromBentoResponse{Deleted: body.Ingredients, Revision: s.bento.Revision})
+	}
+}
+
+func newFakeBentoServer(t *testing.T) (*fakeBentoServer, *api.Client) {
+	fake := &fakeBentoServer{bento: api.GetBentoResponse{
+		BentoID:  "b1",
+		Name:     "prod",
+		Revision: 1,
+		Ingredients: []api.BentoIngredient{
+			{ID: "id-DB_URL", Name: "DB_URL", Value: "postgres://old"},
+			{ID: "id-API_KEY", Name: "API_KEY", Value: "key"},
+		},
+	}}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	return fake, api.NewClient(srv.URL)
+}
+
+func TestApplyBentoChange(t *testing.T) {
+	t.Run("sends the revision it was based on", func(t *testing.T) {
+		fake, client := newFakeBentoServer(t)
+		base, err := client.GetBento(context.Background(), "b1")
+		require.NoError(t, err)
+
+		revision, err := ApplyBentoChange(context.Background(), client, base, BentoChange{
+			Set:   map[string]string{"NEW": "value"},
+			Unset: []string{"API_KEY"},
+		}, func(BentoConflict) (bool, error) {
+			t.Fatal("unexpected conflict")
+			return false, nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, int64(3), revision)
+		require.Equal(t, []string{`"1"`, `"2"`}, fake.ifMatch)
+	})
+
+	t.Run("rebases on the latest revision when the resolver agrees", func(t *testing.T) {
+		fake, client := newFakeBentoServer(t)
+		base, err := client.RevealIngredients(context.Background(), "b1", nil)
+		require.NoError(t, err)
+
+		fake.beforeChange = func(b *api.GetBentoResponse) {
+			b.Revision++
+			b.Ingredients[0].Value = "postgres://new"
+			b.Ingredients = append(b.Ingredients, api.BentoIngredient{ID: "id-OTHER", Name: "OTHER", Value: "x"})
+		}
+
+		var conflict BentoConflict
+		revision, err := ApplyBentoChange(context.Background(), client, base, BentoChange{
+			Set:     map[string]string{"DB_URL": "postgres://mine"},
+			Replace: true,
+		}, func(c BentoConflict) (bool, error) {
+			conflict = c
+			return true, nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, int64(3), revision)
+		require.Equal(t, []string{`"1"`, `"2"`}, fake.ifMatch)
+		require.Equal(t, int64(2), conflict.Latest.Revision)
+		require.Equal(t, []IngredientDiff{
+			{Name: "DB_URL", Kind: IngredientModified, Overlaps: true},
+			{Name: "OTHER", Kind: IngredientAdded},
+		}, conflict.Diff)
+		require.Equal(t, 2, fake.reveals)
+	})
+
+	t.Run("does not reveal values to diff a masked bento", func(t *testing.T) {
+		fake, client := newFakeBentoServer(t)
+		base, err := client.GetBento(context.Background(), "b1")
+		require.NoError(t, err)
+		require.True(t, base.Masked)
+
+		fake.beforeChange = func(b *api.GetBentoResponse) {
+			b.Revision++
+			b.Ingredients[0].Value = "postgres://new"
+			b.Ingredients = append(b.Ingredients, api.BentoIngredient{ID: "id-OTHER", Name: "OTHER", Value: "x"})
+		}
+
+		var conflict BentoConflict
+		_, err = ApplyBentoChange(context.Background(), client, base, BentoChange{
+			Set:     map[string]string{"DB_URL": "postgres://mine"},
+			Replace: true,
+		}, func(c BentoConflict) (bool, error) {
+			conflict = c
+			return false, nil
+		})
+		require.ErrorIs(t, err, ErrBentoChangeAborted)
+		require.True(t, conflict.Latest.Masked)
+		require.Equal(t, []IngredientDiff{
+			{Name: "OTHER", Kind: IngredientAdded},
+		}, conflict.Diff)
+		require.Zero(t, fake.reveals)
+	})
+
+	t.Run("aborts when the resolver declines", func(t *testing.T) {
+		fake, client := newFakeBentoServer(t)
+		base, err := client.GetBento(context.Background(), "b1")
+		require.NoError(t, err)
+		fake.beforeChange = func(b *api.GetBentoResponse) { b.Revision++ }
+
+		_, err = ApplyBentoChange(context.Background(), client, base, BentoChange{
+			Unset: []string{"API_KEY"},
+		}, PromptRebase(strings.NewReader("n\n"), &bytes.Buffer{}))
+		require.ErrorIs(t, err, ErrBentoChangeAborted)
+		require.Len(t, fake.bento.Ingredients, 2)
+	})
+}
+
+func TestPromptRebaseDoesNotPrintValues(t *testing.T) {
+	base := &api.GetBentoResponse{Name: "prod", Revision: 1, Ingredients: []api.BentoIngredient{{Name: "TOKEN", Value: "old-secret"}}}
+	latest := &api.GetBentoResponse{Name: "prod", Revision: 2, Ingredients: []api.BentoIngredient{{Name: "TOKEN", Value: "new-secret"}}}
+	change := BentoChange{Set: map[string]string{"TOKEN": "my-secret"}}
+
+	var out bytes.Buffer
+	rebase, err := PromptRebase(strings.NewReader("y\n"), &out)(BentoConflict{
+		Base:   base,
+		Latest: latest,
+		Change: change,
+		Diff:   DiffBentos(base, latest, change),
+	})
+	require.NoError(t, err)
+	require.True(t, rebase)
+	require.Contains(t, out.String(), "~ TOKEN (modified)  <- also in your change")
+	require.NotContains(t, out.String(), "secret")
+}
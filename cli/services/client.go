@@ -0,0 +1,19 @@
+package services
+
+import (
+	"time"
+
+	"github.com/juancwu/konbini/cli/config"
+	"github.com/juancwu/konbini/cli/telemetry"
+	"github.com/juancwu/konbini/common/api"
+)
+
+// NewClient creates an api client for the configured backend. The token of the
+// signed in user is sent with every request when there is one.
+func NewClient() *api.Client {
+	opts := []api.ClientOption{api.WithHTTPClient(telemetry.NewHTTPClient(time.Second * 30))}
+	if auth := config.GetAuth(); auth != nil {
+		opts = append(opts, api.WithToken(auth.Token))
+	}
+	return api.NewClient(config.BackendUrl(""), opts...)
+}
@@ -0,0 +1,84 @@
+package services
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/atotto/clipboard"
+)
+
+const (
+	// ClipboardTimeoutEnv sets how long a copied value stays in the clipboard, i.e. "45s".
+	ClipboardTimeoutEnv = "KONBINI_CLIPBOARD_TIMEOUT"
+	// DefaultClipboardTimeout is used when ClipboardTimeoutEnv is not set or is not a valid duration.
+	DefaultClipboardTimeout = time.Second * 30
+)
+
+// ClipboardTimeout returns how long a copied value stays in the clipboard before it is cleared.
+func ClipboardTimeout() time.Duration {
+	timeout, err := time.ParseDuration(os.Getenv(ClipboardTimeoutEnv))
+	if err != nil || timeout <= 0 {
+		return DefaultClipboardTimeout
+	}
+	return timeout
+}
+
+// Clipboard copies values and clears them later, without wiping what the user copied in between.
+type Clipboard struct {
+	read  func() (string, error)
+	write func(string) error
+
+	mu     sync.Mutex
+	copied string
+}
+
+// NewClipboard creates a clipboard that reads and writes with the given functions.
+func NewClipboard(read func() (string, error), write func(string) error) *Clipboard {
+	return &Clipboard{read: read, write: write}
+}
+
+// SystemClipboard creates a clipboard of the OS. Linux needs xclip, xsel or wl-clipboard.
+func SystemClipboard() *Clipboard {
+	return NewClipboard(clipboard.ReadAll, clipboard.WriteAll)
+}
+
+// Copy writes value to the clipboard.
+func (c *Clipboard) Copy(value string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.write(value); err != nil {
+		return err
+	}
+	c.copied = value
+	return nil
+}
+
+// Clear empties the clipboard when value is the last value copied and it is still in the
+// clipboard. It reports whether the clipboard was cleared.
+func (c *Clipboard) Clear(value string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.copied == "" || c.copied != value {
+		return false, nil
+	}
+	c.copied = ""
+	current, err := c.read()
+	if err != nil {
+		return false, err
+	}
+	if current != value {
+		return false, nil
+	}
+	return true, c.write("")
+}
+
+// Close clears the last copied value, it is called before exiting so that no value outlives
+// the program.
+func (c *Clipboard) Close() error {
+	c.mu.Lock()
+	value := c.copied
+	c.mu.Unlock()
+	_, err := c.Clear(value)
+	return err
+}
@@ -0,0 +1,68 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClipboard(t *testing.T) {
+	content := ""
+	writes := 0
+	clipboard := NewClipboard(
+		func() (string, error) { return content, nil },
+		func(value string) error {
+			content = value
+			writes++
+			return nil
+		},
+	)
+
+	t.Run("clears the copied value", func(t *testing.T) {
+		require.NoError(t, clipboard.Copy("secret"))
+		require.Equal(t, "secret", content)
+		cleared, err := clipboard.Clear("secret")
+		require.NoError(t, err)
+		require.True(t, cleared)
+		require.Equal(t, "", content)
+	})
+
+	t.Run("keeps what was copied afterwards", func(t *testing.T) {
+		require.NoError(t, clipboard.Copy("first"))
+		require.NoError(t, clipboard.Copy("second"))
+		// the timer of the first value must not clear the second one
+		cleared, err := clipboard.Clear("first")
+		require.NoError(t, err)
+		require.False(t, cleared)
+		require.Equal(t, "second", content)
+
+		// the user copied something else
+		content = "not a secret"
+		cleared, err = clipboard.Clear("second")
+		require.NoError(t, err)
+		require.False(t, cleared)
+		require.Equal(t, "not a secret", content)
+	})
+
+	t.Run("clears the last value on close", func(t *testing.T) {
+		require.NoError(t, clipboard.Copy("secret"))
+		require.NoError(t, clipboard.Close())
+		require.Equal(t, "", content)
+
+		before := writes
+		require.NoError(t, clipboard.Close())
+		require.Equal(t, before, writes)
+	})
+}
+
+func TestClipboardTimeout(t *testing.T) {
+	t.Setenv(ClipboardTimeoutEnv, "")
+	require.Equal(t, DefaultClipboardTimeout, ClipboardTimeout())
+
+	t.Setenv(ClipboardTimeoutEnv, "45s")
+	require.Equal(t, time.Second*45, ClipboardTimeout())
+
+	t.Setenv(ClipboardTimeoutEnv, "soon")
+	require.Equal(t, DefaultClipboardTimeout, ClipboardTimeout())
+}
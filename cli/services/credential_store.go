@@ -0,0 +1,439 @@
+package services
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/juancwu/konbini/cli/config"
+
+	keyring "github.com/zalando/go-keyring"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/term"
+)
+
+const (
+	// CredentialStoreEnv forces a credential store, "keyring" or "file".
+	CredentialStoreEnv = "KONBINI_CREDENTIAL_STORE"
+	// CredentialPassphraseEnv is the passphrase of the encrypted credentials file. When it is
+	// not set the passphrase is prompted for on the terminal.
+	CredentialPassphraseEnv = "KONBINI_CREDENTIALS_PASSPHRASE"
+
+	CREDENTIAL_STORE_KEYRING = "keyring"
+	CREDENTIAL_STORE_FILE    = "file"
+)
+
+var (
+	ErrCredentialNotFound error = errors.New("Credential not found")
+	ErrWrongPassphrase    error = errors.New("Wrong passphrase for the credentials file")
+	ErrPassphraseRequired error = fmt.Errorf("The credentials file needs a passphrase, set %s or run konbi in a terminal.", CredentialPassphraseEnv)
+	ErrPassphraseMismatch error = errors.New("The passphrases don't match")
+)
+
+// CredentialStore keeps the tokens of the CLI by key.
+type CredentialStore interface {
+	// Name is the kind of store, one of the CREDENTIAL_STORE_* constants.
+	Name() string
+	// Location describes where the credentials are kept.
+	Location() string
+	// Get returns ErrCredentialNotFound when there is no credential for the key.
+	Get(key string) (string, error)
+	Set(key string, value string) error
+	// Delete does nothing when there is no credential for the key.
+	Delete(key string) error
+}
+
+// KeyringCredentialStore keeps credentials in the OS keyring: the Keychain on macOS, the
+// Credential Manager on Windows and the Secret Service on Linux.
+type KeyringCredentialStore struct {
+	service string
+}
+
+// NewKeyringCredentialStore creates a store of the entries of a keyring service.
+func NewKeyringCredentialStore(service string) *KeyringCredentialStore {
+	return &KeyringCredentialStore{service: service}
+}
+
+func (s *KeyringCredentialStore) Name() string {
+	return CREDENTIAL_STORE_KEYRING
+}
+
+func (s *KeyringCredentialStore) Location() string {
+	return "OS keyring, service " + s.service
+}
+
+func (s *KeyringCredentialStore) Get(key string) (string, error) {
+	value, err := keyring.Get(s.service, key)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return "", ErrCredentialNotFound
+	}
+	return value, err
+}
+
+func (s *KeyringCredentialStore) Set(key string, value string) error {
+	return keyring.Set(s.service, key, value)
+}
+
+func (s *KeyringCredentialStore) Delete(key string) error {
+	err := keyring.Delete(s.service, key)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// Argon2id parameters of new credentials files, the second recommended option of RFC 9106.
+const (
+	argon2Time    = 3
+	argon2Memory  = 64 * 1024
+	argon2Threads = 4
+	argon2KeyLen  = 32
+)
+
+// credentialsFile is the content of an encrypted credentials file. The credentials are a JSON
+// object sealed with AES-256-GCM, the key is derived from the passphrase with Argon2id.
+type credentialsFile struct {
+	Version int    `json:"version"`
+	KDF     string `json:"kdf"`
+	Salt    []byte `json:"salt"`
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"`
+	Threads uint8  `json:"threads"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+// FileCredentialStore keeps credentials in a file encrypted with a passphrase. It is used
+// where there is no OS keyring, like headless CI runners and containers.
+type FileCredentialStore struct {
+	path       string
+	passphrase func(create bool) (string, error)
+
+	mu     sync.Mutex
+	cached string
+}
+
+// NewFileCredentialStore creates a store of the file at path. passphrase is called once,
+// the first time the file is decrypted or written. create is true when the file doesn't exist
+// yet and the passphrase is chosen, not checked.
+func NewFileCredentialStore(path string, passphrase func(create bool) (string, error)) *FileCredentialStore {
+	return &FileCredentialStore{path: path, passphrase: passphrase}
+}
+
+func (s *FileCredentialStore) Name() string {
+	return CREDENTIAL_STORE_FILE
+}
+
+func (s *FileCredentialStore) Location() string {
+	return s.path
+}
+
+func (s *FileCredentialStore) Get(key string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	values, err := s.read()
+	if err != nil {
+		return "", err
+	}
+	value, ok := values[key]
+	if !ok {
+		return "", ErrCredentialNotFound
+	}
+	return value, nil
+}
+
+func (s *FileCredentialStore) Set(key string, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	values, err := s.read()
+	if err != nil {
+		return err
+	}
+	values[key] = value
+	return s.write(values)
+}
+
+func (s *FileCredentialStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	values, err := s.read()
+	if err != nil {
+		return err
+	}
+	if _, ok := values[key]; !ok {
+		return nil
+	}
+	delete(values, key)
+	return s.write(values)
+}
+
+// Unlock gets the passphrase now instead of on the first read or write, and checks it when the
+// file exists. The TUI unlocks the store before it takes over the terminal.
+func (s *FileCredentialStore) Unlock() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := os.Stat(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		_, err = s.getPassphrase(true)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := s.read(); err != nil {
+		// a wrong passphrase can be entered again
+		s.cached = ""
+		return err
+	}
+	return nil
+}
+
+// read decrypts the credentials. A missing file has no credentials and needs no passphrase.
+func (s *FileCredentialStore) read() (map[string]string, error) {
+	b, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var f credentialsFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("Invalid credentials file %s: %w", s.path, err)
+	}
+	// bound the cost of the key derivation so that a tampered file can't exhaust the memory
+	if f.Version != 1 || f.KDF != "argon2id" || f.Time == 0 || f.Time > 16 || f.Memory > 1024*1024 || f.Threads == 0 || len(f.Salt) < 16 {
+		return nil, fmt.Errorf("Unsupported credentials file %s", s.path)
+	}
+	passphrase, err := s.getPassphrase(false)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newCredentialsCipher(argon2.IDKey([]byte(passphrase), f.Salt, f.Time, f.Memory, f.Threads, argon2KeyLen))
+	if err != nil {
+		return nil, err
+	}
+	// Open panics on a nonce of another size
+	if len(f.Nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("Unsupported credentials file %s", s.path)
+	}
+	plain, err := gcm.Open(nil, f.Nonce, f.Data, nil)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	values := map[string]string{}
+	if err := json.Unmarshal(plain, &values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// write encrypts the credentials with a new salt and nonce and replaces the file in one step.
+func (s *FileCredentialStore) write(values map[string]string) error {
+	_, err := os.Stat(s.path)
+	passphrase, err := s.getPassphrase(errors.Is(err, os.ErrNotExist))
+	if err != nil {
+		return err
+	}
+	plain, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	f := credentialsFile{
+		Version: 1,
+		KDF:     "argon2id",
+		Salt:    make([]byte, 16),
+		Time:    argon2Time,
+		Memory:  argon2Memory,
+		Threads: argon2Threads,
+	}
+	if _, err := rand.Read(f.Salt); err != nil {
+		return err
+	}
+	gcm, err := newCredentialsCipher(argon2.IDKey([]byte(passphrase), f.Salt, f.Time, f.Memory, f.Threads, argon2KeyLen))
+	if err != nil {
+		return err
+	}
+	f.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(f.Nonce); err != nil {
+		return err
+	}
+	f.Data = gcm.Seal(nil, f.Nonce, plain, nil)
+
+	b, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), "."+filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// getPassphrase asks for the passphrase once per store.
+func (s *FileCredentialStore) getPassphrase(create bool) (string, error) {
+	if s.cached != "" {
+		return s.cached, nil
+	}
+	passphrase, err := s.passphrase(create)
+	if err != nil {
+		return "", err
+	}
+	if passphrase == "" {
+		return "", ErrPassphraseRequired
+	}
+	s.cached = passphrase
+	return passphrase, nil
+}
+
+func newCredentialsCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// CredentialsFilePath returns the path of the encrypted credentials file, next to the config file.
+func CredentialsFilePath() (string, error) {
+	path, err := config.Path()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(path), "credentials.enc"), nil
+}
+
+// PromptPassphrase reads the passphrase of the credentials file from CredentialPassphraseEnv,
+// or from the terminal when it is not set. The passphrase of a new file is asked for twice,
+// a typo would lock the user out of it.
+func PromptPassphrase(create bool) (string, error) {
+	if passphrase := os.Getenv(CredentialPassphraseEnv); passphrase != "" {
+		return passphrase, nil
+	}
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", ErrPassphraseRequired
+	}
+	if !create {
+		return readPassphrase(fd, "Passphrase of the konbini credentials file: ")
+	}
+	passphrase, err := readPassphrase(fd, "New passphrase of the konbini credentials file: ")
+	if err != nil || passphrase == "" {
+		return passphrase, err
+	}
+	repeated, err := readPassphrase(fd, "Repeat the passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if repeated != passphrase {
+		return "", ErrPassphraseMismatch
+	}
+	return passphrase, nil
+}
+
+func readPassphrase(fd int, prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	b, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+var (
+	credentialStore     CredentialStore
+	credentialStoreOnce sync.Once
+	credentialStoreErr  error
+	// keyringErr is why the keyring was not used, if it was not.
+	keyringErr error
+)
+
+// Credentials returns the store of the CLI: the OS keyring when it works, otherwise the
+// encrypted credentials file. CredentialStoreEnv forces one of them.
+func Credentials() (CredentialStore, error) {
+	credentialStoreOnce.Do(func() {
+		if credentialStore != nil {
+			return
+		}
+		credentialStore, credentialStoreErr = SelectCredentialStore()
+	})
+	return credentialStore, credentialStoreErr
+}
+
+// SetCredentials replaces the store returned by Credentials.
+func SetCredentials(store CredentialStore) {
+	credentialStoreOnce.Do(func() {})
+	credentialStore, credentialStoreErr = store, nil
+}
+
+// UnlockCredentials asks for the passphrase of the credentials file, if it is the store of the
+// CLI, before something else takes over the terminal.
+func UnlockCredentials() error {
+	store, err := Credentials()
+	if err != nil {
+		return err
+	}
+	if fileStore, ok := store.(*FileCredentialStore); ok {
+		return fileStore.Unlock()
+	}
+	return nil
+}
+
+// KeyringUnavailable returns why the OS keyring is not used, nil if it is or if it was not tried.
+func KeyringUnavailable() error {
+	return keyringErr
+}
+
+// SelectCredentialStore picks the store of the CLI, it probes the OS keyring every time it is called.
+func SelectCredentialStore() (CredentialStore, error) {
+	keyringStore := NewKeyringCredentialStore(keyringService)
+	fileStore := func() (CredentialStore, error) {
+		path, err := CredentialsFilePath()
+		if err != nil {
+			return nil, err
+		}
+		return NewFileCredentialStore(path, PromptPassphrase), nil
+	}
+
+	switch os.Getenv(CredentialStoreEnv) {
+	case CREDENTIAL_STORE_KEYRING:
+		return keyringStore, nil
+	case CREDENTIAL_STORE_FILE:
+		return fileStore()
+	case "":
+	default:
+		return nil, fmt.Errorf("Unknown %s %q, expecting keyring or file", CredentialStoreEnv, os.Getenv(CredentialStoreEnv))
+	}
+
+	// a lookup fails with something else than not found when there is no keyring to talk to
+	_, err := keyringStore.Get(keyringUser(config.DefaultProfile, config.DefaultServer))
+	if err == nil || errors.Is(err, ErrCredentialNotFound) {
+		return keyringStore, nil
+	}
+	keyringErr = err
+	return fileStore()
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileCredentialStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "konbini", "credentials.enc")
+	prompts := 0
+	created := 0
+	passphrase := func(p string) func(bool) (string, error) {
+		return func(create bool) (string, error) {
+			prompts++
+			if create {
+				created++
+			}
+			return p, nil
+		}
+	}
+
+	store := NewFileCredentialStore(path, passphrase("correct horse"))
+	_, err := store.Get("profile:default")
+	require.ErrorIs(t, err, ErrCredentialNotFound)
+	require.Equal(t, 0, prompts, "a missing file needs no passphrase")
+
+	require.NoError(t, store.Set("profile:default", "token-1"))
+	require.NoError(t, store.Set("profile:staging", "token-2"))
+	require.NoError(t, store.Delete("profile:missing"))
+	require.Equal(t, 1, prompts)
+	require.Equal(t, 1, created, "the passphrase of a new file is chosen")
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.NotContains(t, string(b), "token-1")
+	require.Contains(t, string(b), `"kdf":"argon2id"`)
+
+	reopened := NewFileCredentialStore(path, passphrase("correct horse"))
+	token, err := reopened.Get("profile:staging")
+	require.NoError(t, err)
+	require.Equal(t, "token-2", token)
+	require.NoError(t, reopened.Delete("profile:staging"))
+	_, err = reopened.Get("profile:staging")
+	require.ErrorIs(t, err, ErrCredentialNotFound)
+
+	_, err = NewFileCredentialStore(path, passphrase("wrong")).Get("profile:default")
+	require.ErrorIs(t, err, ErrWrongPassphrase)
+
+	_, err = NewFileCredentialStore(path, passphrase("")).Get("profile:default")
+	require.ErrorIs(t, err, ErrPassphraseRequired)
+	require.Equal(t, 1, created, "the passphrase of an existing file is checked")
+
+	t.Run("unlock checks the passphrase up front", func(t *testing.T) {
+		attempts := []string{"wrong", "correct horse"}
+		store := NewFileCredentialStore(path, func(create bool) (string, error) {
+			require.False(t, create)
+			p := attempts[0]
+			attempts = attempts[1:]
+			return p, nil
+		})
+		require.ErrorIs(t, store.Unlock(), ErrWrongPassphrase)
+		require.NoError(t, store.Unlock())
+		token, err := store.Get("profile:default")
+		require.NoError(t, err)
+		require.Equal(t, "token-1", token)
+
+		newPath := filepath.Join(t.TempDir(), "credentials.enc")
+		var creates []bool
+		store = NewFileCredentialStore(newPath, func(create bool) (string, error) {
+			creates = append(creates, create)
+			return "new passphrase", nil
+		})
+		require.NoError(t, store.Unlock())
+		require.NoError(t, store.Set("profile:default", "token"))
+		require.Equal(t, []bool{true}, creates)
+	})
+
+	t.Run("rejects a tampered nonce or salt instead of panicking", func(t *testing.T) {
+		b, err := os.ReadFile(path)
+		require.NoError(t, err)
+		for _, field := range []string{"nonce", "salt"} {
+			var f map[string]interface{}
+			require.NoError(t, json.Unmarshal(b, &f))
+			f[field] = base64.StdEncoding.EncodeToString([]byte("short"))
+			tampered, err := json.Marshal(f)
+			require.NoError(t, err)
+			tamperedPath := filepath.Join(t.TempDir(), "credentials.enc")
+			require.NoError(t, os.WriteFile(tamperedPath, tampered, 0600))
+
+			_, err = NewFileCredentialStore(tamperedPath, passphrase("correct horse")).Get("profile:default")
+			require.EqualError(t, err, "Unsupported credentials file "+tamperedPath, field)
+		}
+	})
+}
+
+func TestCredentialStoreSelection(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv(CredentialStoreEnv, CREDENTIAL_STORE_FILE)
+	t.Setenv(CredentialPassphraseEnv, "from-env")
+	defer SetCredentials(NewKeyringCredentialStore("konbini"))
+
+	SetCredentials(nil)
+	store, err := SelectCredentialStore()
+	require.NoError(t, err)
+	require.Equal(t, CREDENTIAL_STORE_FILE, store.Name())
+	require.Equal(t, filepath.Join(os.Getenv("XDG_CONFIG_HOME"), "konbini", "credentials.enc"), store.Location())
+
+	SetCredentials(store)
+	require.NoError(t, SaveToken("token"))
+	token, err := LoadToken()
+	require.NoError(t, err)
+	require.Equal(t, "token", token)
+
+	t.Setenv(CredentialStoreEnv, "vault")
+	_, err = SelectCredentialStore()
+	require.EqualError(t, err, `Unknown KONBINI_CREDENTIAL_STORE "vault", expecting keyring or file`)
+}
@@ -0,0 +1,116 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"github.com/juancwu/konbini/cli/config"
+	"github.com/juancwu/konbini/common/api"
+)
+
+const (
+	keyringService = "konbini"
+	// legacyKeyringUser is the entry used before profiles, it is still read for the default profile
+	// while it points to the default server.
+	legacyKeyringUser = "user"
+)
+
+var (
+	ErrNotLoggedIn error = errors.New("Not logged in. Run konbi login first.")
+)
+
+// keyringUser is the key of the token of a profile in the credential store. The server is part
+// of the key so that a token is never sent to a server other than the one that issued it, even
+// when the server of the profile is changed by hand in the config file.
+func keyringUser(profile string, server string) string {
+	if server == "" {
+		server = config.DefaultServer
+	}
+	return "profile:" + profile + "@" + server
+}
+
+// SaveToken stores the auth token of the user in the credential store under the selected profile.
+func SaveToken(token string) error {
+	store, err := Credentials()
+	if err != nil {
+		return err
+	}
+	return store.Set(keyringUser(config.ProfileName(), config.CurrentProfile().Server), token)
+}
+
+// LoadToken gets the auth token of the selected profile from the credential store. It returns ErrNotLoggedIn when there is none.
+func LoadToken() (string, error) {
+	store, err := Credentials()
+	if err != nil {
+		return "", err
+	}
+	profile, server := config.ProfileName(), config.CurrentProfile().Server
+	token, err := store.Get(keyringUser(profile, server))
+	if errors.Is(err, ErrCredentialNotFound) && profile == config.DefaultProfile && server == config.DefaultServer {
+		token, err = store.Get(legacyKeyringUser)
+	}
+	if errors.Is(err, ErrCredentialNotFound) {
+		return "", ErrNotLoggedIn
+	}
+	return token, err
+}
+
+// DeleteToken removes the auth token of the selected profile from the credential store, if there is one.
+func DeleteToken() error {
+	return DeleteProfileToken(config.ProfileName(), config.CurrentProfile().Server)
+}
+
+// DeleteProfileToken removes the auth token of a profile for a server from the credential store,
+// if there is one.
+func DeleteProfileToken(profile string, server string) error {
+	store, err := Credentials()
+	if err != nil {
+		return err
+	}
+	users := []string{keyringUser(profile, server)}
+	if profile == config.DefaultProfile && (server == "" || server == config.DefaultServer) {
+		users = append(users, legacyKeyringUser)
+	}
+	for _, user := range users {
+		if err := store.Delete(user); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Authenticate checks the stored token with the server and uses it for the following requests.
+// A refreshed token replaces the stored one and a revoked or expired token is removed.
+func Authenticate(ctx context.Context) (*api.CheckAuthResponse, error) {
+	token, err := LoadToken()
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := NewClient().CheckToken(ctx, token)
+	if err != nil {
+		if IsAuthError(err) {
+			DeleteToken()
+			return nil, ErrNotLoggedIn
+		}
+		return nil, err
+	}
+
+	if res.AuthToken != "" && res.AuthToken != token {
+		if err := SaveToken(res.AuthToken); err != nil {
+			return nil, err
+		}
+	}
+	config.SetAuth(config.Auth{
+		Token:         res.AuthToken,
+		TokenType:     res.TokenType,
+		TOTP:          res.TOTP,
+		EmailVerified: res.EmailVerified,
+	})
+	return res, nil
+}
+
+// IsAuthError reports whether the server rejected the token of the request.
+func IsAuthError(err error) bool {
+	return api.IsErrorCode(err, api.ErrorCodeUnauthorized) || api.IsErrorCode(err, api.ErrorCodeInvalidToken)
+}
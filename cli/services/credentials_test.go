@@ -0,0 +1,67 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/juancwu/konbini/cli/config"
+
+	"github.com/stretchr/testify/require"
+	keyring "github.com/zalando/go-keyring"
+)
+
+func TestProfileTokens(t *testing.T) {
+	keyring.MockInit()
+	SetCredentials(NewKeyringCredentialStore("konbini"))
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	require.NoError(t, (&config.File{Profiles: map[string]*config.Profile{"staging": {}}}).Save())
+	defer config.Load(config.DefaultProfile)
+
+	// tokens stored before profiles existed belong to the default profile
+	require.NoError(t, keyring.Set("konbini", "user", "legacy-token"))
+	require.NoError(t, config.Load(config.DefaultProfile))
+	token, err := LoadToken()
+	require.NoError(t, err)
+	require.Equal(t, "legacy-token", token)
+
+	require.NoError(t, config.Load("staging"))
+	_, err = LoadToken()
+	require.ErrorIs(t, err, ErrNotLoggedIn)
+	require.NoError(t, SaveToken("staging-token"))
+	token, err = LoadToken()
+	require.NoError(t, err)
+	require.Equal(t, "staging-token", token)
+
+	require.NoError(t, config.Load(config.DefaultProfile))
+	require.NoError(t, DeleteToken())
+	_, err = LoadToken()
+	require.ErrorIs(t, err, ErrNotLoggedIn)
+
+	require.NoError(t, config.Load("staging"))
+	token, err = LoadToken()
+	require.NoError(t, err)
+	require.Equal(t, "staging-token", token)
+
+	t.Run("tokens are not sent to another server", func(t *testing.T) {
+		require.NoError(t, keyring.Set("konbini", "user", "legacy-token"))
+		f := &config.File{Profiles: map[string]*config.Profile{
+			config.DefaultProfile: {Server: "https://evil.example.com/api/v1"},
+			"staging":             {Server: "https://staging.example.com/api/v1"},
+		}}
+		require.NoError(t, f.Save())
+
+		// the legacy token was issued by the default server
+		require.NoError(t, config.Load(config.DefaultProfile))
+		_, err := LoadToken()
+		require.ErrorIs(t, err, ErrNotLoggedIn)
+
+		// changing the server by hand leaves the token of the old server behind
+		require.NoError(t, config.Load("staging"))
+		_, err = LoadToken()
+		require.ErrorIs(t, err, ErrNotLoggedIn)
+		require.NoError(t, SaveToken("staging-token"))
+
+		require.NoError(t, DeleteProfileToken("staging", "https://staging.example.com/api/v1"))
+		_, err = LoadToken()
+		require.ErrorIs(t, err, ErrNotLoggedIn)
+	})
+}
@@ -0,0 +1,25 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/juancwu/konbini/common/api"
+)
+
+// Login signs in with email and password. The TOTP code is only sent when it is not empty.
+func Login(email string, password string, totpCode string) (api.LoginResponse, error) {
+	reqBody := api.LoginRequest{Email: email, Password: password}
+	if totpCode != "" {
+		reqBody.TOTPCode = &totpCode
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	res, err := NewClient().Login(ctx, reqBody)
+	if err != nil {
+		return api.LoginResponse{}, err
+	}
+	return *res, nil
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ProjectFile is the name of the file that binds a directory to a bento.
+const ProjectFile = ".konbini.yaml"
+
+var (
+	ErrNoProject error = fmt.Errorf("No %s found in this directory or its parents. Run konbi init first.", ProjectFile)
+)
+
+// Project binds a directory, and its subdirectories, to a bento.
+type Project struct {
+	// Bento is the id or the name of the bento.
+	Bento string `yaml:"bento"`
+	// EnvFile is the path of the .env file relative to the project directory, .env when empty.
+	EnvFile string `yaml:"env_file,omitempty"`
+
+	// Dir is the directory of the project file.
+	Dir string `yaml:"-"`
+}
+
+// EnvFilePath returns the absolute path of the .env file of the project. The project file is
+// meant to be committed, so the path must stay inside the project directory, otherwise pulling
+// a cloned repository could overwrite any file of the user.
+func (p *Project) EnvFilePath() (string, error) {
+	name := p.EnvFile
+	if name == "" {
+		name = ".env"
+	}
+	if filepath.IsAbs(name) {
+		return "", fmt.Errorf("Invalid env_file %q in %s, it must be relative to the project directory", name, ProjectFile)
+	}
+	path := filepath.Join(p.Dir, name)
+	if !insideDir(p.Dir, path) {
+		return "", fmt.Errorf("Invalid env_file %q in %s, it must be inside the project directory", name, ProjectFile)
+	}
+
+	// a directory on the way could be a symlink that points outside of the project
+	dir, err := filepath.EvalSymlinks(filepath.Dir(path))
+	if errors.Is(err, os.ErrNotExist) {
+		return path, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	root, err := filepath.EvalSymlinks(p.Dir)
+	if err != nil {
+		return "", err
+	}
+	if !insideDir(root, dir) {
+		return "", fmt.Errorf("Invalid env_file %q in %s, it resolves outside of the project directory", name, ProjectFile)
+	}
+	return path, nil
+}
+
+// insideDir reports whether path is dir or is in dir, both must be clean.
+func insideDir(dir string, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// FindProject looks for the project file in dir and its parents. It returns ErrNoProject
+// when there is none.
+func FindProject(dir string) (*Project, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		b, err := os.ReadFile(filepath.Join(dir, ProjectFile))
+		if err == nil {
+			p := &Project{Dir: dir}
+			if err := yaml.Unmarshal(b, p); err != nil {
+				return nil, fmt.Errorf("Invalid %s: %w", filepath.Join(dir, ProjectFile), err)
+			}
+			if p.Bento == "" {
+				return nil, fmt.Errorf("Missing bento in %s", filepath.Join(dir, ProjectFile))
+			}
+			if _, err := p.EnvFilePath(); err != nil {
+				return nil, err
+			}
+			return p, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, ErrNoProject
+		}
+		dir = parent
+	}
+}
+
+// SaveProject writes the project file in the directory of the project.
+func SaveProject(p *Project) error {
+	b, err := yaml.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(p.Dir, ProjectFile), b, 0644)
+}
@@ -1,66 +1,25 @@
 package services
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
-	"net/http"
 	"time"
 
-	"github.com/juancwu/konbini/cli/config"
-	"github.com/juancwu/konbini/common/api"
 	commonAPI "github.com/juancwu/konbini/common/api"
 )
 
 func Register(email string, nickname string, password string) (commonAPI.RegisterResponse, error) {
-	body, err := json.Marshal(map[string]string{
-		"email":    email,
-		"nickname": nickname,
-		"password": password,
-	})
-	if err != nil {
-		return commonAPI.RegisterResponse{}, err
-	}
-
-	reader := bytes.NewReader(body)
-
-	req, err := http.NewRequest(http.MethodPost, config.BackendUrl(api.UriRegister), reader)
-	if err != nil {
-		return commonAPI.RegisterResponse{}, err
-	}
-	req.Header.Add("Content-Type", "application/json")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
 
-	client := http.Client{
-		Timeout: time.Second * 10,
-	}
-	res, err := client.Do(req)
-	if err != nil {
-		return commonAPI.RegisterResponse{}, err
-	}
-	defer res.Body.Close()
-
-	data, err := io.ReadAll(res.Body)
-	if err != nil {
-		return commonAPI.RegisterResponse{}, err
-	}
-
-	if res.StatusCode == http.StatusCreated {
-		var resBody commonAPI.RegisterResponse
-		err = json.Unmarshal(data, &resBody)
-		if err != nil {
-			return commonAPI.RegisterResponse{}, err
-		}
-
-		return resBody, nil
-	}
-
-	var resBody commonAPI.ErrorResponse
-	err = json.Unmarshal(data, &resBody)
+	res, err := NewClient().Register(ctx, commonAPI.RegisterRequest{
+		Email:    email,
+		NickName: nickname,
+		Password: password,
+	})
 	if err != nil {
-		return commonAPI.RegisterResponse{}, err
+		return commonAPI.RegisterResponse{}, fmt.Errorf("Registration Error: %w", err)
 	}
 
-	return commonAPI.RegisterResponse{}, fmt.Errorf("Registration Error: %s", resBody.Message)
-
+	return *res, nil
 }
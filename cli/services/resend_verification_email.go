@@ -1,11 +1,9 @@
 package services
 
 import (
+	"context"
 	"errors"
-	"io"
 	"github.com/juancwu/konbini/cli/config"
-	"github.com/juancwu/konbini/common/api"
-	"net/http"
 	"time"
 )
 
@@ -19,26 +17,8 @@ func ResendVerificationEmail() error {
 		return ErrMissingAuth
 	}
 
-	req, err := http.NewRequest(http.MethodPost, config.BackendUrl(api.UriResendVerificationEmail), nil)
-	if err != nil {
-		return err
-	}
-	req.Header.Add(api.HeaderAuthorization, api.Bearer(auth.Token))
-
-	c := http.Client{Timeout: time.Second * 30}
-	res, err := c.Do(req)
-	if err != nil {
-		return err
-	}
-	defer res.Body.Close()
-
-	if res.StatusCode != http.StatusOK {
-		data, err := io.ReadAll(res.Body)
-		if err != nil {
-			return err
-		}
-		return errors.New(string(data))
-	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
 
-	return nil
+	return NewClient().ResendVerificationEmail(ctx)
 }
@@ -0,0 +1,198 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/juancwu/konbini/common/api"
+)
+
+// RedactedValue replaces the values of ingredients in redacted output.
+const RedactedValue = "[REDACTED]"
+
+// MinRedactLength is the length under which values are not redacted, short values like
+// "1" or "true" would otherwise mask most of the output.
+const MinRedactLength = 4
+
+// RunOptions configures how RunWithBentos runs a command.
+type RunOptions struct {
+	// Redact replaces the values of the ingredients in the output of the command.
+	Redact bool
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// MergeIngredients merges the ingredients of the bentos into a single environment. Bentos
+// are applied in order so the last bento that has an ingredient wins.
+func MergeIngredients(bentos []*api.GetBentoResponse) map[string]string {
+	env := map[string]string{}
+	for _, bento := range bentos {
+		for _, ing := range bento.Ingredients {
+			env[ing.Name] = ing.Value
+		}
+	}
+	return env
+}
+
+// MergeEnv overrides the variables of environ, in KEY=VALUE form, with the given ones.
+func MergeEnv(environ []string, vars map[string]string) []string {
+	merged := make([]string, 0, len(environ)+len(vars))
+	for _, kv := range environ {
+		name, _, _ := strings.Cut(kv, "=")
+		if _, ok := vars[name]; !ok {
+			merged = append(merged, kv)
+		}
+	}
+	for _, name := range sortedKeys(vars) {
+		merged = append(merged, name+"="+vars[name])
+	}
+	return merged
+}
+
+// RunWithBentos runs the command with the variables merged into the environment of the CLI.
+// Interrupt, terminate, hangup and quit signals received by the CLI are forwarded to the command.
+// It returns the exit code of the command, 128 plus the signal number when it was killed by a
+// signal, and an error only if the command could not be started.
+func RunWithBentos(ctx context.Context, argv []string, vars map[string]string, opts RunOptions) (int, error) {
+	cmd := exec.Command(argv[0], argv[1:]...)
+	cmd.Env = MergeEnv(os.Environ(), vars)
+	cmd.Stdin = opts.Stdin
+
+	stdout, stderr := opts.Stdout, opts.Stderr
+	var redactors []*Redactor
+	if opts.Redact {
+		secrets := make([]string, 0, len(vars))
+		for _, value := range vars {
+			secrets = append(secrets, value)
+		}
+		out, errOut := NewRedactor(stdout, secrets), NewRedactor(stderr, secrets)
+		redactors = append(redactors, out, errOut)
+		stdout, stderr = out, errOut
+	}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT)
+	defer signal.Stop(signals)
+
+	if err := cmd.Start(); err != nil {
+		return 0, err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case sig := <-signals:
+				cmd.Process.Signal(sig)
+			case <-ctx.Done():
+				cmd.Process.Signal(syscall.SIGTERM)
+				<-done
+				return
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	err := cmd.Wait()
+	close(done)
+	for _, r := range redactors {
+		r.Close()
+	}
+
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return 0, err
+	}
+	state := cmd.ProcessState
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return 128 + int(status.Signal()), nil
+	}
+	return state.ExitCode(), nil
+}
+
+// Redactor is a writer that replaces secrets with RedactedValue before writing to the underlying
+// writer. Output that could be the beginning of a secret is held back until the next write tells
+// whether it is one, Close writes what is left.
+type Redactor struct {
+	mu      sync.Mutex
+	w       io.Writer
+	secrets [][]byte
+	buf     []byte
+}
+
+// NewRedactor creates a Redactor of the secrets that are at least MinRedactLength long.
+func NewRedactor(w io.Writer, secrets []string) *Redactor {
+	r := &Redactor{w: w}
+	seen := map[string]bool{}
+	for _, s := range secrets {
+		if len(s) >= MinRedactLength && !seen[s] {
+			seen[s] = true
+			r.secrets = append(r.secrets, []byte(s))
+		}
+	}
+	// longest first so that a secret that contains another one is redacted whole
+	sort.Slice(r.secrets, func(i, j int) bool { return len(r.secrets[i]) > len(r.secrets[j]) })
+	return r
+}
+
+func (r *Redactor) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.buf = append(r.buf, p...)
+	if err := r.flush(false); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close writes the output that was held back.
+func (r *Redactor) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.flush(true)
+}
+
+func (r *Redactor) flush(final bool) error {
+	var out []byte
+	i := 0
+scan:
+	for i < len(r.buf) {
+		rest := r.buf[i:]
+		if !final {
+			for _, s := range r.secrets {
+				if len(rest) < len(s) && bytes.HasPrefix(s, rest) {
+					// could be the beginning of a secret, wait for more output
+					break scan
+				}
+			}
+		}
+		for _, s := range r.secrets {
+			if bytes.HasPrefix(rest, s) {
+				out = append(out, RedactedValue...)
+				i += len(s)
+				continue scan
+			}
+		}
+		out = append(out, r.buf[i])
+		i++
+	}
+	r.buf = append(r.buf[:0], r.buf[i:]...)
+	if len(out) == 0 {
+		return nil
+	}
+	_, err := r.w.Write(out)
+	return err
+}
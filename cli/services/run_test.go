@@ -0,0 +1,115 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/juancwu/konbini/common/api"
+
+	"github.com/stretchr/testify/require"
+)
+
+// syncBuffer is a bytes.Buffer that can be read while a command writes to it.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestMergeIngredients(t *testing.T) {
+	shared := &api.GetBentoResponse{Ingredients: []api.BentoIngredient{{Name: "A", Value: "shared"}, {Name: "B", Value: "shared"}}}
+	prod := &api.GetBentoResponse{Ingredients: []api.BentoIngredient{{Name: "B", Value: "prod"}}}
+
+	vars := MergeIngredients([]*api.GetBentoResponse{shared, prod})
+	require.Equal(t, map[string]string{"A": "shared", "B": "prod"}, vars)
+
+	require.Equal(t, []string{"HOME=/root", "A=shared", "B=prod"}, MergeEnv([]string{"A=env", "HOME=/root"}, vars))
+}
+
+func TestRedactor(t *testing.T) {
+	var out bytes.Buffer
+	r := NewRedactor(&out, []string{"s3cr3t", "s3cr3t-long", "1", "abcd"})
+
+	for _, chunk := range []string{"token=s3c", "r3t and s3cr3t-lo", "ng, n=1, ab", "c", "d.\n", "ab"} {
+		n, err := r.Write([]byte(chunk))
+		require.NoError(t, err)
+		require.Equal(t, len(chunk), n)
+	}
+	// "ab" could be the beginning of abcd
+	require.Equal(t, "token=[REDACTED] and [REDACTED], n=1, [REDACTED].\n", out.String())
+	require.NoError(t, r.Close())
+	require.Equal(t, "token=[REDACTED] and [REDACTED], n=1, [REDACTED].\nab", out.String())
+}
+
+func TestRunWithBentos(t *testing.T) {
+	vars := map[string]string{"API_KEY": "super-secret"}
+
+	t.Run("passes the environment and the exit code", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		code, err := RunWithBentos(context.Background(), []string{"sh", "-c", `echo "key=$API_KEY"; echo "$API_KEY" >&2; exit 3`}, vars, RunOptions{
+			Stdout: &stdout,
+			Stderr: &stderr,
+		})
+		require.NoError(t, err)
+		require.Equal(t, 3, code)
+		require.Equal(t, "key=super-secret\n", stdout.String())
+		require.Equal(t, "super-secret\n", stderr.String())
+	})
+
+	t.Run("redacts the output", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		code, err := RunWithBentos(context.Background(), []string{"sh", "-c", `printf 'key=%s' "$API_KEY"; echo "$API_KEY" >&2`}, vars, RunOptions{
+			Redact: true,
+			Stdout: &stdout,
+			Stderr: &stderr,
+		})
+		require.NoError(t, err)
+		require.Equal(t, 0, code)
+		require.Equal(t, "key=[REDACTED]", stdout.String())
+		require.Equal(t, "[REDACTED]\n", stderr.String())
+	})
+
+	t.Run("forwards signals", func(t *testing.T) {
+		stdout := &syncBuffer{}
+		result := make(chan int, 1)
+		go func() {
+			code, err := RunWithBentos(context.Background(), []string{"sh", "-c", `trap 'exit 42' TERM; echo ready; while true; do sleep 0.01; done`}, nil, RunOptions{
+				Stdout: stdout,
+				Stderr: os.Stderr,
+			})
+			require.NoError(t, err)
+			result <- code
+		}()
+
+		require.Eventually(t, func() bool { return strings.Contains(stdout.String(), "ready") }, time.Second*5, time.Millisecond*10)
+		require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGTERM))
+		select {
+		case code := <-result:
+			require.Equal(t, 42, code)
+		case <-time.After(time.Second * 5):
+			t.Fatal("the command did not get the signal")
+		}
+	})
+
+	t.Run("reports commands that can't start", func(t *testing.T) {
+		_, err := RunWithBentos(context.Background(), []string{"konbi-test-missing-command"}, nil, RunOptions{})
+		require.Error(t, err)
+	})
+}
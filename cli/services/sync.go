@@ -0,0 +1,209 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/juancwu/konbini/common/api"
+)
+
+// ParseEnvFile reads the variables of a .env file. It understands the files written by
+// FormatEnvFile and the usual hand written forms: comments, an optional "export" prefix,
+// unquoted values with trailing comments, single quoted literal values and double quoted
+// values with escapes, both of which can span multiple lines.
+func ParseEnvFile(content string) (map[string]string, error) {
+	vars := map[string]string{}
+	line := 1
+	i := 0
+	for i < len(content) {
+		// skip blank lines and comments
+		end := strings.IndexByte(content[i:], '\n')
+		if end < 0 {
+			end = len(content) - i
+		}
+		raw := strings.TrimSpace(content[i : i+end])
+		if raw == "" || strings.HasPrefix(raw, "#") {
+			i += end + 1
+			line++
+			continue
+		}
+
+		start := line
+		eq := strings.IndexByte(content[i:i+end], '=')
+		if eq < 0 {
+			return nil, fmt.Errorf("Invalid .env line %d, expecting KEY=VALUE", start)
+		}
+		name := strings.TrimSpace(content[i : i+eq])
+		name = strings.TrimSpace(strings.TrimPrefix(name, "export "))
+		if name == "" || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("Invalid variable name on .env line %d", start)
+		}
+		i += eq + 1
+		for i < len(content) && (content[i] == ' ' || content[i] == '\t') {
+			i++
+		}
+
+		var value string
+		var n int
+		var err error
+		if i < len(content) && (content[i] == '"' || content[i] == '\'') {
+			value, n, err = parseQuotedEnvValue(content[i:])
+			if err != nil {
+				return nil, fmt.Errorf("Invalid value of %s on .env line %d: %w", name, start, err)
+			}
+			line += strings.Count(content[i:i+n], "\n")
+			i += n
+			// only a comment can follow the closing quote
+			end = strings.IndexByte(content[i:], '\n')
+			if end < 0 {
+				end = len(content) - i
+			}
+			rest := strings.TrimSpace(content[i : i+end])
+			if rest != "" && !strings.HasPrefix(rest, "#") {
+				return nil, fmt.Errorf("Unexpected characters after the value of %s on .env line %d", name, line)
+			}
+		} else {
+			end = strings.IndexByte(content[i:], '\n')
+			if end < 0 {
+				end = len(content) - i
+			}
+			value = content[i : i+end]
+			if idx := strings.Index(value, " #"); idx >= 0 {
+				value = value[:idx]
+			}
+			value = strings.TrimSpace(value)
+		}
+		vars[name] = value
+		i += end + 1
+		line++
+	}
+	return vars, nil
+}
+
+// parseQuotedEnvValue parses a quoted value and returns it along with the number of bytes read.
+func parseQuotedEnvValue(s string) (string, int, error) {
+	quote := s[0]
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == quote:
+			return b.String(), i + 1, nil
+		case c == '\\' && quote == '"' && i+1 < len(s):
+			i++
+			switch s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case '\\', '"', '$':
+				b.WriteByte(s[i])
+			default:
+				b.WriteByte('\\')
+				b.WriteByte(s[i])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", 0, errors.New("missing closing quote")
+}
+
+// ReadEnvFile parses the .env file at path. A missing file has no variables.
+func ReadEnvFile(path string) (map[string]string, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ParseEnvFile(string(b))
+}
+
+// DiffEnv lists the variables that differ from the ingredients of a bento to the variables
+// of a .env file, sorted by name. Variables of the file that are not in the bento are added.
+func DiffEnv(bento *api.GetBentoResponse, vars map[string]string) []IngredientDiff {
+	return DiffBentos(bento, envBento(vars), BentoChange{})
+}
+
+// PushChange is the change that makes the bento match the variables of a .env file. The
+// ingredients that are not in the file are only removed when prune is true.
+func PushChange(diff []IngredientDiff, vars map[string]string, prune bool) BentoChange {
+	change := BentoChange{Set: map[string]string{}, Replace: true}
+	for _, d := range diff {
+		switch d.Kind {
+		case IngredientAdded, IngredientModified:
+			change.Set[d.Name] = vars[d.Name]
+		case IngredientRemoved:
+			if prune {
+				change.Unset = append(change.Unset, d.Name)
+			}
+		}
+	}
+	return change
+}
+
+// PrintEnvDiff writes a diff without values. from and to name the two sides, i.e. "bento" and ".env".
+func PrintEnvDiff(w io.Writer, diff []IngredientDiff, from string, to string) {
+	if len(diff) == 0 {
+		fmt.Fprintf(w, "%s and %s are in sync.\n", from, to)
+		return
+	}
+	for _, d := range diff {
+		switch d.Kind {
+		case IngredientAdded:
+			fmt.Fprintf(w, "  + %s (only in %s)\n", d.Name, to)
+		case IngredientRemoved:
+			fmt.Fprintf(w, "  - %s (only in %s)\n", d.Name, from)
+		default:
+			fmt.Fprintf(w, "  ~ %s (modified)\n", d.Name)
+		}
+	}
+}
+
+// PullBento gets the bento of the project and returns the diff from the .env file of the
+// project to the bento. The file is not written, WriteEnvFile does it once the diff is accepted.
+func PullBento(ctx context.Context, client *api.Client, project *Project) (*api.GetBentoResponse, []IngredientDiff, error) {
+	path, err := project.EnvFilePath()
+	if err != nil {
+		return nil, nil, err
+	}
+	bento, err := RevealBento(ctx, client, project.Bento)
+	if err != nil {
+		return nil, nil, err
+	}
+	vars, err := ReadEnvFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return bento, DiffBentos(envBento(vars), bento, BentoChange{}), nil
+}
+
+// PullOverwrites counts the variables of the .env file that a pull with diff replaces and removes.
+func PullOverwrites(diff []IngredientDiff) (modified int, removed int) {
+	for _, d := range diff {
+		switch d.Kind {
+		case IngredientModified:
+			modified++
+		case IngredientRemoved:
+			removed++
+		}
+	}
+	return modified, removed
+}
+
+// envBento wraps the variables of a .env file in a bento so that they can be diffed.
+func envBento(vars map[string]string) *api.GetBentoResponse {
+	bento := &api.GetBentoResponse{}
+	for name, value := range vars {
+		bento.Ingredients = append(bento.Ingredients, api.BentoIngredient{Name: name, Value: value})
+	}
+	return bento
+}
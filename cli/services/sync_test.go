@@ -0,0 +1,177 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/juancwu/konbini/common/api"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseEnvFile(t *testing.T) {
+	t.Run("reads what FormatEnvFile writes", func(t *testing.T) {
+		ingredients := []api.BentoIngredient{
+			{Name: "A", Value: "plain"},
+			{Name: "B", Value: "line 1\nline \"2\" $HOME \\ # not a comment"},
+			{Name: "C", Value: ""},
+			{Name: "D", Value: "crlf\r\n'single'"},
+		}
+		vars, err := ParseEnvFile(FormatEnvFile(ingredients))
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{
+			"A": "plain",
+			"B": "line 1\nline \"2\" $HOME \\ # not a comment",
+			"C": "",
+			"D": "crlf\r\n'single'",
+		}, vars)
+	})
+
+	t.Run("reads hand written files", func(t *testing.T) {
+		vars, err := ParseEnvFile(`# database
+export DB_URL=postgres://localhost/app # local only
+EMPTY=
+SPACED = value with spaces  
+SINGLE='no $escapes\n here'
+MULTI="-----BEGIN KEY-----
+abc
+-----END KEY-----" # pasted
+URL=http://host/#anchor
+`)
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{
+			"DB_URL": "postgres://localhost/app",
+			"EMPTY":  "",
+			"SPACED": "value with spaces",
+			"SINGLE": `no $escapes\n here`,
+			"MULTI":  "-----BEGIN KEY-----\nabc\n-----END KEY-----",
+			"URL":    "http://host/#anchor",
+		}, vars)
+	})
+
+	t.Run("reports the line of invalid entries", func(t *testing.T) {
+		_, err := ParseEnvFile("A=1\n\"B\nC")
+		require.EqualError(t, err, "Invalid .env line 2, expecting KEY=VALUE")
+
+		_, err = ParseEnvFile("A=1\nB=\"open\nC=2\n")
+		require.EqualError(t, err, "Invalid value of B on .env line 2: missing closing quote")
+
+		_, err = ParseEnvFile("A=\"x\"\nB=\"y\" z\n")
+		require.EqualError(t, err, "Unexpected characters after the value of B on .env line 2")
+	})
+}
+
+func TestProject(t *testing.T) {
+	root := t.TempDir()
+	nested := filepath.Join(root, "services", "api")
+	require.NoError(t, os.MkdirAll(nested, 0755))
+
+	_, err := FindProject(nested)
+	require.ErrorIs(t, err, ErrNoProject)
+
+	require.NoError(t, SaveProject(&Project{Bento: "b1", EnvFile: ".env.local", Dir: root}))
+	project, err := FindProject(nested)
+	require.NoError(t, err)
+	require.Equal(t, "b1", project.Bento)
+	path, err := project.EnvFilePath()
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(root, ".env.local"), path)
+
+	require.NoError(t, os.WriteFile(filepath.Join(nested, ProjectFile), []byte("env_file: .env\n"), 0644))
+	_, err = FindProject(nested)
+	require.ErrorContains(t, err, "Missing bento")
+}
+
+func TestProjectEnvFileStaysInProject(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(root, "config"), 0755))
+	require.NoError(t, os.Symlink(outside, filepath.Join(root, "linked")))
+
+	for _, envFile := range []string{"config/.env", "./.env.local", "config/../.env"} {
+		_, err := (&Project{Bento: "b1", EnvFile: envFile, Dir: root}).EnvFilePath()
+		require.NoError(t, err, envFile)
+	}
+	for _, envFile := range []string{"/home/user/.bashrc", "../.bashrc", "config/../../.bashrc", "linked/.bashrc"} {
+		_, err := (&Project{Bento: "b1", EnvFile: envFile, Dir: root}).EnvFilePath()
+		require.Error(t, err, envFile)
+	}
+
+	// a committed project file can't point outside of the cloned repository
+	require.NoError(t, os.WriteFile(filepath.Join(root, ProjectFile), []byte("bento: b1\nenv_file: ../.bashrc\n"), 0644))
+	_, err := FindProject(root)
+	require.ErrorContains(t, err, "must be inside the project directory")
+}
+
+func TestPushChange(t *testing.T) {
+	bento := &api.GetBentoResponse{Ingredients: []api.BentoIngredient{
+		{ID: "1", Name: "KEEP", Value: "same"},
+		{ID: "2", Name: "ROTATED", Value: "old"},
+		{ID: "3", Name: "GONE", Value: "x"},
+	}}
+	vars := map[string]string{"KEEP": "same", "ROTATED": "new", "ADDED": "1"}
+
+	diff := DiffEnv(bento, vars)
+	require.Equal(t, []IngredientDiff{
+		{Name: "ADDED", Kind: IngredientAdded},
+		{Name: "GONE", Kind: IngredientRemoved},
+		{Name: "ROTATED", Kind: IngredientModified},
+	}, diff)
+
+	require.Equal(t, BentoChange{
+		Set:     map[string]string{"ADDED": "1", "ROTATED": "new"},
+		Replace: true,
+	}, PushChange(diff, vars, false))
+	require.Equal(t, []string{"GONE"}, PushChange(diff, vars, true).Unset)
+}
+
+func TestPullBento(t *testing.T) {
+	const id = "7f0c3a4e-1f0c-4c52-9f3b-3f6c3b1f6a10"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(api.GetBentoResponse{
+			BentoID:     id,
+			Name:        "prod",
+			Revision:    4,
+			Ingredients: []api.BentoIngredient{{Name: "API_KEY", Value: "new"}},
+		})
+	}))
+	defer srv.Close()
+	client := api.NewClient(srv.URL)
+
+	project := &Project{Bento: id, Dir: t.TempDir()}
+	path, err := project.EnvFilePath()
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, []byte("API_KEY=old\nLOCAL=1\n"), 0644))
+
+	// the file is only written once the diff is accepted
+	bento, diff, err := PullBento(context.Background(), client, project)
+	require.NoError(t, err)
+	require.Equal(t, []IngredientDiff{
+		{Name: "API_KEY", Kind: IngredientModified},
+		{Name: "LOCAL", Kind: IngredientRemoved},
+	}, diff)
+	modified, removed := PullOverwrites(diff)
+	require.Equal(t, 1, modified)
+	require.Equal(t, 1, removed)
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "API_KEY=old\nLOCAL=1\n", string(b))
+
+	require.NoError(t, WriteEnvFile(path, bento.Ingredients))
+	b, err = os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "API_KEY=\"new\"\n", string(b))
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// new variables of the bento don't overwrite anything
+	modified, removed = PullOverwrites([]IngredientDiff{{Name: "NEW", Kind: IngredientAdded}})
+	require.Zero(t, modified)
+	require.Zero(t, removed)
+}
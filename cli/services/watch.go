@@ -0,0 +1,124 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/juancwu/konbini/common/api"
+)
+
+// WatchOptions configures what WatchBento does when the bento changes.
+type WatchOptions struct {
+	// EnvFile is rewritten with the ingredients of the bento when it is not empty.
+	EnvFile string
+	// Hook is a shell command that runs with the ingredients in its environment when it is not empty.
+	Hook string
+	// OnChange is called with every change before the bento is exported, i.e. to log it.
+	OnChange func(change api.BentoChange)
+}
+
+// WatchBento exports the bento right away and again every time it changes until the context is done.
+func WatchBento(ctx context.Context, client *api.Client, bentoID string, opts WatchOptions) error {
+	bento, err := client.RevealIngredients(ctx, bentoID, nil)
+	if err != nil {
+		return err
+	}
+	if err := ExportBento(ctx, bento, opts); err != nil {
+		return err
+	}
+
+	return client.WatchBento(ctx, bentoID, bento.Revision, func(change api.BentoChange) error {
+		if opts.OnChange != nil {
+			opts.OnChange(change)
+		}
+		if change.Revision <= bento.Revision {
+			// already exported, i.e. several changes were streamed at once
+			return nil
+		}
+		latest, err := client.RevealIngredients(ctx, bentoID, nil)
+		if err != nil {
+			return err
+		}
+		bento = latest
+		return ExportBento(ctx, bento, opts)
+	})
+}
+
+// ExportBento writes the env file and runs the hook of the options.
+func ExportBento(ctx context.Context, bento *api.GetBentoResponse, opts WatchOptions) error {
+	if opts.EnvFile != "" {
+		if err := WriteEnvFile(opts.EnvFile, bento.Ingredients); err != nil {
+			return err
+		}
+	}
+	if opts.Hook != "" {
+		cmd := exec.CommandContext(ctx, "sh", "-c", opts.Hook)
+		cmd.Env = append(os.Environ(), EnvVars(bento.Ingredients)...)
+		cmd.Env = append(cmd.Env,
+			"KONBI_BENTO_ID="+bento.BentoID,
+			"KONBI_BENTO_REVISION="+strconv.FormatInt(bento.Revision, 10),
+		)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("Hook failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// EnvVars formats the ingredients as KEY=VALUE pairs sorted by name.
+func EnvVars(ingredients []api.BentoIngredient) []string {
+	vars := make([]string, len(ingredients))
+	for i, ing := range ingredients {
+		vars[i] = ing.Name + "=" + ing.Value
+	}
+	sort.Strings(vars)
+	return vars
+}
+
+// FormatEnvFile formats the ingredients as a .env file. Values are double quoted so that
+// multi-line values survive.
+func FormatEnvFile(ingredients []api.BentoIngredient) string {
+	sorted := make([]api.BentoIngredient, len(ingredients))
+	copy(sorted, ingredients)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "$", `\$`)
+	var b strings.Builder
+	for _, ing := range sorted {
+		fmt.Fprintf(&b, "%s=\"%s\"\n", ing.Name, replacer.Replace(ing.Value))
+	}
+	return b.String()
+}
+
+// WriteEnvFile replaces the file at path with the ingredients. The file is only readable by
+// the user and is replaced in one step so that readers never see half of it.
+func WriteEnvFile(path string, ingredients []api.BentoIngredient) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.WriteString(FormatEnvFile(ingredients)); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
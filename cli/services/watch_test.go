@@ -0,0 +1,30 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/juancwu/konbini/common/api"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvFile(t *testing.T) {
+	ingredients := []api.BentoIngredient{
+		{Name: "B", Value: "line 1\nline \"2\" $HOME \\"},
+		{Name: "A", Value: "plain"},
+	}
+	require.Equal(t, "A=\"plain\"\nB=\"line 1\\nline \\\"2\\\" \\$HOME \\\\\"\n", FormatEnvFile(ingredients))
+	require.Equal(t, []string{"A=plain", "B=line 1\nline \"2\" $HOME \\"}, EnvVars(ingredients))
+
+	path := filepath.Join(t.TempDir(), ".env")
+	require.NoError(t, WriteEnvFile(path, ingredients))
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+}
@@ -1,27 +1,26 @@
 package tui
 
 import (
-	"bytes"
-	"encoding/json"
-	"errors"
-	"io"
+	"context"
 	"github.com/juancwu/konbini/cli/config"
 	"github.com/juancwu/konbini/cli/router"
-	"github.com/juancwu/konbini/common/api"
-	"net/http"
+	"github.com/juancwu/konbini/cli/services"
 	"time"
 
 	"github.com/charmbracelet/bubbles/help"
 	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/spinner"
 	tea "github.com/charmbracelet/bubbletea"
-	keyring "github.com/zalando/go-keyring"
 )
 
 const (
 	pageMenu        = "menu"
 	pageSetupTOTP   = "setup-totp"
 	pageVerifyEmail = "verify-email"
+	pageRegister    = "register"
+	pageLogin       = "login"
+	pageBentos      = "bentos"
+	pageBento       = "bento"
 )
 
 type GlobalKeyMap struct {
@@ -55,6 +54,9 @@ type App struct {
 	authCheckDone   bool
 
 	routerInitialized bool
+
+	// navigationErr is shown under the page until the next key press
+	navigationErr error
 }
 
 // New creates a new app model
@@ -73,6 +75,22 @@ func New() App {
 		return newVerifyEmail(params)
 	})
 
+	r.RegisterPage(pageRegister, func(params map[string]interface{}) tea.Model {
+		return newRegister(params)
+	})
+
+	r.RegisterPage(pageLogin, func(params map[string]interface{}) tea.Model {
+		return newLogin(params)
+	})
+
+	r.RegisterPage(pageBentos, func(params map[string]interface{}) tea.Model {
+		return newBentos(params)
+	})
+
+	r.RegisterPage(pageBento, func(params map[string]interface{}) tea.Model {
+		return newBentoPage(params)
+	})
+
 	keys := GlobalKeyMap{
 		ForceQuit: key.NewBinding(
 			key.WithKeys("ctrl+c"),
@@ -117,6 +135,7 @@ func (m App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case key.Matches(msg, m.keys.ForceQuit):
 			return m, tea.Quit
 		}
+		m.navigationErr = nil
 	case tea.WindowSizeMsg:
 		if !m.windowSizeCheck {
 			m.width = msg.Width
@@ -127,7 +146,9 @@ func (m App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		params := m.globalParams(msg.Params)
 		cmd, err = m.r.Navigate(msg.To, params)
 		if err != nil {
-			panic(err)
+			// i.e. menu entries for pages that are not implemented yet
+			m.navigationErr = err
+			break
 		}
 		cmds = append(cmds, cmd)
 	case spinner.TickMsg:
@@ -137,6 +158,9 @@ func (m App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 	case authCheckMsg:
 		m.authCheckDone = true
+	case clipboardClearMsg:
+		// cleared here so that it happens even after leaving the page the value was copied from
+		clipboard.Clear(msg.value)
 	}
 
 	if m.ready() {
@@ -167,7 +191,11 @@ func (m App) View() string {
 		return m.s.View() + " Loading..."
 	}
 
-	return m.r.CurrentModel().View()
+	view := m.r.CurrentModel().View()
+	if m.navigationErr != nil {
+		view += "\n" + errTextStyle.Render(m.navigationErr.Error())
+	}
+	return view
 }
 
 type authCheckMsg struct {
@@ -175,64 +203,11 @@ type authCheckMsg struct {
 }
 
 func (m App) authCheck() tea.Msg {
-	token, err := keyring.Get("konbini", "user")
-	if err != nil {
-		return authCheckMsg{Err: err}
-	}
-
-	reqBody := api.CheckAuthTokenRequest{AuthToken: token}
-	reqBodyBytes, err := json.Marshal(reqBody)
-	if err != nil {
-		return authCheckMsg{Err: err}
-	}
-	reader := bytes.NewReader(reqBodyBytes)
-
-	req, err := http.NewRequest(
-		http.MethodPost,
-		config.BackendUrl(api.UriCheckToken),
-		reader,
-	)
-	if err != nil {
-		return authCheckMsg{Err: err}
-	}
-	req.Header.Add(api.HeaderContentType, api.MimeApplicationJson)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
 
-	c := http.Client{Timeout: time.Second * 30}
-	res, err := c.Do(req)
-	if err != nil {
-		return authCheckMsg{Err: err}
-	}
-
-	data, err := io.ReadAll(res.Body)
-	res.Body.Close()
-
-	if res.StatusCode != http.StatusOK {
-		var resBody api.ErrorResponse
-		err := json.Unmarshal(data, &resBody)
-		if err == nil {
-			err = errors.New(resBody.Message)
-		}
-		return authCheckMsg{Err: err}
-	}
-
-	var resBody api.CheckAuthResponse
-	err = json.Unmarshal(data, &resBody)
-	if err != nil {
-		return authCheckMsg{Err: err}
-	}
-
-	if resBody.AuthToken != "" {
-		keyring.Set("konbini", "user", resBody.AuthToken)
-	}
-
-	config.SetAuth(config.Auth{
-		Token:         resBody.AuthToken,
-		TokenType:     resBody.TokenType,
-		TOTP:          resBody.TOTP,
-		EmailVerified: resBody.EmailVerified,
-	})
-
-	return authCheckMsg{}
+	_, err := services.Authenticate(ctx)
+	return authCheckMsg{Err: err}
 }
 
 // Global parameters
@@ -241,6 +216,11 @@ const (
 	paramAppHeight = "_app_height"
 )
 
+// Page parameters
+const (
+	paramBentoID = "bento_id"
+)
+
 // globalParams extends the given params with global params, pass nil is no params
 func (m App) globalParams(params map[string]interface{}) map[string]interface{} {
 	if params == nil {
@@ -0,0 +1,561 @@
+package tui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/juancwu/konbini/cli/router"
+	"github.com/juancwu/konbini/cli/services"
+	"github.com/juancwu/konbini/common/api"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/help"
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// maskedValue is shown instead of values that are not revealed. It has a fixed length so
+// that the length of the values is not leaked either.
+const maskedValue = "••••••••"
+
+// clipboard is shared by the pages so that a copied value is cleared even after leaving the
+// page it was copied from.
+var clipboard = services.SystemClipboard()
+
+// ClearClipboard clears the last value copied by the TUI if it is still in the clipboard.
+func ClearClipboard() error {
+	return clipboard.Close()
+}
+
+// clipboardClearMsg is sent when a copied value has to be cleared from the clipboard.
+type clipboardClearMsg struct {
+	value string
+}
+
+// Modes of the bento page.
+const (
+	bentoModeView = iota
+	bentoModeAdd
+	bentoModeEdit
+	bentoModeDelete
+)
+
+type bentoKeyMap struct {
+	Up      key.Binding
+	Down    key.Binding
+	Reveal  key.Binding
+	Copy    key.Binding
+	Add     key.Binding
+	Edit    key.Binding
+	Delete  key.Binding
+	Refresh key.Binding
+	Back    key.Binding
+}
+
+func (k bentoKeyMap) ShortHelp() []key.Binding {
+	return []key.Binding{k.Reveal, k.Copy, k.Add, k.Edit, k.Delete, k.Back}
+}
+
+func (k bentoKeyMap) FullHelp() [][]key.Binding {
+	return [][]key.Binding{
+		{k.Up, k.Down},
+		{k.Reveal, k.Copy},
+		{k.Add, k.Edit, k.Delete},
+		{k.Refresh, k.Back},
+	}
+}
+
+// bentoPage shows the ingredients of a bento. The server masks the values, they are only
+// fetched by a reveal or a copy, which the server records in the audit log of the bento.
+type bentoPage struct {
+	bentoID string
+	bento   *api.GetBentoResponse
+	cursor  int
+	offset  int
+	// revealed has the values of the revealed ingredients by name
+	revealed map[string]string
+
+	mode     int
+	form     form
+	formKeys formKeyMap
+	// editing is the name of the ingredient being edited or deleted.
+	editing string
+
+	keys bentoKeyMap
+	help help.Model
+
+	loading bool
+	status  string
+	err     error
+
+	width  int
+	height int
+}
+
+func newBentoPage(params map[string]interface{}) bentoPage {
+	return bentoPage{
+		bentoID:  params[paramBentoID].(string),
+		revealed: map[string]string{},
+		formKeys: newFormKeyMap(),
+		keys: bentoKeyMap{
+			Up: key.NewBinding(
+				key.WithKeys("up", "k"),
+				key.WithHelp("↑/k", "Up"),
+			),
+			Down: key.NewBinding(
+				key.WithKeys("down", "j"),
+				key.WithHelp("↓/j", "Down"),
+			),
+			Reveal: key.NewBinding(
+				key.WithKeys("v"),
+				key.WithHelp("v", "Reveal/hide"),
+			),
+			Copy: key.NewBinding(
+				key.WithKeys("c"),
+				key.WithHelp("c", "Copy"),
+			),
+			Add: key.NewBinding(
+				key.WithKeys("a"),
+				key.WithHelp("a", "Add"),
+			),
+			Edit: key.NewBinding(
+				key.WithKeys("e"),
+				key.WithHelp("e", "Edit"),
+			),
+			Delete: key.NewBinding(
+				key.WithKeys("d"),
+				key.WithHelp("d", "Delete"),
+			),
+			Refresh: key.NewBinding(
+				key.WithKeys("r"),
+				key.WithHelp("r", "Refresh"),
+			),
+			Back: key.NewBinding(
+				key.WithKeys("esc"),
+				key.WithHelp("esc", "Back to bentos"),
+			),
+		},
+		help:    help.New(),
+		loading: true,
+		width:   params[paramAppWidth].(int),
+		height:  params[paramAppHeight].(int),
+	}
+}
+
+func (m bentoPage) Init() tea.Cmd {
+	return m.load
+}
+
+func (m bentoPage) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+		m.height = msg.Height
+		return m.scroll(), nil
+	case tea.KeyMsg:
+		if m.loading {
+			return m, nil
+		}
+		switch m.mode {
+		case bentoModeAdd, bentoModeEdit:
+			return m.updateForm(msg)
+		case bentoModeDelete:
+			return m.updateDelete(msg)
+		}
+		return m.updateView(msg)
+	case bentoMsg:
+		m.loading = false
+		if msg.err != nil {
+			m.err = msg.err
+			return m, nil
+		}
+		if m.bento != nil && m.bento.Revision != msg.bento.Revision {
+			// the revealed values may have changed, they are revealed again on demand
+			m.revealed = map[string]string{}
+		}
+		m.bento = msg.bento
+		m.cursor = min(m.cursor, max(len(m.bento.Ingredients)-1, 0))
+		return m.scroll(), nil
+	case revealMsg:
+		m.loading = false
+		if msg.err != nil {
+			m.err = msg.err
+			return m, nil
+		}
+		m.revealed[msg.name] = msg.value
+		return m, nil
+	case copyMsg:
+		m.loading = false
+		if msg.err != nil {
+			m.err = msg.err
+			return m, nil
+		}
+		timeout := services.ClipboardTimeout()
+		m.status = fmt.Sprintf("Copied %s, the clipboard is cleared in %s.", msg.name, timeout)
+		return m, tea.Tick(timeout, func(time.Time) tea.Msg {
+			return clipboardClearMsg{value: msg.value}
+		})
+	case clipboardClearMsg:
+		// the app clears the clipboard, the page only tells the user
+		if strings.HasPrefix(m.status, "Copied ") {
+			m.status = "Clipboard cleared."
+		}
+		return m, nil
+	case bentoChangedMsg:
+		m.loading = false
+		if msg.err != nil {
+			if errors.Is(msg.err, services.ErrBentoChangeAborted) {
+				m.mode = bentoModeView
+				m.err = errors.New("The bento was changed by someone else and was reloaded, try again.")
+				m.loading = true
+				return m, m.load
+			}
+			m.err = msg.err
+			if m.mode == bentoModeDelete {
+				m.mode = bentoModeView
+			} else {
+				m.form, _ = m.form.SetErrors(msg.err)
+			}
+			return m, nil
+		}
+		if m.mode == bentoModeDelete {
+			delete(m.revealed, m.editing)
+		}
+		m.mode = bentoModeView
+		m.status = msg.status
+		m.loading = true
+		return m, m.load
+	}
+
+	if m.mode == bentoModeAdd || m.mode == bentoModeEdit {
+		var cmd tea.Cmd
+		m.form, cmd = m.form.Update(msg)
+		return m, cmd
+	}
+	return m, nil
+}
+
+func (m bentoPage) updateView(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	ingredient, selected := m.selected()
+
+	switch {
+	case key.Matches(msg, m.keys.Back):
+		return m, router.NewNavigationMsg(pageBentos, nil)
+	case key.Matches(msg, m.keys.Up):
+		m.cursor = max(m.cursor-1, 0)
+		return m.scroll(), nil
+	case key.Matches(msg, m.keys.Down):
+		if m.bento != nil {
+			m.cursor = min(m.cursor+1, max(len(m.bento.Ingredients)-1, 0))
+		}
+		return m.scroll(), nil
+	case key.Matches(msg, m.keys.Refresh):
+		m.loading = true
+		m.err = nil
+		return m, m.load
+	case key.Matches(msg, m.keys.Add):
+		if m.bento == nil {
+			return m, nil
+		}
+		m.mode = bentoModeAdd
+		m.err = nil
+		m.status = ""
+		m.form = newForm(
+			newFormField("name", "Name", "API_KEY", false),
+			newFormField("value", "Value", "", true),
+		)
+		return m, nil
+	}
+
+	if !selected {
+		return m, nil
+	}
+	m.err = nil
+	m.status = ""
+
+	switch {
+	case key.Matches(msg, m.keys.Reveal):
+		if _, ok := m.revealed[ingredient.Name]; ok {
+			delete(m.revealed, ingredient.Name)
+			return m, nil
+		}
+		m.loading = true
+		return m, m.reveal(ingredient.Name)
+	case key.Matches(msg, m.keys.Copy):
+		m.loading = true
+		return m, m.copyValue(ingredient)
+	case key.Matches(msg, m.keys.Edit):
+		_, revealed := m.revealed[ingredient.Name]
+		m.mode = bentoModeEdit
+		m.editing = ingredient.Name
+		m.form = newForm(newFormField("value", "New value of "+ingredient.Name, "", !revealed))
+		return m, nil
+	case key.Matches(msg, m.keys.Delete):
+		m.mode = bentoModeDelete
+		m.editing = ingredient.Name
+		return m, nil
+	}
+	return m, nil
+}
+
+func (m bentoPage) updateForm(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch {
+	case key.Matches(msg, m.formKeys.Back):
+		m.mode = bentoModeView
+		m.err = nil
+		return m, nil
+	case key.Matches(msg, m.formKeys.Next):
+		m.form = m.form.Focus(m.form.focus + 1)
+		return m, nil
+	case key.Matches(msg, m.formKeys.Prev):
+		m.form = m.form.Focus(m.form.focus - 1)
+		return m, nil
+	case key.Matches(msg, m.formKeys.Submit):
+		if !m.form.Last() {
+			m.form = m.form.Focus(m.form.focus + 1)
+			return m, nil
+		}
+
+		m.err = nil
+		if m.mode == bentoModeEdit {
+			m.loading = true
+			return m, m.change(services.BentoChange{
+				Set:     map[string]string{m.editing: m.form.Value("value")},
+				Replace: true,
+			}, fmt.Sprintf("Updated %s.", m.editing))
+		}
+
+		name := strings.TrimSpace(m.form.Value("name"))
+		if name == "" {
+			m.form = m.form.SetFieldError("name", "The name is required")
+			return m, nil
+		}
+		for _, ing := range m.bento.Ingredients {
+			if ing.Name == name {
+				m.form = m.form.SetFieldError("name", "There is an ingredient with this name already, edit it instead")
+				return m, nil
+			}
+		}
+		m.loading = true
+		return m, m.change(services.BentoChange{
+			Set: map[string]string{name: m.form.Value("value")},
+		}, fmt.Sprintf("Added %s.", name))
+	}
+
+	var cmd tea.Cmd
+	m.form, cmd = m.form.Update(msg)
+	return m, cmd
+}
+
+func (m bentoPage) updateDelete(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "y", "Y":
+		m.loading = true
+		return m, m.change(services.BentoChange{Unset: []string{m.editing}}, fmt.Sprintf("Deleted %s.", m.editing))
+	case "n", "N", "esc":
+		m.mode = bentoModeView
+	}
+	return m, nil
+}
+
+// selected returns the ingredient under the cursor.
+func (m bentoPage) selected() (api.BentoIngredient, bool) {
+	if m.bento == nil || m.cursor >= len(m.bento.Ingredients) {
+		return api.BentoIngredient{}, false
+	}
+	return m.bento.Ingredients[m.cursor], true
+}
+
+// rows is the number of ingredients that fit in the page.
+func (m bentoPage) rows() int {
+	// leave room for the title, the status line and the help
+	return max(m.height-8, 3)
+}
+
+// scroll moves the visible ingredients so that the cursor is in view.
+func (m bentoPage) scroll() bentoPage {
+	rows := m.rows()
+	if m.cursor < m.offset {
+		m.offset = m.cursor
+	}
+	if m.cursor >= m.offset+rows {
+		m.offset = m.cursor - rows + 1
+	}
+	return m
+}
+
+func (m bentoPage) View() string {
+	if m.bento == nil {
+		if m.err != nil {
+			return strings.Join([]string{
+				errTextStyle.Render(m.err.Error()),
+				m.help.View(m.keys),
+			}, "\n\n")
+		}
+		return "Loading bento..."
+	}
+
+	parts := []string{
+		formLabelStyle.Render(m.bento.Name) + fmt.Sprintf(" (revision %d)", m.bento.Revision),
+	}
+
+	switch m.mode {
+	case bentoModeAdd, bentoModeEdit:
+		parts = append(parts, m.form.View())
+	default:
+		parts = append(parts, m.ingredientsView())
+	}
+
+	switch {
+	case m.loading:
+		parts = append(parts, "Loading...")
+	case m.err != nil:
+		parts = append(parts, errTextStyle.Render(formErrorMessage(m.err)))
+	case m.mode == bentoModeDelete:
+		parts = append(parts, fmt.Sprintf("Delete %s? [y/N]", m.editing))
+	case m.status != "":
+		parts = append(parts, m.status)
+	}
+
+	switch m.mode {
+	case bentoModeAdd, bentoModeEdit:
+		parts = append(parts, m.help.View(m.formKeys))
+	default:
+		parts = append(parts, m.help.View(m.keys))
+	}
+
+	return strings.Join(parts, "\n\n")
+}
+
+func (m bentoPage) ingredientsView() string {
+	if len(m.bento.Ingredients) == 0 {
+		return "No ingredients yet, press a to add one."
+	}
+
+	width := 0
+	for _, ing := range m.bento.Ingredients {
+		width = max(width, len(ing.Name))
+	}
+
+	end := min(m.offset+m.rows(), len(m.bento.Ingredients))
+	lines := make([]string, 0, end-m.offset)
+	for i := m.offset; i < end; i++ {
+		ing := m.bento.Ingredients[i]
+		value, ok := m.revealed[ing.Name]
+		if ok {
+			// keep multi-line values on one line
+			value = strings.NewReplacer("\n", `\n`, "\r", `\r`).Replace(value)
+		} else {
+			value = maskedValue
+		}
+		line := fmt.Sprintf("%-*s  %s", width, ing.Name, value)
+		if m.width > 2 {
+			line = truncate(line, m.width-2)
+		}
+		if i == m.cursor {
+			lines = append(lines, formLabelStyle.Render("> "+line))
+		} else {
+			lines = append(lines, "  "+line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// truncate cuts s to at most n runes.
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:max(n-1, 0)]) + "…"
+}
+
+type bentoMsg struct {
+	bento *api.GetBentoResponse
+	err   error
+}
+
+func (m bentoPage) load() tea.Msg {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	bento, err := services.NewClient().GetBento(ctx, m.bentoID)
+	if err != nil {
+		return bentoMsg{err: err}
+	}
+	sort.Slice(bento.Ingredients, func(i, j int) bool {
+		return bento.Ingredients[i].Name < bento.Ingredients[j].Name
+	})
+	return bentoMsg{bento: bento}
+}
+
+type revealMsg struct {
+	name  string
+	value string
+	err   error
+}
+
+// reveal gets the value of an ingredient, the server records the reveal.
+func (m bentoPage) reveal(name string) tea.Cmd {
+	bentoID := m.bento.BentoID
+	return func() tea.Msg {
+		value, err := revealValue(bentoID, name)
+		return revealMsg{name: name, value: value, err: err}
+	}
+}
+
+func revealValue(bentoID string, name string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	bento, err := services.NewClient().RevealIngredients(ctx, bentoID, []string{name})
+	if err != nil {
+		return "", err
+	}
+	for _, ing := range bento.Ingredients {
+		if ing.Name == name {
+			return ing.Value, nil
+		}
+	}
+	return "", fmt.Errorf("Ingredient %q not found in bento.", name)
+}
+
+type copyMsg struct {
+	name  string
+	value string
+	err   error
+}
+
+// copyValue gets the value of an ingredient like reveal and copies it to the clipboard.
+func (m bentoPage) copyValue(ingredient api.BentoIngredient) tea.Cmd {
+	bentoID := m.bento.BentoID
+	return func() tea.Msg {
+		value, err := revealValue(bentoID, ingredient.Name)
+		if err == nil {
+			err = clipboard.Copy(value)
+		}
+		return copyMsg{name: ingredient.Name, value: value, err: err}
+	}
+}
+
+type bentoChangedMsg struct {
+	status string
+	err    error
+}
+
+// change applies the change on top of the loaded revision. Changes made by someone else in
+// the meantime abort it, the page is reloaded so that the user can see them first.
+func (m bentoPage) change(change services.BentoChange, status string) tea.Cmd {
+	bento := m.bento
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		_, err := services.ApplyBentoChange(ctx, services.NewClient(), bento, change, func(services.BentoConflict) (bool, error) {
+			return false, nil
+		})
+		return bentoChangedMsg{status: status, err: err}
+	}
+}
@@ -0,0 +1,136 @@
+package tui
+
+import (
+	"context"
+	"github.com/juancwu/konbini/cli/router"
+	"github.com/juancwu/konbini/cli/services"
+	"github.com/juancwu/konbini/common/api"
+	"time"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// bentoItem is a bento in the list of bentos.
+type bentoItem struct {
+	bento api.ListBentosResponse
+}
+
+func (i bentoItem) Title() string       { return i.bento.BentoName }
+func (i bentoItem) Description() string { return i.bento.BentoID + " · updated " + i.bento.UpdatedAt }
+func (i bentoItem) FilterValue() string { return i.bento.BentoName }
+
+type bentosKeyMap struct {
+	Open    key.Binding
+	Refresh key.Binding
+	Back    key.Binding
+}
+
+// bentos lists the bentos of the user, type / to filter them by name.
+type bentos struct {
+	list list.Model
+	keys bentosKeyMap
+
+	width  int
+	height int
+}
+
+func newBentos(params map[string]interface{}) bentos {
+	width := params[paramAppWidth].(int)
+	height := params[paramAppHeight].(int)
+
+	keys := bentosKeyMap{
+		Open: key.NewBinding(
+			key.WithKeys("enter"),
+			key.WithHelp("enter", "Open"),
+		),
+		Refresh: key.NewBinding(
+			key.WithKeys("r"),
+			key.WithHelp("r", "Refresh"),
+		),
+		Back: key.NewBinding(
+			key.WithKeys("esc"),
+			key.WithHelp("esc", "Back to menu"),
+		),
+	}
+
+	l := list.New([]list.Item{}, list.NewDefaultDelegate(), width, height)
+	l.Title = "Bentos"
+	l.SetStatusBarItemName("bento", "bentos")
+	l.AdditionalShortHelpKeys = func() []key.Binding {
+		return []key.Binding{keys.Open, keys.Refresh, keys.Back}
+	}
+	// the spinner runs until the bentos are loaded, Init only starts its ticks
+	l.StartSpinner()
+
+	return bentos{
+		list:   l,
+		keys:   keys,
+		width:  width,
+		height: height,
+	}
+}
+
+func (m bentos) Init() tea.Cmd {
+	return tea.Batch(m.list.StartSpinner(), m.load)
+}
+
+func (m bentos) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+		m.height = msg.Height
+		m.list.SetSize(m.width, m.height)
+		return m, nil
+	case tea.KeyMsg:
+		// keys are typed into the filter while filtering
+		if m.list.FilterState() == list.Filtering {
+			break
+		}
+		switch {
+		case key.Matches(msg, m.keys.Open):
+			if item, ok := m.list.SelectedItem().(bentoItem); ok {
+				return m, router.NewNavigationMsg(pageBento, map[string]interface{}{
+					paramBentoID: item.bento.BentoID,
+				})
+			}
+			return m, nil
+		case key.Matches(msg, m.keys.Refresh):
+			return m, tea.Batch(m.list.StartSpinner(), m.load)
+		case key.Matches(msg, m.keys.Back) && m.list.FilterState() == list.Unfiltered:
+			return m, router.NewNavigationMsg(pageMenu, nil)
+		}
+	case bentosMsg:
+		m.list.StopSpinner()
+		if msg.err != nil {
+			return m, m.list.NewStatusMessage(errTextStyle.Render(msg.err.Error()))
+		}
+		items := make([]list.Item, len(msg.bentos))
+		for i, bento := range msg.bentos {
+			items[i] = bentoItem{bento: bento}
+		}
+		return m, m.list.SetItems(items)
+	}
+
+	var cmd tea.Cmd
+	m.list, cmd = m.list.Update(msg)
+	return m, cmd
+}
+
+func (m bentos) View() string {
+	return m.list.View()
+}
+
+type bentosMsg struct {
+	bentos []api.ListBentosResponse
+	err    error
+}
+
+func (m bentos) load() tea.Msg {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	res, err := services.NewClient().ListBentos(ctx)
+	return bentosMsg{bentos: res, err: err}
+}
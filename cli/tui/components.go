@@ -1,6 +1,15 @@
 package tui
 
-import "github.com/charmbracelet/bubbles/spinner"
+import (
+	"errors"
+	"github.com/juancwu/konbini/common/api"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/spinner"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
 
 // newSpinner returns a new spinner.Model
 func newSpinner() spinner.Model {
@@ -8,3 +17,171 @@ func newSpinner() spinner.Model {
 	s.Spinner = spinner.Dot
 	return s
 }
+
+// formField is a labelled text input. The name must match the json field
+// of the request so that validation errors from the server can be shown
+// next to the input that caused them.
+type formField struct {
+	name  string
+	label string
+	input textinput.Model
+	err   string
+}
+
+// newFormField creates a form field, set password to hide the typed characters.
+func newFormField(name string, label string, placeholder string, password bool) formField {
+	input := textinput.New()
+	input.Placeholder = placeholder
+	input.Prompt = "> "
+	if password {
+		input.EchoMode = textinput.EchoPassword
+		input.EchoCharacter = '•'
+	}
+	return formField{name: name, label: label, input: input}
+}
+
+func (f formField) View() string {
+	if f.err == "" {
+		return formLabelStyle.Render(f.label) + "\n" + f.input.View()
+	}
+	return strings.Join([]string{
+		errTextStyle.Bold(true).Render(f.label),
+		errInputStyle.Render(f.input.View()),
+		errTextStyle.Render(f.err),
+	}, "\n")
+}
+
+// form is a list of fields where one field has focus at a time.
+type form struct {
+	fields []formField
+	focus  int
+}
+
+func newForm(fields ...formField) form {
+	f := form{fields: fields}
+	f.fields[0].input.Focus()
+	return f
+}
+
+// Update forwards the message to the focused input.
+func (f form) Update(msg tea.Msg) (form, tea.Cmd) {
+	var cmd tea.Cmd
+	f.fields[f.focus].input, cmd = f.fields[f.focus].input.Update(msg)
+	return f, cmd
+}
+
+// Focus moves the focus to the field at index i.
+func (f form) Focus(i int) form {
+	f.fields[f.focus].input.Blur()
+	f.focus = (i + len(f.fields)) % len(f.fields)
+	f.fields[f.focus].input.Focus()
+	return f
+}
+
+// Last reports whether the focused field is the last one.
+func (f form) Last() bool {
+	return f.focus == len(f.fields)-1
+}
+
+// Value gets the value of the field with the given name.
+func (f form) Value(name string) string {
+	for _, field := range f.fields {
+		if field.name == name {
+			return field.input.Value()
+		}
+	}
+	return ""
+}
+
+// SetErrors highlights the fields that failed validation on the server and
+// focuses the first one. It returns false when err has no field errors.
+func (f form) SetErrors(err error) (form, bool) {
+	fieldErrors := map[string]string{}
+	var errRes *api.ErrorResponse
+	if errors.As(err, &errRes) {
+		fieldErrors = errRes.FieldErrors()
+	}
+
+	first := -1
+	for i := range f.fields {
+		f.fields[i].err = fieldErrors[f.fields[i].name]
+		if f.fields[i].err != "" && first < 0 {
+			first = i
+		}
+	}
+	if first < 0 {
+		return f, false
+	}
+	return f.Focus(first), true
+}
+
+// SetFieldError highlights a single field with the given message and focuses it.
+// Errors on the other fields are cleared.
+func (f form) SetFieldError(name string, message string) form {
+	focus := f.focus
+	for i := range f.fields {
+		f.fields[i].err = ""
+		if f.fields[i].name == name {
+			f.fields[i].err = message
+			focus = i
+		}
+	}
+	return f.Focus(focus)
+}
+
+func (f form) View() string {
+	views := make([]string, len(f.fields))
+	for i, field := range f.fields {
+		views[i] = field.View()
+	}
+	return strings.Join(views, "\n\n")
+}
+
+type formKeyMap struct {
+	Next   key.Binding
+	Prev   key.Binding
+	Submit key.Binding
+	Back   key.Binding
+}
+
+func (k formKeyMap) ShortHelp() []key.Binding {
+	return []key.Binding{k.Next, k.Prev, k.Submit, k.Back}
+}
+
+func (k formKeyMap) FullHelp() [][]key.Binding {
+	return [][]key.Binding{
+		{k.Next, k.Prev},
+		{k.Submit, k.Back},
+	}
+}
+
+func newFormKeyMap() formKeyMap {
+	return formKeyMap{
+		Next: key.NewBinding(
+			key.WithKeys("tab", "down"),
+			key.WithHelp("tab", "Next field"),
+		),
+		Prev: key.NewBinding(
+			key.WithKeys("shift+tab", "up"),
+			key.WithHelp("shift+tab", "Previous field"),
+		),
+		Submit: key.NewBinding(
+			key.WithKeys("enter"),
+			key.WithHelp("enter", "Submit"),
+		),
+		Back: key.NewBinding(
+			key.WithKeys("esc"),
+			key.WithHelp("esc", "Back to menu"),
+		),
+	}
+}
+
+// formErrorMessage gets the message shown below a form. Field errors are already
+// shown next to their inputs, so only the summary of the error response is used.
+func formErrorMessage(err error) string {
+	var errRes *api.ErrorResponse
+	if errors.As(err, &errRes) && len(errRes.Errors) > 0 {
+		return errRes.Message
+	}
+	return err.Error()
+}
@@ -1 +1,136 @@
 package tui
+
+import (
+	"fmt"
+	"github.com/juancwu/konbini/cli/config"
+	"github.com/juancwu/konbini/cli/router"
+	"github.com/juancwu/konbini/cli/services"
+	"github.com/juancwu/konbini/common/api"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/help"
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+type login struct {
+	form    form
+	keys    formKeyMap
+	help    help.Model
+	loading bool
+
+	err error
+}
+
+func newLogin(_ map[string]interface{}) login {
+	return login{
+		form: newForm(
+			newFormField("email", "Email", "you@example.com", false),
+			newFormField("password", "Password", "", true),
+			newFormField("totp_code", "TOTP Code", "leave empty if TOTP is not set up", false),
+		),
+		keys: newFormKeyMap(),
+		help: help.New(),
+	}
+}
+
+func (m login) Init() tea.Cmd {
+	return nil
+}
+
+func (m login) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		if m.loading {
+			return m, nil
+		}
+		switch {
+		case key.Matches(msg, m.keys.Back):
+			return m, router.NewNavigationMsg(pageMenu, nil)
+		case key.Matches(msg, m.keys.Next):
+			m.form = m.form.Focus(m.form.focus + 1)
+			return m, nil
+		case key.Matches(msg, m.keys.Prev):
+			m.form = m.form.Focus(m.form.focus - 1)
+			return m, nil
+		case key.Matches(msg, m.keys.Submit):
+			if !m.form.Last() {
+				m.form = m.form.Focus(m.form.focus + 1)
+				return m, nil
+			}
+			m.loading = true
+			m.err = nil
+			return m, m.submit
+		}
+	case loginMsg:
+		m.loading = false
+		if msg.err != nil {
+			m.err = msg.err
+			m.form = m.highlightError(msg.err)
+			return m, nil
+		}
+		return m, router.NewNavigationMsg(pageMenu, nil)
+	}
+
+	var cmd tea.Cmd
+	m.form, cmd = m.form.Update(msg)
+	return m, cmd
+}
+
+func (m login) View() string {
+	parts := []string{
+		"Sign in to your account",
+		m.form.View(),
+	}
+
+	if m.loading {
+		parts = append(parts, "Signing in...")
+	} else if m.err != nil {
+		parts = append(parts, errTextStyle.Render(formErrorMessage(m.err)))
+	}
+
+	parts = append(parts, m.help.View(m.keys))
+
+	return strings.Join(parts, "\n\n")
+}
+
+// highlightError points the user to the input that needs to change based on the error code.
+func (m login) highlightError(err error) form {
+	switch {
+	case api.IsErrorCode(err, api.ErrorCodeTOTPRequired):
+		return m.form.SetFieldError("totp_code", "Enter the code from your authenticator app or a recovery code")
+	case api.IsErrorCode(err, api.ErrorCodeInvalidTOTPCode),
+		api.IsErrorCode(err, api.ErrorCodeInvalidRecoveryCode),
+		api.IsErrorCode(err, api.ErrorCodeRecoveryCodeUsed):
+		return m.form.SetFieldError("totp_code", formErrorMessage(err))
+	case api.IsErrorCode(err, api.ErrorCodeInvalidCredentials):
+		return m.form.SetFieldError("password", "Invalid email or password")
+	}
+	f, _ := m.form.SetErrors(err)
+	return f
+}
+
+type loginMsg struct {
+	err error
+}
+
+func (m login) submit() tea.Msg {
+	res, err := services.Login(
+		m.form.Value("email"),
+		m.form.Value("password"),
+		m.form.Value("totp_code"),
+	)
+	if err != nil {
+		return loginMsg{err: err}
+	}
+
+	if err := services.SaveToken(res.Token); err != nil {
+		return loginMsg{err: fmt.Errorf("Failed to store the auth token: %w", err)}
+	}
+	config.SetAuth(config.Auth{
+		Token:     res.Token,
+		TokenType: res.Type,
+	})
+
+	return loginMsg{}
+}
@@ -2,6 +2,7 @@ package tui
 
 import (
 	"github.com/juancwu/konbini/cli/config"
+	"github.com/juancwu/konbini/cli/router"
 
 	"github.com/charmbracelet/bubbles/list"
 	tea "github.com/charmbracelet/bubbletea"
@@ -58,7 +59,7 @@ func newMenu(params map[string]interface{}) Menu {
 			menuItem{
 				title:       "Manage Bentos",
 				description: "View and manage your bento configurations",
-				route:       "bentos", // Add this route when ready
+				route:       pageBentos,
 			},
 			menuItem{
 				title:       "Manage Groups",
@@ -92,6 +93,11 @@ func (m Menu) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.list.SetSize(m.width, m.height)
 		return m, nil
 	case tea.KeyMsg:
+		if msg.Type == tea.KeyEnter && m.list.FilterState() != list.Filtering {
+			if item, ok := m.list.SelectedItem().(menuItem); ok {
+				return m, router.NewNavigationMsg(item.route, nil)
+			}
+		}
 		var cmd tea.Cmd
 		m.list, cmd = m.list.Update(msg)
 		return m, cmd
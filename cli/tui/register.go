@@ -1 +1,124 @@
 package tui
+
+import (
+	"fmt"
+	"github.com/juancwu/konbini/cli/config"
+	"github.com/juancwu/konbini/cli/router"
+	"github.com/juancwu/konbini/cli/services"
+	"github.com/juancwu/konbini/common/api"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/help"
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+type register struct {
+	form    form
+	keys    formKeyMap
+	help    help.Model
+	loading bool
+
+	err error
+}
+
+func newRegister(_ map[string]interface{}) register {
+	return register{
+		form: newForm(
+			newFormField("email", "Email", "you@example.com", false),
+			newFormField("nickname", "Nickname", "3 to 32 characters", false),
+			newFormField("password", "Password", "12 to 32 characters", true),
+		),
+		keys: newFormKeyMap(),
+		help: help.New(),
+	}
+}
+
+func (m register) Init() tea.Cmd {
+	return nil
+}
+
+func (m register) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		if m.loading {
+			return m, nil
+		}
+		switch {
+		case key.Matches(msg, m.keys.Back):
+			return m, router.NewNavigationMsg(pageMenu, nil)
+		case key.Matches(msg, m.keys.Next):
+			m.form = m.form.Focus(m.form.focus + 1)
+			return m, nil
+		case key.Matches(msg, m.keys.Prev):
+			m.form = m.form.Focus(m.form.focus - 1)
+			return m, nil
+		case key.Matches(msg, m.keys.Submit):
+			if !m.form.Last() {
+				m.form = m.form.Focus(m.form.focus + 1)
+				return m, nil
+			}
+			m.loading = true
+			m.err = nil
+			return m, m.submit
+		}
+	case registerMsg:
+		m.loading = false
+		if msg.err != nil {
+			m.err = msg.err
+			if api.IsErrorCode(msg.err, api.ErrorCodeEmailTaken) {
+				m.form = m.form.SetFieldError("email", "Email has already been taken")
+			} else {
+				m.form, _ = m.form.SetErrors(msg.err)
+			}
+			return m, nil
+		}
+		return m, router.NewNavigationMsg(pageVerifyEmail, nil)
+	}
+
+	var cmd tea.Cmd
+	m.form, cmd = m.form.Update(msg)
+	return m, cmd
+}
+
+func (m register) View() string {
+	parts := []string{
+		"Create a new account",
+		m.form.View(),
+	}
+
+	if m.loading {
+		parts = append(parts, "Creating account...")
+	} else if m.err != nil {
+		parts = append(parts, errTextStyle.Render(formErrorMessage(m.err)))
+	}
+
+	parts = append(parts, m.help.View(m.keys))
+
+	return strings.Join(parts, "\n\n")
+}
+
+type registerMsg struct {
+	err error
+}
+
+func (m register) submit() tea.Msg {
+	res, err := services.Register(
+		m.form.Value("email"),
+		m.form.Value("nickname"),
+		m.form.Value("password"),
+	)
+	if err != nil {
+		return registerMsg{err: err}
+	}
+
+	if err := services.SaveToken(res.AuthToken); err != nil {
+		return registerMsg{err: fmt.Errorf("Failed to store the auth token: %w", err)}
+	}
+	config.SetAuth(config.Auth{
+		Token:     res.AuthToken,
+		TokenType: res.TokenType,
+	})
+
+	return registerMsg{}
+}
@@ -6,4 +6,10 @@ var (
 	menuItemStyle = lipgloss.NewStyle().PaddingLeft(2).PaddingRight(2)
 
 	errTextStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#ff0000"))
+
+	formLabelStyle = lipgloss.NewStyle().Bold(true)
+	errInputStyle  = lipgloss.NewStyle().
+			BorderStyle(lipgloss.NormalBorder()).
+			BorderLeft(true).
+			BorderForeground(lipgloss.Color("#ff0000"))
 )
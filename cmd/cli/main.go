@@ -1,11 +1,14 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 
 	command "github.com/juancwu/konbini/cli/commands"
 	"github.com/juancwu/konbini/cli/config"
+	"github.com/juancwu/konbini/cli/services"
+	"github.com/juancwu/konbini/cli/telemetry"
 
 	tea "github.com/charmbracelet/bubbletea"
 
@@ -13,18 +16,34 @@ import (
 )
 
 func main() {
-	config.Init()
+	shutdownTelemetry, err := telemetry.Init(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer shutdownTelemetry(context.Background())
+
 	if len(os.Args) == 1 {
+		if err := config.Load(""); err != nil {
+			log.Fatal(err)
+		}
+		// the passphrase of the credentials file can't be prompted for once the TUI owns the terminal
+		if err := services.UnlockCredentials(); err != nil {
+			log.Fatal(err)
+		}
 		m := tui.New()
 		p := tea.NewProgram(m, tea.WithAltScreen())
-		_, err := p.Run()
+		_, err = p.Run()
+		// copied values must not stay in the clipboard after quitting
+		tui.ClearClipboard()
 		if err != nil {
 			log.Fatal(err)
 		}
 	} else {
-		err := command.Execute()
+		err = command.Execute()
 		if err != nil {
-			log.Fatal(err)
+			// the error was already printed
+			shutdownTelemetry(context.Background())
+			os.Exit(command.ExitCode(err))
 		}
 	}
 }
@@ -1,13 +1,25 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"github.com/juancwu/konbini/server/config"
 	"github.com/juancwu/konbini/server/db"
+	"github.com/juancwu/konbini/server/events"
 	"github.com/juancwu/konbini/server/handlers"
+	"github.com/juancwu/konbini/server/memcache"
+	"github.com/juancwu/konbini/server/metrics"
+	"github.com/juancwu/konbini/server/middlewares"
 	"github.com/juancwu/konbini/server/routes"
+	"github.com/juancwu/konbini/server/services"
+	"github.com/juancwu/konbini/server/tracing"
 	inner_validator "github.com/juancwu/konbini/server/validator"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
-	"github.com/go-playground/validator/v10"
 	"github.com/labstack/echo/v4"
 	"github.com/rs/zerolog/log"
 )
@@ -18,28 +30,147 @@ func main() {
 		log.Fatal().Err(err).Msg("Failed to load server configuration")
 	}
 
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to setup tracing")
+	}
+
 	dbUrl, dbAuthToken := cfg.GetDatabaseConfig()
+	connector := db.NewConnector(dbUrl, dbAuthToken)
+
+	cache, err := memcache.New(cfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to create cache")
+	}
+	memcache.SetCache(cache)
+
+	emailSender, err := services.NewEmailSender(cfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to create email sender")
+	}
+
+	// outbound emails are persisted and delivered in the background
+	queueConfig := services.DefaultEmailQueueConfig()
+	queueConfig.Workers = cfg.GetEmailQueueWorkers()
+	queueConfig.MaxAttempts = cfg.GetEmailMaxAttempts()
+	emailQueue := services.NewEmailQueue(
+		services.NewDBEmailJobStore(connector),
+		emailSender,
+		queueConfig,
+	)
+	emailQueue.Start(context.Background())
+	services.SetDefaultEmailQueue(emailQueue)
+
+	// webhook deliveries are persisted and retried in the background like emails
+	webhookQueue := services.NewWebhookQueue(
+		services.NewDBWebhookDeliveryStore(connector, cfg.GetAesKey()),
+		nil,
+		services.DefaultWebhookQueueConfig(),
+	)
+	webhookQueue.Start(context.Background())
+
+	// handlers publish their events to the bus, async subscribers get them from the outbox
+	// once the transaction of the change commits
+	bus := events.NewBus(events.NewDBOutboxStore(connector), events.DefaultBusConfig())
+	services.SubscribeWebhooks(bus, connector, webhookQueue)
+	services.SubscribeEmails(bus, connector)
+	services.SubscribeAudit(bus)
+	bus.Start(context.Background())
+	events.SetDefaultBus(bus)
+
+	// the server stops on SIGINT or SIGTERM, the cleanups stop with it
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	events.StartOutboxCleanup(ctx, connector, time.Hour, time.Hour*24*7)
+
+	// expired and used email verification tokens are removed in the background
+	services.StartEmailTokenCleanup(ctx, connector, time.Hour)
 
 	e := echo.New()
 
-	validate := validator.New()
-	cv := inner_validator.Validator{Validator: validate}
-	e.Validator = &cv
+	e.Validator = inner_validator.New()
+	e.JSONSerializer = middlewares.TracedJSONSerializer{}
 
 	// set global error handler
 	e.HTTPErrorHandler = handlers.ErrorHandler()
 
+	// every request gets an id, including the ones that don't match a route
+	e.Use(middlewares.RequestID())
+	e.Use(middlewares.Tracing())
+	e.Use(middlewares.Metrics())
+
+	// metrics are served on their own listener so they are not exposed with the api
+	var metricsServer *http.Server
+	if addr := cfg.GetMetricsAddress(); addr != "" {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("/metrics", metrics.Handler())
+		metricsServer = &http.Server{Addr: addr, Handler: metricsMux}
+		go func() {
+			if err := metricsServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Error().Err(err).Msg("Failed to start metrics server.")
+			}
+		}()
+	}
+
+	// probes are served outside of the api group so they are not logged
+	healthChecker := services.NewHealthChecker(
+		cfg.GetVersion(),
+		time.Second*5,
+		time.Second*3,
+		services.DatabaseCheck(connector),
+		services.MigrationCheck(connector, db.SchemaVersion),
+		services.CacheCheck(cache),
+		services.EmailTransportCheck(cfg),
+	)
+	e.GET("/livez", handlers.Livez(cfg))
+	e.GET("/readyz", handlers.Readyz(healthChecker))
+
 	// v1 routes
-	apiV1 := e.Group("/api/v1")
+	apiV1 := e.Group(routes.V1_PREFIX)
 	routeConfig := &routes.RouteConfig{
 		Echo:         apiV1,
 		ServerConfig: cfg,
-		DBConnector:  db.NewConnector(dbUrl, dbAuthToken),
+		DBConnector:  connector,
+		EmailQueue:   emailQueue,
+		WebhookQueue: webhookQueue,
+		Routes:       e.Routes,
 	}
 	routes.SetupRoutesV1(routeConfig)
 
-	err = e.Start(cfg.GetPort())
-	if err != nil {
-		log.Fatal().Err(err).Msg("Failed to start server.")
+	startErr := make(chan error, 1)
+	go func() {
+		startErr <- e.Start(cfg.GetPort())
+	}()
+	failed := false
+	select {
+	case err := <-startErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.Error().Err(err).Msg("Failed to start server.")
+			failed = true
+		}
+	case <-ctx.Done():
+	}
+
+	// in-flight requests finish before the queues stop, they may still enqueue emails, webhooks
+	// and events. The bus stops after the queues and the traces of all of them are flushed last.
+	log.Info().Msg("Shutting down server.")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+	if err := e.Shutdown(shutdownCtx); err != nil {
+		log.Error().Err(err).Msg("Failed to shutdown server.")
+	}
+	if metricsServer != nil {
+		if err := metricsServer.Shutdown(shutdownCtx); err != nil {
+			log.Error().Err(err).Msg("Failed to shutdown metrics server.")
+		}
+	}
+	emailQueue.Stop()
+	webhookQueue.Stop()
+	bus.Stop()
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		log.Error().Err(err).Msg("Failed to flush traces")
+	}
+	if failed {
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,236 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMaxRetries is the number of times a rate limited request is retried.
+	DefaultMaxRetries = 3
+	// DefaultMaxRetryWait is the longest the client waits before retrying a rate limited request.
+	// Requests that have to wait longer fail with the rate limited error right away.
+	DefaultMaxRetryWait = time.Second * 30
+	// DefaultRetryWait is used when a rate limited response has no valid Retry-After header.
+	DefaultRetryWait = time.Second
+)
+
+// Client is a typed client of the Konbini api. Errors returned by the api are
+// returned as *ErrorResponse, use IsErrorCode to branch on them.
+type Client struct {
+	baseURL      string
+	httpClient   *http.Client
+	maxRetries   int
+	maxRetryWait time.Duration
+
+	mu    sync.RWMutex
+	token string
+}
+
+// ClientOption configures a Client.
+type ClientOption func(*Client)
+
+// WithHTTPClient sets the http client used to send requests. Defaults to a client with a 30 seconds timeout.
+func WithHTTPClient(httpClient *http.Client) ClientOption {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithToken sets the auth token sent with every request.
+func WithToken(token string) ClientOption {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithMaxRetries sets how many times a rate limited request is retried. Use 0 to disable retries.
+func WithMaxRetries(n int) ClientOption {
+	return func(c *Client) {
+		c.maxRetries = n
+	}
+}
+
+// WithMaxRetryWait sets the longest the client waits before retrying a rate limited request.
+func WithMaxRetryWait(d time.Duration) ClientOption {
+	return func(c *Client) {
+		c.maxRetryWait = d
+	}
+}
+
+// NewClient creates a new client for the api at baseURL, i.e. "http://localhost:3000/api/v1".
+func NewClient(baseURL string, opts ...ClientOption) *Client {
+	c := &Client{
+		baseURL:      strings.TrimSuffix(baseURL, "/"),
+		httpClient:   &http.Client{Timeout: time.Second * 30},
+		maxRetries:   DefaultMaxRetries,
+		maxRetryWait: DefaultMaxRetryWait,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+type idempotencyKeyCtxKey struct{}
+
+// WithIdempotencyKey sets the Idempotency-Key sent with a mutating request. Reuse the same key
+// when retrying a request so that the server does not apply it twice. A new key is generated for
+// every call when the context has none, it is reused when a rate limited request is retried.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyCtxKey{}, key)
+}
+
+type ifMatchCtxKey struct{}
+
+// WithIfMatch sets the If-Match header sent with a request, use BentoETag to make a bento change
+// conditional. The request fails with ErrorCodeBentoChanged when the bento is at another revision.
+func WithIfMatch(ctx context.Context, etag string) context.Context {
+	return context.WithValue(ctx, ifMatchCtxKey{}, etag)
+}
+
+// SetToken sets the auth token sent with every request, i.e. after logging in.
+func (c *Client) SetToken(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token = token
+}
+
+// Token gets the auth token sent with every request.
+func (c *Client) Token() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.token
+}
+
+// do sends a request to the api. The request body is encoded as json when it is not nil
+// and a successful response is decoded into resBody when it is not nil. Rate limited
+// requests are retried after waiting for the duration in the Retry-After header.
+func (c *Client) do(ctx context.Context, method string, uri string, query url.Values, reqBody any, resBody any) error {
+	var body []byte
+	if reqBody != nil {
+		var err error
+		body, err = json.Marshal(reqBody)
+		if err != nil {
+			return err
+		}
+	}
+
+	target := c.baseURL + uri
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	idempotencyKey := ""
+	if method != http.MethodGet && method != http.MethodHead {
+		idempotencyKey, _ = ctx.Value(idempotencyKeyCtxKey{}).(string)
+		if idempotencyKey == "" {
+			var err error
+			idempotencyKey, err = newIdempotencyKey()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		var reader io.Reader
+		if body != nil {
+			reader = bytes.NewReader(body)
+		}
+		req, err := http.NewRequestWithContext(ctx, method, target, reader)
+		if err != nil {
+			return err
+		}
+		if body != nil {
+			req.Header.Set(HeaderContentType, MimeApplicationJson)
+		}
+		if token := c.Token(); token != "" {
+			req.Header.Set(HeaderAuthorization, Bearer(token))
+		}
+		if idempotencyKey != "" {
+			req.Header.Set(HeaderIdempotencyKey, idempotencyKey)
+		}
+		if etag, _ := ctx.Value(ifMatchCtxKey{}).(string); etag != "" {
+			req.Header.Set(HeaderIfMatch, etag)
+		}
+
+		res, err := c.httpClient.Do(req)
+		if err != nil {
+			return err
+		}
+		data, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		if res.StatusCode == http.StatusTooManyRequests && attempt < c.maxRetries {
+			wait := retryAfter(res.Header)
+			if wait <= c.maxRetryWait {
+				if err := sleep(ctx, wait); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+
+		if res.StatusCode < 200 || res.StatusCode >= 300 {
+			return ParseErrorResponse(res, data)
+		}
+		if resBody == nil || len(bytes.TrimSpace(data)) == 0 {
+			return nil
+		}
+		return json.Unmarshal(data, resBody)
+	}
+}
+
+// retryAfter reads the Retry-After header, it can either be a number of seconds or a http date.
+func retryAfter(header http.Header) time.Duration {
+	value := header.Get(HeaderRetryAfter)
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(date); wait > 0 {
+			return wait
+		}
+		return 0
+	}
+	return DefaultRetryWait
+}
+
+// sleep waits for d or until the context is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func newIdempotencyKey() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// withID replaces the :id parameter of a uri.
+func withID(uri string, id string) string {
+	return strings.Replace(uri, ":id", url.PathEscape(id), 1)
+}
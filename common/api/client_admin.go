@@ -0,0 +1,31 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// ListEmailJobs lists the email jobs with the given status. The server defaults to dead jobs
+// when status is empty and to 50 jobs when limit is 0.
+func (c *Client) ListEmailJobs(ctx context.Context, status string, limit int) ([]EmailJobResponse, error) {
+	query := url.Values{}
+	if status != "" {
+		query.Set("status", status)
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+
+	var res []EmailJobResponse
+	if err := c.do(ctx, http.MethodGet, UriEmailJobs, query, nil, &res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// RedriveEmailJob queues a dead email job to be sent again.
+func (c *Client) RedriveEmailJob(ctx context.Context, jobID string) error {
+	return c.do(ctx, http.MethodPost, withID(UriRedriveEmailJob, jobID), nil, nil, nil)
+}
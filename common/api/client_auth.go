@@ -0,0 +1,72 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// Register creates a new user. The token in the response is a partial token until TOTP is setup.
+func (c *Client) Register(ctx context.Context, req RegisterRequest) (*RegisterResponse, error) {
+	var res RegisterResponse
+	if err := c.do(ctx, http.MethodPost, UriRegister, nil, req, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Login signs in with email and password. The TOTP code, or a recovery code, is required once TOTP is setup.
+func (c *Client) Login(ctx context.Context, req LoginRequest) (*LoginResponse, error) {
+	var res LoginResponse
+	if err := c.do(ctx, http.MethodPost, UriLogin, nil, req, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// CheckToken checks if an auth token is still valid and gets the state of its user.
+func (c *Client) CheckToken(ctx context.Context, token string) (*CheckAuthResponse, error) {
+	var res CheckAuthResponse
+	if err := c.do(ctx, http.MethodPost, UriCheckToken, nil, CheckAuthTokenRequest{AuthToken: token}, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Logout revokes the token of the client.
+func (c *Client) Logout(ctx context.Context) error {
+	return c.do(ctx, http.MethodPost, UriLogout, nil, nil, nil)
+}
+
+// SetupTOTP starts the TOTP setup. The setup has to be locked with a valid code with LockTOTP.
+func (c *Client) SetupTOTP(ctx context.Context) (*SetupTOTPResponse, error) {
+	var res SetupTOTPResponse
+	if err := c.do(ctx, http.MethodPost, UriTOTPSetup, nil, nil, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// LockTOTP completes the TOTP setup. The response has the recovery codes and a full token.
+func (c *Client) LockTOTP(ctx context.Context, req SetupTOTPLockRequest) (*LockTOTPResponse, error) {
+	var res LockTOTPResponse
+	if err := c.do(ctx, http.MethodPost, UriTOTPLock, nil, req, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// RemoveTOTP removes the TOTP setup with a TOTP code or a recovery code.
+func (c *Client) RemoveTOTP(ctx context.Context, req RemoveTOTPRequest) error {
+	return c.do(ctx, http.MethodDelete, UriTOTPDelete, nil, req, nil)
+}
+
+// VerifyEmail verifies an email with the token sent in the verification email.
+func (c *Client) VerifyEmail(ctx context.Context, token string) error {
+	return c.do(ctx, http.MethodGet, UriVerifyEmail, url.Values{"token": {token}}, nil, nil)
+}
+
+// ResendVerificationEmail sends a new verification email to the user.
+func (c *Client) ResendVerificationEmail(ctx context.Context) error {
+	return c.do(ctx, http.MethodPost, UriResendVerificationEmail, nil, nil, nil)
+}
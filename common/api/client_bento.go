@@ -0,0 +1,87 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// GetBento gets a bento and its ingredients, the values of the ingredients are masked.
+// Use RevealIngredients to get the values.
+func (c *Client) GetBento(ctx context.Context, bentoID string) (*GetBentoResponse, error) {
+	var res GetBentoResponse
+	if err := c.do(ctx, http.MethodGet, UriBento, url.Values{"bento_id": {bentoID}}, nil, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// ListBentos lists the bentos the user has access to.
+func (c *Client) ListBentos(ctx context.Context) ([]ListBentosResponse, error) {
+	var res []ListBentosResponse
+	if err := c.do(ctx, http.MethodGet, UriBentos, nil, nil, &res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// NewBento creates a bento with the given ingredients.
+func (c *Client) NewBento(ctx context.Context, req NewBentoRequest) (*NewBentoResponse, error) {
+	var res NewBentoResponse
+	if err := c.do(ctx, http.MethodPost, UriNewBento, nil, req, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// DeleteBento deletes a bento along with its ingredients.
+func (c *Client) DeleteBento(ctx context.Context, bentoID string) error {
+	return c.do(ctx, http.MethodDelete, withID(UriBentoByID, bentoID), nil, nil, nil)
+}
+
+// RevealIngredients gets a bento with the values of the named ingredients, or of all its
+// ingredients when names is empty. The server records the reveal in the audit log of the bento.
+func (c *Client) RevealIngredients(ctx context.Context, bentoID string, names []string) (*GetBentoResponse, error) {
+	var res GetBentoResponse
+	if err := c.do(ctx, http.MethodPost, withID(UriBentoReveals, bentoID), nil, RevealIngredientsRequest{Ingredients: names}, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// ListBentoReveals lists the latest reveals of a bento, limit 0 uses the server default.
+func (c *Client) ListBentoReveals(ctx context.Context, bentoID string, limit int) (*BentoRevealsResponse, error) {
+	query := url.Values{}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	var res BentoRevealsResponse
+	if err := c.do(ctx, http.MethodGet, withID(UriBentoReveals, bentoID), query, nil, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// AddIngredientsToBento adds ingredients to a bento. Existing ingredients are only
+// overwritten when replace is true.
+func (c *Client) AddIngredientsToBento(ctx context.Context, req AddIngredientsToBentoRequest, replace bool) (*AddIngredientsToBentoResponse, error) {
+	query := url.Values{}
+	if replace {
+		query.Set("replace", strconv.FormatBool(replace))
+	}
+	var res AddIngredientsToBentoResponse
+	if err := c.do(ctx, http.MethodPost, UriBentoIngredients, query, req, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// RemoveIngredientsFromBento removes ingredients from a bento by id.
+func (c *Client) RemoveIngredientsFromBento(ctx context.Context, req RemoveIngredientsFromBentoRequest) (*RemoveIngredientsFromBentoResponse, error) {
+	var res RemoveIngredientsFromBentoResponse
+	if err := c.do(ctx, http.MethodDelete, UriBentoIngredients, nil, req, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
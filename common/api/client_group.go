@@ -0,0 +1,31 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// NewGroup creates a group owned by the user.
+func (c *Client) NewGroup(ctx context.Context, req NewGroupRequest) (*NewGroupResponse, error) {
+	var res NewGroupResponse
+	if err := c.do(ctx, http.MethodPost, UriNewGroup, nil, req, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// DeleteGroup deletes a group owned by the user.
+func (c *Client) DeleteGroup(ctx context.Context, groupID string) error {
+	return c.do(ctx, http.MethodDelete, withID(UriGroup, groupID), nil, nil, nil)
+}
+
+// InviteUsersToJoinGroup sends an invitation email to every address.
+func (c *Client) InviteUsersToJoinGroup(ctx context.Context, req InviteUsersToJoinGroupRequest) error {
+	return c.do(ctx, http.MethodPost, UriInviteToGroup, nil, req, nil)
+}
+
+// AcceptGroupInvitation accepts an invitation with the token sent in the invitation email.
+func (c *Client) AcceptGroupInvitation(ctx context.Context, token string) error {
+	return c.do(ctx, http.MethodGet, UriAcceptGroupInvitation, url.Values{"token": {token}}, nil, nil)
+}
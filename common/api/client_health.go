@@ -0,0 +1,25 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+// HealthCheck gets the health report of the server.
+func (c *Client) HealthCheck(ctx context.Context) (*HealthReport, error) {
+	var res HealthReport
+	if err := c.do(ctx, http.MethodGet, UriHealthCheck, nil, nil, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// OpenAPI gets the OpenAPI document of the api.
+func (c *Client) OpenAPI(ctx context.Context) (json.RawMessage, error) {
+	var res json.RawMessage
+	if err := c.do(ctx, http.MethodGet, UriOpenAPI, nil, nil, &res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
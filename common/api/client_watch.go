@@ -0,0 +1,151 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultWatchRetry is how long WatchBento waits before reconnecting when the server did not set a retry delay.
+const DefaultWatchRetry = time.Second * 3
+
+// GetBentoChanges lists the changes of a bento after the since revision. Use limit 0 for the server default.
+func (c *Client) GetBentoChanges(ctx context.Context, bentoID string, since int64, limit int) (*BentoChangesResponse, error) {
+	query := url.Values{"since": {strconv.FormatInt(since, 10)}}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	var res BentoChangesResponse
+	if err := c.do(ctx, http.MethodGet, withID(UriBentoChanges, bentoID), query, nil, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// WatchBento streams the changes of a bento and calls handle for each one of them until the
+// context is done or handle returns an error. Pass the revision the caller is up to date with
+// to also receive the changes after it, or 0 to only receive new changes.
+//
+// The stream is reopened after the last received revision when the connection drops. Errors
+// returned by the api with a 4xx status stop the watch, i.e. when the user loses access.
+func (c *Client) WatchBento(ctx context.Context, bentoID string, since int64, handle func(BentoChange) error) error {
+	// the stream stays open, the timeout of the client would close it
+	httpClient := *c.httpClient
+	httpClient.Timeout = 0
+
+	retry := DefaultWatchRetry
+	lastEventID := ""
+	if since > 0 {
+		lastEventID = strconv.FormatInt(since, 10)
+	}
+
+	for {
+		err := c.watch(ctx, &httpClient, bentoID, &lastEventID, &retry, handle)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var errRes *ErrorResponse
+		if errors.As(err, &errRes) && errRes.Code < 500 && errRes.Code != http.StatusTooManyRequests {
+			return err
+		}
+		var handleErr handlerError
+		if errors.As(err, &handleErr) {
+			return handleErr.err
+		}
+		if err := sleep(ctx, retry); err != nil {
+			return err
+		}
+	}
+}
+
+// handlerError is an error returned by the handle function of WatchBento.
+type handlerError struct {
+	err error
+}
+
+func (e handlerError) Error() string {
+	return e.err.Error()
+}
+
+// watch reads one connection of the event stream. lastEventID and retry are updated as events arrive.
+func (c *Client) watch(ctx context.Context, httpClient *http.Client, bentoID string, lastEventID *string, retry *time.Duration, handle func(BentoChange) error) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+withID(UriBentoEvents, bentoID), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", MimeTextEventStream)
+	if token := c.Token(); token != "" {
+		req.Header.Set(HeaderAuthorization, Bearer(token))
+	}
+	if *lastEventID != "" {
+		req.Header.Set(HeaderLastEventID, *lastEventID)
+	}
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		data, err := io.ReadAll(res.Body)
+		if err != nil {
+			return err
+		}
+		return ParseErrorResponse(res, data)
+	}
+
+	scanner := bufio.NewScanner(res.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	id, event, data := "", "", []string{}
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			// a blank line dispatches the event
+			if event == BentoChangeEvent && len(data) > 0 {
+				var change BentoChange
+				if err := json.Unmarshal([]byte(strings.Join(data, "\n")), &change); err != nil {
+					return err
+				}
+				if err := handle(change); err != nil {
+					return handlerError{err: err}
+				}
+			}
+			if id != "" {
+				*lastEventID = id
+			}
+			id, event, data = "", "", data[:0]
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			// comment, i.e. keep-alive
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "id":
+			id = value
+		case "event":
+			event = value
+		case "data":
+			data = append(data, value)
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil && ms >= 0 {
+				*retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return io.ErrUnexpectedEOF
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// NewBentoWebhook subscribes a webhook to the events of a bento. The secret in the response is only shown once.
+func (c *Client) NewBentoWebhook(ctx context.Context, bentoID string, req NewWebhookRequest) (*NewWebhookResponse, error) {
+	var res NewWebhookResponse
+	if err := c.do(ctx, http.MethodPost, withID(UriBentoWebhooks, bentoID), nil, req, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// ListBentoWebhooks lists the webhooks of a bento.
+func (c *Client) ListBentoWebhooks(ctx context.Context, bentoID string) ([]WebhookResponse, error) {
+	var res []WebhookResponse
+	if err := c.do(ctx, http.MethodGet, withID(UriBentoWebhooks, bentoID), nil, nil, &res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// NewGroupWebhook subscribes a webhook to the events of a group. The secret in the response is only shown once.
+func (c *Client) NewGroupWebhook(ctx context.Context, groupID string, req NewWebhookRequest) (*NewWebhookResponse, error) {
+	var res NewWebhookResponse
+	if err := c.do(ctx, http.MethodPost, withID(UriGroupWebhooks, groupID), nil, req, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// ListGroupWebhooks lists the webhooks of a group.
+func (c *Client) ListGroupWebhooks(ctx context.Context, groupID string) ([]WebhookResponse, error) {
+	var res []WebhookResponse
+	if err := c.do(ctx, http.MethodGet, withID(UriGroupWebhooks, groupID), nil, nil, &res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// DeleteWebhook deletes a webhook along with its delivery log.
+func (c *Client) DeleteWebhook(ctx context.Context, webhookID string) error {
+	return c.do(ctx, http.MethodDelete, withID(UriWebhook, webhookID), nil, nil, nil)
+}
+
+// ListWebhookDeliveries lists the latest deliveries of a webhook. The server defaults to 50 deliveries when limit is 0.
+func (c *Client) ListWebhookDeliveries(ctx context.Context, webhookID string, limit int) ([]WebhookDeliveryResponse, error) {
+	query := url.Values{}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+
+	var res []WebhookDeliveryResponse
+	if err := c.do(ctx, http.MethodGet, withID(UriWebhookDeliveries, webhookID), query, nil, &res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// TestWebhook queues a webhook.test event for a webhook.
+func (c *Client) TestWebhook(ctx context.Context, webhookID string) (*TestWebhookResponse, error) {
+	var res TestWebhookResponse
+	if err := c.do(ctx, http.MethodPost, withID(UriWebhookTest, webhookID), nil, nil, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
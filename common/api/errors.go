@@ -0,0 +1,121 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+)
+
+// ErrorCode is a stable machine-readable code sent in every ErrorResponse.
+// Clients should branch on the code instead of the status or the message.
+// Codes are never renamed, new ones may be added.
+type ErrorCode string
+
+// Generic error codes. They are used when a more specific code does not apply.
+const (
+	ErrorCodeBadRequest           ErrorCode = "bad_request"
+	ErrorCodeValidationFailed     ErrorCode = "validation_failed"
+	ErrorCodeUnauthorized         ErrorCode = "unauthorized"
+	ErrorCodeForbidden            ErrorCode = "forbidden"
+	ErrorCodeNotFound             ErrorCode = "not_found"
+	ErrorCodeMethodNotAllowed     ErrorCode = "method_not_allowed"
+	ErrorCodeConflict             ErrorCode = "conflict"
+	ErrorCodePreconditionFailed   ErrorCode = "precondition_failed"
+	ErrorCodePayloadTooLarge      ErrorCode = "payload_too_large"
+	ErrorCodeUnsupportedMediaType ErrorCode = "unsupported_media_type"
+	ErrorCodeRateLimited          ErrorCode = "rate_limited"
+	ErrorCodeInternal             ErrorCode = "internal_error"
+	ErrorCodeUnavailable          ErrorCode = "service_unavailable"
+)
+
+// Idempotency error codes.
+const (
+	ErrorCodeInvalidIdempotencyKey ErrorCode = "invalid_idempotency_key"
+	ErrorCodeIdempotencyKeyReused  ErrorCode = "idempotency_key_reused"
+	ErrorCodeIdempotencyKeyInUse   ErrorCode = "idempotency_key_in_use"
+)
+
+// Authentication error codes.
+const (
+	ErrorCodeEmailTaken          ErrorCode = "email_taken"
+	ErrorCodeInvalidCredentials  ErrorCode = "invalid_credentials"
+	ErrorCodeEmailUnverified     ErrorCode = "email_unverified"
+	ErrorCodeTOTPRequired        ErrorCode = "totp_required"
+	ErrorCodeInvalidTOTPCode     ErrorCode = "invalid_totp_code"
+	ErrorCodeInvalidRecoveryCode ErrorCode = "invalid_recovery_code"
+	ErrorCodeRecoveryCodeUsed    ErrorCode = "recovery_code_used"
+	ErrorCodeTOTPAlreadySetup    ErrorCode = "totp_already_setup"
+	ErrorCodeTOTPNotSetup        ErrorCode = "totp_not_setup"
+	ErrorCodeInvalidToken        ErrorCode = "invalid_token"
+	ErrorCodeTokenExpired        ErrorCode = "token_expired"
+)
+
+// Bento error codes.
+const (
+	ErrorCodeBentoNotFound      ErrorCode = "bento_not_found"
+	ErrorCodeBentoNameTaken     ErrorCode = "bento_name_taken"
+	ErrorCodeIngredientExists   ErrorCode = "ingredient_exists"
+	ErrorCodeIngredientNotFound ErrorCode = "ingredient_not_found"
+	// ErrorCodeBentoChanged is returned when the If-Match header does not match the bento revision.
+	ErrorCodeBentoChanged ErrorCode = "bento_changed"
+)
+
+// Group error codes.
+const (
+	ErrorCodeGroupNotFound     ErrorCode = "group_not_found"
+	ErrorCodeGroupNameTaken    ErrorCode = "group_name_taken"
+	ErrorCodeUserNotFound      ErrorCode = "user_not_found"
+	ErrorCodeInvitationInvalid ErrorCode = "invitation_invalid"
+	ErrorCodeInvitationExpired ErrorCode = "invitation_expired"
+)
+
+// Webhook error codes.
+const (
+	ErrorCodeWebhookNotFound      ErrorCode = "webhook_not_found"
+	ErrorCodeWebhookURLNotAllowed ErrorCode = "webhook_url_not_allowed"
+)
+
+// Admin error codes.
+const (
+	ErrorCodeEmailJobNotFound ErrorCode = "email_job_not_found"
+)
+
+// ErrorCodeFromStatus gets the generic error code for a HTTP status code.
+func ErrorCodeFromStatus(status int) ErrorCode {
+	switch status {
+	case http.StatusBadRequest:
+		return ErrorCodeBadRequest
+	case http.StatusUnauthorized:
+		return ErrorCodeUnauthorized
+	case http.StatusForbidden:
+		return ErrorCodeForbidden
+	case http.StatusNotFound:
+		return ErrorCodeNotFound
+	case http.StatusMethodNotAllowed:
+		return ErrorCodeMethodNotAllowed
+	case http.StatusConflict:
+		return ErrorCodeConflict
+	case http.StatusPreconditionFailed:
+		return ErrorCodePreconditionFailed
+	case http.StatusRequestEntityTooLarge:
+		return ErrorCodePayloadTooLarge
+	case http.StatusUnsupportedMediaType:
+		return ErrorCodeUnsupportedMediaType
+	case http.StatusTooManyRequests:
+		return ErrorCodeRateLimited
+	case http.StatusServiceUnavailable:
+		return ErrorCodeUnavailable
+	}
+	if status >= 400 && status < 500 {
+		return ErrorCodeBadRequest
+	}
+	return ErrorCodeInternal
+}
+
+// IsErrorCode reports whether err is an ErrorResponse with the given code.
+func IsErrorCode(err error, code ErrorCode) bool {
+	var errRes *ErrorResponse
+	if !errors.As(err, &errRes) {
+		return false
+	}
+	return errRes.ErrorCode == code
+}
@@ -0,0 +1,31 @@
+package api
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidETag error = errors.New("Invalid ETag")
+)
+
+// BentoETag formats the revision of a bento as the value of the ETag header.
+// Send it back in the If-Match header to only apply a change to that revision.
+func BentoETag(revision int64) string {
+	return strconv.Quote(strconv.FormatInt(revision, 10))
+}
+
+// ParseBentoETag gets the revision of a bento from an ETag created with BentoETag.
+func ParseBentoETag(etag string) (int64, error) {
+	etag = strings.TrimPrefix(strings.TrimSpace(etag), "W/")
+	unquoted, err := strconv.Unquote(etag)
+	if err != nil {
+		return 0, ErrInvalidETag
+	}
+	revision, err := strconv.ParseInt(unquoted, 10, 64)
+	if err != nil || revision < 1 {
+		return 0, ErrInvalidETag
+	}
+	return revision, nil
+}
@@ -5,8 +5,18 @@ import "fmt"
 const (
 	HeaderContentType   = "Content-Type"
 	HeaderAuthorization = "Authorization"
+	HeaderRequestID     = "X-Request-ID"
+	HeaderRetryAfter    = "Retry-After"
+	HeaderETag          = "ETag"
+	HeaderIfMatch       = "If-Match"
+	HeaderLastEventID   = "Last-Event-ID"
+	// HeaderIdempotencyKey lets clients retry a mutating request without applying it twice
+	HeaderIdempotencyKey = "Idempotency-Key"
+	// HeaderIdempotentReplayed is set to "true" on responses replayed for an idempotency key
+	HeaderIdempotentReplayed = "Idempotent-Replayed"
 
 	MimeApplicationJson = "application/json"
+	MimeTextEventStream = "text/event-stream"
 )
 
 // Bearer formats a string valid for the Bearer token format
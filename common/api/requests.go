@@ -13,3 +13,58 @@ type CheckAuthTokenRequest struct {
 type SetupTOTPLockRequest struct {
 	Code string `json:"code" validate:"required,len=6"`
 }
+
+// RegisterRequest represents the request body for register route.
+type RegisterRequest struct {
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required,min=12,max=32"`
+	NickName string `json:"nickname" validate:"required,min=3,max=32"`
+}
+
+// RemoveTOTPRequest is the expected request body for remove totp request
+type RemoveTOTPRequest struct {
+	Code string `json:"code" validate:"required,len=6|len=32|len=8"`
+}
+
+// Ingredient is a secret that is stored in a bento.
+type Ingredient struct {
+	Name  string `json:"name" validate:"required,min=1,printascii"`
+	Value string `json:"value"`
+}
+
+type NewBentoRequest struct {
+	Name        string       `json:"name" validate:"required,min=3,printascii"`
+	Ingredients []Ingredient `json:"ingredients,omitempty" validate:"omitnil,omitempty,dive"`
+}
+
+// RevealIngredientsRequest has the names of the ingredients whose values are revealed,
+// all the ingredients of the bento are revealed when it is empty.
+type RevealIngredientsRequest struct {
+	Ingredients []string `json:"ingredients,omitempty" validate:"omitempty,dive,required,printascii"`
+}
+
+type AddIngredientsToBentoRequest struct {
+	BentoID     string       `json:"bento_id" validate:"required,uuid4"`
+	Ingredients []Ingredient `json:"ingredients,omitempty" validate:"omitnil,omitempty,dive"`
+}
+
+type RemoveIngredientsFromBentoRequest struct {
+	BentoID     string   `json:"bento_id" validate:"required,uuid4"`
+	Ingredients []string `json:"ingredients" validate:"required,gt=0,dive,uuid4"`
+}
+
+// NewGroupRequest is the request body to create a new group
+type NewGroupRequest struct {
+	Name string `json:"name" validate:"required,min=3,max=50,printascii"`
+}
+
+type InviteUsersToJoinGroupRequest struct {
+	GroupID string   `json:"group_id" validate:"required,uuid4"`
+	Emails  []string `json:"emails" validate:"gt=0,dive,email"`
+}
+
+// NewWebhookRequest is the request body to subscribe a webhook to the events of a bento or a group.
+type NewWebhookRequest struct {
+	URL    string   `json:"url" validate:"required,http_url,max=2048"`
+	Events []string `json:"events" validate:"required,gt=0,dive,oneof=bento.ingredients_changed group.member_joined security.totp_removed"`
+}
@@ -2,7 +2,10 @@ package api
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
+	"net/http"
+	"strings"
 )
 
 type SetupTOTPResponse struct {
@@ -35,11 +38,199 @@ type RegisterResponse struct {
 	TokenType string `json:"type"`
 }
 
+type NewBentoResponse struct {
+	BentoID  string `json:"bento_id"`
+	Revision int64  `json:"revision"`
+}
+
+// BentoIngredient is an ingredient of a bento with its id.
+type BentoIngredient struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// GetBentoResponse is a bento with its ingredients. Getting a bento masks the values of the
+// ingredients, they are only sent by the reveal endpoint which records it in the audit log.
+type GetBentoResponse struct {
+	BentoID     string            `json:"bento_id"`
+	Name        string            `json:"name"`
+	Revision    int64             `json:"revision"`
+	Ingredients []BentoIngredient `json:"ingredients"`
+	// Masked is true when the values of the ingredients are left empty.
+	Masked bool `json:"masked"`
+}
+
+// AddIngredientsToBentoResponse has the revision of the bento after adding the ingredients.
+type AddIngredientsToBentoResponse struct {
+	Revision int64 `json:"revision"`
+}
+
+// RemoveIngredientsFromBentoResponse lists the ids of the ingredients that were and were not deleted.
+type RemoveIngredientsFromBentoResponse struct {
+	Deleted    []string `json:"deleted"`
+	NotDeleted []string `json:"not_deleted"`
+	Revision   int64    `json:"revision"`
+}
+
+// Actions of a bento change.
+const (
+	BentoChangeAdd     = "add"
+	BentoChangeReplace = "replace"
+	BentoChangeRemove  = "remove"
+)
+
+// BentoChangeEvent is the name of the server-sent events that notify a bento change.
+const BentoChangeEvent = "change"
+
+// BentoChange is a change to the ingredients of a bento. It has the names of the
+// ingredients that changed but never their values.
+type BentoChange struct {
+	Revision    int64    `json:"revision"`
+	Action      string   `json:"action"`
+	Ingredients []string `json:"ingredients"`
+	UserID      string   `json:"user_id"`
+	CreatedAt   string   `json:"created_at"`
+}
+
+// BentoChangesResponse lists the changes of a bento after a revision, oldest first.
+type BentoChangesResponse struct {
+	BentoID string        `json:"bento_id"`
+	Changes []BentoChange `json:"changes"`
+	// HasMore is true when there are more changes after the last one in the list.
+	HasMore bool `json:"has_more"`
+}
+
+// BentoReveal is an entry of the audit log of a bento, it records that the values of some
+// ingredients were shown to a user.
+type BentoReveal struct {
+	ID          string   `json:"id"`
+	Ingredients []string `json:"ingredients"`
+	UserID      string   `json:"user_id"`
+	IP          string   `json:"ip"`
+	UserAgent   string   `json:"user_agent"`
+	CreatedAt   string   `json:"created_at"`
+}
+
+// BentoRevealsResponse lists the latest reveals of a bento, newest first.
+type BentoRevealsResponse struct {
+	BentoID string        `json:"bento_id"`
+	Reveals []BentoReveal `json:"reveals"`
+}
+
+type ListBentosResponse struct {
+	OwnerID    string `json:"owner_id"`
+	BentoID    string `json:"bento_id"`
+	BentoName  string `json:"bento_name"`
+	CreatedAt  string `json:"created_at"`
+	UpdatedAt  string `json:"updated_at"`
+	UserPerms  string `json:"user_perms"`
+	GroupPerms string `json:"group_perms"`
+}
+
+type NewGroupResponse struct {
+	GroupID string `json:"group_id"`
+}
+
+// EmailJobResponse is the admin view of a queued email. The rendered body is
+// left out on purpose since it may contain verification or invitation tokens.
+type EmailJobResponse struct {
+	ID          string   `json:"id"`
+	Status      string   `json:"status"`
+	To          []string `json:"to"`
+	Subject     string   `json:"subject"`
+	Attempts    int64    `json:"attempts"`
+	MaxAttempts int64    `json:"max_attempts"`
+	LastError   *string  `json:"last_error"`
+	MessageID   *string  `json:"message_id"`
+	RunAt       string   `json:"run_at"`
+	CreatedAt   string   `json:"created_at"`
+	UpdatedAt   string   `json:"updated_at"`
+}
+
+// NewWebhookResponse has the secret that signs the deliveries of a new webhook. It is only shown once.
+type NewWebhookResponse struct {
+	WebhookID string `json:"webhook_id"`
+	Secret    string `json:"secret"`
+}
+
+// WebhookResponse is a webhook without its secret.
+type WebhookResponse struct {
+	ID        string   `json:"id"`
+	BentoID   *string  `json:"bento_id"`
+	GroupID   *string  `json:"group_id"`
+	URL       string   `json:"url"`
+	Events    []string `json:"events"`
+	CreatedAt string   `json:"created_at"`
+}
+
+// WebhookDeliveryResponse is an entry of the delivery log of a webhook.
+type WebhookDeliveryResponse struct {
+	ID             string  `json:"id"`
+	EventID        string  `json:"event_id"`
+	EventType      string  `json:"event_type"`
+	Status         string  `json:"status"`
+	Attempts       int64   `json:"attempts"`
+	MaxAttempts    int64   `json:"max_attempts"`
+	ResponseStatus *int64  `json:"response_status"`
+	LastError      *string `json:"last_error"`
+	RunAt          string  `json:"run_at"`
+	DeliveredAt    *string `json:"delivered_at"`
+	CreatedAt      string  `json:"created_at"`
+}
+
+// TestWebhookResponse has the id of the queued test delivery.
+type TestWebhookResponse struct {
+	DeliveryID string `json:"delivery_id"`
+}
+
+// HealthReport represents a health check report response body.
+type HealthReport struct {
+	Version                  string `json:"version"`
+	DatabaseConnectionStatus string `json:"database_connection_status"`
+}
+
+// LivenessReport represents a liveness probe response body.
+type LivenessReport struct {
+	Status  string `json:"status"`
+	Version string `json:"version"`
+}
+
+// ReadinessReport represents a readiness probe response body. The errors of failed
+// checks are only logged by the server.
+type ReadinessReport struct {
+	Status    string           `json:"status"`
+	Version   string           `json:"version"`
+	CheckedAt string           `json:"checked_at"`
+	Checks    []ReadinessCheck `json:"checks"`
+}
+
+// ReadinessCheck is the status of a single readiness check.
+type ReadinessCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+}
+
 type ErrorResponse struct {
-	Code      int      `json:"code"`
-	Message   string   `json:"message"`
-	Errors    []string `json:"errors,omitempty"`
-	RequestId string   `json:"request_id"`
+	// Code is the HTTP status code
+	Code int `json:"code"`
+	// ErrorCode is the machine-readable code of the error, one of the ErrorCode* constants
+	ErrorCode ErrorCode `json:"error_code"`
+	Message   string    `json:"message"`
+	// Errors lists the request fields that failed validation
+	Errors    []FieldError `json:"errors,omitempty"`
+	RequestId string       `json:"request_id"`
+}
+
+// FieldError describes a single field that failed validation.
+type FieldError struct {
+	// Field is the path of the field in the request body, i.e. "email" or "ingredients[0].name"
+	Field string `json:"field"`
+	// Rule is the validation rule that failed, i.e. "required" or "min"
+	Rule string `json:"rule"`
+	// Param is the parameter of the rule, i.e. "12" for "min=12"
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
 }
 
 func ReadErrorResponse(body io.Reader) (*ErrorResponse, error) {
@@ -56,3 +247,52 @@ func ReadErrorResponse(body io.Reader) (*ErrorResponse, error) {
 
 	return &res, nil
 }
+
+// Error formats the error response so it can be returned as an error. The request id
+// is included so that users can reference it when reporting a problem.
+func (e *ErrorResponse) Error() string {
+	msg := e.Message
+	if len(e.Errors) > 0 {
+		messages := make([]string, len(e.Errors))
+		for i, fe := range e.Errors {
+			messages[i] = fe.Message
+		}
+		msg = fmt.Sprintf("%s: %s", strings.TrimSuffix(msg, "."), strings.Join(messages, "; "))
+	}
+	if e.RequestId == "" {
+		return msg
+	}
+	return fmt.Sprintf("%s (request id: %s)", msg, e.RequestId)
+}
+
+// FieldErrors maps every field that failed validation to its message. Only the
+// first error of each field is kept.
+func (e *ErrorResponse) FieldErrors() map[string]string {
+	fields := make(map[string]string, len(e.Errors))
+	for _, fe := range e.Errors {
+		if _, ok := fields[fe.Field]; !ok {
+			fields[fe.Field] = fe.Message
+		}
+	}
+	return fields
+}
+
+// ParseErrorResponse builds an ErrorResponse from a failed response and its body.
+// It falls back to the status text when the body is not an ErrorResponse and to the
+// X-Request-ID response header when the body has no request id.
+func ParseErrorResponse(res *http.Response, body []byte) *ErrorResponse {
+	var errRes ErrorResponse
+	if err := json.Unmarshal(body, &errRes); err != nil || errRes.Message == "" {
+		errRes.Message = http.StatusText(res.StatusCode)
+	}
+	if errRes.Code == 0 {
+		errRes.Code = res.StatusCode
+	}
+	if errRes.ErrorCode == "" {
+		errRes.ErrorCode = ErrorCodeFromStatus(res.StatusCode)
+	}
+	if errRes.RequestId == "" {
+		errRes.RequestId = res.Header.Get(HeaderRequestID)
+	}
+	return &errRes
+}
@@ -6,9 +6,37 @@ const (
 	UriLogin                   = "/auth/login"
 	UriRegister                = "/auth/register"
 	UriCheckToken              = "/auth/token/check"
+	UriLogout                  = "/auth/logout"
 	UriTOTPSetup               = "/auth/totp/setup"
 	UriTOTPLock                = "/auth/totp/lock"
 	UriTOTPDelete              = "/auth/totp"
 	UriVerifyEmail             = "/auth/email/verify"
 	UriResendVerificationEmail = "/auth/email/resend-verification"
+
+	UriHealthCheck = "/health-check"
+	UriOpenAPI     = "/openapi.json"
+
+	UriBento            = "/bento"
+	UriBentoByID        = "/bento/:id"
+	UriBentos           = "/bentos"
+	UriNewBento         = "/bento/new"
+	UriBentoIngredients = "/bento/ingredients"
+	UriBentoChanges     = "/bento/:id/changes"
+	UriBentoEvents      = "/bento/:id/events"
+	UriBentoReveals     = "/bento/:id/reveals"
+	UriBentoWebhooks    = "/bento/:id/webhooks"
+
+	UriNewGroup              = "/group/new"
+	UriGroup                 = "/group/:id"
+	UriGroupWebhooks         = "/group/:id/webhooks"
+	UriInviteToGroup         = "/group/invite"
+	UriAcceptGroupInvitation = "/group/invitation/accept"
+
+	UriWebhook           = "/webhook/:id"
+	UriWebhookDeliveries = "/webhook/:id/deliveries"
+	UriWebhookTest       = "/webhook/:id/test"
+
+	UriEmailJobs         = "/admin/email-jobs"
+	UriRedriveEmailJob   = "/admin/email-jobs/:id/redrive"
+	UriAdminBentoReveals = "/admin/bentos/:id/reveals"
 )
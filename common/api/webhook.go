@@ -0,0 +1,60 @@
+package api
+
+import (
+	"encoding/json"
+)
+
+// Events delivered to webhooks.
+const (
+	// WebhookEventBentoIngredientsChanged is sent to the webhooks of a bento when ingredients are added, replaced or removed.
+	WebhookEventBentoIngredientsChanged = "bento.ingredients_changed"
+	// WebhookEventGroupMemberJoined is sent to the webhooks of a group when a user accepts an invitation.
+	WebhookEventGroupMemberJoined = "group.member_joined"
+	// WebhookEventTOTPRemoved is sent to the webhooks of every group of a user that removed their TOTP setup.
+	WebhookEventTOTPRemoved = "security.totp_removed"
+	// WebhookEventTest is only sent when requested with the test endpoint of a webhook.
+	WebhookEventTest = "webhook.test"
+)
+
+// Headers of a webhook delivery. The signature is the hex encoded HMAC-SHA256 of the timestamp,
+// a dot and the body, keyed with the secret of the webhook: "sha256=" + hex(hmac(secret, ts + "." + body)).
+// Receivers should reject deliveries with an old timestamp to prevent replays.
+const (
+	HeaderWebhookEvent     = "X-Konbini-Event"
+	HeaderWebhookDelivery  = "X-Konbini-Delivery"
+	HeaderWebhookTimestamp = "X-Konbini-Timestamp"
+	HeaderWebhookSignature = "X-Konbini-Signature"
+)
+
+// WebhookEvent is the body of a webhook delivery.
+type WebhookEvent struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt string          `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// BentoIngredientsChangedData is the data of a bento.ingredients_changed event. Values are never sent.
+type BentoIngredientsChangedData struct {
+	BentoID     string   `json:"bento_id"`
+	Revision    int64    `json:"revision"`
+	Action      string   `json:"action"`
+	Ingredients []string `json:"ingredients"`
+	UserID      string   `json:"user_id"`
+}
+
+// GroupMemberJoinedData is the data of a group.member_joined event.
+type GroupMemberJoinedData struct {
+	GroupID string `json:"group_id"`
+	UserID  string `json:"user_id"`
+}
+
+// TOTPRemovedData is the data of a security.totp_removed event.
+type TOTPRemovedData struct {
+	UserID string `json:"user_id"`
+}
+
+// WebhookTestData is the data of a webhook.test event.
+type WebhookTestData struct {
+	WebhookID string `json:"webhook_id"`
+}
@@ -3,7 +3,10 @@ package config
 import (
 	"encoding/hex"
 	"errors"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 	"github.com/rs/zerolog/log"
@@ -34,8 +37,18 @@ var (
 	ErrMissingBentoTokenKey               error = errors.New("BENTO_TOKEN_KEY environment varaible must be set")
 	ErrMissingEmailTokenKey               error = errors.New("EMAIL_TOKEN_KEY environment varaible must be set")
 	ErrMissingAesKey                      error = errors.New("AES_KEY environment varaible must be set")
-
-	ErrInvalidAppEnv error = errors.New("Invalid value for APP_ENV environment variable")
+	ErrMissingSMTPHost                    error = errors.New("SMTP_HOST environment variable must be set when EMAIL_TRANSPORT is smtp")
+	ErrMissingEmailFileDir                error = errors.New("EMAIL_FILE_DIR environment variable must be set when EMAIL_TRANSPORT is file")
+	ErrMissingRedisUrl                    error = errors.New("REDIS_URL environment variable must be set when CACHE_BACKEND is redis")
+
+	ErrInvalidAppEnv            error = errors.New("Invalid value for APP_ENV environment variable")
+	ErrInvalidEmailQueueWorkers error = errors.New("EMAIL_QUEUE_WORKERS environment variable must be a positive integer")
+	ErrInvalidEmailMaxAttempts  error = errors.New("EMAIL_MAX_ATTEMPTS environment variable must be a positive integer")
+	ErrInvalidEmailTransport    error = errors.New("EMAIL_TRANSPORT environment variable must be one of: resend, smtp, file, console")
+	ErrInvalidSMTPTLS           error = errors.New("SMTP_TLS environment variable must be one of: starttls, tls, none")
+	ErrInvalidCacheBackend      error = errors.New("CACHE_BACKEND environment variable must be one of: memory, redis")
+	ErrInvalidTracingExporter   error = errors.New("TRACING_EXPORTER environment variable must be one of: none, otlp")
+	ErrInvalidOTLPEndpoint      error = errors.New("OTEL_EXPORTER_OTLP_ENDPOINT environment variable must be a http or https url")
 
 	ErrUninitializedGlobalConfig error = errors.New("Global configuration not initialized. Use config.New() to initialize it.")
 	ErrUninitializedMemCache     error = errors.New("Memory cache hasn't been initialized. Use config.New() to initialize it.")
@@ -62,6 +75,43 @@ type Config struct {
 	version string
 }
 
+// Supported email transports, selected with the 'EMAIL_TRANSPORT' environment variable.
+const (
+	EMAIL_TRANSPORT_RESEND  string = "resend"
+	EMAIL_TRANSPORT_SMTP    string = "smtp"
+	EMAIL_TRANSPORT_FILE    string = "file"
+	EMAIL_TRANSPORT_CONSOLE string = "console"
+)
+
+// Supported SMTP connection security modes, selected with the 'SMTP_TLS' environment variable.
+const (
+	SMTP_TLS_STARTTLS string = "starttls"
+	SMTP_TLS_IMPLICIT string = "tls"
+	SMTP_TLS_NONE     string = "none"
+)
+
+// Supported cache backends, selected with the 'CACHE_BACKEND' environment variable.
+const (
+	CACHE_BACKEND_MEMORY string = "memory"
+	CACHE_BACKEND_REDIS  string = "redis"
+)
+
+// Supported trace exporters, selected with the 'TRACING_EXPORTER' environment variable.
+const (
+	TRACING_EXPORTER_NONE string = "none"
+	TRACING_EXPORTER_OTLP string = "otlp"
+)
+
+// SMTPConfig holds the settings used to connect to an SMTP relay.
+type SMTPConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	// TLS is one of SMTP_TLS_STARTTLS, SMTP_TLS_IMPLICIT or SMTP_TLS_NONE.
+	TLS string
+}
+
 type EnvConfig struct {
 	databaseUrl                 string
 	databaseAuthToken           string
@@ -76,8 +126,28 @@ type EnvConfig struct {
 	bentoTokenKey               []byte
 	emailTokenKey               []byte
 	aesKey                      []byte
+	emailQueueWorkers           int
+	emailMaxAttempts            int
+	adminEmails                 []string
+	emailTransport              string
+	smtp                        SMTPConfig
+	emailFileDir                string
+	cacheBackend                string
+	redisUrl                    string
+	metricsAddress              string
+	tracingExporter             string
+	otlpEndpoint                string
+	serviceName                 string
 }
 
+const (
+	defaultEmailQueueWorkers int    = 2
+	defaultEmailMaxAttempts  int    = 5
+	defaultSMTPPort          string = "587"
+	defaultOTLPEndpoint      string = "http://localhost:4318"
+	defaultServiceName       string = "konbini"
+)
+
 // Create a new server configuration. This method reads in required environment
 // variables too and it will return an error if any is not set.
 // This function also sets the global config instance which can be access with Global() function.
@@ -159,6 +229,21 @@ func (c *Config) GetResendApiKey() string {
 	return c.env.resendApiKey
 }
 
+// Gets the transport used to deliver emails. One of the EMAIL_TRANSPORT_* constants.
+func (c *Config) GetEmailTransport() string {
+	return c.env.emailTransport
+}
+
+// Gets the SMTP relay settings. Only set when the email transport is smtp.
+func (c *Config) GetSMTPConfig() SMTPConfig {
+	return c.env.smtp
+}
+
+// Gets the directory where .eml files are written when the email transport is file.
+func (c *Config) GetEmailFileDir() string {
+	return c.env.emailFileDir
+}
+
 // Gets the no reply email address value
 func (c *Config) GetVerifyEmailAddress() string {
 	return c.env.verifyEmailAddress
@@ -191,6 +276,57 @@ func (c *Config) GetAesKey() []byte {
 	return c.env.aesKey
 }
 
+// Gets the backend used by the shared cache. One of the CACHE_BACKEND_* constants.
+func (c *Config) GetCacheBackend() string {
+	return c.env.cacheBackend
+}
+
+// Gets the redis connection url. Only set when the cache backend is redis.
+func (c *Config) GetRedisUrl() string {
+	return c.env.redisUrl
+}
+
+// Gets the address of the dedicated metrics listener, i.e. ":9090". The metrics are never
+// served by the main server, the listener is not started when it is empty.
+func (c *Config) GetMetricsAddress() string {
+	return c.env.metricsAddress
+}
+
+// Gets the exporter used for traces. One of the TRACING_EXPORTER_* constants.
+func (c *Config) GetTracingExporter() string {
+	return c.env.tracingExporter
+}
+
+// Gets the url of the OTLP/HTTP collector that receives traces, i.e. "http://localhost:4318".
+func (c *Config) GetOTLPEndpoint() string {
+	return c.env.otlpEndpoint
+}
+
+// Gets the service name reported in traces.
+func (c *Config) GetServiceName() string {
+	return c.env.serviceName
+}
+
+// Gets the number of workers that process the outbound email queue.
+func (c *Config) GetEmailQueueWorkers() int {
+	return c.env.emailQueueWorkers
+}
+
+// Gets how many times an email is attempted before it is moved to the dead-letter state.
+func (c *Config) GetEmailMaxAttempts() int {
+	return c.env.emailMaxAttempts
+}
+
+// IsAdminEmail checks if the given email belongs to a server administrator.
+func (c *Config) IsAdminEmail(email string) bool {
+	for _, e := range c.env.adminEmails {
+		if strings.EqualFold(e, email) {
+			return true
+		}
+	}
+	return false
+}
+
 // Load and verify that all required environment variables have been set.
 // It will log a warning for missing optional environment variables.
 func (c *Config) loadEnvironmentVariables() error {
@@ -231,9 +367,49 @@ func (c *Config) loadEnvironmentVariables() error {
 		return ErrMissingPort
 	}
 
+	// emails are not delivered anywhere while testing unless a transport is set explicitly
+	c.env.emailTransport = os.Getenv("EMAIL_TRANSPORT")
+	if c.env.emailTransport == "" {
+		c.env.emailTransport = EMAIL_TRANSPORT_RESEND
+		if c.IsTesting() {
+			c.env.emailTransport = EMAIL_TRANSPORT_CONSOLE
+		}
+	}
 	c.env.resendApiKey = os.Getenv("RESEND_API_KEY")
-	if c.env.resendApiKey == "" {
-		return ErrMissingResendApiKey
+	switch c.env.emailTransport {
+	case EMAIL_TRANSPORT_RESEND:
+		if c.env.resendApiKey == "" {
+			return ErrMissingResendApiKey
+		}
+	case EMAIL_TRANSPORT_SMTP:
+		c.env.smtp = SMTPConfig{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     os.Getenv("SMTP_PORT"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			TLS:      os.Getenv("SMTP_TLS"),
+		}
+		if c.env.smtp.Host == "" {
+			return ErrMissingSMTPHost
+		}
+		if c.env.smtp.Port == "" {
+			c.env.smtp.Port = defaultSMTPPort
+		}
+		switch c.env.smtp.TLS {
+		case "":
+			c.env.smtp.TLS = SMTP_TLS_STARTTLS
+		case SMTP_TLS_STARTTLS, SMTP_TLS_IMPLICIT, SMTP_TLS_NONE:
+		default:
+			return ErrInvalidSMTPTLS
+		}
+	case EMAIL_TRANSPORT_FILE:
+		c.env.emailFileDir = os.Getenv("EMAIL_FILE_DIR")
+		if c.env.emailFileDir == "" {
+			return ErrMissingEmailFileDir
+		}
+	case EMAIL_TRANSPORT_CONSOLE:
+	default:
+		return ErrInvalidEmailTransport
 	}
 
 	c.env.verifyEmailAddress = os.Getenv("VERIFY_EMAIL_ADDRESS")
@@ -293,9 +469,89 @@ func (c *Config) loadEnvironmentVariables() error {
 
 	// --- end required environment variables ---
 
+	// --- start optional environment variables ---
+
+	c.env.emailQueueWorkers, err = parsePositiveInt("EMAIL_QUEUE_WORKERS", defaultEmailQueueWorkers, ErrInvalidEmailQueueWorkers)
+	if err != nil {
+		return err
+	}
+
+	c.env.emailMaxAttempts, err = parsePositiveInt("EMAIL_MAX_ATTEMPTS", defaultEmailMaxAttempts, ErrInvalidEmailMaxAttempts)
+	if err != nil {
+		return err
+	}
+
+	// the in-memory cache only works with a single server instance
+	c.env.cacheBackend = os.Getenv("CACHE_BACKEND")
+	c.env.redisUrl = ""
+	switch c.env.cacheBackend {
+	case "", CACHE_BACKEND_MEMORY:
+		c.env.cacheBackend = CACHE_BACKEND_MEMORY
+	case CACHE_BACKEND_REDIS:
+		c.env.redisUrl = os.Getenv("REDIS_URL")
+		if c.env.redisUrl == "" {
+			return ErrMissingRedisUrl
+		}
+	default:
+		return ErrInvalidCacheBackend
+	}
+
+	c.env.metricsAddress = os.Getenv("METRICS_ADDRESS")
+
+	// traces are only exported when an exporter is set explicitly
+	c.env.tracingExporter = os.Getenv("TRACING_EXPORTER")
+	c.env.otlpEndpoint = ""
+	switch c.env.tracingExporter {
+	case "", TRACING_EXPORTER_NONE:
+		c.env.tracingExporter = TRACING_EXPORTER_NONE
+	case TRACING_EXPORTER_OTLP:
+		c.env.otlpEndpoint = os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+		if c.env.otlpEndpoint == "" {
+			c.env.otlpEndpoint = defaultOTLPEndpoint
+		}
+		u, err := url.Parse(c.env.otlpEndpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return ErrInvalidOTLPEndpoint
+		}
+	default:
+		return ErrInvalidTracingExporter
+	}
+
+	c.env.serviceName = os.Getenv("OTEL_SERVICE_NAME")
+	if c.env.serviceName == "" {
+		c.env.serviceName = defaultServiceName
+	}
+
+	c.env.adminEmails = nil
+	for _, email := range strings.Split(os.Getenv("ADMIN_EMAILS"), ",") {
+		email = strings.TrimSpace(email)
+		if email != "" {
+			c.env.adminEmails = append(c.env.adminEmails, email)
+		}
+	}
+	if len(c.env.adminEmails) == 0 {
+		log.Warn().Msg("ADMIN_EMAILS is not set, admin routes will reject every request")
+	}
+
+	// --- end optional environment variables ---
+
 	return nil
 }
 
+// parsePositiveInt reads an optional environment variable as a positive integer.
+// The fallback value is returned when the variable is not set.
+func parsePositiveInt(name string, fallback int, invalidErr error) (int, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return 0, invalidErr
+	}
+	return n, nil
+}
+
 func decodeHexKey(value string) ([]byte, error) {
 	decoded := make([]byte, 32)
 	n, err := hex.Decode(decoded, []byte(value))
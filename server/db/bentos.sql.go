@@ -33,6 +33,15 @@ func (q *Queries) AddIngredientToBento(ctx context.Context, arg AddIngredientToB
 	return err
 }
 
+const deleteBento = `-- name: DeleteBento :exec
+DELETE FROM bentos WHERE id = ?
+`
+
+func (q *Queries) DeleteBento(ctx context.Context, id string) error {
+	_, err := q.db.ExecContext(ctx, deleteBento, id)
+	return err
+}
+
 const existsBentoWithNameOwnedByUser = `-- name: ExistsBentoWithNameOwnedByUser :one
 SELECT EXISTS(SELECT 1 FROM bentos WHERE name = ? AND user_id = ?)
 `
@@ -50,7 +59,7 @@ func (q *Queries) ExistsBentoWithNameOwnedByUser(ctx context.Context, arg Exists
 }
 
 const getBentoByIDWithPermissions = `-- name: GetBentoByIDWithPermissions :one
-SELECT b.id, b.user_id, b.name, b.created_at, b.updated_at, p.bytes FROM bentos b
+SELECT b.id, b.user_id, b.name, b.created_at, b.updated_at, b.revision, p.bytes FROM bentos b
 LEFT JOIN bento_permissions p ON p.user_id = ? AND p.bento_id = b.id
 WHERE b.id = ?
 `
@@ -66,6 +75,7 @@ type GetBentoByIDWithPermissionsRow struct {
 	Name      string `db:"name" json:"name"`
 	CreatedAt string `db:"created_at" json:"created_at"`
 	UpdatedAt string `db:"updated_at" json:"updated_at"`
+	Revision  int64  `db:"revision" json:"revision"`
 	Bytes     []byte `db:"bytes" json:"bytes"`
 }
 
@@ -78,6 +88,7 @@ func (q *Queries) GetBentoByIDWithPermissions(ctx context.Context, arg GetBentoB
 		&i.Name,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Revision,
 		&i.Bytes,
 	)
 	return i, err
@@ -110,6 +121,39 @@ func (q *Queries) GetBentoIngredientIDsInBento(ctx context.Context, bentoID stri
 	return items, nil
 }
 
+const getBentoIngredientNames = `-- name: GetBentoIngredientNames :many
+SELECT id, name FROM bento_ingredients
+WHERE bento_id = ?
+`
+
+type GetBentoIngredientNamesRow struct {
+	ID   string `db:"id" json:"id"`
+	Name string `db:"name" json:"name"`
+}
+
+func (q *Queries) GetBentoIngredientNames(ctx context.Context, bentoID string) ([]GetBentoIngredientNamesRow, error) {
+	rows, err := q.db.QueryContext(ctx, getBentoIngredientNames, bentoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetBentoIngredientNamesRow
+	for rows.Next() {
+		var i GetBentoIngredientNamesRow
+		if err := rows.Scan(&i.ID, &i.Name); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getBentoIngredients = `-- name: GetBentoIngredients :many
 SELECT id, name, CAST(value AS TEXT) FROM bento_ingredients
 WHERE bento_id = ?
@@ -145,7 +189,7 @@ func (q *Queries) GetBentoIngredients(ctx context.Context, bentoID string) ([]Ge
 }
 
 const getBentoWithIDOwnedByUser = `-- name: GetBentoWithIDOwnedByUser :one
-SELECT id, user_id, name, created_at, updated_at FROM bentos WHERE id = ? AND user_id = ?
+SELECT id, user_id, name, created_at, updated_at, revision FROM bentos WHERE id = ? AND user_id = ?
 `
 
 type GetBentoWithIDOwnedByUserParams struct {
@@ -162,10 +206,133 @@ func (q *Queries) GetBentoWithIDOwnedByUser(ctx context.Context, arg GetBentoWit
 		&i.Name,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Revision,
 	)
 	return i, err
 }
 
+const incrementBentoRevision = `-- name: IncrementBentoRevision :one
+UPDATE bentos SET revision = revision + 1, updated_at = ?
+WHERE id = ? RETURNING revision
+`
+
+type IncrementBentoRevisionParams struct {
+	UpdatedAt string `db:"updated_at" json:"updated_at"`
+	ID        string `db:"id" json:"id"`
+}
+
+func (q *Queries) IncrementBentoRevision(ctx context.Context, arg IncrementBentoRevisionParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, incrementBentoRevision, arg.UpdatedAt, arg.ID)
+	var revision int64
+	err := row.Scan(&revision)
+	return revision, err
+}
+
+const incrementBentoRevisionIfMatch = `-- name: IncrementBentoRevisionIfMatch :one
+UPDATE bentos SET revision = revision + 1, updated_at = ?
+WHERE id = ? AND revision = ? RETURNING revision
+`
+
+type IncrementBentoRevisionIfMatchParams struct {
+	UpdatedAt string `db:"updated_at" json:"updated_at"`
+	ID        string `db:"id" json:"id"`
+	Revision  int64  `db:"revision" json:"revision"`
+}
+
+func (q *Queries) IncrementBentoRevisionIfMatch(ctx context.Context, arg IncrementBentoRevisionIfMatchParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, incrementBentoRevisionIfMatch, arg.UpdatedAt, arg.ID, arg.Revision)
+	var revision int64
+	err := row.Scan(&revision)
+	return revision, err
+}
+
+const listBentoChangesSince = `-- name: ListBentoChangesSince :many
+SELECT id, bento_id, revision, user_id, "action", ingredients, created_at FROM bento_changes
+WHERE bento_id = ? AND revision > ?
+ORDER BY revision
+LIMIT ?
+`
+
+type ListBentoChangesSinceParams struct {
+	BentoID  string `db:"bento_id" json:"bento_id"`
+	Revision int64  `db:"revision" json:"revision"`
+	Limit    int64  `db:"limit" json:"limit"`
+}
+
+func (q *Queries) ListBentoChangesSince(ctx context.Context, arg ListBentoChangesSinceParams) ([]BentoChange, error) {
+	rows, err := q.db.QueryContext(ctx, listBentoChangesSince, arg.BentoID, arg.Revision, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []BentoChange
+	for rows.Next() {
+		var i BentoChange
+		if err := rows.Scan(
+			&i.ID,
+			&i.BentoID,
+			&i.Revision,
+			&i.UserID,
+			&i.Action,
+			&i.Ingredients,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listBentoReveals = `-- name: ListBentoReveals :many
+SELECT id, bento_id, user_id, ingredients, ip, user_agent, created_at FROM bento_reveals
+WHERE bento_id = ?
+ORDER BY created_at DESC
+LIMIT ?
+`
+
+type ListBentoRevealsParams struct {
+	BentoID string `db:"bento_id" json:"bento_id"`
+	Limit   int64  `db:"limit" json:"limit"`
+}
+
+func (q *Queries) ListBentoReveals(ctx context.Context, arg ListBentoRevealsParams) ([]BentoReveal, error) {
+	rows, err := q.db.QueryContext(ctx, listBentoReveals, arg.BentoID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []BentoReveal
+	for rows.Next() {
+		var i BentoReveal
+		if err := rows.Scan(
+			&i.ID,
+			&i.BentoID,
+			&i.UserID,
+			&i.Ingredients,
+			&i.Ip,
+			&i.UserAgent,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listBentosWithAccess = `-- name: ListBentosWithAccess :many
 SELECT b.user_id as owner_id, b.id as bento_id, b.name as bento_name, b.created_at, b.updated_at, p.bytes as user_perms, g.bytes as group_perms FROM bentos b
 LEFT JOIN bento_permissions p ON p.bento_id = b.id AND p.user_id = ?1
@@ -217,7 +384,7 @@ func (q *Queries) ListBentosWithAccess(ctx context.Context, userID string) ([]Li
 
 const newBento = `-- name: NewBento :one
 INSERT INTO bentos (user_id, name, created_at, updated_at)
-VALUES (?, ?, ?, ?) RETURNING id
+VALUES (?, ?, ?, ?) RETURNING id, revision
 `
 
 type NewBentoParams struct {
@@ -227,20 +394,78 @@ type NewBentoParams struct {
 	UpdatedAt string `db:"updated_at" json:"updated_at"`
 }
 
-func (q *Queries) NewBento(ctx context.Context, arg NewBentoParams) (string, error) {
+type NewBentoRow struct {
+	ID       string `db:"id" json:"id"`
+	Revision int64  `db:"revision" json:"revision"`
+}
+
+func (q *Queries) NewBento(ctx context.Context, arg NewBentoParams) (NewBentoRow, error) {
 	row := q.db.QueryRowContext(ctx, newBento,
 		arg.UserID,
 		arg.Name,
 		arg.CreatedAt,
 		arg.UpdatedAt,
 	)
-	var id string
-	err := row.Scan(&id)
-	return id, err
+	var i NewBentoRow
+	err := row.Scan(&i.ID, &i.Revision)
+	return i, err
+}
+
+const newBentoChange = `-- name: NewBentoChange :exec
+INSERT INTO bento_changes (bento_id, revision, user_id, action, ingredients, created_at)
+VALUES (?, ?, ?, ?, ?, ?)
+`
+
+type NewBentoChangeParams struct {
+	BentoID     string `db:"bento_id" json:"bento_id"`
+	Revision    int64  `db:"revision" json:"revision"`
+	UserID      string `db:"user_id" json:"user_id"`
+	Action      string `db:"action" json:"action"`
+	Ingredients string `db:"ingredients" json:"ingredients"`
+	CreatedAt   string `db:"created_at" json:"created_at"`
 }
 
-const removeIngredientFromBento = `-- name: RemoveIngredientFromBento :execrows
+func (q *Queries) NewBentoChange(ctx context.Context, arg NewBentoChangeParams) error {
+	_, err := q.db.ExecContext(ctx, newBentoChange,
+		arg.BentoID,
+		arg.Revision,
+		arg.UserID,
+		arg.Action,
+		arg.Ingredients,
+		arg.CreatedAt,
+	)
+	return err
+}
+
+const newBentoReveal = `-- name: NewBentoReveal :exec
+INSERT INTO bento_reveals (bento_id, user_id, ingredients, ip, user_agent, created_at)
+VALUES (?, ?, ?, ?, ?, ?)
+`
+
+type NewBentoRevealParams struct {
+	BentoID     string `db:"bento_id" json:"bento_id"`
+	UserID      string `db:"user_id" json:"user_id"`
+	Ingredients string `db:"ingredients" json:"ingredients"`
+	Ip          string `db:"ip" json:"ip"`
+	UserAgent   string `db:"user_agent" json:"user_agent"`
+	CreatedAt   string `db:"created_at" json:"created_at"`
+}
+
+func (q *Queries) NewBentoReveal(ctx context.Context, arg NewBentoRevealParams) error {
+	_, err := q.db.ExecContext(ctx, newBentoReveal,
+		arg.BentoID,
+		arg.UserID,
+		arg.Ingredients,
+		arg.Ip,
+		arg.UserAgent,
+		arg.CreatedAt,
+	)
+	return err
+}
+
+const removeIngredientFromBento = `-- name: RemoveIngredientFromBento :one
 DELETE FROM bento_ingredients WHERE bento_id = ? AND id = ?
+RETURNING name
 `
 
 type RemoveIngredientFromBentoParams struct {
@@ -248,12 +473,11 @@ type RemoveIngredientFromBentoParams struct {
 	ID      string `db:"id" json:"id"`
 }
 
-func (q *Queries) RemoveIngredientFromBento(ctx context.Context, arg RemoveIngredientFromBentoParams) (int64, error) {
-	result, err := q.db.ExecContext(ctx, removeIngredientFromBento, arg.BentoID, arg.ID)
-	if err != nil {
-		return 0, err
-	}
-	return result.RowsAffected()
+func (q *Queries) RemoveIngredientFromBento(ctx context.Context, arg RemoveIngredientFromBentoParams) (string, error) {
+	row := q.db.QueryRowContext(ctx, removeIngredientFromBento, arg.BentoID, arg.ID)
+	var name string
+	err := row.Scan(&name)
+	return name, err
 }
 
 const setBentoIngredient = `-- name: SetBentoIngredient :exec
@@ -0,0 +1,240 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: email_jobs.sql
+
+package db
+
+import (
+	"context"
+)
+
+const buryEmailJob = `-- name: BuryEmailJob :execrows
+UPDATE email_jobs SET
+    status = 'dead',
+    last_error = ?,
+    locked_until = NULL,
+    updated_at = ?
+WHERE id = ? AND status = 'processing' AND locked_until = ?
+`
+
+type BuryEmailJobParams struct {
+	LastError   *string `db:"last_error" json:"last_error"`
+	UpdatedAt   string  `db:"updated_at" json:"updated_at"`
+	ID          string  `db:"id" json:"id"`
+	LockedUntil *string `db:"locked_until" json:"locked_until"`
+}
+
+func (q *Queries) BuryEmailJob(ctx context.Context, arg BuryEmailJobParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, buryEmailJob,
+		arg.LastError,
+		arg.UpdatedAt,
+		arg.ID,
+		arg.LockedUntil,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const claimEmailJob = `-- name: ClaimEmailJob :one
+UPDATE email_jobs SET
+    status = 'processing',
+    attempts = attempts + 1,
+    locked_until = ?1,
+    updated_at = ?2
+WHERE id = (
+    SELECT j.id FROM email_jobs j
+    WHERE (j.status = 'pending' AND j.run_at <= ?3)
+       OR (j.status = 'processing' AND j.locked_until <= ?3)
+    ORDER BY j.run_at
+    LIMIT 1
+)
+RETURNING id, payload, status, attempts, max_attempts, last_error, message_id, run_at, locked_until, created_at, updated_at
+`
+
+type ClaimEmailJobParams struct {
+	LockedUntil *string `db:"locked_until" json:"locked_until"`
+	UpdatedAt   string  `db:"updated_at" json:"updated_at"`
+	Now         string  `db:"now" json:"now"`
+}
+
+func (q *Queries) ClaimEmailJob(ctx context.Context, arg ClaimEmailJobParams) (EmailJob, error) {
+	row := q.db.QueryRowContext(ctx, claimEmailJob, arg.LockedUntil, arg.UpdatedAt, arg.Now)
+	var i EmailJob
+	err := row.Scan(
+		&i.ID,
+		&i.Payload,
+		&i.Status,
+		&i.Attempts,
+		&i.MaxAttempts,
+		&i.LastError,
+		&i.MessageID,
+		&i.RunAt,
+		&i.LockedUntil,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const completeEmailJob = `-- name: CompleteEmailJob :execrows
+UPDATE email_jobs SET
+    status = 'sent',
+    message_id = ?,
+    last_error = NULL,
+    locked_until = NULL,
+    updated_at = ?
+WHERE id = ? AND status = 'processing' AND locked_until = ?
+`
+
+type CompleteEmailJobParams struct {
+	MessageID   *string `db:"message_id" json:"message_id"`
+	UpdatedAt   string  `db:"updated_at" json:"updated_at"`
+	ID          string  `db:"id" json:"id"`
+	LockedUntil *string `db:"locked_until" json:"locked_until"`
+}
+
+func (q *Queries) CompleteEmailJob(ctx context.Context, arg CompleteEmailJobParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, completeEmailJob,
+		arg.MessageID,
+		arg.UpdatedAt,
+		arg.ID,
+		arg.LockedUntil,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const listEmailJobsByStatus = `-- name: ListEmailJobsByStatus :many
+SELECT id, payload, status, attempts, max_attempts, last_error, message_id, run_at, locked_until, created_at, updated_at FROM email_jobs
+WHERE status = ?
+ORDER BY created_at DESC
+LIMIT ?
+`
+
+type ListEmailJobsByStatusParams struct {
+	Status string `db:"status" json:"status"`
+	Limit  int64  `db:"limit" json:"limit"`
+}
+
+func (q *Queries) ListEmailJobsByStatus(ctx context.Context, arg ListEmailJobsByStatusParams) ([]EmailJob, error) {
+	rows, err := q.db.QueryContext(ctx, listEmailJobsByStatus, arg.Status, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []EmailJob
+	for rows.Next() {
+		var i EmailJob
+		if err := rows.Scan(
+			&i.ID,
+			&i.Payload,
+			&i.Status,
+			&i.Attempts,
+			&i.MaxAttempts,
+			&i.LastError,
+			&i.MessageID,
+			&i.RunAt,
+			&i.LockedUntil,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const newEmailJob = `-- name: NewEmailJob :one
+INSERT INTO email_jobs (payload, max_attempts, run_at, created_at, updated_at)
+VALUES (?, ?, ?, ?, ?)
+RETURNING id
+`
+
+type NewEmailJobParams struct {
+	Payload     string `db:"payload" json:"payload"`
+	MaxAttempts int64  `db:"max_attempts" json:"max_attempts"`
+	RunAt       string `db:"run_at" json:"run_at"`
+	CreatedAt   string `db:"created_at" json:"created_at"`
+	UpdatedAt   string `db:"updated_at" json:"updated_at"`
+}
+
+func (q *Queries) NewEmailJob(ctx context.Context, arg NewEmailJobParams) (string, error) {
+	row := q.db.QueryRowContext(ctx, newEmailJob,
+		arg.Payload,
+		arg.MaxAttempts,
+		arg.RunAt,
+		arg.CreatedAt,
+		arg.UpdatedAt,
+	)
+	var id string
+	err := row.Scan(&id)
+	return id, err
+}
+
+const redriveEmailJob = `-- name: RedriveEmailJob :execrows
+UPDATE email_jobs SET
+    status = 'pending',
+    attempts = 0,
+    last_error = NULL,
+    run_at = ?,
+    updated_at = ?
+WHERE id = ? AND status = 'dead'
+`
+
+type RedriveEmailJobParams struct {
+	RunAt     string `db:"run_at" json:"run_at"`
+	UpdatedAt string `db:"updated_at" json:"updated_at"`
+	ID        string `db:"id" json:"id"`
+}
+
+func (q *Queries) RedriveEmailJob(ctx context.Context, arg RedriveEmailJobParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, redriveEmailJob, arg.RunAt, arg.UpdatedAt, arg.ID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const retryEmailJob = `-- name: RetryEmailJob :execrows
+UPDATE email_jobs SET
+    status = 'pending',
+    last_error = ?,
+    run_at = ?,
+    locked_until = NULL,
+    updated_at = ?
+WHERE id = ? AND status = 'processing' AND locked_until = ?
+`
+
+type RetryEmailJobParams struct {
+	LastError   *string `db:"last_error" json:"last_error"`
+	RunAt       string  `db:"run_at" json:"run_at"`
+	UpdatedAt   string  `db:"updated_at" json:"updated_at"`
+	ID          string  `db:"id" json:"id"`
+	LockedUntil *string `db:"locked_until" json:"locked_until"`
+}
+
+func (q *Queries) RetryEmailJob(ctx context.Context, arg RetryEmailJobParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, retryEmailJob,
+		arg.LastError,
+		arg.RunAt,
+		arg.UpdatedAt,
+		arg.ID,
+		arg.LockedUntil,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
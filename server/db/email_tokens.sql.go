@@ -0,0 +1,86 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: email_tokens.sql
+
+package db
+
+import (
+	"context"
+)
+
+const deleteStaleEmailTokens = `-- name: DeleteStaleEmailTokens :execrows
+DELETE FROM email_tokens
+WHERE expires_at <= ?1 OR used_at IS NOT NULL
+`
+
+func (q *Queries) DeleteStaleEmailTokens(ctx context.Context, now string) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteStaleEmailTokens, now)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getEmailTokenByID = `-- name: GetEmailTokenByID :one
+SELECT id, user_id, created_at, expires_at, used_at FROM email_tokens WHERE id = ?
+`
+
+func (q *Queries) GetEmailTokenByID(ctx context.Context, id string) (EmailToken, error) {
+	row := q.db.QueryRowContext(ctx, getEmailTokenByID, id)
+	var i EmailToken
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+		&i.UsedAt,
+	)
+	return i, err
+}
+
+const newEmailToken = `-- name: NewEmailToken :one
+INSERT INTO email_tokens
+(user_id, created_at, expires_at)
+VALUES
+(?, ?, ?)
+RETURNING id, user_id, created_at, expires_at, used_at
+`
+
+type NewEmailTokenParams struct {
+	UserID    string `db:"user_id" json:"user_id"`
+	CreatedAt string `db:"created_at" json:"created_at"`
+	ExpiresAt string `db:"expires_at" json:"expires_at"`
+}
+
+func (q *Queries) NewEmailToken(ctx context.Context, arg NewEmailTokenParams) (EmailToken, error) {
+	row := q.db.QueryRowContext(ctx, newEmailToken, arg.UserID, arg.CreatedAt, arg.ExpiresAt)
+	var i EmailToken
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+		&i.UsedAt,
+	)
+	return i, err
+}
+
+const useEmailToken = `-- name: UseEmailToken :execrows
+UPDATE email_tokens
+SET used_at = ?
+WHERE id = ? AND used_at IS NULL
+`
+
+type UseEmailTokenParams struct {
+	UsedAt *string `db:"used_at" json:"used_at"`
+	ID     string  `db:"id" json:"id"`
+}
+
+func (q *Queries) UseEmailToken(ctx context.Context, arg UseEmailTokenParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, useEmailToken, arg.UsedAt, arg.ID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,104 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"github.com/juancwu/konbini/server/metrics"
+	"github.com/juancwu/konbini/server/tracing"
+	"strings"
+	"time"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentedDBTX reports the duration of every query it runs.
+type instrumentedDBTX struct {
+	db DBTX
+}
+
+// Instrument wraps a connection or a transaction so that the duration of every
+// query is recorded under its sqlc query name, both as a metric and as a span.
+// Use it when creating queries:
+//
+//	q := db.New(db.Instrument(conn))
+//	q = db.New(db.Instrument(tx))
+func Instrument(db DBTX) DBTX {
+	if _, ok := db.(*instrumentedDBTX); ok {
+		return db
+	}
+	return &instrumentedDBTX{db: db}
+}
+
+func (i *instrumentedDBTX) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	q := startQuery(ctx, query)
+	res, err := i.db.ExecContext(q.ctx, query, args...)
+	q.end(err)
+	return res, err
+}
+
+func (i *instrumentedDBTX) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return i.db.PrepareContext(ctx, query)
+}
+
+// QueryContext only times the query call, up to the first result being ready. sql.Rows can't be
+// wrapped to end the span on Close, so the time spent reading the rows is not part of it.
+func (i *instrumentedDBTX) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	q := startQuery(ctx, query)
+	rows, err := i.db.QueryContext(q.ctx, query, args...)
+	q.end(err)
+	return rows, err
+}
+
+func (i *instrumentedDBTX) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	q := startQuery(ctx, query)
+	row := i.db.QueryRowContext(q.ctx, query, args...)
+	err := row.Err()
+	if err == sql.ErrNoRows {
+		err = nil
+	}
+	q.end(err)
+	return row
+}
+
+// instrumentedQuery is a query in flight.
+type instrumentedQuery struct {
+	ctx   context.Context
+	name  string
+	span  trace.Span
+	start time.Time
+}
+
+// startQuery starts a client span named after the sqlc query.
+func startQuery(ctx context.Context, query string) *instrumentedQuery {
+	name := QueryName(query)
+	ctx, span := tracing.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemSqlite,
+			semconv.DBOperationName(name),
+			semconv.DBQueryText(query),
+		),
+	)
+	return &instrumentedQuery{ctx: ctx, name: name, span: span, start: time.Now()}
+}
+
+func (q *instrumentedQuery) end(err error) {
+	metrics.ObserveDBQuery(q.name, err, time.Since(q.start))
+	tracing.RecordError(q.span, err)
+	q.span.End()
+}
+
+// QueryName extracts the query name from the "-- name: GetUserByID :one" comment
+// that sqlc puts at the start of every generated query.
+func QueryName(query string) string {
+	const prefix = "-- name: "
+	if !strings.HasPrefix(query, prefix) {
+		return "unknown"
+	}
+	line := query[len(prefix):]
+	if i := strings.IndexAny(line, " \n"); i >= 0 {
+		line = line[:i]
+	}
+	return line
+}
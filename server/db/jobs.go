@@ -0,0 +1,57 @@
+package db
+
+import (
+	"github.com/juancwu/konbini/server/utils"
+	"time"
+)
+
+// The rows of the job tables are the jobs claimed by the workers of the jobs package.
+
+func (j EmailJob) JobID() string {
+	return j.ID
+}
+
+func (j EmailJob) JobAttempts() (int64, int64) {
+	return j.Attempts, j.MaxAttempts
+}
+
+func (j EmailJob) JobLease() string {
+	return jobLease(j.LockedUntil)
+}
+
+func (d WebhookDelivery) JobID() string {
+	return d.ID
+}
+
+func (d WebhookDelivery) JobAttempts() (int64, int64) {
+	return d.Attempts, d.MaxAttempts
+}
+
+func (d WebhookDelivery) JobLease() string {
+	return jobLease(d.LockedUntil)
+}
+
+func (e OutboxEvent) JobID() string {
+	return e.ID
+}
+
+func (e OutboxEvent) JobAttempts() (int64, int64) {
+	return e.Attempts, e.MaxAttempts
+}
+
+func (e OutboxEvent) JobLease() string {
+	return jobLease(e.LockedUntil)
+}
+
+// jobLease returns the locked_until set by the claim, it is unique to every claim of a job. The
+// driver reads it back without trailing zeros, it is formatted again to match the column.
+func jobLease(lockedUntil *string) string {
+	if lockedUntil == nil {
+		return ""
+	}
+	t, err := time.Parse(time.RFC3339Nano, *lockedUntil)
+	if err != nil {
+		return *lockedUntil
+	}
+	return utils.FormatRFC3339NanoFixed(t)
+}
@@ -0,0 +1,27 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+
+	"github.com/pressly/goose/v3"
+)
+
+// SchemaVersion is the version of the latest migration in .sqlc/migrations. It must be
+// updated together with every new migration so that readiness checks can tell when the
+// database has not been migrated for the running server.
+const SchemaVersion int64 = 20250314120000
+
+var gooseDialect = sync.OnceValue(func() error {
+	return goose.SetDialect("turso")
+})
+
+// GetMigrationVersion returns the current migration version as goose sees it, so a
+// migration that was rolled back no longer counts as applied.
+func GetMigrationVersion(ctx context.Context, conn *sql.DB) (int64, error) {
+	if err := gooseDialect(); err != nil {
+		return 0, err
+	}
+	return goose.GetDBVersionContext(ctx, conn)
+}
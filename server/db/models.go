@@ -29,6 +29,17 @@ type Bento struct {
 	Name      string `db:"name" json:"name"`
 	CreatedAt string `db:"created_at" json:"created_at"`
 	UpdatedAt string `db:"updated_at" json:"updated_at"`
+	Revision  int64  `db:"revision" json:"revision"`
+}
+
+type BentoChange struct {
+	ID          string `db:"id" json:"id"`
+	BentoID     string `db:"bento_id" json:"bento_id"`
+	Revision    int64  `db:"revision" json:"revision"`
+	UserID      string `db:"user_id" json:"user_id"`
+	Action      string `db:"action" json:"action"`
+	Ingredients string `db:"ingredients" json:"ingredients"`
+	CreatedAt   string `db:"created_at" json:"created_at"`
 }
 
 type BentoIngredient struct {
@@ -48,6 +59,16 @@ type BentoPermission struct {
 	UpdatedAt string `db:"updated_at" json:"updated_at"`
 }
 
+type BentoReveal struct {
+	ID          string `db:"id" json:"id"`
+	BentoID     string `db:"bento_id" json:"bento_id"`
+	UserID      string `db:"user_id" json:"user_id"`
+	Ingredients string `db:"ingredients" json:"ingredients"`
+	Ip          string `db:"ip" json:"ip"`
+	UserAgent   string `db:"user_agent" json:"user_agent"`
+	CreatedAt   string `db:"created_at" json:"created_at"`
+}
+
 type BentoToken struct {
 	ID         string  `db:"id" json:"id"`
 	BentoID    string  `db:"bento_id" json:"bento_id"`
@@ -58,6 +79,28 @@ type BentoToken struct {
 	ExpiresAt  *string `db:"expires_at" json:"expires_at"`
 }
 
+type EmailJob struct {
+	ID          string  `db:"id" json:"id"`
+	Payload     string  `db:"payload" json:"payload"`
+	Status      string  `db:"status" json:"status"`
+	Attempts    int64   `db:"attempts" json:"attempts"`
+	MaxAttempts int64   `db:"max_attempts" json:"max_attempts"`
+	LastError   *string `db:"last_error" json:"last_error"`
+	MessageID   *string `db:"message_id" json:"message_id"`
+	RunAt       string  `db:"run_at" json:"run_at"`
+	LockedUntil *string `db:"locked_until" json:"locked_until"`
+	CreatedAt   string  `db:"created_at" json:"created_at"`
+	UpdatedAt   string  `db:"updated_at" json:"updated_at"`
+}
+
+type EmailToken struct {
+	ID        string  `db:"id" json:"id"`
+	UserID    string  `db:"user_id" json:"user_id"`
+	CreatedAt string  `db:"created_at" json:"created_at"`
+	ExpiresAt string  `db:"expires_at" json:"expires_at"`
+	UsedAt    *string `db:"used_at" json:"used_at"`
+}
+
 type Group struct {
 	ID        string `db:"id" json:"id"`
 	Name      string `db:"name" json:"name"`
@@ -82,6 +125,22 @@ type GroupPermission struct {
 	UpdatedAt string `db:"updated_at" json:"updated_at"`
 }
 
+type OutboxEvent struct {
+	ID          string  `db:"id" json:"id"`
+	EventID     string  `db:"event_id" json:"event_id"`
+	Name        string  `db:"name" json:"name"`
+	Subscriber  string  `db:"subscriber" json:"subscriber"`
+	Payload     string  `db:"payload" json:"payload"`
+	Status      string  `db:"status" json:"status"`
+	Attempts    int64   `db:"attempts" json:"attempts"`
+	MaxAttempts int64   `db:"max_attempts" json:"max_attempts"`
+	LastError   *string `db:"last_error" json:"last_error"`
+	RunAt       string  `db:"run_at" json:"run_at"`
+	LockedUntil *string `db:"locked_until" json:"locked_until"`
+	CreatedAt   string  `db:"created_at" json:"created_at"`
+	UpdatedAt   string  `db:"updated_at" json:"updated_at"`
+}
+
 type TotpRecoveryCode struct {
 	ID        string  `db:"id" json:"id"`
 	UserID    string  `db:"user_id" json:"user_id"`
@@ -108,3 +167,33 @@ type UsersGroup struct {
 	GroupID   string `db:"group_id" json:"group_id"`
 	CreatedAt string `db:"created_at" json:"created_at"`
 }
+
+type Webhook struct {
+	ID        string  `db:"id" json:"id"`
+	UserID    string  `db:"user_id" json:"user_id"`
+	BentoID   *string `db:"bento_id" json:"bento_id"`
+	GroupID   *string `db:"group_id" json:"group_id"`
+	Url       string  `db:"url" json:"url"`
+	Secret    []byte  `db:"secret" json:"secret"`
+	Events    string  `db:"events" json:"events"`
+	CreatedAt string  `db:"created_at" json:"created_at"`
+	UpdatedAt string  `db:"updated_at" json:"updated_at"`
+}
+
+type WebhookDelivery struct {
+	ID             string  `db:"id" json:"id"`
+	WebhookID      string  `db:"webhook_id" json:"webhook_id"`
+	EventID        string  `db:"event_id" json:"event_id"`
+	EventType      string  `db:"event_type" json:"event_type"`
+	Payload        string  `db:"payload" json:"payload"`
+	Status         string  `db:"status" json:"status"`
+	Attempts       int64   `db:"attempts" json:"attempts"`
+	MaxAttempts    int64   `db:"max_attempts" json:"max_attempts"`
+	ResponseStatus *int64  `db:"response_status" json:"response_status"`
+	LastError      *string `db:"last_error" json:"last_error"`
+	RunAt          string  `db:"run_at" json:"run_at"`
+	LockedUntil    *string `db:"locked_until" json:"locked_until"`
+	DeliveredAt    *string `db:"delivered_at" json:"delivered_at"`
+	CreatedAt      string  `db:"created_at" json:"created_at"`
+	UpdatedAt      string  `db:"updated_at" json:"updated_at"`
+}
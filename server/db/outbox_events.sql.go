@@ -0,0 +1,183 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: outbox_events.sql
+
+package db
+
+import (
+	"context"
+)
+
+const buryOutboxEvent = `-- name: BuryOutboxEvent :execrows
+UPDATE outbox_events SET
+    status = 'dead',
+    last_error = ?,
+    locked_until = NULL,
+    updated_at = ?
+WHERE id = ? AND status = 'processing' AND locked_until = ?
+`
+
+type BuryOutboxEventParams struct {
+	LastError   *string `db:"last_error" json:"last_error"`
+	UpdatedAt   string  `db:"updated_at" json:"updated_at"`
+	ID          string  `db:"id" json:"id"`
+	LockedUntil *string `db:"locked_until" json:"locked_until"`
+}
+
+func (q *Queries) BuryOutboxEvent(ctx context.Context, arg BuryOutboxEventParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, buryOutboxEvent,
+		arg.LastError,
+		arg.UpdatedAt,
+		arg.ID,
+		arg.LockedUntil,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const claimOutboxEvent = `-- name: ClaimOutboxEvent :one
+UPDATE outbox_events SET
+    status = 'processing',
+    attempts = attempts + 1,
+    locked_until = ?1,
+    updated_at = ?2
+WHERE id = (
+    SELECT o.id FROM outbox_events o
+    WHERE (o.status = 'pending' AND o.run_at <= ?3)
+       OR (o.status = 'processing' AND o.locked_until <= ?3)
+    ORDER BY o.run_at
+    LIMIT 1
+)
+RETURNING id, event_id, name, subscriber, payload, status, attempts, max_attempts, last_error, run_at, locked_until, created_at, updated_at
+`
+
+type ClaimOutboxEventParams struct {
+	LockedUntil *string `db:"locked_until" json:"locked_until"`
+	UpdatedAt   string  `db:"updated_at" json:"updated_at"`
+	Now         string  `db:"now" json:"now"`
+}
+
+func (q *Queries) ClaimOutboxEvent(ctx context.Context, arg ClaimOutboxEventParams) (OutboxEvent, error) {
+	row := q.db.QueryRowContext(ctx, claimOutboxEvent, arg.LockedUntil, arg.UpdatedAt, arg.Now)
+	var i OutboxEvent
+	err := row.Scan(
+		&i.ID,
+		&i.EventID,
+		&i.Name,
+		&i.Subscriber,
+		&i.Payload,
+		&i.Status,
+		&i.Attempts,
+		&i.MaxAttempts,
+		&i.LastError,
+		&i.RunAt,
+		&i.LockedUntil,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const completeOutboxEvent = `-- name: CompleteOutboxEvent :execrows
+UPDATE outbox_events SET
+    status = 'done',
+    last_error = NULL,
+    locked_until = NULL,
+    updated_at = ?
+WHERE id = ? AND status = 'processing' AND locked_until = ?
+`
+
+type CompleteOutboxEventParams struct {
+	UpdatedAt   string  `db:"updated_at" json:"updated_at"`
+	ID          string  `db:"id" json:"id"`
+	LockedUntil *string `db:"locked_until" json:"locked_until"`
+}
+
+func (q *Queries) CompleteOutboxEvent(ctx context.Context, arg CompleteOutboxEventParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, completeOutboxEvent, arg.UpdatedAt, arg.ID, arg.LockedUntil)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteDoneOutboxEvents = `-- name: DeleteDoneOutboxEvents :execrows
+DELETE FROM outbox_events
+WHERE status = 'done' AND updated_at < ?
+`
+
+func (q *Queries) DeleteDoneOutboxEvents(ctx context.Context, updatedAt string) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteDoneOutboxEvents, updatedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const newOutboxEvent = `-- name: NewOutboxEvent :one
+INSERT INTO outbox_events (event_id, name, subscriber, payload, max_attempts, run_at, created_at, updated_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+RETURNING id
+`
+
+type NewOutboxEventParams struct {
+	EventID     string `db:"event_id" json:"event_id"`
+	Name        string `db:"name" json:"name"`
+	Subscriber  string `db:"subscriber" json:"subscriber"`
+	Payload     string `db:"payload" json:"payload"`
+	MaxAttempts int64  `db:"max_attempts" json:"max_attempts"`
+	RunAt       string `db:"run_at" json:"run_at"`
+	CreatedAt   string `db:"created_at" json:"created_at"`
+	UpdatedAt   string `db:"updated_at" json:"updated_at"`
+}
+
+func (q *Queries) NewOutboxEvent(ctx context.Context, arg NewOutboxEventParams) (string, error) {
+	row := q.db.QueryRowContext(ctx, newOutboxEvent,
+		arg.EventID,
+		arg.Name,
+		arg.Subscriber,
+		arg.Payload,
+		arg.MaxAttempts,
+		arg.RunAt,
+		arg.CreatedAt,
+		arg.UpdatedAt,
+	)
+	var id string
+	err := row.Scan(&id)
+	return id, err
+}
+
+const retryOutboxEvent = `-- name: RetryOutboxEvent :execrows
+UPDATE outbox_events SET
+    status = 'pending',
+    last_error = ?,
+    run_at = ?,
+    locked_until = NULL,
+    updated_at = ?
+WHERE id = ? AND status = 'processing' AND locked_until = ?
+`
+
+type RetryOutboxEventParams struct {
+	LastError   *string `db:"last_error" json:"last_error"`
+	RunAt       string  `db:"run_at" json:"run_at"`
+	UpdatedAt   string  `db:"updated_at" json:"updated_at"`
+	ID          string  `db:"id" json:"id"`
+	LockedUntil *string `db:"locked_until" json:"locked_until"`
+}
+
+func (q *Queries) RetryOutboxEvent(ctx context.Context, arg RetryOutboxEventParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, retryOutboxEvent,
+		arg.LastError,
+		arg.RunAt,
+		arg.UpdatedAt,
+		arg.ID,
+		arg.LockedUntil,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
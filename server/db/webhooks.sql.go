@@ -0,0 +1,448 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: webhooks.sql
+
+package db
+
+import (
+	"context"
+)
+
+const buryWebhookDelivery = `-- name: BuryWebhookDelivery :execrows
+UPDATE webhook_deliveries SET
+    status = 'dead',
+    response_status = ?,
+    last_error = ?,
+    locked_until = NULL,
+    updated_at = ?
+WHERE id = ? AND status = 'processing' AND locked_until = ?
+`
+
+type BuryWebhookDeliveryParams struct {
+	ResponseStatus *int64  `db:"response_status" json:"response_status"`
+	LastError      *string `db:"last_error" json:"last_error"`
+	UpdatedAt      string  `db:"updated_at" json:"updated_at"`
+	ID             string  `db:"id" json:"id"`
+	LockedUntil    *string `db:"locked_until" json:"locked_until"`
+}
+
+func (q *Queries) BuryWebhookDelivery(ctx context.Context, arg BuryWebhookDeliveryParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, buryWebhookDelivery,
+		arg.ResponseStatus,
+		arg.LastError,
+		arg.UpdatedAt,
+		arg.ID,
+		arg.LockedUntil,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const claimWebhookDelivery = `-- name: ClaimWebhookDelivery :one
+UPDATE webhook_deliveries SET
+    status = 'processing',
+    attempts = attempts + 1,
+    locked_until = ?1,
+    updated_at = ?2
+WHERE id = (
+    SELECT d.id FROM webhook_deliveries d
+    WHERE (d.status = 'pending' AND d.run_at <= ?3)
+       OR (d.status = 'processing' AND d.locked_until <= ?3)
+    ORDER BY d.run_at
+    LIMIT 1
+)
+RETURNING id, webhook_id, event_id, event_type, payload, status, attempts, max_attempts, response_status, last_error, run_at, locked_until, delivered_at, created_at, updated_at
+`
+
+type ClaimWebhookDeliveryParams struct {
+	LockedUntil *string `db:"locked_until" json:"locked_until"`
+	UpdatedAt   string  `db:"updated_at" json:"updated_at"`
+	Now         string  `db:"now" json:"now"`
+}
+
+func (q *Queries) ClaimWebhookDelivery(ctx context.Context, arg ClaimWebhookDeliveryParams) (WebhookDelivery, error) {
+	row := q.db.QueryRowContext(ctx, claimWebhookDelivery, arg.LockedUntil, arg.UpdatedAt, arg.Now)
+	var i WebhookDelivery
+	err := row.Scan(
+		&i.ID,
+		&i.WebhookID,
+		&i.EventID,
+		&i.EventType,
+		&i.Payload,
+		&i.Status,
+		&i.Attempts,
+		&i.MaxAttempts,
+		&i.ResponseStatus,
+		&i.LastError,
+		&i.RunAt,
+		&i.LockedUntil,
+		&i.DeliveredAt,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const completeWebhookDelivery = `-- name: CompleteWebhookDelivery :execrows
+UPDATE webhook_deliveries SET
+    status = 'delivered',
+    response_status = ?,
+    last_error = NULL,
+    locked_until = NULL,
+    delivered_at = ?,
+    updated_at = ?
+WHERE id = ? AND status = 'processing' AND locked_until = ?
+`
+
+type CompleteWebhookDeliveryParams struct {
+	ResponseStatus *int64  `db:"response_status" json:"response_status"`
+	DeliveredAt    *string `db:"delivered_at" json:"delivered_at"`
+	UpdatedAt      string  `db:"updated_at" json:"updated_at"`
+	ID             string  `db:"id" json:"id"`
+	LockedUntil    *string `db:"locked_until" json:"locked_until"`
+}
+
+func (q *Queries) CompleteWebhookDelivery(ctx context.Context, arg CompleteWebhookDeliveryParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, completeWebhookDelivery,
+		arg.ResponseStatus,
+		arg.DeliveredAt,
+		arg.UpdatedAt,
+		arg.ID,
+		arg.LockedUntil,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteWebhook = `-- name: DeleteWebhook :exec
+DELETE FROM webhooks WHERE id = ?
+`
+
+func (q *Queries) DeleteWebhook(ctx context.Context, id string) error {
+	_, err := q.db.ExecContext(ctx, deleteWebhook, id)
+	return err
+}
+
+const getWebhookByID = `-- name: GetWebhookByID :one
+SELECT id, user_id, bento_id, group_id, url, secret, events, created_at, updated_at FROM webhooks WHERE id = ?
+`
+
+func (q *Queries) GetWebhookByID(ctx context.Context, id string) (Webhook, error) {
+	row := q.db.QueryRowContext(ctx, getWebhookByID, id)
+	var i Webhook
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.BentoID,
+		&i.GroupID,
+		&i.Url,
+		&i.Secret,
+		&i.Events,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const getWebhookManagedByUser = `-- name: GetWebhookManagedByUser :one
+SELECT w.id, w.user_id, w.bento_id, w.group_id, w.url, w.secret, w.events, w.created_at, w.updated_at FROM webhooks w
+LEFT JOIN bentos b ON b.id = w.bento_id
+LEFT JOIN groups g ON g.id = w.group_id
+WHERE w.id = ?1 AND (b.user_id = ?2 OR g.owner_id = ?2)
+`
+
+type GetWebhookManagedByUserParams struct {
+	ID     string `db:"id" json:"id"`
+	UserID string `db:"user_id" json:"user_id"`
+}
+
+func (q *Queries) GetWebhookManagedByUser(ctx context.Context, arg GetWebhookManagedByUserParams) (Webhook, error) {
+	row := q.db.QueryRowContext(ctx, getWebhookManagedByUser, arg.ID, arg.UserID)
+	var i Webhook
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.BentoID,
+		&i.GroupID,
+		&i.Url,
+		&i.Secret,
+		&i.Events,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const listBentoWebhooks = `-- name: ListBentoWebhooks :many
+SELECT id, user_id, bento_id, group_id, url, secret, events, created_at, updated_at FROM webhooks WHERE bento_id = ? ORDER BY created_at
+`
+
+func (q *Queries) ListBentoWebhooks(ctx context.Context, bentoID *string) ([]Webhook, error) {
+	rows, err := q.db.QueryContext(ctx, listBentoWebhooks, bentoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Webhook
+	for rows.Next() {
+		var i Webhook
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.BentoID,
+			&i.GroupID,
+			&i.Url,
+			&i.Secret,
+			&i.Events,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listGroupWebhooks = `-- name: ListGroupWebhooks :many
+SELECT id, user_id, bento_id, group_id, url, secret, events, created_at, updated_at FROM webhooks WHERE group_id = ? ORDER BY created_at
+`
+
+func (q *Queries) ListGroupWebhooks(ctx context.Context, groupID *string) ([]Webhook, error) {
+	rows, err := q.db.QueryContext(ctx, listGroupWebhooks, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Webhook
+	for rows.Next() {
+		var i Webhook
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.BentoID,
+			&i.GroupID,
+			&i.Url,
+			&i.Secret,
+			&i.Events,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listWebhookDeliveries = `-- name: ListWebhookDeliveries :many
+SELECT id, webhook_id, event_id, event_type, payload, status, attempts, max_attempts, response_status, last_error, run_at, locked_until, delivered_at, created_at, updated_at FROM webhook_deliveries
+WHERE webhook_id = ?
+ORDER BY created_at DESC
+LIMIT ?
+`
+
+type ListWebhookDeliveriesParams struct {
+	WebhookID string `db:"webhook_id" json:"webhook_id"`
+	Limit     int64  `db:"limit" json:"limit"`
+}
+
+func (q *Queries) ListWebhookDeliveries(ctx context.Context, arg ListWebhookDeliveriesParams) ([]WebhookDelivery, error) {
+	rows, err := q.db.QueryContext(ctx, listWebhookDeliveries, arg.WebhookID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []WebhookDelivery
+	for rows.Next() {
+		var i WebhookDelivery
+		if err := rows.Scan(
+			&i.ID,
+			&i.WebhookID,
+			&i.EventID,
+			&i.EventType,
+			&i.Payload,
+			&i.Status,
+			&i.Attempts,
+			&i.MaxAttempts,
+			&i.ResponseStatus,
+			&i.LastError,
+			&i.RunAt,
+			&i.LockedUntil,
+			&i.DeliveredAt,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listWebhooksOfUserGroups = `-- name: ListWebhooksOfUserGroups :many
+SELECT w.id, w.user_id, w.bento_id, w.group_id, w.url, w.secret, w.events, w.created_at, w.updated_at FROM webhooks w
+WHERE w.group_id IN (
+    SELECT ug.group_id FROM users_groups ug WHERE ug.user_id = ?1
+    UNION
+    SELECT g.id FROM groups g WHERE g.owner_id = ?1
+)
+ORDER BY w.created_at
+`
+
+func (q *Queries) ListWebhooksOfUserGroups(ctx context.Context, userID string) ([]Webhook, error) {
+	rows, err := q.db.QueryContext(ctx, listWebhooksOfUserGroups, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Webhook
+	for rows.Next() {
+		var i Webhook
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.BentoID,
+			&i.GroupID,
+			&i.Url,
+			&i.Secret,
+			&i.Events,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const newWebhook = `-- name: NewWebhook :one
+INSERT INTO webhooks (user_id, bento_id, group_id, url, secret, events, created_at, updated_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+RETURNING id
+`
+
+type NewWebhookParams struct {
+	UserID    string  `db:"user_id" json:"user_id"`
+	BentoID   *string `db:"bento_id" json:"bento_id"`
+	GroupID   *string `db:"group_id" json:"group_id"`
+	Url       string  `db:"url" json:"url"`
+	Secret    []byte  `db:"secret" json:"secret"`
+	Events    string  `db:"events" json:"events"`
+	CreatedAt string  `db:"created_at" json:"created_at"`
+	UpdatedAt string  `db:"updated_at" json:"updated_at"`
+}
+
+func (q *Queries) NewWebhook(ctx context.Context, arg NewWebhookParams) (string, error) {
+	row := q.db.QueryRowContext(ctx, newWebhook,
+		arg.UserID,
+		arg.BentoID,
+		arg.GroupID,
+		arg.Url,
+		arg.Secret,
+		arg.Events,
+		arg.CreatedAt,
+		arg.UpdatedAt,
+	)
+	var id string
+	err := row.Scan(&id)
+	return id, err
+}
+
+const newWebhookDelivery = `-- name: NewWebhookDelivery :one
+INSERT INTO webhook_deliveries (webhook_id, event_id, event_type, payload, max_attempts, run_at, created_at, updated_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+RETURNING id
+`
+
+type NewWebhookDeliveryParams struct {
+	WebhookID   string `db:"webhook_id" json:"webhook_id"`
+	EventID     string `db:"event_id" json:"event_id"`
+	EventType   string `db:"event_type" json:"event_type"`
+	Payload     string `db:"payload" json:"payload"`
+	MaxAttempts int64  `db:"max_attempts" json:"max_attempts"`
+	RunAt       string `db:"run_at" json:"run_at"`
+	CreatedAt   string `db:"created_at" json:"created_at"`
+	UpdatedAt   string `db:"updated_at" json:"updated_at"`
+}
+
+func (q *Queries) NewWebhookDelivery(ctx context.Context, arg NewWebhookDeliveryParams) (string, error) {
+	row := q.db.QueryRowContext(ctx, newWebhookDelivery,
+		arg.WebhookID,
+		arg.EventID,
+		arg.EventType,
+		arg.Payload,
+		arg.MaxAttempts,
+		arg.RunAt,
+		arg.CreatedAt,
+		arg.UpdatedAt,
+	)
+	var id string
+	err := row.Scan(&id)
+	return id, err
+}
+
+const retryWebhookDelivery = `-- name: RetryWebhookDelivery :execrows
+UPDATE webhook_deliveries SET
+    status = 'pending',
+    response_status = ?,
+    last_error = ?,
+    run_at = ?,
+    locked_until = NULL,
+    updated_at = ?
+WHERE id = ? AND status = 'processing' AND locked_until = ?
+`
+
+type RetryWebhookDeliveryParams struct {
+	ResponseStatus *int64  `db:"response_status" json:"response_status"`
+	LastError      *string `db:"last_error" json:"last_error"`
+	RunAt          string  `db:"run_at" json:"run_at"`
+	UpdatedAt      string  `db:"updated_at" json:"updated_at"`
+	ID             string  `db:"id" json:"id"`
+	LockedUntil    *string `db:"locked_until" json:"locked_until"`
+}
+
+func (q *Queries) RetryWebhookDelivery(ctx context.Context, arg RetryWebhookDeliveryParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, retryWebhookDelivery,
+		arg.ResponseStatus,
+		arg.LastError,
+		arg.RunAt,
+		arg.UpdatedAt,
+		arg.ID,
+		arg.LockedUntil,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,267 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/juancwu/konbini/server/db"
+	"github.com/juancwu/konbini/server/jobs"
+	"github.com/juancwu/konbini/server/metrics"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+// Outbox event statuses as stored in the outbox_events table.
+const (
+	OUTBOX_PENDING    string = "pending"
+	OUTBOX_PROCESSING string = "processing"
+	OUTBOX_DONE       string = "done"
+	OUTBOX_DEAD       string = "dead"
+)
+
+var (
+	ErrOutboxNotSet error = errors.New("Events with async subscribers can't be published without an outbox store.")
+)
+
+// BusConfig configures the dispatcher of a Bus.
+type BusConfig struct {
+	Workers      int
+	MaxAttempts  int
+	PollInterval time.Duration
+	Lease        time.Duration
+	Timeout      time.Duration
+	BaseBackoff  time.Duration
+	MaxBackoff   time.Duration
+}
+
+// DefaultBusConfig returns the configuration used by the server.
+func DefaultBusConfig() BusConfig {
+	return BusConfig{
+		Workers:      2,
+		MaxAttempts:  10,
+		PollInterval: time.Second * 5,
+		Lease:        time.Minute,
+		Timeout:      time.Second * 30,
+		BaseBackoff:  time.Second,
+		MaxBackoff:   time.Minute * 10,
+	}
+}
+
+type syncHandler func(ctx context.Context, q *db.Queries, event Event) error
+
+type asyncHandler func(ctx context.Context, payload []byte) error
+
+// Bus delivers the events published by the handlers to the subscribers of other domains.
+//
+// Sync subscribers run in Publish with the queries of the transaction that made the change,
+// an error from one of them fails the change. Async subscribers get the event after the
+// transaction commits: Publish writes one outbox entry per async subscriber in the same
+// transaction, and a pool of workers dispatches the entries with retries. Async subscribers
+// get every event at least once, use EventID to tell a retried event apart.
+type Bus struct {
+	store  OutboxStore
+	cfg    BusConfig
+	worker *jobs.Worker[db.OutboxEvent, struct{}]
+
+	mu    sync.RWMutex
+	sync  map[string][]syncHandler
+	async map[string]map[string]asyncHandler
+}
+
+// NewBus creates a bus that writes async events to the store. Call Start to begin
+// dispatching them. A bus without a store only supports sync subscribers.
+func NewBus(store OutboxStore, cfg BusConfig) *Bus {
+	defaults := DefaultBusConfig()
+	if cfg.Workers <= 0 {
+		cfg.Workers = defaults.Workers
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = defaults.MaxAttempts
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = defaults.PollInterval
+	}
+	if cfg.Lease <= 0 {
+		cfg.Lease = defaults.Lease
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaults.Timeout
+	}
+	if cfg.BaseBackoff <= 0 {
+		cfg.BaseBackoff = defaults.BaseBackoff
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = defaults.MaxBackoff
+	}
+	b := &Bus{
+		store: store,
+		cfg:   cfg,
+		sync:  map[string][]syncHandler{},
+		async: map[string]map[string]asyncHandler{},
+	}
+	b.worker = jobs.NewWorker("outbox", store, jobs.Config{
+		Workers:      cfg.Workers,
+		PollInterval: cfg.PollInterval,
+		Lease:        cfg.Lease,
+		Timeout:      cfg.Timeout,
+		BaseBackoff:  cfg.BaseBackoff,
+		MaxBackoff:   cfg.MaxBackoff,
+	}, b.dispatch)
+	b.worker.Log = func(entry db.OutboxEvent, logger zerolog.Context) zerolog.Context {
+		return logger.Str("event", entry.Name).Str("subscriber", entry.Subscriber)
+	}
+	b.worker.Observe = func(entry db.OutboxEvent, _ struct{}, outcome jobs.Outcome) {
+		switch outcome {
+		case jobs.OUTCOME_DONE:
+			metrics.EventDispatch(entry.Subscriber, metrics.EVENT_DONE)
+		case jobs.OUTCOME_RETRY:
+			metrics.EventDispatch(entry.Subscriber, metrics.EVENT_RETRY)
+		case jobs.OUTCOME_DEAD:
+			metrics.EventDispatch(entry.Subscriber, metrics.EVENT_DEAD)
+		}
+	}
+	return b
+}
+
+// Subscribe registers a sync subscriber of the events of type E. It runs in Publish with the
+// queries of the transaction that made the change.
+func Subscribe[E Event](b *Bus, handle func(ctx context.Context, q *db.Queries, event E) error) {
+	var zero E
+	name := zero.EventName()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.sync[name] = append(b.sync[name], func(ctx context.Context, q *db.Queries, event Event) error {
+		e, ok := event.(E)
+		if !ok {
+			return fmt.Errorf("Event %s has unexpected type %T", name, event)
+		}
+		return handle(ctx, q, e)
+	})
+}
+
+// SubscribeAsync registers an async subscriber of the events of type E. The subscriber name
+// is stored with the outbox entries so it must be unique per event and must not change.
+// It panics if the name is already subscribed to the event.
+func SubscribeAsync[E Event](b *Bus, subscriber string, handle func(ctx context.Context, event E) error) {
+	var zero E
+	name := zero.EventName()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.async[name] == nil {
+		b.async[name] = map[string]asyncHandler{}
+	}
+	if _, ok := b.async[name][subscriber]; ok {
+		panic(fmt.Sprintf("events: %s is already subscribed to %s", subscriber, name))
+	}
+	b.async[name][subscriber] = func(ctx context.Context, payload []byte) error {
+		var e E
+		if err := json.Unmarshal(payload, &e); err != nil {
+			return err
+		}
+		return handle(ctx, e)
+	}
+}
+
+// Publish runs the sync subscribers of the events and writes an outbox entry for every async
+// subscriber. q must use the transaction of the change so that the entries are only visible
+// once it commits. Call Dispatch after the commit to wake the dispatcher.
+func (b *Bus) Publish(ctx context.Context, q *db.Queries, events ...Event) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, event := range events {
+		name := event.EventName()
+		for _, handle := range b.sync[name] {
+			if err := handle(ctx, q, event); err != nil {
+				return err
+			}
+		}
+
+		subscribers := b.async[name]
+		if len(subscribers) == 0 {
+			continue
+		}
+		if b.store == nil {
+			return ErrOutboxNotSet
+		}
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		entry := OutboxEntry{
+			EventID:     uuid.NewString(),
+			Name:        name,
+			Payload:     string(payload),
+			MaxAttempts: b.cfg.MaxAttempts,
+			RunAt:       time.Now(),
+		}
+		for subscriber := range subscribers {
+			entry.Subscriber = subscriber
+			if _, err := b.store.Enqueue(ctx, q, entry); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Dispatch wakes an idle worker to dispatch newly committed events, it does not block if one is already awake.
+func (b *Bus) Dispatch() {
+	b.worker.Nudge()
+}
+
+// Start launches the dispatcher workers. Workers stop when the context is cancelled or Stop is called.
+func (b *Bus) Start(ctx context.Context) {
+	b.worker.Start(ctx)
+}
+
+// Stop stops all workers and waits for in-flight subscribers to finish.
+func (b *Bus) Stop() {
+	b.worker.Stop()
+}
+
+// dispatch calls the subscriber of an outbox entry with the id of the event. A panic is
+// returned as an error that names the subscriber as the culprit.
+func (b *Bus) dispatch(ctx context.Context, entry db.OutboxEvent) (_ struct{}, err error) {
+	b.mu.RLock()
+	handle := b.async[entry.Name][entry.Subscriber]
+	b.mu.RUnlock()
+	if handle == nil {
+		return struct{}{}, jobs.Permanent(errors.New("No subscriber"))
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("Subscriber panicked: %v", r)
+		}
+	}()
+	return struct{}{}, handle(context.WithValue(ctx, eventIDKey{}, entry.EventID), []byte(entry.Payload))
+}
+
+type eventIDKey struct{}
+
+// EventID returns the id of the event being dispatched to an async subscriber. The id is the
+// same for every subscriber and every retry of the event. It is empty outside of a subscriber.
+func EventID(ctx context.Context) string {
+	id, _ := ctx.Value(eventIDKey{}).(string)
+	return id
+}
+
+var defaultBus = NewBus(nil, DefaultBusConfig())
+
+// SetDefaultBus sets the bus the handlers publish to.
+// It is not safe for concurrent use and should only be called during server boot.
+func SetDefaultBus(b *Bus) {
+	defaultBus = b
+}
+
+// DefaultBus returns the bus set by SetDefaultBus. Until then it is a bus without subscribers.
+func DefaultBus() *Bus {
+	return defaultBus
+}
@@ -0,0 +1,106 @@
+package events
+
+// Event is something that happened in one domain that other domains may react to. Events
+// are encoded as JSON when they are written to the outbox for async subscribers.
+type Event interface {
+	EventName() string
+}
+
+// Names of the events, they are stored in the outbox and must not change.
+const (
+	BENTO_INGREDIENT_CHANGED     string = "bento.ingredient_changed"
+	USER_LOGGED_IN               string = "user.logged_in"
+	GROUP_MEMBER_ADDED           string = "group.member_added"
+	TOTP_REMOVED                 string = "user.totp_removed"
+	BENTO_INGREDIENTS_REVEALED   string = "bento.ingredients_revealed"
+	EMAIL_VERIFICATION_REQUESTED string = "user.email_verification_requested"
+	GROUP_INVITATION_CREATED     string = "group.invitation_created"
+)
+
+// BentoIngredientChanged is published when ingredients are added to, replaced in or removed
+// from a bento. It only has the names of the ingredients, never their values.
+type BentoIngredientChanged struct {
+	BentoID     string   `json:"bento_id"`
+	Revision    int64    `json:"revision"`
+	Action      string   `json:"action"`
+	Ingredients []string `json:"ingredients"`
+	UserID      string   `json:"user_id"`
+}
+
+func (BentoIngredientChanged) EventName() string {
+	return BENTO_INGREDIENT_CHANGED
+}
+
+// BentoIngredientsRevealed is published when the values of ingredients are shown to a user,
+// i.e. with the reveal key of the TUI. It only has the names of the ingredients.
+type BentoIngredientsRevealed struct {
+	BentoID     string   `json:"bento_id"`
+	Ingredients []string `json:"ingredients"`
+	UserID      string   `json:"user_id"`
+	IP          string   `json:"ip"`
+	UserAgent   string   `json:"user_agent"`
+}
+
+func (BentoIngredientsRevealed) EventName() string {
+	return BENTO_INGREDIENTS_REVEALED
+}
+
+// UserLoggedIn is published when a user gets a new token with their credentials.
+type UserLoggedIn struct {
+	UserID    string `json:"user_id"`
+	TokenType string `json:"token_type"`
+	// RecoveryCode is true when the second factor was a recovery code.
+	RecoveryCode bool   `json:"recovery_code"`
+	IP           string `json:"ip"`
+	UserAgent    string `json:"user_agent"`
+}
+
+func (UserLoggedIn) EventName() string {
+	return USER_LOGGED_IN
+}
+
+// GroupMemberAdded is published when a user joins a group.
+type GroupMemberAdded struct {
+	GroupID string `json:"group_id"`
+	UserID  string `json:"user_id"`
+}
+
+func (GroupMemberAdded) EventName() string {
+	return GROUP_MEMBER_ADDED
+}
+
+// TOTPRemoved is published when a user removes their TOTP setup.
+type TOTPRemoved struct {
+	UserID string `json:"user_id"`
+}
+
+func (TOTPRemoved) EventName() string {
+	return TOTP_REMOVED
+}
+
+// EmailVerificationRequested is published when a user registers or asks for a new verification email.
+type EmailVerificationRequested struct {
+	UserID string `json:"user_id"`
+	Email  string `json:"email"`
+}
+
+func (EmailVerificationRequested) EventName() string {
+	return EMAIL_VERIFICATION_REQUESTED
+}
+
+// GroupInvitationCreated is published for every user invited to a group. The invitation token
+// is made by the subscriber that sends it, it is never stored in the outbox.
+type GroupInvitationCreated struct {
+	InvitationID string `json:"invitation_id"`
+	GroupID      string `json:"group_id"`
+	GroupName    string `json:"group_name"`
+	InvitorName  string `json:"invitor_name"`
+	UserName     string `json:"user_name"`
+	Email        string `json:"email"`
+	// ExpiresAt is the expiration of the invitation as it is stored in the database.
+	ExpiresAt string `json:"expires_at"`
+}
+
+func (GroupInvitationCreated) EventName() string {
+	return GROUP_INVITATION_CREATED
+}
@@ -0,0 +1,147 @@
+package events
+
+import (
+	"context"
+	"github.com/juancwu/konbini/server/db"
+	"github.com/juancwu/konbini/server/jobs"
+	"github.com/juancwu/konbini/server/utils"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// OutboxEntry is an event waiting to be dispatched to one async subscriber.
+type OutboxEntry struct {
+	EventID     string
+	Name        string
+	Subscriber  string
+	Payload     string
+	MaxAttempts int
+	RunAt       time.Time
+}
+
+// OutboxStore persists the events of async subscribers. Subscribers have no result to record.
+type OutboxStore interface {
+	jobs.Store[db.OutboxEvent, struct{}]
+	// Enqueue writes the entry with q, the queries of the transaction that made the change.
+	Enqueue(ctx context.Context, q *db.Queries, entry OutboxEntry) (string, error)
+}
+
+// DBOutboxStore is an OutboxStore backed by the outbox_events table.
+type DBOutboxStore struct {
+	connector *db.DBConnector
+}
+
+// NewDBOutboxStore creates an OutboxStore that uses the given connector.
+func NewDBOutboxStore(connector *db.DBConnector) *DBOutboxStore {
+	return &DBOutboxStore{connector: connector}
+}
+
+func (s *DBOutboxStore) Enqueue(ctx context.Context, q *db.Queries, entry OutboxEntry) (string, error) {
+	now := utils.FormatRFC3339NanoFixed(time.Now())
+	return q.NewOutboxEvent(ctx, db.NewOutboxEventParams{
+		EventID:     entry.EventID,
+		Name:        entry.Name,
+		Subscriber:  entry.Subscriber,
+		Payload:     entry.Payload,
+		MaxAttempts: int64(entry.MaxAttempts),
+		RunAt:       utils.FormatRFC3339NanoFixed(entry.RunAt),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	})
+}
+
+func (s *DBOutboxStore) Claim(ctx context.Context, now time.Time, lease time.Duration) (db.OutboxEvent, error) {
+	conn, err := s.connector.Connect()
+	if err != nil {
+		return db.OutboxEvent{}, err
+	}
+	defer conn.Close()
+
+	lockedUntil := utils.FormatRFC3339NanoFixed(now.Add(lease))
+	return db.New(db.Instrument(conn)).ClaimOutboxEvent(ctx, db.ClaimOutboxEventParams{
+		LockedUntil: &lockedUntil,
+		UpdatedAt:   utils.FormatRFC3339NanoFixed(now),
+		Now:         utils.FormatRFC3339NanoFixed(now),
+	})
+}
+
+func (s *DBOutboxStore) Complete(ctx context.Context, id string, lease string, _ struct{}) error {
+	conn, err := s.connector.Connect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return jobs.LeaseHeld(db.New(db.Instrument(conn)).CompleteOutboxEvent(ctx, db.CompleteOutboxEventParams{
+		UpdatedAt:   utils.FormatRFC3339NanoFixed(time.Now()),
+		ID:          id,
+		LockedUntil: &lease,
+	}))
+}
+
+func (s *DBOutboxStore) Retry(ctx context.Context, id string, lease string, runAt time.Time, _ struct{}, lastError string) error {
+	conn, err := s.connector.Connect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return jobs.LeaseHeld(db.New(db.Instrument(conn)).RetryOutboxEvent(ctx, db.RetryOutboxEventParams{
+		LastError:   &lastError,
+		RunAt:       utils.FormatRFC3339NanoFixed(runAt),
+		UpdatedAt:   utils.FormatRFC3339NanoFixed(time.Now()),
+		ID:          id,
+		LockedUntil: &lease,
+	}))
+}
+
+func (s *DBOutboxStore) Bury(ctx context.Context, id string, lease string, _ struct{}, lastError string) error {
+	conn, err := s.connector.Connect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return jobs.LeaseHeld(db.New(db.Instrument(conn)).BuryOutboxEvent(ctx, db.BuryOutboxEventParams{
+		LastError:   &lastError,
+		UpdatedAt:   utils.FormatRFC3339NanoFixed(time.Now()),
+		ID:          id,
+		LockedUntil: &lease,
+	}))
+}
+
+// StartOutboxCleanup periodically deletes the outbox entries that were dispatched more than
+// retention ago. Dead entries are kept. It stops when the context is cancelled.
+func StartOutboxCleanup(ctx context.Context, connector *db.DBConnector, interval time.Duration, retention time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			n, err := deleteDoneOutboxEvents(ctx, connector, time.Now().Add(-retention))
+			if err != nil {
+				log.Error().Err(err).Msg("Failed to delete dispatched outbox events")
+				continue
+			}
+			if n > 0 {
+				log.Info().Int64("count", n).Msg("Deleted dispatched outbox events")
+			}
+		}
+	}()
+}
+
+func deleteDoneOutboxEvents(ctx context.Context, connector *db.DBConnector, before time.Time) (int64, error) {
+	conn, err := connector.Connect()
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	return db.New(db.Instrument(conn)).DeleteDoneOutboxEvents(ctx, utils.FormatRFC3339NanoFixed(before))
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	commonApi "github.com/juancwu/konbini/common/api"
+	"github.com/juancwu/konbini/server/middlewares"
+	"github.com/juancwu/konbini/server/services"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ListEmailJobs lists the email jobs with the given status. Defaults to dead jobs.
+func ListEmailJobs(queue *services.EmailQueue) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		status := c.QueryParam("status")
+		if status == "" {
+			status = services.EMAIL_JOB_DEAD
+		}
+		switch status {
+		case services.EMAIL_JOB_PENDING, services.EMAIL_JOB_PROCESSING, services.EMAIL_JOB_SENT, services.EMAIL_JOB_DEAD:
+		default:
+			return APIError{
+				Code:          http.StatusBadRequest,
+				PublicMessage: "Invalid status. Expecting one of: pending, processing, sent, dead.",
+				ErrorCode:     commonApi.ErrorCodeBadRequest,
+			}
+		}
+
+		limit := 50
+		if raw := c.QueryParam("limit"); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n <= 0 || n > 500 {
+				return APIError{
+					Code:          http.StatusBadRequest,
+					PublicMessage: "Invalid limit. Expecting a number between 1 and 500.",
+					ErrorCode:     commonApi.ErrorCodeBadRequest,
+				}
+			}
+			limit = n
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request().Context(), FiveSeconds)
+		defer cancel()
+
+		jobs, err := queue.List(ctx, status, limit)
+		if err != nil {
+			return err
+		}
+
+		res := make([]commonApi.EmailJobResponse, len(jobs))
+		for i, job := range jobs {
+			var msg services.EmailMessage
+			if err := json.Unmarshal([]byte(job.Payload), &msg); err != nil {
+				middlewares.GetLogger(c).Error().Err(err).Str("job_id", job.ID).Msg("Failed to decode email job payload")
+			}
+			res[i] = commonApi.EmailJobResponse{
+				ID:          job.ID,
+				Status:      job.Status,
+				To:          msg.To,
+				Subject:     msg.Subject,
+				Attempts:    job.Attempts,
+				MaxAttempts: job.MaxAttempts,
+				LastError:   job.LastError,
+				MessageID:   job.MessageID,
+				RunAt:       job.RunAt,
+				CreatedAt:   job.CreatedAt,
+				UpdatedAt:   job.UpdatedAt,
+			}
+		}
+
+		return c.JSON(http.StatusOK, res)
+	}
+}
+
+// RedriveEmailJob moves a dead email job back into the queue.
+func RedriveEmailJob(queue *services.EmailQueue) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		id := c.Param("id")
+		if id == "" {
+			return APIError{
+				Code:          http.StatusBadRequest,
+				PublicMessage: "Missing email job id",
+				ErrorCode:     commonApi.ErrorCodeBadRequest,
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request().Context(), FiveSeconds)
+		defer cancel()
+
+		err := queue.Redrive(ctx, id)
+		if err != nil {
+			if err == services.ErrEmailJobNotRedrive {
+				return APIError{
+					Code:          http.StatusNotFound,
+					PublicMessage: "No dead email job found",
+					ErrorCode:     commonApi.ErrorCodeEmailJobNotFound,
+					InternalError: err,
+				}
+			}
+			return err
+		}
+
+		return c.NoContent(http.StatusAccepted)
+	}
+}
@@ -5,10 +5,11 @@ import (
 	"database/sql"
 	"encoding/hex"
 	"errors"
-	"fmt"
 	commonApi "github.com/juancwu/konbini/common/api"
 	"github.com/juancwu/konbini/server/db"
+	"github.com/juancwu/konbini/server/events"
 	"github.com/juancwu/konbini/server/memcache"
+	"github.com/juancwu/konbini/server/metrics"
 	"github.com/juancwu/konbini/server/middlewares"
 	"github.com/juancwu/konbini/server/services"
 	"github.com/juancwu/konbini/server/utils"
@@ -20,13 +21,6 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
-// RegisterRequest represents the request body for register route.
-type RegisterRequest struct {
-	Email    string `json:"email" validate:"required,email"`
-	Password string `json:"password" validate:"required,min=12,max=32"`
-	NickName string `json:"nickname" validate:"required,min=3,max=32"`
-}
-
 // Register is a handler function that registers a user for Konbini.
 func Register(connector *db.DBConnector) echo.HandlerFunc {
 	return func(c echo.Context) error {
@@ -35,8 +29,8 @@ func Register(connector *db.DBConnector) echo.HandlerFunc {
 			return err
 		}
 		defer conn.Close()
-		queries := db.New(conn)
-		body, ok := c.Get(middlewares.JSON_BODY_KEY).(*RegisterRequest)
+		queries := db.New(db.Instrument(conn))
+		body, ok := c.Get(middlewares.JSON_BODY_KEY).(*commonApi.RegisterRequest)
 		if !ok {
 			return errors.New("Failed to get JSON body from context.")
 		}
@@ -55,6 +49,7 @@ func Register(connector *db.DBConnector) echo.HandlerFunc {
 			return APIError{
 				Code:          http.StatusBadRequest,
 				PublicMessage: "Email has already been taken.",
+				ErrorCode:     commonApi.ErrorCodeEmailTaken,
 			}
 		}
 
@@ -64,6 +59,13 @@ func Register(connector *db.DBConnector) echo.HandlerFunc {
 			return err
 		}
 
+		// the verification email is only sent if the user and its token are created
+		tx, err := conn.Begin()
+		if err != nil {
+			return err
+		}
+		queries = db.New(db.Instrument(tx))
+
 		now := time.Now()
 		userId, err := queries.CreateUser(ctx, db.CreateUserParams{
 			Email:     body.Email,
@@ -73,11 +75,14 @@ func Register(connector *db.DBConnector) echo.HandlerFunc {
 			UpdatedAt: utils.FormatRFC3339NanoFixed(now),
 		})
 		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		err = events.DefaultBus().Publish(ctx, queries, events.EmailVerificationRequested{UserID: userId, Email: body.Email})
+		if err != nil {
+			tx.Rollback()
 			return err
 		}
-
-		logger.Info().Str("user_id", userId).Msg("New user registered.")
-		go sendVerificationEmail(userId, body.Email, logger)
 
 		// generate a partial token so that the user can immediately setup TOTP
 		exp := now.Add(time.Hour * 24 * 7)
@@ -89,17 +94,27 @@ func Register(connector *db.DBConnector) echo.HandlerFunc {
 			ExpiresAt: utils.FormatRFC3339NanoFixed(exp),
 		})
 		if err != nil {
+			tx.Rollback()
 			return err
 		}
 		authToken, err = services.NewAuthToken(dbJwt.ID, userId, services.PARTIAL_USER_TOKEN_TYPE, exp)
 		if err != nil {
+			tx.Rollback()
 			return err
 		}
 
 		token, err := authToken.Package()
 		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if err := tx.Commit(); err != nil {
 			return err
 		}
+		events.DefaultBus().Dispatch()
+
+		logger.Info().Str("user_id", userId).Msg("New user registered.")
 
 		return c.JSON(
 			http.StatusCreated,
@@ -112,7 +127,9 @@ func Register(connector *db.DBConnector) echo.HandlerFunc {
 }
 
 func Login(connector *db.DBConnector) echo.HandlerFunc {
-	return func(c echo.Context) error {
+	return func(c echo.Context) (err error) {
+		defer func() { metrics.Login(err == nil) }()
+
 		body, err := middlewares.GetJsonBody[commonApi.LoginRequest](c)
 		if err != nil {
 			return err
@@ -124,7 +141,7 @@ func Login(connector *db.DBConnector) echo.HandlerFunc {
 		}
 		defer conn.Close()
 
-		queries := db.New(conn)
+		queries := db.New(db.Instrument(conn))
 
 		ctx, cancel := context.WithTimeout(c.Request().Context(), time.Minute)
 		defer cancel()
@@ -143,6 +160,7 @@ func Login(connector *db.DBConnector) echo.HandlerFunc {
 			return APIError{
 				Code:          http.StatusBadRequest,
 				PublicMessage: "Invalid credentials. Please try again.",
+				ErrorCode:     commonApi.ErrorCodeInvalidCredentials,
 			}
 		}
 
@@ -154,9 +172,15 @@ func Login(connector *db.DBConnector) echo.HandlerFunc {
 				return APIError{
 					Code:          http.StatusBadRequest,
 					PublicMessage: "User has TOTP setup, code is required. Make a new login request with the totp_code field in the body.",
+					ErrorCode:     commonApi.ErrorCodeTOTPRequired,
 				}
 			}
 
+			// the lockout applies to correct codes too, otherwise codes can be guessed while locked out
+			if err := middlewares.CheckTOTPAttempts(c, user.ID); err != nil {
+				return err
+			}
+
 			// recovery code
 			if len(*body.TOTPCode) == 32 {
 				// check database for recovery code
@@ -166,30 +190,14 @@ func Login(connector *db.DBConnector) echo.HandlerFunc {
 				})
 				if err != nil {
 					if err == sql.ErrNoRows {
-						// Record failed TOTP recovery code attempt
-						middlewares.RecordFailedTOTPAttempt(user.ID)
-
-						// Check if user is now rate limited after this attempt
-						key := middlewares.TOTPAttemptsKeyPrefix + user.ID
-						attemptsData, found := memcache.Cache().Get(key)
-
-						if found {
-							attempts := attemptsData.(middlewares.TOTPAttempts)
-							if attempts.Attempts >= middlewares.MaxTOTPAttempts {
-								cooldownEnd := attempts.LastAttempt.Add(middlewares.TOTPCooldownDuration)
-								retryAfter := int(time.Until(cooldownEnd).Seconds())
-								c.Response().Header().Set("Retry-After", fmt.Sprintf("%d", retryAfter))
-
-								return APIError{
-									Code:          http.StatusTooManyRequests,
-									PublicMessage: fmt.Sprintf("Too many failed attempts. Try again in %d seconds.", retryAfter),
-								}
-							}
+						if err := middlewares.FailTOTPAttempt(c, user.ID); err != nil {
+							return err
 						}
 
 						return APIError{
 							Code:           http.StatusBadRequest,
 							PublicMessage:  "Invalid recovery code.",
+							ErrorCode:      commonApi.ErrorCodeInvalidRecoveryCode,
 							PrivateMessage: "No recovery code found in database.",
 							InternalError:  err,
 						}
@@ -202,30 +210,14 @@ func Login(connector *db.DBConnector) echo.HandlerFunc {
 				}
 
 				if recoveryCode.Used {
-					// Record failed TOTP attempt for used recovery code
-					middlewares.RecordFailedTOTPAttempt(user.ID)
-
-					// Check if user is now rate limited after this attempt
-					key := middlewares.TOTPAttemptsKeyPrefix + user.ID
-					attemptsData, found := memcache.Cache().Get(key)
-
-					if found {
-						attempts := attemptsData.(middlewares.TOTPAttempts)
-						if attempts.Attempts >= middlewares.MaxTOTPAttempts {
-							cooldownEnd := attempts.LastAttempt.Add(middlewares.TOTPCooldownDuration)
-							retryAfter := int(time.Until(cooldownEnd).Seconds())
-							c.Response().Header().Set("Retry-After", fmt.Sprintf("%d", retryAfter))
-
-							return APIError{
-								Code:          http.StatusTooManyRequests,
-								PublicMessage: fmt.Sprintf("Too many failed attempts. Try again in %d seconds.", retryAfter),
-							}
-						}
+					if err := middlewares.FailTOTPAttempt(c, user.ID); err != nil {
+						return err
 					}
 
 					return APIError{
 						Code:           http.StatusBadRequest,
 						PublicMessage:  "Recovery code has been used before. Please use another one.",
+						ErrorCode:      commonApi.ErrorCodeRecoveryCodeUsed,
 						PrivateMessage: "Used recovery code. Reject.",
 					}
 				}
@@ -242,59 +234,60 @@ func Login(connector *db.DBConnector) echo.HandlerFunc {
 					}
 				}
 			} else if !totp.Validate(*body.TOTPCode, *user.TotpSecret) {
-				// Record failed TOTP attempt
-				middlewares.RecordFailedTOTPAttempt(user.ID)
-
-				// Check if user is now rate limited after this attempt
-				key := middlewares.TOTPAttemptsKeyPrefix + user.ID
-				attemptsData, found := memcache.Cache().Get(key)
-
-				if found {
-					attempts := attemptsData.(middlewares.TOTPAttempts)
-					if attempts.Attempts >= middlewares.MaxTOTPAttempts {
-						cooldownEnd := attempts.LastAttempt.Add(middlewares.TOTPCooldownDuration)
-						retryAfter := int(time.Until(cooldownEnd).Seconds())
-						c.Response().Header().Set("Retry-After", fmt.Sprintf("%d", retryAfter))
-
-						return APIError{
-							Code:          http.StatusTooManyRequests,
-							PublicMessage: fmt.Sprintf("Too many failed TOTP attempts. Try again in %d seconds.", retryAfter),
-						}
-					}
-
-					// Add rate limit headers
-					remainingAttempts := middlewares.MaxTOTPAttempts - attempts.Attempts
-					if remainingAttempts < 0 {
-						remainingAttempts = 0
-					}
-					c.Response().Header().Set("X-RateLimit-Limit", fmt.Sprintf("%d", middlewares.MaxTOTPAttempts))
-					c.Response().Header().Set("X-RateLimit-Remaining", fmt.Sprintf("%d", remainingAttempts))
-					c.Response().Header().Set("X-RateLimit-Reset", fmt.Sprintf("%d", attempts.LastAttempt.Add(middlewares.TOTPCooldownDuration).Unix()))
+				if err := middlewares.FailTOTPAttempt(c, user.ID); err != nil {
+					return err
 				}
 
 				return APIError{
 					Code:          http.StatusBadRequest,
 					PublicMessage: "Invalid TOTP code.",
+					ErrorCode:     commonApi.ErrorCodeInvalidTOTPCode,
 				}
 			}
 
 			// Reset rate limiting counter on successful TOTP validation
-			middlewares.ResetTOTPAttempts(user.ID)
+			middlewares.ResetTOTPAttempts(c.Request().Context(), user.ID)
 
 			tokType = services.FULL_USER_TOKEN_TYPE
 		} else {
 			tokType = services.FULL_USER_TOKEN_TYPE
 		}
 
+		// the login event is only recorded if the token is created
+		tx, err := conn.Begin()
+		if err != nil {
+			return err
+		}
+		queries = db.New(db.Instrument(tx))
+
 		authToken, err := newAuthToken(ctx, queries, user.ID, tokType)
 		if err != nil {
+			tx.Rollback()
 			return err
 		}
 
 		token, err := authToken.Package()
 		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		err = events.DefaultBus().Publish(ctx, queries, events.UserLoggedIn{
+			UserID:       user.ID,
+			TokenType:    tokType.String(),
+			RecoveryCode: body.TOTPCode != nil && len(*body.TOTPCode) == 32,
+			IP:           c.RealIP(),
+			UserAgent:    c.Request().UserAgent(),
+		})
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if err := tx.Commit(); err != nil {
 			return err
 		}
+		events.DefaultBus().Dispatch()
 
 		return c.JSON(http.StatusOK, commonApi.LoginResponse{Token: token, Type: tokType.String()})
 	}
@@ -307,6 +300,7 @@ func VerifyEmail(connector *db.DBConnector) echo.HandlerFunc {
 			return APIError{
 				Code:          http.StatusBadRequest,
 				PublicMessage: "Missing token query parameter.",
+				ErrorCode:     commonApi.ErrorCodeBadRequest,
 			}
 		}
 
@@ -324,33 +318,46 @@ func VerifyEmail(connector *db.DBConnector) echo.HandlerFunc {
 			return APIError{
 				Code:           http.StatusBadRequest,
 				PublicMessage:  "Invalid.",
+				ErrorCode:      commonApi.ErrorCodeInvalidToken,
 				PrivateMessage: "Failed to extract email token id from token string.",
 				InternalError:  err,
 			}
 		}
 
-		emailToken, err := getEmailTokenFromCache(id)
+		queries := db.New(db.Instrument(conn))
+
+		emailToken, err := queries.GetEmailTokenByID(ctx, id)
 		if err != nil {
-			if err == memcache.ErrNotFound {
+			if err == sql.ErrNoRows {
 				return APIError{
 					Code:           http.StatusBadRequest,
 					PublicMessage:  "Invalid link",
-					PrivateMessage: "email token not found in memory cache.",
+					ErrorCode:      commonApi.ErrorCodeInvalidToken,
+					PrivateMessage: "email token not found in database.",
 					InternalError:  err,
 				}
 			}
 			return err
 		}
 
-		if time.Now().UTC().After(emailToken.ExpiresAt) {
+		if emailToken.UsedAt != nil {
+			return APIError{
+				Code:           http.StatusBadRequest,
+				PublicMessage:  "Invalid link",
+				ErrorCode:      commonApi.ErrorCodeInvalidToken,
+				PrivateMessage: "email token has already been used.",
+			}
+		}
+
+		if utils.FormatRFC3339NanoFixed(time.Now()) >= emailToken.ExpiresAt {
 			return APIError{
 				Code:          http.StatusBadRequest,
 				PublicMessage: "Expired.",
+				ErrorCode:     commonApi.ErrorCodeTokenExpired,
 			}
 		}
 
-		userId := emailToken.UserId
-		queries := db.New(conn)
+		userId := emailToken.UserID
 
 		isVerified, err := queries.IsUserEmailVerified(ctx, userId)
 		if err != nil {
@@ -361,6 +368,38 @@ func VerifyEmail(connector *db.DBConnector) echo.HandlerFunc {
 			return c.String(http.StatusOK, "verified")
 		}
 
+		logger := middlewares.GetLogger(c)
+		tx, err := conn.Begin()
+		if err != nil {
+			return err
+		}
+		queries = db.New(db.Instrument(tx))
+
+		// the token is marked as used in the same transaction so that a link
+		// can only verify once even if it is opened on multiple instances
+		usedAt := utils.FormatRFC3339NanoFixed(time.Now())
+		n, err := queries.UseEmailToken(ctx, db.UseEmailTokenParams{
+			UsedAt: &usedAt,
+			ID:     emailToken.ID,
+		})
+		if err != nil {
+			if err := tx.Rollback(); err != nil {
+				logger.Error().Err(err).Msg("failed to rollback")
+			}
+			return err
+		}
+		if n != 1 {
+			if err := tx.Rollback(); err != nil {
+				logger.Error().Err(err).Msg("failed to rollback")
+			}
+			return APIError{
+				Code:           http.StatusBadRequest,
+				PublicMessage:  "Invalid link",
+				ErrorCode:      commonApi.ErrorCodeInvalidToken,
+				PrivateMessage: "email token was used concurrently.",
+			}
+		}
+
 		err = queries.SetUserEmailVerifiedStatus(
 			ctx,
 			db.SetUserEmailVerifiedStatusParams{
@@ -370,6 +409,13 @@ func VerifyEmail(connector *db.DBConnector) echo.HandlerFunc {
 			},
 		)
 		if err != nil {
+			if err := tx.Rollback(); err != nil {
+				logger.Error().Err(err).Msg("failed to rollback")
+			}
+			return err
+		}
+
+		if err := tx.Commit(); err != nil {
 			return err
 		}
 
@@ -388,8 +434,17 @@ func ResendVerificationEmail(connector *db.DBConnector) echo.HandlerFunc {
 			return c.String(http.StatusBadRequest, "Email already verified.")
 		}
 
-		logger := middlewares.GetLogger(c)
-		go sendVerificationEmail(user.ID, user.Email, logger)
+		conn, err := connector.Connect()
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		err = events.DefaultBus().Publish(c.Request().Context(), db.New(db.Instrument(conn)), events.EmailVerificationRequested{UserID: user.ID, Email: user.Email})
+		if err != nil {
+			return err
+		}
+		events.DefaultBus().Dispatch()
 
 		return nil
 	}
@@ -407,6 +462,7 @@ func SetupTOTP(connector *db.DBConnector) echo.HandlerFunc {
 			return APIError{
 				Code:          http.StatusBadRequest,
 				PublicMessage: "To re-setup TOTP please remove the TOTP first.",
+				ErrorCode:     commonApi.ErrorCodeTOTPAlreadySetup,
 			}
 		}
 
@@ -421,6 +477,7 @@ func SetupTOTP(connector *db.DBConnector) echo.HandlerFunc {
 			return APIError{
 				Code:           http.StatusInternalServerError,
 				PublicMessage:  "Failed to setup TOTP. Please try again.",
+				ErrorCode:      commonApi.ErrorCodeInternal,
 				PrivateMessage: "Error generating TOTP",
 				InternalError:  err,
 			}
@@ -431,13 +488,14 @@ func SetupTOTP(connector *db.DBConnector) echo.HandlerFunc {
 			return APIError{
 				Code:           http.StatusInternalServerError,
 				PublicMessage:  "Failed to setup TOTP. Please try again.",
+				ErrorCode:      commonApi.ErrorCodeInternal,
 				PrivateMessage: "Error connecting to database",
 				InternalError:  err,
 			}
 		}
 		defer conn.Close()
 
-		q := db.New(conn)
+		q := db.New(db.Instrument(conn))
 
 		secret := key.Secret()
 		err = q.SetUserTOTPSecret(c.Request().Context(), db.SetUserTOTPSecretParams{
@@ -449,6 +507,7 @@ func SetupTOTP(connector *db.DBConnector) echo.HandlerFunc {
 			return APIError{
 				Code:           http.StatusInternalServerError,
 				PublicMessage:  "Failed to setup TOTP. Please try again.",
+				ErrorCode:      commonApi.ErrorCodeInternal,
 				PrivateMessage: "Error saving user TOTP secret.",
 				InternalError:  err,
 			}
@@ -473,6 +532,7 @@ func SetupTOTPLock(connector *db.DBConnector) echo.HandlerFunc {
 			return APIError{
 				Code:          http.StatusBadRequest,
 				PublicMessage: "No TOTP setup yet.",
+				ErrorCode:     commonApi.ErrorCodeTOTPNotSetup,
 			}
 		}
 
@@ -480,6 +540,7 @@ func SetupTOTPLock(connector *db.DBConnector) echo.HandlerFunc {
 			return APIError{
 				Code:          http.StatusBadRequest,
 				PublicMessage: "To re-setup TOTP please remove it first.",
+				ErrorCode:     commonApi.ErrorCodeTOTPAlreadySetup,
 			}
 		}
 
@@ -498,6 +559,7 @@ func SetupTOTPLock(connector *db.DBConnector) echo.HandlerFunc {
 			return APIError{
 				Code:          http.StatusBadRequest,
 				PublicMessage: "Invalid code.",
+				ErrorCode:     commonApi.ErrorCodeInvalidTOTPCode,
 			}
 		}
 
@@ -508,6 +570,7 @@ func SetupTOTPLock(connector *db.DBConnector) echo.HandlerFunc {
 				return APIError{
 					Code:           http.StatusInternalServerError,
 					PublicMessage:  "Failed to validate TOTP code.",
+					ErrorCode:      commonApi.ErrorCodeInternal,
 					PrivateMessage: "Failed when generating new random bytes for recovery code",
 					InternalError:  err,
 				}
@@ -533,8 +596,7 @@ func SetupTOTPLock(connector *db.DBConnector) echo.HandlerFunc {
 			}
 		}
 
-		q := db.New(conn)
-		q = q.WithTx(tx)
+		q := db.New(db.Instrument(tx))
 
 		err = q.NewRecoveryCodes(c.Request().Context(), db.NewRecoveryCodesParams{
 			UserID:    user.ID,
@@ -553,6 +615,7 @@ func SetupTOTPLock(connector *db.DBConnector) echo.HandlerFunc {
 			return APIError{
 				Code:           http.StatusInternalServerError,
 				PublicMessage:  "Failed to verify TOTP code.",
+				ErrorCode:      commonApi.ErrorCodeInternal,
 				PrivateMessage: "Failed to store the recovery codes in the database.",
 				InternalError:  err,
 			}
@@ -632,7 +695,7 @@ func SetupTOTPLock(connector *db.DBConnector) echo.HandlerFunc {
 		}
 
 		// Reset rate limiting counter on successful TOTP setup
-		middlewares.ResetTOTPAttempts(user.ID)
+		middlewares.ResetTOTPAttempts(c.Request().Context(), user.ID)
 
 		return c.JSON(http.StatusOK, commonApi.LockTOTPResponse{
 			RecoveryCodes: codes,
@@ -642,11 +705,6 @@ func SetupTOTPLock(connector *db.DBConnector) echo.HandlerFunc {
 	}
 }
 
-// RemoveTOTPRequest is the expected request body for remove totp request
-type RemoveTOTPRequest struct {
-	Code string `json:"code" validate:"required,len=6|len=32|len=8"`
-}
-
 // RemoveTOTP removes the TOTP that has been setup for the requesting user.
 func RemoveTOTP(connector *db.DBConnector) echo.HandlerFunc {
 	return func(c echo.Context) error {
@@ -655,7 +713,7 @@ func RemoveTOTP(connector *db.DBConnector) echo.HandlerFunc {
 			return err
 		}
 
-		body, err := middlewares.GetJsonBody[RemoveTOTPRequest](c)
+		body, err := middlewares.GetJsonBody[commonApi.RemoveTOTPRequest](c)
 		if err != nil {
 			return err
 		}
@@ -664,9 +722,15 @@ func RemoveTOTP(connector *db.DBConnector) echo.HandlerFunc {
 			return APIError{
 				Code:          http.StatusBadRequest,
 				PublicMessage: "No TOTP setup.",
+				ErrorCode:     commonApi.ErrorCodeTOTPNotSetup,
 			}
 		}
 
+		// the rate limit middleware only covers POST requests
+		if err := middlewares.CheckTOTPAttempts(c, user.ID); err != nil {
+			return err
+		}
+
 		conn, err := connector.Connect()
 		if err != nil {
 			return err
@@ -676,30 +740,14 @@ func RemoveTOTP(connector *db.DBConnector) echo.HandlerFunc {
 		switch len(body.Code) {
 		case 6:
 			if !totp.Validate(body.Code, *user.TotpSecret) {
-				// Record failed TOTP attempt
-				middlewares.RecordFailedTOTPAttempt(user.ID)
-
-				// Check if user is now rate limited after this attempt
-				key := middlewares.TOTPAttemptsKeyPrefix + user.ID
-				attemptsData, found := memcache.Cache().Get(key)
-
-				if found {
-					attempts := attemptsData.(middlewares.TOTPAttempts)
-					if attempts.Attempts >= middlewares.MaxTOTPAttempts {
-						cooldownEnd := attempts.LastAttempt.Add(middlewares.TOTPCooldownDuration)
-						retryAfter := int(time.Until(cooldownEnd).Seconds())
-						c.Response().Header().Set("Retry-After", fmt.Sprintf("%d", retryAfter))
-
-						return APIError{
-							Code:          http.StatusTooManyRequests,
-							PublicMessage: fmt.Sprintf("Too many failed attempts. Try again in %d seconds.", retryAfter),
-						}
-					}
+				if err := middlewares.FailTOTPAttempt(c, user.ID); err != nil {
+					return err
 				}
 
 				return APIError{
 					Code:          http.StatusBadRequest,
 					PublicMessage: "Invalid TOTP code.",
+					ErrorCode:     commonApi.ErrorCodeInvalidTOTPCode,
 				}
 			}
 		case 8:
@@ -708,53 +756,50 @@ func RemoveTOTP(connector *db.DBConnector) echo.HandlerFunc {
 				return APIError{
 					Code:          http.StatusBadRequest,
 					PublicMessage: "Email must be verified to use email codes.",
+					ErrorCode:     commonApi.ErrorCodeEmailUnverified,
 				}
 			}
-			k, exp, found := memcache.Cache().GetWithExpiration("email_code_" + user.ID)
-			if !found || time.Now().After(exp) {
-				return APIError{
-					Code:           http.StatusBadRequest,
-					PublicMessage:  "Invalid 2FA code.",
-					PrivateMessage: "Email code not found in memory cache or expired",
+			emailCode, err := memcache.Cache().Get(c.Request().Context(), "email_code_"+user.ID)
+			if err != nil {
+				if err == memcache.ErrNotFound {
+					return APIError{
+						Code:           http.StatusBadRequest,
+						PublicMessage:  "Invalid 2FA code.",
+						ErrorCode:      commonApi.ErrorCodeInvalidTOTPCode,
+						PrivateMessage: "Email code not found in memory cache or expired",
+					}
 				}
-			}
-			emailCode, ok := k.(string)
-			if !ok {
 				return APIError{
 					Code:           http.StatusInternalServerError,
-					PrivateMessage: "Failed to cast email code stored in memory cache to string",
+					PrivateMessage: "Failed to get email code from memory cache",
+					InternalError:  err,
 				}
 			}
-			if body.Code != emailCode {
+			if body.Code != string(emailCode) {
 				return APIError{
 					Code:          http.StatusBadRequest,
 					PublicMessage: "Invalid 2FA code.",
+					ErrorCode:     commonApi.ErrorCodeInvalidTOTPCode,
 				}
 			}
 		case 32:
-			q := db.New(conn)
+			q := db.New(db.Instrument(conn))
 			if err := verifyRecoveryCode(c.Request().Context(), q, user.ID, body.Code); err != nil {
-				// Check if user has exceeded rate limits
-				key := middlewares.TOTPAttemptsKeyPrefix + user.ID
-				attemptsData, found := memcache.Cache().Get(key)
-
-				if found {
-					attempts := attemptsData.(middlewares.TOTPAttempts)
-					if attempts.Attempts >= middlewares.MaxTOTPAttempts {
-						cooldownEnd := attempts.LastAttempt.Add(middlewares.TOTPCooldownDuration)
-						retryAfter := int(time.Until(cooldownEnd).Seconds())
-						c.Response().Header().Set("Retry-After", fmt.Sprintf("%d", retryAfter))
-
-						return APIError{
-							Code:          http.StatusTooManyRequests,
-							PublicMessage: fmt.Sprintf("Too many failed attempts. Try again in %d seconds.", retryAfter),
-						}
+				if err != sql.ErrNoRows && err != ErrUsedRecoveryCode {
+					return APIError{
+						Code:           http.StatusInternalServerError,
+						PrivateMessage: "Failed to verify recovery code.",
+						InternalError:  err,
 					}
 				}
+				if err := middlewares.FailTOTPAttempt(c, user.ID); err != nil {
+					return err
+				}
 
 				return APIError{
 					Code:           http.StatusBadRequest,
 					PublicMessage:  "Invalid TOTP code.",
+					ErrorCode:      commonApi.ErrorCodeInvalidTOTPCode,
 					PrivateMessage: "Verification failed at recovery code.",
 					InternalError:  err,
 				}
@@ -763,6 +808,7 @@ func RemoveTOTP(connector *db.DBConnector) echo.HandlerFunc {
 			return APIError{
 				Code:          http.StatusBadRequest,
 				PublicMessage: "Invalid 'code' in body.",
+				ErrorCode:     commonApi.ErrorCodeBadRequest,
 			}
 		}
 
@@ -771,8 +817,7 @@ func RemoveTOTP(connector *db.DBConnector) echo.HandlerFunc {
 			return err
 		}
 
-		q := db.New(conn)
-		q = q.WithTx(tx)
+		q := db.New(db.Instrument(tx))
 
 		err = q.RemoveUserRecoveryCodes(c.Request().Context(), user.ID)
 		if err != nil {
@@ -780,6 +825,7 @@ func RemoveTOTP(connector *db.DBConnector) echo.HandlerFunc {
 			return APIError{
 				Code:           http.StatusInternalServerError,
 				PublicMessage:  "Failed to remove TOTP",
+				ErrorCode:      commonApi.ErrorCodeInternal,
 				PrivateMessage: "Failed to remove the user recovery codes from database",
 				InternalError:  err,
 			}
@@ -797,6 +843,7 @@ func RemoveTOTP(connector *db.DBConnector) echo.HandlerFunc {
 			return APIError{
 				Code:           http.StatusInternalServerError,
 				PublicMessage:  "Failed to remove TOTP",
+				ErrorCode:      commonApi.ErrorCodeInternal,
 				PrivateMessage: "Failed to update the user totp secret and locked properites in database",
 				InternalError:  err,
 			}
@@ -809,23 +856,39 @@ func RemoveTOTP(connector *db.DBConnector) echo.HandlerFunc {
 			return APIError{
 				Code:           http.StatusInternalServerError,
 				PublicMessage:  "Failed to remove TOTP",
+				ErrorCode:      commonApi.ErrorCodeInternal,
 				PrivateMessage: "Failed to invalidate all tokens in database",
 				InternalError:  err,
 			}
 		}
 
+		err = events.DefaultBus().Publish(c.Request().Context(), q, events.TOTPRemoved{UserID: user.ID})
+		if err != nil {
+			tx.Rollback()
+			return APIError{
+				Code:           http.StatusInternalServerError,
+				PublicMessage:  "Failed to remove TOTP",
+				ErrorCode:      commonApi.ErrorCodeInternal,
+				PrivateMessage: "Failed to publish the TOTP removal",
+				InternalError:  err,
+			}
+		}
+
 		err = tx.Commit()
 		if err != nil {
 			return APIError{
 				Code:           http.StatusInternalServerError,
 				PublicMessage:  "Failed to remove TOTP",
+				ErrorCode:      commonApi.ErrorCodeInternal,
 				PrivateMessage: "Failed to commit changes to completely remove TOTP",
 				InternalError:  err,
 			}
 		}
 
 		// Reset rate limiting counter on successful TOTP removal
-		middlewares.ResetTOTPAttempts(user.ID)
+		middlewares.ResetTOTPAttempts(c.Request().Context(), user.ID)
+
+		events.DefaultBus().Dispatch()
 
 		return c.NoContent(http.StatusOK)
 	}
@@ -839,7 +902,12 @@ func CheckAuthToken(cnt *db.DBConnector) echo.HandlerFunc {
 		}
 		token, err := services.VerifyAuthToken(body.AuthToken)
 		if err != nil {
-			return err
+			return APIError{
+				Code:          http.StatusUnauthorized,
+				ErrorCode:     commonApi.ErrorCodeInvalidToken,
+				PublicMessage: "Invalid or expired auth token.",
+				InternalError: err,
+			}
 		}
 
 		ctx, cancel := context.WithTimeout(c.Request().Context(), time.Second*30)
@@ -851,7 +919,21 @@ func CheckAuthToken(cnt *db.DBConnector) echo.HandlerFunc {
 		}
 		defer conn.Close()
 
-		q := db.New(conn)
+		q := db.New(db.Instrument(conn))
+
+		// tokens are revoked by removing them from the database
+		exists, err := q.ExistsAuthTokenById(ctx, token.ID)
+		if err != nil {
+			return err
+		}
+		if exists != 1 {
+			return APIError{
+				Code:           http.StatusUnauthorized,
+				ErrorCode:      commonApi.ErrorCodeInvalidToken,
+				PublicMessage:  "Invalid or expired auth token.",
+				PrivateMessage: "AuthToken does not exists in database.",
+			}
+		}
 
 		// get the user
 		user, err := q.GetUserById(ctx, token.UserID)
@@ -902,3 +984,28 @@ func CheckAuthToken(cnt *db.DBConnector) echo.HandlerFunc {
 		})
 	}
 }
+
+// Logout revokes the auth token of the request. Other tokens of the user stay valid.
+func Logout(connector *db.DBConnector) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		authToken, err := middlewares.GetJWT(c)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request().Context(), FiveSeconds)
+		defer cancel()
+
+		conn, err := connector.Connect()
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		if err := db.New(db.Instrument(conn)).DeletAuthTokenById(ctx, authToken.ID); err != nil {
+			return err
+		}
+
+		return c.NoContent(http.StatusOK)
+	}
+}
@@ -12,21 +12,18 @@ import (
 
 var ErrUsedRecoveryCode error = errors.New("Recovery code has already been used")
 
-// verifyRecoveryCode validates a recovery code for a user and marks it as used if valid
+// verifyRecoveryCode validates a recovery code for a user and marks it as used if valid.
+// It returns sql.ErrNoRows for unknown codes, the caller records the failed attempt.
 func verifyRecoveryCode(ctx context.Context, queries *db.Queries, userID, code string) error {
 	recoveryCode, err := queries.GetRecoveryCode(ctx, db.GetRecoveryCodeParams{
 		UserID: userID,
 		Code:   code,
 	})
 	if err != nil {
-		// Record the failed attempt
-		middlewares.RecordFailedTOTPAttempt(userID)
 		return err
 	}
 
 	if recoveryCode.Used {
-		// Record the failed attempt with used code
-		middlewares.RecordFailedTOTPAttempt(userID)
 		return ErrUsedRecoveryCode
 	}
 
@@ -39,7 +36,7 @@ func verifyRecoveryCode(ctx context.Context, queries *db.Queries, userID, code s
 	}
 
 	// Reset the attempt counter on successful verification
-	middlewares.ResetTOTPAttempts(userID)
+	middlewares.ResetTOTPAttempts(ctx, userID)
 
 	return nil
 }
@@ -47,7 +44,7 @@ func verifyRecoveryCode(ctx context.Context, queries *db.Queries, userID, code s
 func newAuthToken(ctx context.Context, queries *db.Queries, userID string, tokType services.TokenType) (*services.AuthToken, error) {
 	// If this is a successful auth operation, reset any TOTP attempt counters
 	if tokType == services.FULL_USER_TOKEN_TYPE {
-		middlewares.ResetTOTPAttempts(userID)
+		middlewares.ResetTOTPAttempts(ctx, userID)
 	}
 
 	now := time.Now()
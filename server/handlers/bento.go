@@ -4,26 +4,20 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	commonApi "github.com/juancwu/konbini/common/api"
 	"github.com/juancwu/konbini/server/db"
+	"github.com/juancwu/konbini/server/events"
 	"github.com/juancwu/konbini/server/middlewares"
 	"github.com/juancwu/konbini/server/permission"
+	"github.com/juancwu/konbini/server/services"
 	"github.com/juancwu/konbini/server/utils"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/labstack/echo/v4"
 )
 
-type ingredient struct {
-	Name  string `json:"name" validate:"required,min=1,printascii"`
-	Value string `json:"value"`
-}
-
-type NewBentoRequest struct {
-	Name        string       `json:"name" validate:"required,min=3,printascii"`
-	Ingredients []ingredient `json:"ingredients,omitempty" validate:"omitnil,omitempty,dive"`
-}
-
 func NewBento(connector *db.DBConnector) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		user, err := middlewares.GetUser(c)
@@ -34,10 +28,11 @@ func NewBento(connector *db.DBConnector) echo.HandlerFunc {
 			return APIError{
 				Code:          http.StatusBadRequest,
 				PublicMessage: "Email must be verified before creating a new bento",
+				ErrorCode:     commonApi.ErrorCodeEmailUnverified,
 			}
 		}
 
-		body, err := middlewares.GetJsonBody[NewBentoRequest](c)
+		body, err := middlewares.GetJsonBody[commonApi.NewBentoRequest](c)
 		if err != nil {
 			return err
 		}
@@ -58,7 +53,7 @@ func NewBento(connector *db.DBConnector) echo.HandlerFunc {
 			return err
 		}
 
-		q := db.New(tx)
+		q := db.New(db.Instrument(tx))
 
 		exists, err := q.ExistsBentoWithNameOwnedByUser(
 			ctx,
@@ -74,11 +69,12 @@ func NewBento(connector *db.DBConnector) echo.HandlerFunc {
 			return APIError{
 				Code:          http.StatusBadRequest,
 				PublicMessage: fmt.Sprintf("Bento with name %s already exists.", body.Name),
+				ErrorCode:     commonApi.ErrorCodeBentoNameTaken,
 			}
 		}
 
 		// create bento
-		bentoID, err := q.NewBento(
+		newBento, err := q.NewBento(
 			ctx,
 			db.NewBentoParams{
 				Name:      body.Name,
@@ -92,6 +88,8 @@ func NewBento(connector *db.DBConnector) echo.HandlerFunc {
 			return err
 		}
 
+		bentoID := newBento.ID
+
 		if body.Ingredients != nil && len(body.Ingredients) > 0 {
 			timestamp := utils.FormatRFC3339NanoFixed(time.Now())
 			for _, ing := range body.Ingredients {
@@ -112,6 +110,14 @@ func NewBento(connector *db.DBConnector) echo.HandlerFunc {
 			}
 		}
 
+		if len(body.Ingredients) > 0 {
+			err = recordBentoChange(ctx, q, bentoID, newBento.Revision, user.ID, commonApi.BentoChangeAdd, ingredientNames(body.Ingredients))
+			if err != nil {
+				db.RollabackWithLog(tx, logger)
+				return err
+			}
+		}
+
 		// create new bento permissions for the owner
 		timestamp := utils.FormatRFC3339NanoFixed(time.Now())
 		err = q.NewBentoPermission(
@@ -134,16 +140,13 @@ func NewBento(connector *db.DBConnector) echo.HandlerFunc {
 			db.RollabackWithLog(tx, logger)
 			return err
 		}
+		events.DefaultBus().Dispatch()
 
-		return c.JSON(http.StatusCreated, map[string]string{"bento_id": bentoID})
+		c.Response().Header().Set(commonApi.HeaderETag, commonApi.BentoETag(newBento.Revision))
+		return c.JSON(http.StatusCreated, commonApi.NewBentoResponse{BentoID: bentoID, Revision: newBento.Revision})
 	}
 }
 
-type AddIngredientsToBentoRequest struct {
-	BentoID     string       `json:"bento_id" validate:"required,uuid4"`
-	Ingredients []ingredient `json:"ingredients,omitempty" validate:"omitnil,omitempty,dive"`
-}
-
 // AddIngredientsToBento add the ingridients in the request body to the bento
 func AddIngredientsToBento(cnt *db.DBConnector) echo.HandlerFunc {
 	return func(c echo.Context) error {
@@ -156,7 +159,7 @@ func AddIngredientsToBento(cnt *db.DBConnector) echo.HandlerFunc {
 		if err != nil {
 			return err
 		}
-		body, err := middlewares.GetJsonBody[AddIngredientsToBentoRequest](c)
+		body, err := middlewares.GetJsonBody[commonApi.AddIngredientsToBentoRequest](c)
 		if err != nil {
 			return err
 		}
@@ -167,7 +170,7 @@ func AddIngredientsToBento(cnt *db.DBConnector) echo.HandlerFunc {
 		}
 		defer conn.Close()
 
-		q := db.New(conn)
+		q := db.New(db.Instrument(conn))
 
 		bento, err := q.GetBentoWithIDOwnedByUser(
 			ctx,
@@ -181,6 +184,7 @@ func AddIngredientsToBento(cnt *db.DBConnector) echo.HandlerFunc {
 				return APIError{
 					Code:           http.StatusBadRequest,
 					PublicMessage:  "No bento found",
+					ErrorCode:      commonApi.ErrorCodeBentoNotFound,
 					PrivateMessage: "No bento found with given ID owned by requesting user",
 					InternalError:  err,
 				}
@@ -193,7 +197,13 @@ func AddIngredientsToBento(cnt *db.DBConnector) echo.HandlerFunc {
 			return err
 		}
 
-		q = q.WithTx(tx)
+		q = db.New(db.Instrument(tx))
+
+		revision, err := incrementBentoRevision(ctx, c, q, bento.ID)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
 
 		for _, ing := range body.Ingredients {
 			if replace {
@@ -225,6 +235,7 @@ func AddIngredientsToBento(cnt *db.DBConnector) echo.HandlerFunc {
 					return APIError{
 						Code:          http.StatusBadRequest,
 						PublicMessage: fmt.Sprintf("Ingridient with name '%s' already exists. To replace set the query parameter 'replace=true'.", ing.Name),
+						ErrorCode:     commonApi.ErrorCodeIngredientExists,
 						InternalError: err,
 					}
 				}
@@ -232,19 +243,28 @@ func AddIngredientsToBento(cnt *db.DBConnector) echo.HandlerFunc {
 			}
 		}
 
+		action := commonApi.BentoChangeAdd
+		if replace {
+			action = commonApi.BentoChangeReplace
+		}
+		err = recordBentoChange(ctx, q, bento.ID, revision, user.ID, action, ingredientNames(body.Ingredients))
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
 		err = tx.Commit()
 		if err != nil {
 			tx.Rollback()
 			return err
 		}
 
-		return c.NoContent(http.StatusOK)
-	}
-}
+		services.DefaultBentoNotifier().Publish(bento.ID, revision)
+		events.DefaultBus().Dispatch()
 
-type RemoveIngredientsFromBentoRequest struct {
-	BentoID     string   `json:"bento_id" validate:"required,uuid4"`
-	Ingredients []string `json:"ingredients" validate:"required,gt=0,dive,uuid4"`
+		c.Response().Header().Set(commonApi.HeaderETag, commonApi.BentoETag(revision))
+		return c.JSON(http.StatusOK, commonApi.AddIngredientsToBentoResponse{Revision: revision})
+	}
 }
 
 // RemoveIngredientsFromBento removes ingridients by id from the bento
@@ -257,7 +277,7 @@ func RemoveIngredientsFromBento(cnt *db.DBConnector) echo.HandlerFunc {
 		if err != nil {
 			return err
 		}
-		body, err := middlewares.GetJsonBody[RemoveIngredientsFromBentoRequest](c)
+		body, err := middlewares.GetJsonBody[commonApi.RemoveIngredientsFromBentoRequest](c)
 		if err != nil {
 			return err
 		}
@@ -273,7 +293,7 @@ func RemoveIngredientsFromBento(cnt *db.DBConnector) echo.HandlerFunc {
 			return err
 		}
 
-		q := db.New(tx)
+		q := db.New(db.Instrument(tx))
 
 		bento, err := q.GetBentoWithIDOwnedByUser(
 			ctx,
@@ -283,35 +303,51 @@ func RemoveIngredientsFromBento(cnt *db.DBConnector) echo.HandlerFunc {
 			},
 		)
 		if err != nil {
+			tx.Rollback()
 			if err == sql.ErrNoRows {
 				return APIError{
 					Code:          http.StatusBadRequest,
 					PublicMessage: "No bento found",
+					ErrorCode:     commonApi.ErrorCodeBentoNotFound,
 				}
 			}
 			return err
 		}
 
+		revision, err := incrementBentoRevision(ctx, c, q, bento.ID)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
 		deleted := []string{}
 		notDeleted := []string{}
+		deletedNames := []string{}
 
 		for _, ingID := range body.Ingredients {
-			n, err := q.RemoveIngredientFromBento(
+			name, err := q.RemoveIngredientFromBento(
 				ctx,
 				db.RemoveIngredientFromBentoParams{
 					BentoID: bento.ID,
 					ID:      ingID,
 				},
 			)
+			if err == sql.ErrNoRows {
+				notDeleted = append(notDeleted, ingID)
+				continue
+			}
 			if err != nil {
 				tx.Rollback()
 				return err
 			}
-			if n != 1 {
-				notDeleted = append(notDeleted, ingID)
-			} else {
-				deleted = append(deleted, ingID)
-			}
+			deleted = append(deleted, ingID)
+			deletedNames = append(deletedNames, name)
+		}
+
+		err = recordBentoChange(ctx, q, bento.ID, revision, user.ID, commonApi.BentoChangeRemove, deletedNames)
+		if err != nil {
+			tx.Rollback()
+			return err
 		}
 
 		err = tx.Commit()
@@ -320,14 +356,105 @@ func RemoveIngredientsFromBento(cnt *db.DBConnector) echo.HandlerFunc {
 			return err
 		}
 
-		return c.JSON(http.StatusOK, map[string][]string{
-			"deleted":     deleted,
-			"not_deleted": notDeleted,
+		services.DefaultBentoNotifier().Publish(bento.ID, revision)
+		events.DefaultBus().Dispatch()
+
+		c.Response().Header().Set(commonApi.HeaderETag, commonApi.BentoETag(revision))
+		return c.JSON(http.StatusOK, commonApi.RemoveIngredientsFromBentoResponse{
+			Deleted:    deleted,
+			NotDeleted: notDeleted,
+			Revision:   revision,
 		})
 	}
 }
 
-// GetBento gets the bento info and ingridients
+// DeleteBento deletes a bento along with its ingredients, permissions and change feed.
+func DeleteBento(cnt *db.DBConnector) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		user, err := middlewares.GetUser(c)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request().Context(), FiveSeconds)
+		defer cancel()
+
+		conn, err := cnt.Connect()
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		q := db.New(db.Instrument(conn))
+
+		bento, err := readableBento(ctx, c, q, user.ID, c.Param("id"))
+		if err != nil {
+			return err
+		}
+		u64Perms, err := permission.FromBytes(bento.Bytes)
+		if err != nil {
+			return err
+		}
+		if u64Perms&permission.Delete == 0 {
+			return APIError{
+				Code:          http.StatusForbidden,
+				PublicMessage: "No permission to delete the bento.",
+				ErrorCode:     commonApi.ErrorCodeForbidden,
+			}
+		}
+
+		tx, err := conn.Begin()
+		if err != nil {
+			return err
+		}
+
+		q = db.New(db.Instrument(tx))
+
+		revision, err := incrementBentoRevision(ctx, c, q, bento.ID)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		rows, err := q.GetBentoIngredientNames(ctx, bento.ID)
+		if err != nil && err != sql.ErrNoRows {
+			tx.Rollback()
+			return err
+		}
+		names := make([]string, len(rows))
+		for i, row := range rows {
+			names[i] = row.Name
+		}
+
+		// the change is removed with the bento but its event is kept in the outbox
+		err = recordBentoChange(ctx, q, bento.ID, revision, user.ID, commonApi.BentoChangeRemove, names)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		err = q.DeleteBento(ctx, bento.ID)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		// watchers read the bento again and stop when it is gone
+		services.DefaultBentoNotifier().Publish(bento.ID, revision)
+		events.DefaultBus().Dispatch()
+
+		return c.NoContent(http.StatusOK)
+	}
+}
+
+// GetBento gets the bento info and ingridients. The values are masked, RevealIngredients
+// sends them and records it in the audit log of the bento.
 func GetBento(cnt *db.DBConnector) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		bentoID := c.QueryParam("bento_id")
@@ -335,6 +462,7 @@ func GetBento(cnt *db.DBConnector) echo.HandlerFunc {
 			return APIError{
 				Code:          http.StatusBadRequest,
 				PublicMessage: "Missing bento_id query parameter.",
+				ErrorCode:     commonApi.ErrorCodeBadRequest,
 			}
 		}
 
@@ -343,8 +471,6 @@ func GetBento(cnt *db.DBConnector) echo.HandlerFunc {
 			return err
 		}
 
-		logger := middlewares.GetLogger(c)
-
 		ctx, cancel := context.WithTimeout(c.Request().Context(), time.Second*5)
 		defer cancel()
 
@@ -354,65 +480,87 @@ func GetBento(cnt *db.DBConnector) echo.HandlerFunc {
 		}
 		defer conn.Close()
 
-		q := db.New(conn)
+		q := db.New(db.Instrument(conn))
 
-		bento, err := q.GetBentoByIDWithPermissions(
-			ctx,
-			db.GetBentoByIDWithPermissionsParams{
-				UserID: user.ID,
-				ID:     bentoID,
-			},
-		)
+		bento, err := readableBento(ctx, c, q, user.ID, bentoID)
 		if err != nil {
-			if err == sql.ErrNoRows {
-				return APIError{
-					Code:          http.StatusNotFound,
-					PublicMessage: "Bento not found",
-					InternalError: err,
-				}
-			}
 			return err
 		}
 
-		// check if they have permission to read the bento
-		u64Perms, err := permission.FromBytes(bento.Bytes)
-		if err != nil {
-			return err
-		}
-		if u64Perms&permission.Read == 0 {
-			logger.Debug().Uint64("perms", u64Perms).Send()
-			return APIError{
-				Code:           http.StatusNotFound,
-				PublicMessage:  "Bento not found",
-				PrivateMessage: "No permissions to read bento",
-			}
-		}
-
-		// get bento ingredients
-		rows, err := q.GetBentoIngredients(
+		// get bento ingredients, without their values
+		rows, err := q.GetBentoIngredientNames(
 			ctx,
 			bento.ID,
 		)
 		if err != nil && err != sql.ErrNoRows {
 			return err
 		}
+		ingredients := make([]commonApi.BentoIngredient, len(rows))
+		for i, row := range rows {
+			ingredients[i] = commonApi.BentoIngredient{ID: row.ID, Name: row.Name}
+		}
 
-		return c.JSON(http.StatusOK, map[string]interface{}{
-			"bento_id":    bento.ID,
-			"name":        bento.Name,
-			"ingredients": rows,
+		c.Response().Header().Set(commonApi.HeaderETag, commonApi.BentoETag(bento.Revision))
+		return c.JSON(http.StatusOK, commonApi.GetBentoResponse{
+			BentoID:     bento.ID,
+			Name:        bento.Name,
+			Revision:    bento.Revision,
+			Ingredients: ingredients,
+			Masked:      true,
 		})
 	}
 }
 
-type ListBentosResponse struct {
-	OwnerID    string `json:"owner_id"`
-	BentoID    string `json:"bento_id"`
-	BentoName  string `json:"bento_name"`
-	CreatedAt  string `json:"created_at"`
-	UpdatedAt  string `json:"updated_at"`
-	UserPerms  string `json:"user_perms"`
-	GroupPerms string `json:"group_perms"`
+// ifMatchRevision reads the bento revision in the If-Match header. The request is not
+// conditional when the header is missing or is "*" since the bento always exists at this point.
+func ifMatchRevision(c echo.Context) (int64, bool, error) {
+	value := strings.TrimSpace(c.Request().Header.Get(commonApi.HeaderIfMatch))
+	if value == "" || value == "*" {
+		return 0, false, nil
+	}
+	revision, err := commonApi.ParseBentoETag(value)
+	if err != nil {
+		return 0, false, APIError{
+			Code:          http.StatusBadRequest,
+			PublicMessage: "Invalid If-Match header. Use the ETag returned when getting the bento.",
+			ErrorCode:     commonApi.ErrorCodeBadRequest,
+			InternalError: err,
+		}
+	}
+	return revision, true, nil
+}
+
+// incrementBentoRevision bumps the revision of a bento that is being changed, it must run in the
+// same transaction as the change. Conditional requests fail with 412 when the bento is at another
+// revision so that concurrent changes are not overwritten.
+func incrementBentoRevision(ctx context.Context, c echo.Context, q *db.Queries, bentoID string) (int64, error) {
+	expected, conditional, err := ifMatchRevision(c)
+	if err != nil {
+		return 0, err
+	}
+
+	updatedAt := utils.FormatRFC3339NanoFixed(time.Now())
+	if !conditional {
+		return q.IncrementBentoRevision(ctx, db.IncrementBentoRevisionParams{
+			UpdatedAt: updatedAt,
+			ID:        bentoID,
+		})
+	}
+
+	revision, err := q.IncrementBentoRevisionIfMatch(ctx, db.IncrementBentoRevisionIfMatchParams{
+		UpdatedAt: updatedAt,
+		ID:        bentoID,
+		Revision:  expected,
+	})
+	if err == sql.ErrNoRows {
+		return 0, APIError{
+			Code:           http.StatusPreconditionFailed,
+			PublicMessage:  "The bento has changed since it was read. Get the bento again and retry.",
+			ErrorCode:      commonApi.ErrorCodeBentoChanged,
+			PrivateMessage: fmt.Sprintf("If-Match revision %d does not match", expected),
+		}
+	}
+	return revision, err
 }
 
 // ListBentos gets a list of all the user's bentos. The list only contains
@@ -433,14 +581,14 @@ func ListBentos(cnt *db.DBConnector) echo.HandlerFunc {
 		}
 		defer conn.Close()
 
-		q := db.New(conn)
+		q := db.New(db.Instrument(conn))
 
 		rows, err := q.ListBentosWithAccess(ctx, user.ID)
 		if err != nil && err != sql.ErrNoRows {
 			return err
 		}
 
-		res := make([]ListBentosResponse, len(rows))
+		res := make([]commonApi.ListBentosResponse, len(rows))
 		for i := 0; i < len(rows); i++ {
 			uPerms, err := permission.BytesToString(rows[i].UserPerms)
 			if err != nil {
@@ -450,7 +598,7 @@ func ListBentos(cnt *db.DBConnector) echo.HandlerFunc {
 			if err != nil {
 				return err
 			}
-			res[i] = ListBentosResponse{
+			res[i] = commonApi.ListBentosResponse{
 				OwnerID:    rows[i].OwnerID,
 				BentoID:    rows[i].BentoID,
 				BentoName:  rows[i].BentoName,
@@ -0,0 +1,360 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	commonApi "github.com/juancwu/konbini/common/api"
+	"github.com/juancwu/konbini/server/db"
+	"github.com/juancwu/konbini/server/events"
+	"github.com/juancwu/konbini/server/middlewares"
+	"github.com/juancwu/konbini/server/permission"
+	"github.com/juancwu/konbini/server/services"
+	"github.com/juancwu/konbini/server/utils"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// BENTO_WATCH_POLL_INTERVAL is how often a watcher checks for changes made through other
+	// server instances. A comment is sent at the same interval to keep the connection open.
+	BENTO_WATCH_POLL_INTERVAL = time.Second * 15
+	// BENTO_WATCH_RETRY is how long clients wait before reconnecting to a closed stream.
+	BENTO_WATCH_RETRY = time.Second * 3
+	// DEFAULT_BENTO_CHANGES_LIMIT is the number of changes listed when the request has no limit.
+	DEFAULT_BENTO_CHANGES_LIMIT = 100
+	// MAX_BENTO_CHANGES_LIMIT is the largest number of changes listed by one request.
+	MAX_BENTO_CHANGES_LIMIT = 500
+)
+
+// GetBentoChanges lists the changes of a bento after the revision in the since query parameter.
+func GetBentoChanges(cnt *db.DBConnector) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		bentoID := c.Param("id")
+
+		since, err := revisionParam(c.QueryParam("since"), "since")
+		if err != nil {
+			return err
+		}
+		limit := DEFAULT_BENTO_CHANGES_LIMIT
+		if value := c.QueryParam("limit"); value != "" {
+			limit, err = strconv.Atoi(value)
+			if err != nil || limit < 1 || limit > MAX_BENTO_CHANGES_LIMIT {
+				return APIError{
+					Code:          http.StatusBadRequest,
+					PublicMessage: fmt.Sprintf("limit must be a number between 1 and %d.", MAX_BENTO_CHANGES_LIMIT),
+					ErrorCode:     commonApi.ErrorCodeBadRequest,
+				}
+			}
+		}
+
+		user, err := middlewares.GetUser(c)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request().Context(), FiveSeconds)
+		defer cancel()
+
+		conn, err := cnt.Connect()
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		q := db.New(db.Instrument(conn))
+
+		bento, err := readableBento(ctx, c, q, user.ID, bentoID)
+		if err != nil {
+			return err
+		}
+
+		// one more row than the limit tells if there are more changes
+		rows, err := q.ListBentoChangesSince(ctx, db.ListBentoChangesSinceParams{
+			BentoID:  bento.ID,
+			Revision: since,
+			Limit:    int64(limit + 1),
+		})
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		hasMore := len(rows) > limit
+		if hasMore {
+			rows = rows[:limit]
+		}
+
+		changes, err := toBentoChanges(rows)
+		if err != nil {
+			return err
+		}
+
+		c.Response().Header().Set(commonApi.HeaderETag, commonApi.BentoETag(bento.Revision))
+		return c.JSON(http.StatusOK, commonApi.BentoChangesResponse{
+			BentoID: bento.ID,
+			Changes: changes,
+			HasMore: hasMore,
+		})
+	}
+}
+
+// WatchBento streams the changes of a bento as server-sent events. The stream starts after
+// the revision in the since query parameter or the Last-Event-ID header of a reconnecting
+// client, without either only new changes are sent. Each event has the revision as its id.
+func WatchBento(cnt *db.DBConnector, notifier *services.BentoNotifier, pollInterval time.Duration) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		bentoID := c.Param("id")
+
+		value := c.QueryParam("since")
+		if lastEventID := c.Request().Header.Get(commonApi.HeaderLastEventID); lastEventID != "" {
+			value = lastEventID
+		}
+		since, err := revisionParam(value, "since")
+		if err != nil {
+			return err
+		}
+
+		user, err := middlewares.GetUser(c)
+		if err != nil {
+			return err
+		}
+
+		logger := middlewares.GetLogger(c)
+		ctx := c.Request().Context()
+
+		// subscribe before reading the bento so that no change is missed in between
+		updates, unsubscribe := notifier.Subscribe(bentoID)
+		defer unsubscribe()
+
+		bento, err := watchedBento(ctx, c, cnt, user.ID, bentoID)
+		if err != nil {
+			return err
+		}
+		if value == "" {
+			since = bento.Revision
+		}
+
+		res := c.Response()
+		res.Header().Set(echo.HeaderContentType, commonApi.MimeTextEventStream)
+		res.Header().Set(echo.HeaderCacheControl, "no-cache")
+		res.Header().Set(echo.HeaderConnection, "keep-alive")
+		// proxies like nginx buffer responses unless told otherwise
+		res.Header().Set("X-Accel-Buffering", "no")
+		res.WriteHeader(http.StatusOK)
+		fmt.Fprintf(res, "retry: %d\n\n", BENTO_WATCH_RETRY.Milliseconds())
+		res.Flush()
+
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+
+		for {
+			since, err = sendBentoChanges(ctx, c, cnt, user.ID, bentoID, since)
+			if err != nil {
+				// the response has started, the client reconnects with the last event id
+				if ctx.Err() == nil {
+					logger.Error().Err(err).Str("bento_id", bentoID).Msg("Failed to send bento changes")
+				}
+				return nil
+			}
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-updates:
+			case <-ticker.C:
+				if _, err := fmt.Fprint(res, ": keep-alive\n\n"); err != nil {
+					return nil
+				}
+				res.Flush()
+			}
+		}
+	}
+}
+
+// sendBentoChanges writes the changes after since as events and returns the last revision sent.
+// Access is checked every time so that a user that loses access stops receiving changes.
+func sendBentoChanges(ctx context.Context, c echo.Context, cnt *db.DBConnector, userID string, bentoID string, since int64) (int64, error) {
+	if _, err := watchedBento(ctx, c, cnt, userID, bentoID); err != nil {
+		return since, err
+	}
+
+	for {
+		rows, err := listBentoChanges(ctx, cnt, bentoID, since)
+		if err != nil {
+			return since, err
+		}
+		changes, err := toBentoChanges(rows)
+		if err != nil {
+			return since, err
+		}
+
+		res := c.Response()
+		for _, change := range changes {
+			data, err := json.Marshal(change)
+			if err != nil {
+				return since, err
+			}
+			_, err = fmt.Fprintf(res, "id: %d\nevent: %s\ndata: %s\n\n", change.Revision, commonApi.BentoChangeEvent, data)
+			if err != nil {
+				return since, err
+			}
+			since = change.Revision
+		}
+		res.Flush()
+
+		if len(rows) < MAX_BENTO_CHANGES_LIMIT {
+			return since, nil
+		}
+	}
+}
+
+// watchedBento checks that the user can still read the bento with a short lived connection,
+// a stream can stay open for hours and must not hold on to one.
+func watchedBento(ctx context.Context, c echo.Context, cnt *db.DBConnector, userID string, bentoID string) (db.GetBentoByIDWithPermissionsRow, error) {
+	ctx, cancel := context.WithTimeout(ctx, FiveSeconds)
+	defer cancel()
+
+	conn, err := cnt.Connect()
+	if err != nil {
+		return db.GetBentoByIDWithPermissionsRow{}, err
+	}
+	defer conn.Close()
+
+	return readableBento(ctx, c, db.New(db.Instrument(conn)), userID, bentoID)
+}
+
+func listBentoChanges(ctx context.Context, cnt *db.DBConnector, bentoID string, since int64) ([]db.BentoChange, error) {
+	ctx, cancel := context.WithTimeout(ctx, FiveSeconds)
+	defer cancel()
+
+	conn, err := cnt.Connect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	rows, err := db.New(db.Instrument(conn)).ListBentoChangesSince(ctx, db.ListBentoChangesSinceParams{
+		BentoID:  bentoID,
+		Revision: since,
+		Limit:    MAX_BENTO_CHANGES_LIMIT,
+	})
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// readableBento gets a bento the user has permission to read. Bentos without
+// permission are reported as not found so that their existence is not leaked.
+func readableBento(ctx context.Context, c echo.Context, q *db.Queries, userID string, bentoID string) (db.GetBentoByIDWithPermissionsRow, error) {
+	bento, err := q.GetBentoByIDWithPermissions(
+		ctx,
+		db.GetBentoByIDWithPermissionsParams{
+			UserID: userID,
+			ID:     bentoID,
+		},
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return bento, APIError{
+				Code:          http.StatusNotFound,
+				PublicMessage: "Bento not found",
+				ErrorCode:     commonApi.ErrorCodeBentoNotFound,
+				InternalError: err,
+			}
+		}
+		return bento, err
+	}
+
+	// check if they have permission to read the bento, users without a row have no permissions
+	u64Perms := permission.NoOp
+	if bento.Bytes != nil {
+		u64Perms, err = permission.FromBytes(bento.Bytes)
+		if err != nil {
+			return bento, err
+		}
+	}
+	if u64Perms&permission.Read == 0 {
+		middlewares.GetLogger(c).Debug().Uint64("perms", u64Perms).Send()
+		return bento, APIError{
+			Code:           http.StatusNotFound,
+			PublicMessage:  "Bento not found",
+			ErrorCode:      commonApi.ErrorCodeBentoNotFound,
+			PrivateMessage: "No permissions to read bento",
+		}
+	}
+
+	return bento, nil
+}
+
+// recordBentoChange saves a change to the feed of a bento and publishes it, it must run in the
+// same transaction as the change. Only the names of the ingredients are saved.
+func recordBentoChange(ctx context.Context, q *db.Queries, bentoID string, revision int64, userID string, action string, names []string) error {
+	b, err := json.Marshal(names)
+	if err != nil {
+		return err
+	}
+	err = q.NewBentoChange(ctx, db.NewBentoChangeParams{
+		BentoID:     bentoID,
+		Revision:    revision,
+		UserID:      userID,
+		Action:      action,
+		Ingredients: string(b),
+		CreatedAt:   utils.FormatRFC3339NanoFixed(time.Now()),
+	})
+	if err != nil {
+		return err
+	}
+	return events.DefaultBus().Publish(ctx, q, events.BentoIngredientChanged{
+		BentoID:     bentoID,
+		Revision:    revision,
+		Action:      action,
+		Ingredients: names,
+		UserID:      userID,
+	})
+}
+
+func toBentoChanges(rows []db.BentoChange) ([]commonApi.BentoChange, error) {
+	changes := make([]commonApi.BentoChange, len(rows))
+	for i, row := range rows {
+		names := []string{}
+		if err := json.Unmarshal([]byte(row.Ingredients), &names); err != nil {
+			return nil, err
+		}
+		changes[i] = commonApi.BentoChange{
+			Revision:    row.Revision,
+			Action:      row.Action,
+			Ingredients: names,
+			UserID:      row.UserID,
+			CreatedAt:   row.CreatedAt,
+		}
+	}
+	return changes, nil
+}
+
+func ingredientNames(ingredients []commonApi.Ingredient) []string {
+	names := make([]string, len(ingredients))
+	for i, ing := range ingredients {
+		names[i] = ing.Name
+	}
+	return names
+}
+
+// revisionParam parses a revision given by the client, an empty value is revision 0.
+func revisionParam(value string, name string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	revision, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || revision < 0 {
+		return 0, APIError{
+			Code:          http.StatusBadRequest,
+			PublicMessage: fmt.Sprintf("%s must be a bento revision.", name),
+			ErrorCode:     commonApi.ErrorCodeBadRequest,
+		}
+	}
+	return revision, nil
+}
@@ -0,0 +1,270 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	commonApi "github.com/juancwu/konbini/common/api"
+	"github.com/juancwu/konbini/server/db"
+	"github.com/juancwu/konbini/server/events"
+	"github.com/juancwu/konbini/server/middlewares"
+	"github.com/juancwu/konbini/server/permission"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// DEFAULT_BENTO_REVEALS_LIMIT is the number of reveals listed when the request has no limit.
+	DEFAULT_BENTO_REVEALS_LIMIT = 100
+	// MAX_BENTO_REVEALS_LIMIT is the largest number of reveals listed by one request.
+	MAX_BENTO_REVEALS_LIMIT = 500
+)
+
+// RevealIngredients responds with the values of the named ingredients of a bento, or of all its
+// ingredients when no name is given. The reveal is recorded in the audit log of the bento in the
+// same request, so values can't be read without leaving a record.
+func RevealIngredients(cnt *db.DBConnector) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		user, err := middlewares.GetUser(c)
+		if err != nil {
+			return err
+		}
+		body, err := middlewares.GetJsonBody[commonApi.RevealIngredientsRequest](c)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request().Context(), FiveSeconds)
+		defer cancel()
+
+		conn, err := cnt.Connect()
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		q := db.New(db.Instrument(conn))
+
+		bento, err := readableBento(ctx, c, q, user.ID, c.Param("id"))
+		if err != nil {
+			return err
+		}
+
+		rows, err := q.GetBentoIngredients(ctx, bento.ID)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		ingredients, err := revealedIngredients(rows, body.Ingredients)
+		if err != nil {
+			return err
+		}
+
+		names := make([]string, len(ingredients))
+		for i, ing := range ingredients {
+			names[i] = ing.Name
+		}
+
+		tx, err := conn.Begin()
+		if err != nil {
+			return err
+		}
+
+		q = db.New(db.Instrument(tx))
+
+		// the audit subscriber records the reveal in the transaction
+		err = events.DefaultBus().Publish(ctx, q, events.BentoIngredientsRevealed{
+			BentoID:     bento.ID,
+			Ingredients: names,
+			UserID:      user.ID,
+			IP:          c.RealIP(),
+			UserAgent:   c.Request().UserAgent(),
+		})
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		// the values are only sent once the reveal is recorded
+		err = tx.Commit()
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		events.DefaultBus().Dispatch()
+
+		middlewares.GetLogger(c).Info().
+			Str("bento_id", bento.ID).
+			Str("user_id", user.ID).
+			Strs("ingredients", names).
+			Msg("Bento ingredients revealed")
+
+		c.Response().Header().Set(commonApi.HeaderETag, commonApi.BentoETag(bento.Revision))
+		return c.JSON(http.StatusOK, commonApi.GetBentoResponse{
+			BentoID:     bento.ID,
+			Name:        bento.Name,
+			Revision:    bento.Revision,
+			Ingredients: ingredients,
+		})
+	}
+}
+
+// revealedIngredients picks the named ingredients from rows in the order of names, or all of
+// them when names is empty. Unknown names are a 404.
+func revealedIngredients(rows []db.GetBentoIngredientsRow, names []string) ([]commonApi.BentoIngredient, error) {
+	byName := make(map[string]commonApi.BentoIngredient, len(rows))
+	all := make([]commonApi.BentoIngredient, len(rows))
+	for i, row := range rows {
+		all[i] = commonApi.BentoIngredient{ID: row.ID, Name: row.Name, Value: row.Value}
+		byName[row.Name] = all[i]
+	}
+	if len(names) == 0 {
+		return all, nil
+	}
+
+	ingredients := make([]commonApi.BentoIngredient, 0, len(names))
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		ing, ok := byName[name]
+		if !ok {
+			return nil, APIError{
+				Code:          http.StatusNotFound,
+				PublicMessage: fmt.Sprintf("Ingredient %q not found in bento.", name),
+				ErrorCode:     commonApi.ErrorCodeIngredientNotFound,
+			}
+		}
+		if !seen[name] {
+			seen[name] = true
+			ingredients = append(ingredients, ing)
+		}
+	}
+	return ingredients, nil
+}
+
+// ListBentoReveals lists the latest reveals of a bento, it needs admin access to the bento.
+func ListBentoReveals(cnt *db.DBConnector) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		limit, err := bentoRevealsLimit(c)
+		if err != nil {
+			return err
+		}
+
+		user, err := middlewares.GetUser(c)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request().Context(), FiveSeconds)
+		defer cancel()
+
+		conn, err := cnt.Connect()
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		q := db.New(db.Instrument(conn))
+
+		bento, err := readableBento(ctx, c, q, user.ID, c.Param("id"))
+		if err != nil {
+			return err
+		}
+		u64Perms, err := permission.FromBytes(bento.Bytes)
+		if err != nil {
+			return err
+		}
+		if u64Perms&(permission.Owner|permission.Admin) == 0 {
+			return APIError{
+				Code:          http.StatusForbidden,
+				PublicMessage: "Only the owner and admins of the bento can see its reveals.",
+				ErrorCode:     commonApi.ErrorCodeForbidden,
+			}
+		}
+
+		reveals, err := listBentoReveals(ctx, q, bento.ID, limit)
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, commonApi.BentoRevealsResponse{
+			BentoID: bento.ID,
+			Reveals: reveals,
+		})
+	}
+}
+
+// ListAdminBentoReveals lists the latest reveals of any bento for server administrators. The
+// reveals are kept when a bento is deleted, this is the only way to read them afterwards.
+func ListAdminBentoReveals(cnt *db.DBConnector) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		limit, err := bentoRevealsLimit(c)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request().Context(), FiveSeconds)
+		defer cancel()
+
+		conn, err := cnt.Connect()
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		bentoID := c.Param("id")
+		reveals, err := listBentoReveals(ctx, db.New(db.Instrument(conn)), bentoID, limit)
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, commonApi.BentoRevealsResponse{
+			BentoID: bentoID,
+			Reveals: reveals,
+		})
+	}
+}
+
+// bentoRevealsLimit parses the limit query parameter of the reveal listings.
+func bentoRevealsLimit(c echo.Context) (int, error) {
+	value := c.QueryParam("limit")
+	if value == "" {
+		return DEFAULT_BENTO_REVEALS_LIMIT, nil
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 || limit > MAX_BENTO_REVEALS_LIMIT {
+		return 0, APIError{
+			Code:          http.StatusBadRequest,
+			PublicMessage: fmt.Sprintf("limit must be a number between 1 and %d.", MAX_BENTO_REVEALS_LIMIT),
+			ErrorCode:     commonApi.ErrorCodeBadRequest,
+		}
+	}
+	return limit, nil
+}
+
+// listBentoReveals gets the latest reveals of a bento, newest first.
+func listBentoReveals(ctx context.Context, q *db.Queries, bentoID string, limit int) ([]commonApi.BentoReveal, error) {
+	rows, err := q.ListBentoReveals(ctx, db.ListBentoRevealsParams{
+		BentoID: bentoID,
+		Limit:   int64(limit),
+	})
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	reveals := make([]commonApi.BentoReveal, len(rows))
+	for i, row := range rows {
+		names := []string{}
+		if err := json.Unmarshal([]byte(row.Ingredients), &names); err != nil {
+			return nil, err
+		}
+		reveals[i] = commonApi.BentoReveal{
+			ID:          row.ID,
+			Ingredients: names,
+			UserID:      row.UserID,
+			IP:          row.Ip,
+			UserAgent:   row.UserAgent,
+			CreatedAt:   row.CreatedAt,
+		}
+	}
+	return reveals, nil
+}
@@ -1,19 +1,26 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	commonApi "github.com/juancwu/konbini/common/api"
+	"github.com/juancwu/konbini/server/middlewares"
+	inner_validator "github.com/juancwu/konbini/server/validator"
 	"net/http"
 
+	"github.com/go-playground/validator/v10"
 	"github.com/labstack/echo/v4"
 	"github.com/rs/zerolog/log"
 )
 
 type APIError struct {
-	Code          int      `json:"code"`
-	PublicMessage string   `json:"message"`
-	Errors        []string `json:"errors,omitempty"`
-	RequestId     string   `json:"request_id"`
+	Code int `json:"code"`
+	// ErrorCode is sent to clients so they can branch on it. It defaults to the generic code of the status.
+	ErrorCode     commonApi.ErrorCode    `json:"error_code"`
+	PublicMessage string                 `json:"message"`
+	Errors        []commonApi.FieldError `json:"errors,omitempty"`
+	RequestId     string                 `json:"request_id"`
 
 	PrivateMessage string `json:"-"`
 	InternalError  error  `json:"-"`
@@ -30,26 +37,51 @@ func (e APIError) Error() string {
 	)
 }
 
+// StatusCode returns the status code of the response sent for the error.
+func (e APIError) StatusCode() int {
+	return e.Code
+}
+
 func ErrorHandler() echo.HTTPErrorHandler {
 	return func(err error, c echo.Context) {
 		var apiError APIError
-		switch err.(type) {
-		case *echo.HTTPError:
-			he := err.(*echo.HTTPError)
-			apiError.Code = he.Code
-			apiError.PublicMessage = he.Error()
-			apiError.InternalError = he.Internal
-		case APIError:
-			apiError = err.(APIError)
-		default:
+		var bodyError *middlewares.RequestBodyError
+		var errRes *commonApi.ErrorResponse
+		switch {
+		case errors.As(err, &bodyError):
+			// the request body is valid json but it doesn't match the request struct
+			apiError.Code = bodyError.StatusCode()
+			apiError.ErrorCode = commonApi.ErrorCodeValidationFailed
+			apiError.PublicMessage = "Request body failed validation."
+			apiError.Errors = bodyFieldErrors(bodyError.Err)
 			apiError.InternalError = err
-			apiError.Code = http.StatusInternalServerError
-			apiError.PublicMessage = http.StatusText(apiError.Code)
-			apiError.PrivateMessage = err.Error()
+		case errors.As(err, &errRes):
+			// middlewares can't return an APIError, they return the response they want instead
+			apiError.Code = errRes.Code
+			apiError.ErrorCode = errRes.ErrorCode
+			apiError.PublicMessage = errRes.Message
+			apiError.Errors = errRes.Errors
+		default:
+			switch err.(type) {
+			case *echo.HTTPError:
+				he := err.(*echo.HTTPError)
+				apiError.Code = he.Code
+				apiError.PublicMessage = he.Error()
+				apiError.InternalError = he.Internal
+			case APIError:
+				apiError = err.(APIError)
+			default:
+				apiError.InternalError = err
+				apiError.Code = http.StatusInternalServerError
+				apiError.PublicMessage = http.StatusText(apiError.Code)
+				apiError.PrivateMessage = err.Error()
+			}
 		}
 
-		requestId := c.Request().Header.Get(echo.HeaderXRequestID)
-		apiError.RequestId = requestId
+		if apiError.ErrorCode == "" {
+			apiError.ErrorCode = commonApi.ErrorCodeFromStatus(apiError.Code)
+		}
+		apiError.RequestId = middlewares.GetRequestID(c)
 		path := c.Request().URL.Path
 		method := c.Request().Method
 		ip := c.RealIP()
@@ -59,6 +91,7 @@ func ErrorHandler() echo.HTTPErrorHandler {
 			Err(apiError.InternalError).
 			Str("request_id", apiError.RequestId).
 			Int("code", apiError.Code).
+			Str("error_code", string(apiError.ErrorCode)).
 			Str("path", path).
 			Str("method", method).
 			Str("ip", ip).
@@ -68,6 +101,7 @@ func ErrorHandler() echo.HTTPErrorHandler {
 		if !c.Response().Committed {
 			err := c.JSON(apiError.Code, commonApi.ErrorResponse{
 				Code:      apiError.Code,
+				ErrorCode: apiError.ErrorCode,
 				Message:   apiError.PublicMessage,
 				Errors:    apiError.Errors,
 				RequestId: apiError.RequestId,
@@ -78,3 +112,16 @@ func ErrorHandler() echo.HTTPErrorHandler {
 		}
 	}
 }
+
+// bodyFieldErrors returns the fields of the request body that failed to decode or validate.
+func bodyFieldErrors(err error) []commonApi.FieldError {
+	var validationErrors validator.ValidationErrors
+	var typeError *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &validationErrors):
+		return inner_validator.FieldErrors(validationErrors)
+	case errors.As(err, &typeError):
+		return []commonApi.FieldError{inner_validator.TypeFieldError(typeError)}
+	}
+	return nil
+}
@@ -5,23 +5,18 @@ import (
 	"database/sql"
 	"encoding/base64"
 	"fmt"
+	commonApi "github.com/juancwu/konbini/common/api"
 	"github.com/juancwu/konbini/server/config"
 	"github.com/juancwu/konbini/server/db"
+	"github.com/juancwu/konbini/server/events"
 	"github.com/juancwu/konbini/server/middlewares"
-	"github.com/juancwu/konbini/server/services"
 	"github.com/juancwu/konbini/server/utils"
 	"net/http"
 	"time"
 
 	"github.com/labstack/echo/v4"
-	"github.com/rs/zerolog/log"
 )
 
-// NewGroupRequest is the request body to create a new group
-type NewGroupRequest struct {
-	Name string `json:"name" validate:"required,min=3,max=50,printascii"`
-}
-
 // NewGroup handles request to create new groups
 func NewGroup(connector *db.DBConnector) echo.HandlerFunc {
 	return func(c echo.Context) error {
@@ -34,7 +29,7 @@ func NewGroup(connector *db.DBConnector) echo.HandlerFunc {
 				InternalError:  err,
 			}
 		}
-		body, err := middlewares.GetJsonBody[NewGroupRequest](c)
+		body, err := middlewares.GetJsonBody[commonApi.NewGroupRequest](c)
 		if err != nil {
 			return APIError{
 				Code:           http.StatusInternalServerError,
@@ -49,7 +44,7 @@ func NewGroup(connector *db.DBConnector) echo.HandlerFunc {
 		}
 		defer conn.Close()
 
-		q := db.New(conn)
+		q := db.New(db.Instrument(conn))
 
 		ctx, cancel := context.WithTimeout(c.Request().Context(), time.Minute)
 		defer cancel()
@@ -69,6 +64,7 @@ func NewGroup(connector *db.DBConnector) echo.HandlerFunc {
 			return APIError{
 				Code:           http.StatusBadRequest,
 				PublicMessage:  fmt.Sprintf("Group with name: '%s' already exists.", body.Name),
+				ErrorCode:      commonApi.ErrorCodeGroupNameTaken,
 				PrivateMessage: "Duplicate group",
 			}
 		}
@@ -77,7 +73,7 @@ func NewGroup(connector *db.DBConnector) echo.HandlerFunc {
 		if err != nil {
 			return err
 		}
-		q = q.WithTx(tx)
+		q = db.New(db.Instrument(tx))
 
 		groupId, err := q.NewGroup(ctx, db.NewGroupParams{
 			Name:      body.Name,
@@ -127,7 +123,7 @@ func NewGroup(connector *db.DBConnector) echo.HandlerFunc {
 			}
 		}
 
-		return c.JSON(http.StatusCreated, map[string]string{"group_id": groupId})
+		return c.JSON(http.StatusCreated, commonApi.NewGroupResponse{GroupID: groupId})
 	}
 }
 
@@ -139,6 +135,7 @@ func DeleteGroup(connector *db.DBConnector) echo.HandlerFunc {
 			return APIError{
 				Code:          http.StatusBadRequest,
 				PublicMessage: "Missing group id",
+				ErrorCode:     commonApi.ErrorCodeBadRequest,
 			}
 		}
 		user, err := middlewares.GetUser(c)
@@ -152,7 +149,7 @@ func DeleteGroup(connector *db.DBConnector) echo.HandlerFunc {
 		}
 		defer conn.Close()
 
-		q := db.New(conn)
+		q := db.New(db.Instrument(conn))
 
 		exists, err := q.ExistsGroupWithIdOwnedByUser(c.Request().Context(), db.ExistsGroupWithIdOwnedByUserParams{
 			ID:      groupId,
@@ -163,6 +160,7 @@ func DeleteGroup(connector *db.DBConnector) echo.HandlerFunc {
 				return APIError{
 					Code:          http.StatusBadRequest,
 					PublicMessage: "Group not found",
+					ErrorCode:     commonApi.ErrorCodeGroupNotFound,
 					InternalError: err,
 				}
 			}
@@ -172,6 +170,7 @@ func DeleteGroup(connector *db.DBConnector) echo.HandlerFunc {
 			return APIError{
 				Code:          http.StatusBadRequest,
 				PublicMessage: "Group not found",
+				ErrorCode:     commonApi.ErrorCodeGroupNotFound,
 				InternalError: err,
 			}
 		}
@@ -185,22 +184,13 @@ func DeleteGroup(connector *db.DBConnector) echo.HandlerFunc {
 	}
 }
 
-type InviteUsersToJoinGroupRequest struct {
-	GroupID string   `json:"group_id" validate:"required,uuid4"`
-	Emails  []string `json:"emails" validate:"gt=0,dive,email"`
-}
-
 func InviteUsersToJoinGroup(connector *db.DBConnector) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		user, err := middlewares.GetUser(c)
 		if err != nil {
 			return err
 		}
-		body, err := middlewares.GetJsonBody[InviteUsersToJoinGroupRequest](c)
-		if err != nil {
-			return err
-		}
-		cfg, err := config.Global()
+		body, err := middlewares.GetJsonBody[commonApi.InviteUsersToJoinGroupRequest](c)
 		if err != nil {
 			return err
 		}
@@ -213,7 +203,7 @@ func InviteUsersToJoinGroup(connector *db.DBConnector) echo.HandlerFunc {
 		}
 		defer conn.Close()
 
-		q := db.New(conn)
+		q := db.New(db.Instrument(conn))
 
 		group, err := q.GetGroupByIDOwendByUser(
 			c.Request().Context(),
@@ -227,54 +217,46 @@ func InviteUsersToJoinGroup(connector *db.DBConnector) echo.HandlerFunc {
 				return APIError{
 					Code:          http.StatusBadRequest,
 					PublicMessage: "No group found",
+					ErrorCode:     commonApi.ErrorCodeGroupNotFound,
 					InternalError: err,
 				}
 			}
 			return err
 		}
 
-		// the token needs to have the
-		// - invitation id
-		// - expiry time
-		// default expiry time is 24 hours
-
+		// the invitations are emailed once they are committed, the token of each one
+		// is made from the invitation id and expiry time when the email is sent
 		tx, err := conn.Begin()
 		if err != nil {
 			return err
 		}
 
-		q = q.WithTx(tx)
+		q = db.New(db.Instrument(tx))
 
-		params := services.SendGroupInvitationEmailsParams{
-			InvitorName: user.Nickname,
-			GroupName:   group.Name,
-			Users: make([]struct {
-				Name  string
-				Token string
-				Email string
-			}, len(body.Emails)),
-		}
-		for i, email := range body.Emails {
+		for _, email := range body.Emails {
 			invitedUser, err := q.GetUserByEmail(c.Request().Context(), email)
 			if err != nil {
+				tx.Rollback()
 				if err == sql.ErrNoRows {
 					return APIError{
 						Code:          http.StatusBadRequest,
 						PublicMessage: fmt.Sprintf("No user with email: '%s'", email),
+						ErrorCode:     commonApi.ErrorCodeUserNotFound,
 						InternalError: err,
 					}
 				}
 				return err
 			}
+			// default expiry time is 24 hours
 			now := time.Now()
-			exp := now.Add(time.Hour * 24)
+			exp := utils.FormatRFC3339NanoFixed(now.Add(time.Hour * 24))
 			invitationId, err := q.NewGroupInvitation(
 				c.Request().Context(),
 				db.NewGroupInvitationParams{
 					UserID:    invitedUser.ID,
 					GroupID:   body.GroupID,
 					CreatedAt: utils.FormatRFC3339NanoFixed(now),
-					ExpiresAt: utils.FormatRFC3339NanoFixed(exp),
+					ExpiresAt: exp,
 				},
 			)
 			if err != nil {
@@ -284,23 +266,21 @@ func InviteUsersToJoinGroup(connector *db.DBConnector) echo.HandlerFunc {
 				return err
 			}
 
-			// 36 bytes from invitation id + 30 from time
-			token := make([]byte, 66)
-			copy(token[:], []byte(invitationId))
-			copy(token[36:], []byte(utils.FormatRFC3339NanoFixed(exp)))
-
-			token, err = utils.EncryptAES(token, cfg.GetAesKey())
+			err = events.DefaultBus().Publish(c.Request().Context(), q, events.GroupInvitationCreated{
+				InvitationID: invitationId,
+				GroupID:      body.GroupID,
+				GroupName:    group.Name,
+				InvitorName:  user.Nickname,
+				UserName:     invitedUser.Nickname,
+				Email:        invitedUser.Email,
+				ExpiresAt:    exp,
+			})
 			if err != nil {
 				if err := tx.Rollback(); err != nil {
 					logger.Error().Err(err).Msg("Failed to rollback")
 				}
 				return err
 			}
-
-			// add encrypted token to list
-			params.Users[i].Token = base64.URLEncoding.EncodeToString(token)
-			params.Users[i].Name = invitedUser.Nickname
-			params.Users[i].Email = invitedUser.Email
 		}
 
 		// commit changes
@@ -311,22 +291,7 @@ func InviteUsersToJoinGroup(connector *db.DBConnector) echo.HandlerFunc {
 			}
 			return err
 		}
-
-		// send the emails
-		go func(params services.SendGroupInvitationEmailsParams) {
-			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
-			defer cancel()
-			res, err := services.SendGroupInvitationEmails(ctx, params)
-			if err != nil {
-				log.Error().Err(err).Msg("Failed to send group invitations")
-				return
-			}
-			ids := make([]string, len(res.Data))
-			for i, d := range res.Data {
-				ids[i] = d.Id
-			}
-			log.Info().Strs("email_ids", ids).Msg("Successfully sent group invitations")
-		}(params)
+		events.DefaultBus().Dispatch()
 
 		return c.NoContent(http.StatusCreated)
 	}
@@ -340,6 +305,7 @@ func AcceptGroupInvitation(connector *db.DBConnector) echo.HandlerFunc {
 			return APIError{
 				Code:          http.StatusBadRequest,
 				PublicMessage: "Missing token",
+				ErrorCode:     commonApi.ErrorCodeBadRequest,
 			}
 		}
 
@@ -354,6 +320,7 @@ func AcceptGroupInvitation(connector *db.DBConnector) echo.HandlerFunc {
 			return APIError{
 				Code:           http.StatusBadRequest,
 				PublicMessage:  "Invalid token",
+				ErrorCode:      commonApi.ErrorCodeInvitationInvalid,
 				PrivateMessage: "Failed to decode base64 token",
 				InternalError:  err,
 			}
@@ -365,6 +332,7 @@ func AcceptGroupInvitation(connector *db.DBConnector) echo.HandlerFunc {
 			return APIError{
 				Code:           http.StatusBadRequest,
 				PublicMessage:  "Invalid token",
+				ErrorCode:      commonApi.ErrorCodeInvitationInvalid,
 				PrivateMessage: "Failed to decrypt token",
 				InternalError:  err,
 			}
@@ -375,6 +343,7 @@ func AcceptGroupInvitation(connector *db.DBConnector) echo.HandlerFunc {
 			return APIError{
 				Code:           http.StatusBadRequest,
 				PublicMessage:  "Invalid token",
+				ErrorCode:      commonApi.ErrorCodeInvitationInvalid,
 				PrivateMessage: "Token is not 66 bytes long",
 			}
 		}
@@ -392,6 +361,7 @@ func AcceptGroupInvitation(connector *db.DBConnector) echo.HandlerFunc {
 			return APIError{
 				Code:          http.StatusBadRequest,
 				PublicMessage: "Invitation Expired",
+				ErrorCode:     commonApi.ErrorCodeInvitationExpired,
 			}
 		}
 
@@ -407,7 +377,7 @@ func AcceptGroupInvitation(connector *db.DBConnector) echo.HandlerFunc {
 			return err
 		}
 
-		q := db.New(tx)
+		q := db.New(db.Instrument(tx))
 
 		invitation, err := q.GetGroupInvitationByID(c.Request().Context(), string(invitationId))
 		if err != nil {
@@ -415,6 +385,7 @@ func AcceptGroupInvitation(connector *db.DBConnector) echo.HandlerFunc {
 				return APIError{
 					Code:           http.StatusBadRequest,
 					PublicMessage:  "Invalid Invitation",
+					ErrorCode:      commonApi.ErrorCodeInvitationInvalid,
 					PrivateMessage: "No invitation found in the database",
 					InternalError:  err,
 				}
@@ -444,11 +415,21 @@ func AcceptGroupInvitation(connector *db.DBConnector) echo.HandlerFunc {
 			return err
 		}
 
+		err = events.DefaultBus().Publish(c.Request().Context(), q, events.GroupMemberAdded{
+			GroupID: invitation.GroupID,
+			UserID:  invitation.UserID,
+		})
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
 		err = tx.Commit()
 		if err != nil {
 			tx.Rollback()
 			return err
 		}
+		events.DefaultBus().Dispatch()
 
 		return c.NoContent(http.StatusOK)
 	}
@@ -2,8 +2,10 @@ package handlers
 
 import (
 	"context"
+	commonApi "github.com/juancwu/konbini/common/api"
 	"github.com/juancwu/konbini/server/config"
 	"github.com/juancwu/konbini/server/db"
+	"github.com/juancwu/konbini/server/services"
 	"net/http"
 	"time"
 
@@ -11,15 +13,9 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
-// HealthReport represents a health check report response body.
-type HealthReport struct {
-	Version                  string `json:"version"`
-	DatabaseConnectionStatus string `json:"database_connection_status"`
-}
-
 // HealthCheck handles health check requests.
 // It gets the current running version of the app.
-// It gets the database connection status.
+// It gets the database connection status and responds with 503 if the database is not reachable.
 func HealthCheck(cfg *config.Config, connector *db.DBConnector) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		conn, err := connector.Connect()
@@ -27,21 +23,58 @@ func HealthCheck(cfg *config.Config, connector *db.DBConnector) echo.HandlerFunc
 			return err
 		}
 		defer conn.Close()
-		report := HealthReport{
+		report := commonApi.HealthReport{
 			Version: cfg.GetVersion(),
 		}
 
-		ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+		ctx, cancel := context.WithTimeout(c.Request().Context(), time.Second*5)
 		defer cancel()
 		err = conn.PingContext(ctx)
 		dbStatus := "Healthy"
+		status := http.StatusOK
 		if err != nil {
 			log.Error().Err(err).Msg("Failed to ping database during health check")
 			dbStatus = "Error"
+			status = http.StatusServiceUnavailable
 		}
 
 		report.DatabaseConnectionStatus = dbStatus
 
-		return c.JSON(http.StatusOK, report)
+		return c.JSON(status, report)
+	}
+}
+
+// Livez handles liveness probes. It only reports that the process is serving
+// requests and never checks dependencies, a restart would not fix them.
+func Livez(cfg *config.Config) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.JSON(http.StatusOK, commonApi.LivenessReport{
+			Status:  services.HEALTH_STATUS_OK,
+			Version: cfg.GetVersion(),
+		})
+	}
+}
+
+// Readyz handles readiness probes. It responds with 503 and the status of every
+// check when any dependency is not ready. The errors are logged instead of sent,
+// they can contain hostnames and other details of the dependencies.
+func Readyz(checker *services.HealthChecker) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		report := checker.Check(c.Request().Context())
+		res := commonApi.ReadinessReport{
+			Status:    report.Status,
+			Version:   report.Version,
+			CheckedAt: report.CheckedAt,
+			Checks:    make([]commonApi.ReadinessCheck, len(report.Checks)),
+		}
+		for i, check := range report.Checks {
+			res.Checks[i] = commonApi.ReadinessCheck{Name: check.Name, Status: check.Status}
+		}
+
+		if !report.Ready() {
+			log.Warn().Interface("checks", report.Checks).Msg("Readiness check failed")
+			return c.JSON(http.StatusServiceUnavailable, res)
+		}
+		return c.JSON(http.StatusOK, res)
 	}
 }
@@ -0,0 +1,22 @@
+package handlers
+
+import (
+	"github.com/juancwu/konbini/server/openapi"
+	"net/http"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+)
+
+// OpenAPI serves the OpenAPI document of the api. The document is built on the
+// first request, every route has been registered by then.
+func OpenAPI(build func() *openapi.Document) echo.HandlerFunc {
+	var once sync.Once
+	var doc *openapi.Document
+	return func(c echo.Context) error {
+		once.Do(func() {
+			doc = build()
+		})
+		return c.JSON(http.StatusOK, doc)
+	}
+}
@@ -0,0 +1,370 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	commonApi "github.com/juancwu/konbini/common/api"
+	"github.com/juancwu/konbini/server/config"
+	"github.com/juancwu/konbini/server/db"
+	"github.com/juancwu/konbini/server/middlewares"
+	"github.com/juancwu/konbini/server/services"
+	"github.com/juancwu/konbini/server/utils"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// NewBentoWebhook subscribes a webhook to the events of a bento. Only the owner of the bento can manage its webhooks.
+func NewBentoWebhook(connector *db.DBConnector) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		bentoID := c.Param("id")
+		return newWebhook(c, connector, func(ctx context.Context, q *db.Queries, user db.User) (db.NewWebhookParams, error) {
+			if _, err := ownedBento(ctx, q, user.ID, bentoID); err != nil {
+				return db.NewWebhookParams{}, err
+			}
+			return db.NewWebhookParams{BentoID: &bentoID}, nil
+		})
+	}
+}
+
+// ListBentoWebhooks lists the webhooks of a bento.
+func ListBentoWebhooks(connector *db.DBConnector) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		bentoID := c.Param("id")
+		return listWebhooks(c, connector, func(ctx context.Context, q *db.Queries, user db.User) ([]db.Webhook, error) {
+			if _, err := ownedBento(ctx, q, user.ID, bentoID); err != nil {
+				return nil, err
+			}
+			return q.ListBentoWebhooks(ctx, &bentoID)
+		})
+	}
+}
+
+// NewGroupWebhook subscribes a webhook to the events of a group. Only the owner of the group can manage its webhooks.
+func NewGroupWebhook(connector *db.DBConnector) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		groupID := c.Param("id")
+		return newWebhook(c, connector, func(ctx context.Context, q *db.Queries, user db.User) (db.NewWebhookParams, error) {
+			if _, err := ownedGroup(ctx, q, user.ID, groupID); err != nil {
+				return db.NewWebhookParams{}, err
+			}
+			return db.NewWebhookParams{GroupID: &groupID}, nil
+		})
+	}
+}
+
+// ListGroupWebhooks lists the webhooks of a group.
+func ListGroupWebhooks(connector *db.DBConnector) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		groupID := c.Param("id")
+		return listWebhooks(c, connector, func(ctx context.Context, q *db.Queries, user db.User) ([]db.Webhook, error) {
+			if _, err := ownedGroup(ctx, q, user.ID, groupID); err != nil {
+				return nil, err
+			}
+			return q.ListGroupWebhooks(ctx, &groupID)
+		})
+	}
+}
+
+// DeleteWebhook removes a webhook along with its delivery log.
+func DeleteWebhook(connector *db.DBConnector) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		user, err := middlewares.GetUser(c)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request().Context(), FiveSeconds)
+		defer cancel()
+
+		conn, err := connector.Connect()
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		q := db.New(db.Instrument(conn))
+
+		webhook, err := managedWebhook(ctx, q, user.ID, c.Param("id"))
+		if err != nil {
+			return err
+		}
+		if err := q.DeleteWebhook(ctx, webhook.ID); err != nil {
+			return err
+		}
+
+		return c.NoContent(http.StatusOK)
+	}
+}
+
+// ListWebhookDeliveries lists the latest deliveries of a webhook, newest first.
+func ListWebhookDeliveries(connector *db.DBConnector) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		limit := 50
+		if raw := c.QueryParam("limit"); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n <= 0 || n > 500 {
+				return APIError{
+					Code:          http.StatusBadRequest,
+					PublicMessage: "Invalid limit. Expecting a number between 1 and 500.",
+					ErrorCode:     commonApi.ErrorCodeBadRequest,
+				}
+			}
+			limit = n
+		}
+
+		user, err := middlewares.GetUser(c)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request().Context(), FiveSeconds)
+		defer cancel()
+
+		conn, err := connector.Connect()
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		q := db.New(db.Instrument(conn))
+
+		webhook, err := managedWebhook(ctx, q, user.ID, c.Param("id"))
+		if err != nil {
+			return err
+		}
+		deliveries, err := q.ListWebhookDeliveries(ctx, db.ListWebhookDeliveriesParams{
+			WebhookID: webhook.ID,
+			Limit:     int64(limit),
+		})
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+
+		res := make([]commonApi.WebhookDeliveryResponse, len(deliveries))
+		for i, d := range deliveries {
+			res[i] = commonApi.WebhookDeliveryResponse{
+				ID:             d.ID,
+				EventID:        d.EventID,
+				EventType:      d.EventType,
+				Status:         d.Status,
+				Attempts:       d.Attempts,
+				MaxAttempts:    d.MaxAttempts,
+				ResponseStatus: d.ResponseStatus,
+				LastError:      d.LastError,
+				RunAt:          d.RunAt,
+				DeliveredAt:    d.DeliveredAt,
+				CreatedAt:      d.CreatedAt,
+			}
+		}
+
+		return c.JSON(http.StatusOK, res)
+	}
+}
+
+// TestWebhook queues a webhook.test event for a webhook so that receivers can check their setup.
+func TestWebhook(connector *db.DBConnector, queue *services.WebhookQueue) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		user, err := middlewares.GetUser(c)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request().Context(), FiveSeconds)
+		defer cancel()
+
+		conn, err := connector.Connect()
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		webhook, err := managedWebhook(ctx, db.New(db.Instrument(conn)), user.ID, c.Param("id"))
+		if err != nil {
+			return err
+		}
+
+		deliveryID, err := queue.SendTest(ctx, webhook.ID)
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(http.StatusAccepted, commonApi.TestWebhookResponse{DeliveryID: deliveryID})
+	}
+}
+
+// newWebhook creates a webhook for the scope returned by the scope function, it also checks access to it.
+func newWebhook(c echo.Context, connector *db.DBConnector, scope func(ctx context.Context, q *db.Queries, user db.User) (db.NewWebhookParams, error)) error {
+	user, err := middlewares.GetUser(c)
+	if err != nil {
+		return err
+	}
+	body, err := middlewares.GetJsonBody[commonApi.NewWebhookRequest](c)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), FiveSeconds)
+	defer cancel()
+
+	if err := services.ValidateWebhookURL(ctx, body.URL); err != nil {
+		return APIError{
+			Code:          http.StatusBadRequest,
+			PublicMessage: "The webhook url must resolve to a public address.",
+			ErrorCode:     commonApi.ErrorCodeWebhookURLNotAllowed,
+			InternalError: err,
+		}
+	}
+
+	cfg, err := config.Global()
+	if err != nil {
+		return err
+	}
+
+	conn, err := connector.Connect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	q := db.New(db.Instrument(conn))
+
+	params, err := scope(ctx, q, user)
+	if err != nil {
+		return err
+	}
+
+	secret, err := services.NewWebhookSecret()
+	if err != nil {
+		return err
+	}
+	encrypted, err := utils.EncryptAES([]byte(secret), cfg.GetAesKey())
+	if err != nil {
+		return err
+	}
+	events, err := json.Marshal(uniqueStrings(body.Events))
+	if err != nil {
+		return err
+	}
+
+	now := utils.FormatRFC3339NanoFixed(time.Now())
+	params.UserID = user.ID
+	params.Url = body.URL
+	params.Secret = encrypted
+	params.Events = string(events)
+	params.CreatedAt = now
+	params.UpdatedAt = now
+
+	id, err := q.NewWebhook(ctx, params)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusCreated, commonApi.NewWebhookResponse{WebhookID: id, Secret: secret})
+}
+
+// listWebhooks responds with the webhooks returned by the list function without their secrets.
+func listWebhooks(c echo.Context, connector *db.DBConnector, list func(ctx context.Context, q *db.Queries, user db.User) ([]db.Webhook, error)) error {
+	user, err := middlewares.GetUser(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), FiveSeconds)
+	defer cancel()
+
+	conn, err := connector.Connect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	webhooks, err := list(ctx, db.New(db.Instrument(conn)), user)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	res := make([]commonApi.WebhookResponse, len(webhooks))
+	for i, w := range webhooks {
+		events, err := services.WebhookEvents(w)
+		if err != nil {
+			return err
+		}
+		res[i] = commonApi.WebhookResponse{
+			ID:        w.ID,
+			BentoID:   w.BentoID,
+			GroupID:   w.GroupID,
+			URL:       w.Url,
+			Events:    events,
+			CreatedAt: w.CreatedAt,
+		}
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+// ownedBento gets a bento owned by the user.
+func ownedBento(ctx context.Context, q *db.Queries, userID string, bentoID string) (db.Bento, error) {
+	bento, err := q.GetBentoWithIDOwnedByUser(ctx, db.GetBentoWithIDOwnedByUserParams{
+		ID:     bentoID,
+		UserID: userID,
+	})
+	if err == sql.ErrNoRows {
+		return bento, APIError{
+			Code:          http.StatusNotFound,
+			PublicMessage: "Bento not found",
+			ErrorCode:     commonApi.ErrorCodeBentoNotFound,
+			InternalError: err,
+		}
+	}
+	return bento, err
+}
+
+// ownedGroup gets a group owned by the user.
+func ownedGroup(ctx context.Context, q *db.Queries, userID string, groupID string) (db.Group, error) {
+	group, err := q.GetGroupByIDOwendByUser(ctx, db.GetGroupByIDOwendByUserParams{
+		ID:      groupID,
+		OwnerID: userID,
+	})
+	if err == sql.ErrNoRows {
+		return group, APIError{
+			Code:          http.StatusNotFound,
+			PublicMessage: "Group not found",
+			ErrorCode:     commonApi.ErrorCodeGroupNotFound,
+			InternalError: err,
+		}
+	}
+	return group, err
+}
+
+// managedWebhook gets a webhook of a bento or a group owned by the user.
+func managedWebhook(ctx context.Context, q *db.Queries, userID string, webhookID string) (db.Webhook, error) {
+	webhook, err := q.GetWebhookManagedByUser(ctx, db.GetWebhookManagedByUserParams{
+		ID:     webhookID,
+		UserID: userID,
+	})
+	if err == sql.ErrNoRows {
+		return webhook, APIError{
+			Code:          http.StatusNotFound,
+			PublicMessage: "Webhook not found",
+			ErrorCode:     commonApi.ErrorCodeWebhookNotFound,
+			InternalError: err,
+		}
+	}
+	return webhook, err
+}
+
+func uniqueStrings(values []string) []string {
+	seen := map[string]bool{}
+	unique := []string{}
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			unique = append(unique, v)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,263 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Outcomes of an attempt to run a job.
+type Outcome string
+
+const (
+	OUTCOME_DONE  Outcome = "done"
+	OUTCOME_RETRY Outcome = "retry"
+	OUTCOME_DEAD  Outcome = "dead"
+)
+
+// Job is a job claimed from a Store.
+type Job interface {
+	JobID() string
+	// JobAttempts returns the attempts made so far, including the claimed one, and how many are allowed.
+	JobAttempts() (attempts int64, maxAttempts int64)
+	// JobLease returns the lease of the claim. The result of an attempt is only recorded while the
+	// job still holds it.
+	JobLease() string
+}
+
+// ErrLeaseLost is returned by a Store when the job was claimed again after its lease expired.
+var ErrLeaseLost error = errors.New("Job lease was lost")
+
+// LeaseHeld returns ErrLeaseLost when the write of a result changed no rows.
+func LeaseHeld(rows int64, err error) error {
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// Store persists the jobs of a Worker. J is a claimed job and R the result of running it, the
+// store records the result of every attempt. Claim must be atomic so that multiple workers
+// (or multiple server instances) never run the same job at the same time.
+// Complete, Retry and Bury return ErrLeaseLost when the job no longer holds the lease.
+type Store[J Job, R any] interface {
+	// Claim locks the next runnable job until the lease expires. It returns sql.ErrNoRows
+	// when there is nothing to run.
+	Claim(ctx context.Context, now time.Time, lease time.Duration) (J, error)
+	Complete(ctx context.Context, id string, lease string, result R) error
+	Retry(ctx context.Context, id string, lease string, runAt time.Time, result R, lastError string) error
+	Bury(ctx context.Context, id string, lease string, result R, lastError string) error
+}
+
+// finishTimeout bounds the write of the outcome of an attempt.
+const finishTimeout time.Duration = time.Second * 10
+
+// Config configures the goroutines of a Worker.
+type Config struct {
+	Workers      int
+	PollInterval time.Duration
+	Lease        time.Duration
+	// Timeout bounds every attempt.
+	Timeout     time.Duration
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+}
+
+// permanentError is an error that fails a job without retries.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks an error that will happen again on every attempt, like a malformed payload.
+// The job is buried without using the attempts that are left.
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// Worker runs the jobs of a Store with a pool of goroutines. A failed job is retried with
+// exponential backoff until it runs out of attempts, then it is buried where it can be
+// inspected. Jobs are run at least once, a job whose lease expires is claimed again.
+type Worker[J Job, R any] struct {
+	name  string
+	store Store[J, R]
+	run   func(ctx context.Context, job J) (R, error)
+	cfg   Config
+
+	// Log adds the fields that identify a job to the logs of the worker, it is optional.
+	Log func(job J, logger zerolog.Context) zerolog.Context
+	// Observe is called with the outcome of every attempt, it is optional.
+	Observe func(job J, result R, outcome Outcome)
+
+	wake   chan struct{}
+	wg     sync.WaitGroup
+	cancel context.CancelFunc
+}
+
+// NewWorker creates a worker that runs the jobs of store with run. The name is used in the logs.
+// Call Start to begin running jobs.
+func NewWorker[J Job, R any](name string, store Store[J, R], cfg Config, run func(ctx context.Context, job J) (R, error)) *Worker[J, R] {
+	return &Worker[J, R]{
+		name:  name,
+		store: store,
+		run:   run,
+		cfg:   cfg,
+		wake:  make(chan struct{}, 1),
+	}
+}
+
+// Nudge wakes an idle goroutine to run a new job, it does not block if one is already awake.
+func (w *Worker[J, R]) Nudge() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start launches the goroutines. They stop when the context is cancelled or Stop is called.
+func (w *Worker[J, R]) Start(ctx context.Context) {
+	ctx, w.cancel = context.WithCancel(ctx)
+	for i := 0; i < w.cfg.Workers; i++ {
+		w.wg.Add(1)
+		go w.work(ctx)
+	}
+}
+
+// Stop stops all goroutines and waits for the jobs in flight to finish. The jobs in flight are
+// not cancelled, they are bounded by the timeout of the worker.
+func (w *Worker[J, R]) Stop() {
+	if w.cancel != nil {
+		w.cancel()
+	}
+	w.wg.Wait()
+}
+
+// work is the loop run by each goroutine.
+func (w *Worker[J, R]) work(ctx context.Context) {
+	defer w.wg.Done()
+	ticker := time.NewTicker(w.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		processed, err := w.processNext(ctx)
+		if err != nil {
+			log.Error().Err(err).Str("worker", w.name).Msg("Failed to process job")
+		}
+		if processed {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// processNext claims and runs a single job. It returns false when no job was runnable.
+func (w *Worker[J, R]) processNext(ctx context.Context) (bool, error) {
+	if ctx.Err() != nil {
+		return false, nil
+	}
+
+	job, err := w.store.Claim(ctx, time.Now(), w.cfg.Lease)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	id := job.JobID()
+	attempts, maxAttempts := job.JobAttempts()
+	logContext := log.With().Str("worker", w.name).Str("job_id", id).Int64("attempts", attempts)
+	if w.Log != nil {
+		logContext = w.Log(job, logContext)
+	}
+	logger := logContext.Logger()
+
+	// Stop waits for the claimed job, it must not cancel the attempt or the write of its outcome
+	ctx = context.WithoutCancel(ctx)
+	result, err := w.attempt(ctx, job)
+
+	ctx, cancel := context.WithTimeout(ctx, finishTimeout)
+	defer cancel()
+	lease := job.JobLease()
+	var outcome Outcome
+	var permanent *permanentError
+	switch {
+	case err == nil:
+		outcome = OUTCOME_DONE
+		err = w.store.Complete(ctx, id, lease, result)
+	case errors.As(err, &permanent) || attempts >= maxAttempts:
+		logger.Error().Err(err).Msg("Job failed for good, moving to dead-letter")
+		outcome = OUTCOME_DEAD
+		err = w.store.Bury(ctx, id, lease, result, err.Error())
+	default:
+		runAt := time.Now().Add(Backoff(w.cfg.BaseBackoff, w.cfg.MaxBackoff, attempts))
+		logger.Warn().Err(err).Time("run_at", runAt).Msg("Job failed, scheduling retry")
+		outcome = OUTCOME_RETRY
+		err = w.store.Retry(ctx, id, lease, runAt, result, err.Error())
+	}
+	if errors.Is(err, ErrLeaseLost) {
+		// the job was claimed again, the attempt that holds the lease records its outcome
+		logger.Warn().Str("outcome", string(outcome)).Msg("Job lease expired before the attempt finished, dropping its outcome")
+		return true, nil
+	}
+	if err != nil {
+		return true, err
+	}
+	w.observe(job, result, outcome)
+	return true, nil
+}
+
+// attempt runs the job with the timeout of the worker. A panic is returned as an error so that
+// it is retried like any other failure.
+func (w *Worker[J, R]) attempt(ctx context.Context, job J) (result R, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("Job panicked: %v", r)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, w.cfg.Timeout)
+	defer cancel()
+	return w.run(ctx, job)
+}
+
+func (w *Worker[J, R]) observe(job J, result R, outcome Outcome) {
+	if w.Observe != nil {
+		w.Observe(job, result, outcome)
+	}
+}
+
+// Backoff calculates the delay before the next attempt. The delay doubles
+// after every failed attempt and is capped at max.
+func Backoff(base time.Duration, max time.Duration, attempts int64) time.Duration {
+	delay := base
+	for i := int64(1); i < attempts; i++ {
+		delay *= 2
+		if delay >= max {
+			return max
+		}
+	}
+	return delay
+}
@@ -1,19 +1,59 @@
 package memcache
 
 import (
+	"context"
+	"github.com/juancwu/konbini/server/config"
 	"time"
-
-	gocache "github.com/patrickmn/go-cache"
 )
 
-var cache *gocache.Cache
+// Store is a key-value cache with expiration. Values are raw bytes so that every
+// backend stores the same representation and different server instances sharing
+// a backend can read each other's entries.
+type Store interface {
+	// Get returns the value stored at key or ErrNotFound.
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Set stores the value at key, replacing any existing value.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Add stores the value only if the key does not exist yet, otherwise it returns ErrExists.
+	Add(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Delete removes the key. Deleting a missing key is not an error.
+	Delete(ctx context.Context, key string) error
+	// Incr atomically increments the counter at key by delta and returns the new value.
+	// Missing keys start at zero. The expiration of the key is reset to ttl on every call, a ttl
+	// of zero or less keeps the key without expiration.
+	Incr(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error)
+	// TTL returns the time left before the key expires or ErrNotFound.
+	// Keys without an expiration return 0.
+	TTL(ctx context.Context, key string) (time.Duration, error)
+}
+
+var cache Store
 
-func Cache() *gocache.Cache {
+// Cache returns the cache shared by the server. An in-memory cache is used
+// if SetCache has not been called.
+func Cache() Store {
 	if cache != nil {
 		return cache
 	}
 
-	cache = gocache.New(time.Minute*5, time.Minute*10)
+	cache = NewMemoryStore(time.Minute * 10)
 
 	return cache
 }
+
+// SetCache sets the cache returned by Cache. It is not safe for concurrent use
+// and should only be called during the server boot.
+func SetCache(store Store) {
+	cache = store
+}
+
+// New creates the cache backend selected by the server configuration.
+func New(cfg *config.Config) (Store, error) {
+	switch cfg.GetCacheBackend() {
+	case config.CACHE_BACKEND_MEMORY:
+		return NewMemoryStore(time.Minute * 10), nil
+	case config.CACHE_BACKEND_REDIS:
+		return NewRedisStore(cfg.GetRedisUrl())
+	}
+	return nil, ErrUnknownCacheBackend
+}
@@ -3,6 +3,8 @@ package memcache
 import "errors"
 
 var (
-	ErrNotFound    error = errors.New("Not found in memory cache")
-	ErrInvalidItem error = errors.New("Invalid item type/struct")
+	ErrNotFound            error = errors.New("Not found in memory cache")
+	ErrInvalidItem         error = errors.New("Invalid item type/struct")
+	ErrExists              error = errors.New("Key already exists in memory cache")
+	ErrUnknownCacheBackend error = errors.New("Unknown cache backend")
 )
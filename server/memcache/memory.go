@@ -0,0 +1,85 @@
+package memcache
+
+import (
+	"context"
+	"github.com/juancwu/konbini/server/metrics"
+	"strconv"
+	"sync"
+	"time"
+
+	gocache "github.com/patrickmn/go-cache"
+)
+
+// MemoryStore is a process-local Store. Entries are not shared between server instances.
+type MemoryStore struct {
+	items *gocache.Cache
+	// incrLock serializes read-modify-write counter updates
+	incrLock sync.Mutex
+}
+
+// NewMemoryStore creates an in-memory store that purges expired items every cleanupInterval.
+func NewMemoryStore(cleanupInterval time.Duration) *MemoryStore {
+	return &MemoryStore{items: gocache.New(gocache.NoExpiration, cleanupInterval)}
+}
+
+func (s *MemoryStore) Get(_ context.Context, key string) ([]byte, error) {
+	v, found := s.items.Get(key)
+	metrics.CacheLookup(found)
+	if !found {
+		return nil, ErrNotFound
+	}
+	b, ok := v.([]byte)
+	if !ok {
+		return nil, ErrInvalidItem
+	}
+	return append([]byte(nil), b...), nil
+}
+
+func (s *MemoryStore) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	s.items.Set(key, append([]byte(nil), value...), ttl)
+	return nil
+}
+
+func (s *MemoryStore) Add(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	if err := s.items.Add(key, append([]byte(nil), value...), ttl); err != nil {
+		return ErrExists
+	}
+	return nil
+}
+
+func (s *MemoryStore) Delete(_ context.Context, key string) error {
+	s.items.Delete(key)
+	return nil
+}
+
+func (s *MemoryStore) Incr(_ context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	s.incrLock.Lock()
+	defer s.incrLock.Unlock()
+
+	var n int64
+	if v, found := s.items.Get(key); found {
+		b, ok := v.([]byte)
+		if !ok {
+			return 0, ErrInvalidItem
+		}
+		current, err := strconv.ParseInt(string(b), 10, 64)
+		if err != nil {
+			return 0, ErrInvalidItem
+		}
+		n = current
+	}
+	n += delta
+	s.items.Set(key, []byte(strconv.FormatInt(n, 10)), ttl)
+	return n, nil
+}
+
+func (s *MemoryStore) TTL(_ context.Context, key string) (time.Duration, error) {
+	_, exp, found := s.items.GetWithExpiration(key)
+	if !found {
+		return 0, ErrNotFound
+	}
+	if exp.IsZero() {
+		return 0, nil
+	}
+	return time.Until(exp), nil
+}
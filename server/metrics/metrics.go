@@ -0,0 +1,177 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "konbini"
+
+// Label values shared by the counters below.
+const (
+	RESULT_SUCCESS string = "success"
+	RESULT_FAILURE string = "failure"
+
+	CACHE_HIT  string = "hit"
+	CACHE_MISS string = "miss"
+
+	EMAIL_SENT  string = "sent"
+	EMAIL_RETRY string = "retry"
+	EMAIL_DEAD  string = "dead"
+
+	WEBHOOK_DELIVERED string = "delivered"
+	WEBHOOK_RETRY     string = "retry"
+	WEBHOOK_DEAD      string = "dead"
+
+	EVENT_DONE  string = "done"
+	EVENT_RETRY string = "retry"
+	EVENT_DEAD  string = "dead"
+)
+
+// Registry holds every konbini metric plus the Go runtime and process collectors.
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+var (
+	httpRequestDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Duration of HTTP requests by route and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	dbQueryDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "db",
+		Name:      "query_duration_seconds",
+		Help:      "Duration of database queries by sqlc query name.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"query", "result"})
+
+	cacheRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "cache",
+		Name:      "requests_total",
+		Help:      "Cache lookups by result (hit or miss).",
+	}, []string{"result"})
+
+	logins = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "auth",
+		Name:      "logins_total",
+		Help:      "Login attempts by result (success or failure).",
+	}, []string{"result"})
+
+	totpLockouts = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "auth",
+		Name:      "totp_lockouts_total",
+		Help:      "Number of times a user reached the maximum failed TOTP attempts.",
+	})
+
+	totpBlockedRequests = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "auth",
+		Name:      "totp_blocked_requests_total",
+		Help:      "Requests rejected because the user is in a TOTP cooldown.",
+	})
+
+	emailSends = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "email",
+		Name:      "sends_total",
+		Help:      "Email send attempts by outcome (sent, retry or dead).",
+	}, []string{"outcome"})
+
+	webhookDeliveries = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "webhook",
+		Name:      "deliveries_total",
+		Help:      "Webhook delivery attempts by outcome (delivered, retry or dead).",
+	}, []string{"outcome"})
+
+	eventDispatches = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "events",
+		Name:      "dispatches_total",
+		Help:      "Outbox event dispatches to async subscribers by subscriber and outcome (done, retry or dead).",
+	}, []string{"subscriber", "outcome"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// ObserveHTTPRequest records the duration of a request. The route should be the
+// route pattern and not the raw path to keep the number of series bounded.
+func ObserveHTTPRequest(method string, route string, status int, duration time.Duration) {
+	httpRequestDuration.WithLabelValues(method, route, strconv.Itoa(status)).Observe(duration.Seconds())
+}
+
+// ObserveDBQuery records the duration of a sqlc query.
+func ObserveDBQuery(query string, err error, duration time.Duration) {
+	result := RESULT_SUCCESS
+	if err != nil {
+		result = RESULT_FAILURE
+	}
+	dbQueryDuration.WithLabelValues(query, result).Observe(duration.Seconds())
+}
+
+// CacheLookup counts a cache hit or miss.
+func CacheLookup(hit bool) {
+	if hit {
+		cacheRequests.WithLabelValues(CACHE_HIT).Inc()
+	} else {
+		cacheRequests.WithLabelValues(CACHE_MISS).Inc()
+	}
+}
+
+// Login counts a login attempt.
+func Login(success bool) {
+	if success {
+		logins.WithLabelValues(RESULT_SUCCESS).Inc()
+	} else {
+		logins.WithLabelValues(RESULT_FAILURE).Inc()
+	}
+}
+
+// TOTPLockout counts a user reaching the maximum failed TOTP attempts.
+func TOTPLockout() {
+	totpLockouts.Inc()
+}
+
+// TOTPBlockedRequest counts a request rejected during a TOTP cooldown.
+func TOTPBlockedRequest() {
+	totpBlockedRequests.Inc()
+}
+
+// EmailSend counts the outcome of an email send attempt.
+func EmailSend(outcome string) {
+	emailSends.WithLabelValues(outcome).Inc()
+}
+
+// WebhookDelivery counts the outcome of a webhook delivery attempt.
+func WebhookDelivery(outcome string) {
+	webhookDeliveries.WithLabelValues(outcome).Inc()
+}
+
+// EventDispatch counts the outcome of dispatching an outbox event to an async subscriber.
+func EventDispatch(subscriber string, outcome string) {
+	eventDispatches.WithLabelValues(subscriber, outcome).Inc()
+}
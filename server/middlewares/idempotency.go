@@ -0,0 +1,240 @@
+package middlewares
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	commonApi "github.com/juancwu/konbini/common/api"
+	"github.com/juancwu/konbini/server/memcache"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// IDEMPOTENCY_KEY_TTL is how long the response of a request is kept for its idempotency key.
+	IDEMPOTENCY_KEY_TTL = 24 * time.Hour
+	// IDEMPOTENCY_LOCK_TTL is how long a key is reserved while its request is handled. It expires
+	// on its own if the server stops in the middle of a request.
+	IDEMPOTENCY_LOCK_TTL = time.Minute
+	// MAX_IDEMPOTENCY_KEY_LENGTH is the longest idempotency key accepted.
+	MAX_IDEMPOTENCY_KEY_LENGTH = 255
+	// Key prefix for memcache
+	IdempotencyKeyPrefix = "idempotency_"
+)
+
+// IdempotencyConfig is the configuration of the Idempotency middleware.
+type IdempotencyConfig struct {
+	// TTL is how long responses are stored, defaults to IDEMPOTENCY_KEY_TTL.
+	TTL time.Duration
+	// LockTTL is how long a key is reserved while its request is handled, defaults to IDEMPOTENCY_LOCK_TTL.
+	LockTTL time.Duration
+	// Store holds the responses, defaults to the shared memcache.Cache().
+	Store memcache.Store
+	// MaxBodySize limits the request body that is read to fingerprint the request, defaults to 10MB.
+	MaxBodySize int64
+}
+
+// idempotencyRecord is the state of an idempotency key that is saved in the cache.
+type idempotencyRecord struct {
+	// Fingerprint identifies the request the key was first used with.
+	Fingerprint string `json:"fingerprint"`
+	Completed   bool   `json:"completed"`
+	Status      int    `json:"status,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	ETag        string `json:"etag,omitempty"`
+	Body        []byte `json:"body,omitempty"`
+}
+
+// Idempotency is a shortcut function to use the Idempotency middleware with the default configuration.
+func Idempotency() echo.MiddlewareFunc {
+	return IdempotencyWithConfig(IdempotencyConfig{})
+}
+
+// IdempotencyWithConfig is a middleware that honors the Idempotency-Key header. The successful
+// response of a request is stored per user and replayed for requests that reuse the key with the
+// same method, path and body. A key reused for a different request is rejected.
+//
+// Only successful responses are stored, a request that failed can be retried with the same key.
+// The middleware must be placed after one of the Protect middlewares since keys are scoped to the user.
+func IdempotencyWithConfig(cfg IdempotencyConfig) echo.MiddlewareFunc {
+	if cfg.TTL == 0 {
+		cfg.TTL = IDEMPOTENCY_KEY_TTL
+	}
+	if cfg.LockTTL == 0 {
+		cfg.LockTTL = IDEMPOTENCY_LOCK_TTL
+	}
+	if cfg.MaxBodySize == 0 {
+		cfg.MaxBodySize = 10 << 20 // 10MB
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			key := c.Request().Header.Get(commonApi.HeaderIdempotencyKey)
+			if key == "" {
+				return next(c)
+			}
+			if len(key) > MAX_IDEMPOTENCY_KEY_LENGTH {
+				return &commonApi.ErrorResponse{
+					Code:      http.StatusBadRequest,
+					ErrorCode: commonApi.ErrorCodeInvalidIdempotencyKey,
+					Message:   fmt.Sprintf("Idempotency-Key must be at most %d characters long.", MAX_IDEMPOTENCY_KEY_LENGTH),
+				}
+			}
+
+			user, err := GetUser(c)
+			if err != nil {
+				return err
+			}
+
+			store := cfg.Store
+			if store == nil {
+				store = memcache.Cache()
+			}
+			ctx := c.Request().Context()
+			logger := GetLogger(c)
+
+			fingerprint, err := requestFingerprint(c, cfg.MaxBodySize)
+			if err != nil {
+				return err
+			}
+			cacheKey := idempotencyCacheKey(user.ID, key)
+
+			// reserve the key, only one request can be handled for it at a time
+			lock, err := json.Marshal(idempotencyRecord{Fingerprint: fingerprint})
+			if err != nil {
+				return err
+			}
+			err = store.Add(ctx, cacheKey, lock, cfg.LockTTL)
+			if errors.Is(err, memcache.ErrExists) {
+				return replayIdempotentResponse(c, store, cacheKey, fingerprint)
+			}
+			if err != nil {
+				return err
+			}
+
+			recorder := &idempotencyRecorder{ResponseWriter: c.Response().Writer}
+			c.Response().Writer = recorder
+
+			err = next(c)
+
+			status := c.Response().Status
+			if err != nil || status < 200 || status >= 300 {
+				// release the key so the request can be retried
+				if delErr := store.Delete(ctx, cacheKey); delErr != nil {
+					logger.Error().Err(delErr).Msg("Failed to release idempotency key")
+				}
+				return err
+			}
+
+			record, marshalErr := json.Marshal(idempotencyRecord{
+				Fingerprint: fingerprint,
+				Completed:   true,
+				Status:      status,
+				ContentType: c.Response().Header().Get(echo.HeaderContentType),
+				ETag:        c.Response().Header().Get(commonApi.HeaderETag),
+				Body:        recorder.body.Bytes(),
+			})
+			if marshalErr == nil {
+				marshalErr = store.Set(ctx, cacheKey, record, cfg.TTL)
+			}
+			if marshalErr != nil {
+				// the response has been sent already, a retry will run the request again
+				logger.Error().Err(marshalErr).Msg("Failed to store idempotent response")
+				store.Delete(ctx, cacheKey)
+			}
+
+			return nil
+		}
+	}
+}
+
+// replayIdempotentResponse responds to a request that reused an idempotency key.
+func replayIdempotentResponse(c echo.Context, store memcache.Store, cacheKey string, fingerprint string) error {
+	b, err := store.Get(c.Request().Context(), cacheKey)
+	if errors.Is(err, memcache.ErrNotFound) {
+		// the first request failed and released the key in the meantime
+		return keyInUseError()
+	}
+	if err != nil {
+		return err
+	}
+
+	var record idempotencyRecord
+	if err := json.Unmarshal(b, &record); err != nil {
+		return err
+	}
+
+	if record.Fingerprint != fingerprint {
+		return &commonApi.ErrorResponse{
+			Code:      http.StatusUnprocessableEntity,
+			ErrorCode: commonApi.ErrorCodeIdempotencyKeyReused,
+			Message:   "Idempotency-Key has already been used for a different request.",
+		}
+	}
+	if !record.Completed {
+		return keyInUseError()
+	}
+
+	c.Response().Header().Set(commonApi.HeaderIdempotentReplayed, "true")
+	if record.ETag != "" {
+		c.Response().Header().Set(commonApi.HeaderETag, record.ETag)
+	}
+	if record.ContentType == "" {
+		return c.NoContent(record.Status)
+	}
+	return c.Blob(record.Status, record.ContentType, record.Body)
+}
+
+func keyInUseError() error {
+	return &commonApi.ErrorResponse{
+		Code:      http.StatusConflict,
+		ErrorCode: commonApi.ErrorCodeIdempotencyKeyInUse,
+		Message:   "A request with the same Idempotency-Key is being processed. Try again later.",
+	}
+}
+
+// requestFingerprint hashes the method, path and body of the request. The body is restored for the next handlers.
+func requestFingerprint(c echo.Context, maxBodySize int64) (string, error) {
+	body, err := io.ReadAll(http.MaxBytesReader(c.Response(), c.Request().Body, maxBodySize))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			he := echo.NewHTTPError(http.StatusRequestEntityTooLarge, fmt.Sprintf("The request body is too large. The maximum size is %d bytes.", maxBodySize))
+			he.SetInternal(err)
+			return "", he
+		}
+		return "", err
+	}
+	c.Request().Body = io.NopCloser(bytes.NewBuffer(body))
+
+	h := sha256.New()
+	h.Write([]byte(c.Request().Method))
+	h.Write([]byte{0})
+	h.Write([]byte(c.Request().URL.RequestURI()))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// idempotencyCacheKey scopes the key to the user. The key is hashed so that any key fits in the cache.
+func idempotencyCacheKey(userID string, key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return IdempotencyKeyPrefix + userID + "_" + hex.EncodeToString(sum[:])
+}
+
+// idempotencyRecorder keeps a copy of the response body so that it can be stored.
+type idempotencyRecorder struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *idempotencyRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
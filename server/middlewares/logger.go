@@ -6,6 +6,7 @@ import (
 
 	"github.com/labstack/echo/v4"
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const CONTEXT_LOGGER_KEY = "middlewares_logger"
@@ -26,12 +27,16 @@ func LoggerWithConfig(cfg LoggerConfig) echo.MiddlewareFunc {
 			req := c.Request()
 			res := c.Response()
 
-			reqLogger := cfg.Logger.With().
+			logCtx := cfg.Logger.With().
 				Str("path", req.URL.Path).
 				Str("method", req.Method).
 				Str("remote_ip", c.RealIP()).
-				Str("request_id", req.Header.Get(echo.HeaderXRequestID)).
-				Logger()
+				Str("request_id", GetRequestID(c))
+			// link the logs to the trace started by the Tracing middleware
+			if sc := trace.SpanContextFromContext(req.Context()); sc.IsValid() {
+				logCtx = logCtx.Str("trace_id", sc.TraceID().String())
+			}
+			reqLogger := logCtx.Logger()
 
 			c.Set(CONTEXT_LOGGER_KEY, &reqLogger)
 
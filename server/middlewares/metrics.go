@@ -0,0 +1,38 @@
+package middlewares
+
+import (
+	"github.com/juancwu/konbini/server/metrics"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Metrics records the latency of every request by route pattern and status code.
+// Errors are left to the echo error handler, the recorded status of an error that
+// has not been sent yet is the one the error handler responds with.
+func Metrics() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+
+			err := next(c)
+
+			route := c.Path()
+			if route == "" {
+				route = "unmatched"
+			}
+			metrics.ObserveHTTPRequest(c.Request().Method, route, responseStatus(c, err), time.Since(start))
+
+			return err
+		}
+	}
+}
+
+// responseStatus returns the status code sent to the client for a request that
+// returned err, once the error handler has run.
+func responseStatus(c echo.Context, err error) int {
+	if err != nil && !c.Response().Committed {
+		return ErrorStatus(err)
+	}
+	return c.Response().Status
+}
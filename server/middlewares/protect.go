@@ -3,6 +3,8 @@ package middlewares
 import (
 	"database/sql"
 	"errors"
+	commonApi "github.com/juancwu/konbini/common/api"
+	"github.com/juancwu/konbini/server/config"
 	"github.com/juancwu/konbini/server/db"
 	"github.com/juancwu/konbini/server/services"
 	"net/http"
@@ -57,7 +59,7 @@ func ProtectAll(connector *db.DBConnector) echo.MiddlewareFunc {
 // ProtectWithConfig is a middleware that checks for a authToken in the request and validates it.
 // The middleware also refreshes the cache for the authToken in memory if the expiry <= 10 minutes.
 func ProtectWithConfig(cfg ProtectConfig) echo.MiddlewareFunc {
-	return func(next echo.HandlerFunc) echo.HandlerFunc {
+	return traceMiddleware("middlewares.Protect", func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			logger := GetLogger(c)
 			var token string
@@ -98,7 +100,7 @@ func ProtectWithConfig(cfg ProtectConfig) echo.MiddlewareFunc {
 				return err
 			}
 
-			q := db.New(conn)
+			q := db.New(db.Instrument(conn))
 
 			exists, err := q.ExistsAuthTokenById(c.Request().Context(), authToken.ID)
 			if err != nil {
@@ -134,7 +136,7 @@ func ProtectWithConfig(cfg ProtectConfig) echo.MiddlewareFunc {
 
 			return next(c)
 		}
-	}
+	})
 }
 
 func GetJWT(c echo.Context) (*services.AuthToken, error) {
@@ -152,3 +154,30 @@ func GetUser(c echo.Context) (db.User, error) {
 	}
 	return user, nil
 }
+
+// ProtectAdmin is a middleware that only allows users listed in the ADMIN_EMAILS configuration
+// whose email is verified, so an unverified account can't claim an admin address.
+// It must be placed after one of the Protect middlewares since it relies on the user in the context.
+func ProtectAdmin() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			user, err := GetUser(c)
+			if err != nil {
+				return err
+			}
+			cfg, err := config.Global()
+			if err != nil {
+				return err
+			}
+			if !user.EmailVerified || !cfg.IsAdminEmail(user.Email) {
+				GetLogger(c).Warn().Str("user_id", user.ID).Bool("email_verified", user.EmailVerified).Msg("Non-admin user tried to access an admin route. Reject.")
+				return &commonApi.ErrorResponse{
+					Code:      http.StatusForbidden,
+					ErrorCode: commonApi.ErrorCodeForbidden,
+					Message:   http.StatusText(http.StatusForbidden),
+				}
+			}
+			return next(c)
+		}
+	}
+}
@@ -1,10 +1,14 @@
 package middlewares
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	commonApi "github.com/juancwu/konbini/common/api"
 	"github.com/juancwu/konbini/server/memcache"
+	"github.com/juancwu/konbini/server/metrics"
 	"net/http"
-	"sync"
+	"strconv"
 	"time"
 
 	"github.com/labstack/echo/v4"
@@ -27,11 +31,6 @@ const (
 	TOTPAttemptsKeyPrefix = "totp_attempts_"
 )
 
-var (
-	// Mutex to prevent race conditions when updating attempts
-	attemptsLock = &sync.Mutex{}
-)
-
 // LimitTOTPAttempts checks if a user has exceeded the maximum allowed TOTP verification attempts
 func LimitTOTPAttempts(userID string) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
@@ -41,42 +40,9 @@ func LimitTOTPAttempts(userID string) echo.MiddlewareFunc {
 				return next(c)
 			}
 
-			key := TOTPAttemptsKeyPrefix + userID
-			cache := memcache.Cache()
-
-			attemptsLock.Lock()
-			defer attemptsLock.Unlock()
-
-			// Get current attempts from cache
-			attemptsData, found := cache.Get(key)
-
-			var attempts TOTPAttempts
-			if found {
-				attempts = attemptsData.(TOTPAttempts)
-
-				// Check if in cooldown period
-				if attempts.Attempts >= MaxTOTPAttempts {
-					cooldownEnd := attempts.LastAttempt.Add(TOTPCooldownDuration)
-					if time.Now().Before(cooldownEnd) {
-						// Still in cooldown period
-						retryAfter := int(time.Until(cooldownEnd).Seconds())
-						c.Response().Header().Set("Retry-After", fmt.Sprintf("%d", retryAfter))
-
-						return echo.NewHTTPError(
-							http.StatusTooManyRequests,
-							fmt.Sprintf("Too many failed attempts. Try again in %d seconds.", retryAfter),
-						)
-					}
-					// Cooldown period expired, reset attempts
-					attempts.Attempts = 0
-				}
-			} else {
-				// Initialize new attempts tracker
-				attempts = TOTPAttempts{
-					UserID:      userID,
-					Attempts:    0,
-					LastAttempt: time.Now(),
-				}
+			// Check if in cooldown period, the counter expires when the cooldown ends
+			if err := CheckTOTPAttempts(c, userID); err != nil {
+				return err
 			}
 
 			// Store original handler response writer
@@ -87,41 +53,26 @@ func LimitTOTPAttempts(userID string) echo.MiddlewareFunc {
 			// Call next handler
 			err := next(c)
 
-			// Check if TOTP verification failed based on status code
-			if capturedWriter.statusCode >= 400 && capturedWriter.statusCode < 500 {
-				// Increment failed attempts
-				attempts.Attempts++
-				attempts.LastAttempt = time.Now()
-
-				// Calculate appropriate expiration time
-				var expiration time.Duration
-				if attempts.Attempts >= MaxTOTPAttempts {
-					expiration = TOTPCooldownDuration
-					log.Warn().
-						Str("user_id", userID).
-						Int("attempts", attempts.Attempts).
-						Str("ip", c.RealIP()).
-						Str("user_agent", c.Request().UserAgent()).
-						Msg("SECURITY: User exceeded maximum TOTP attempts")
-				} else {
-					// Regular expiration
-					expiration = TOTPCooldownDuration
+			// Check if TOTP verification failed based on status code, handlers usually
+			// return an error that has not been written yet
+			status := capturedWriter.statusCode
+			if err != nil && !c.Response().Committed {
+				status = ErrorStatus(err)
+			}
+			if status >= 400 && status < 500 {
+				if c.Response().Committed {
+					// the response can't be changed anymore, the attempt is recorded all the same
+					if _, err := RecordFailedTOTPAttempt(c.Request().Context(), userID); err != nil {
+						log.Error().Err(err).Str("user_id", userID).Msg("Failed to record failed TOTP attempt")
+					}
+					return err
 				}
-
-				// Store updated attempts in cache
-				cache.Set(key, attempts, expiration)
-
-				// Add X-RateLimit headers to response
-				remainingAttempts := MaxTOTPAttempts - attempts.Attempts
-				if remainingAttempts < 0 {
-					remainingAttempts = 0
+				if failErr := FailTOTPAttempt(c, userID); failErr != nil {
+					return failErr
 				}
-				c.Response().Header().Set("X-RateLimit-Limit", fmt.Sprintf("%d", MaxTOTPAttempts))
-				c.Response().Header().Set("X-RateLimit-Remaining", fmt.Sprintf("%d", remainingAttempts))
-				c.Response().Header().Set("X-RateLimit-Reset", fmt.Sprintf("%d", attempts.LastAttempt.Add(TOTPCooldownDuration).Unix()))
-			} else if err == nil && capturedWriter.statusCode < 300 {
+			} else if err == nil && status < 300 {
 				// Successful verification - reset the counter
-				cache.Delete(key)
+				ResetTOTPAttempts(c.Request().Context(), userID)
 			}
 
 			return err
@@ -129,46 +80,124 @@ func LimitTOTPAttempts(userID string) echo.MiddlewareFunc {
 	}
 }
 
-// ResetTOTPAttempts resets the TOTP attempt counter for a user
-func ResetTOTPAttempts(userID string) {
-	key := TOTPAttemptsKeyPrefix + userID
-	memcache.Cache().Delete(key)
+// CheckTOTPAttempts returns a 429 error when the user is in the TOTP cooldown. The lockout can't
+// be skipped, a 503 error is returned when the failed attempts can't be read from the cache.
+func CheckTOTPAttempts(c echo.Context, userID string) error {
+	attempts, found, err := GetTOTPAttempts(c.Request().Context(), userID)
+	if err != nil {
+		log.Error().Err(err).Str("user_id", userID).Msg("Failed to get TOTP attempts from cache")
+		return totpAttemptsUnavailableError()
+	}
+	if found && attempts.Attempts >= MaxTOTPAttempts {
+		metrics.TOTPBlockedRequest()
+		return totpCooldownError(c, attempts)
+	}
+	return nil
 }
 
-// RecordFailedTOTPAttempt increments the failed TOTP attempt counter for a user
-func RecordFailedTOTPAttempt(userID string) {
+// FailTOTPAttempt records a failed TOTP attempt of the user and sets the X-RateLimit headers.
+// It returns a 429 error once the user has reached the maximum attempts, and a 503 error when
+// the attempt can't be recorded.
+func FailTOTPAttempt(c echo.Context, userID string) error {
+	n, err := RecordFailedTOTPAttempt(c.Request().Context(), userID)
+	if err != nil {
+		log.Error().Err(err).Str("user_id", userID).Msg("Failed to record failed TOTP attempt")
+		return totpAttemptsUnavailableError()
+	}
+
+	if n >= MaxTOTPAttempts {
+		return totpCooldownError(c, &TOTPAttempts{UserID: userID, Attempts: n, LastAttempt: time.Now()})
+	}
+
+	// Add X-RateLimit headers to response
+	c.Response().Header().Set("X-RateLimit-Limit", fmt.Sprintf("%d", MaxTOTPAttempts))
+	c.Response().Header().Set("X-RateLimit-Remaining", fmt.Sprintf("%d", MaxTOTPAttempts-n))
+	c.Response().Header().Set("X-RateLimit-Reset", fmt.Sprintf("%d", time.Now().Add(TOTPCooldownDuration).Unix()))
+	return nil
+}
+
+func totpCooldownError(c echo.Context, attempts *TOTPAttempts) error {
+	cooldownEnd := attempts.LastAttempt.Add(TOTPCooldownDuration)
+	retryAfter := int(time.Until(cooldownEnd).Seconds())
+	c.Response().Header().Set("Retry-After", fmt.Sprintf("%d", retryAfter))
+	return &commonApi.ErrorResponse{
+		Code:      http.StatusTooManyRequests,
+		ErrorCode: commonApi.ErrorCodeRateLimited,
+		Message:   fmt.Sprintf("Too many failed attempts. Try again in %d seconds.", retryAfter),
+	}
+}
+
+func totpAttemptsUnavailableError() error {
+	return &commonApi.ErrorResponse{
+		Code:      http.StatusServiceUnavailable,
+		ErrorCode: commonApi.ErrorCodeUnavailable,
+		Message:   "Two-factor verification is temporarily unavailable. Please try again later.",
+	}
+}
+
+// GetTOTPAttempts gets the failed TOTP attempts of a user. It returns false if the
+// user has no failed attempts within the cooldown duration, and an error if the
+// attempts can't be read, callers must not treat it as no attempts.
+func GetTOTPAttempts(ctx context.Context, userID string) (*TOTPAttempts, bool, error) {
 	key := TOTPAttemptsKeyPrefix + userID
 	cache := memcache.Cache()
 
-	attemptsLock.Lock()
-	defer attemptsLock.Unlock()
+	b, err := cache.Get(ctx, key)
+	if err != nil {
+		if errors.Is(err, memcache.ErrNotFound) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	n, err := strconv.Atoi(string(b))
+	if err != nil {
+		return nil, false, fmt.Errorf("Invalid TOTP attempts counter in cache: %w", err)
+	}
+	ttl, err := cache.TTL(ctx, key)
+	if err != nil {
+		if errors.Is(err, memcache.ErrNotFound) {
+			// the counter expired in between
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
 
-	var attempts TOTPAttempts
-	attemptsData, found := cache.Get(key)
+	// the counter expiration is refreshed on every failed attempt
+	return &TOTPAttempts{
+		UserID:      userID,
+		Attempts:    n,
+		LastAttempt: time.Now().Add(ttl - TOTPCooldownDuration),
+	}, true, nil
+}
 
-	if found {
-		attempts = attemptsData.(TOTPAttempts)
-	} else {
-		attempts = TOTPAttempts{
-			UserID:      userID,
-			Attempts:    0,
-			LastAttempt: time.Now(),
-		}
+// ResetTOTPAttempts resets the TOTP attempt counter for a user
+func ResetTOTPAttempts(ctx context.Context, userID string) {
+	key := TOTPAttemptsKeyPrefix + userID
+	if err := memcache.Cache().Delete(ctx, key); err != nil {
+		log.Error().Err(err).Str("user_id", userID).Msg("Failed to reset TOTP attempts")
 	}
+}
 
-	attempts.Attempts++
-	attempts.LastAttempt = time.Now()
+// RecordFailedTOTPAttempt increments the failed TOTP attempt counter for a user
+// and returns the number of failed attempts within the cooldown duration.
+func RecordFailedTOTPAttempt(ctx context.Context, userID string) (int, error) {
+	key := TOTPAttemptsKeyPrefix + userID
 
-	// Set appropriate expiration
-	expiration := TOTPCooldownDuration
-	cache.Set(key, attempts, expiration)
+	n, err := memcache.Cache().Incr(ctx, key, 1, TOTPCooldownDuration)
+	if err != nil {
+		return 0, err
+	}
 
-	if attempts.Attempts >= MaxTOTPAttempts {
+	if n == MaxTOTPAttempts {
+		metrics.TOTPLockout()
+	}
+	if n >= MaxTOTPAttempts {
 		log.Warn().
 			Str("user_id", userID).
-			Int("attempts", attempts.Attempts).
+			Int64("attempts", n).
 			Msg("SECURITY: User exceeded maximum TOTP attempts")
 	}
+	return int(n), nil
 }
 
 // captureResponseWriter wraps http.ResponseWriter to capture status code
@@ -181,4 +210,3 @@ func (crw *captureResponseWriter) WriteHeader(code int) {
 	crw.statusCode = code
 	crw.ResponseWriter.WriteHeader(code)
 }
-
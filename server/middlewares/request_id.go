@@ -0,0 +1,55 @@
+package middlewares
+
+import (
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+const CONTEXT_REQUEST_ID_KEY = "middlewares_request_id"
+
+// maxRequestIdLength limits the size of request ids provided by clients.
+const maxRequestIdLength = 128
+
+// RequestID accepts the request id sent in the X-Request-ID header or generates a new one.
+// The id is echoed in the response header and stored in the request header and echo context
+// so that loggers and the error handler can include it.
+func RequestID() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			id := req.Header.Get(echo.HeaderXRequestID)
+			if !validRequestId(id) {
+				id = uuid.NewString()
+			}
+			req.Header.Set(echo.HeaderXRequestID, id)
+			c.Response().Header().Set(echo.HeaderXRequestID, id)
+			c.Set(CONTEXT_REQUEST_ID_KEY, id)
+			return next(c)
+		}
+	}
+}
+
+// GetRequestID gets the request id set by the RequestID middleware. It falls back to
+// the X-Request-ID request header when the middleware did not run.
+func GetRequestID(c echo.Context) string {
+	if id, ok := c.Get(CONTEXT_REQUEST_ID_KEY).(string); ok {
+		return id
+	}
+	return c.Request().Header.Get(echo.HeaderXRequestID)
+}
+
+// validRequestId only accepts short ids made of characters that are safe to log and echo back.
+func validRequestId(id string) bool {
+	if id == "" || len(id) > maxRequestIdLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.', r == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
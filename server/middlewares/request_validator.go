@@ -20,6 +20,26 @@ var (
 	ErrFailedToGetJsonBody error = errors.New("Failed to get json body from context")
 )
 
+// RequestBodyError is returned by ValidateJson when the body can't be decoded into the request
+// struct or fails validation. The error handler only translates the errors it wraps into field
+// errors, the same errors returned by a handler are not about the request body.
+type RequestBodyError struct {
+	Err error
+}
+
+func (e *RequestBodyError) Error() string {
+	return "Invalid request body: " + e.Err.Error()
+}
+
+func (e *RequestBodyError) Unwrap() error {
+	return e.Err
+}
+
+// StatusCode returns the status code of the response sent for the error.
+func (e *RequestBodyError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
 type ValidateJsonConfig struct {
 	MaxBodySize int64
 }
@@ -31,7 +51,7 @@ func ValidateJson(structType reflect.Type) echo.MiddlewareFunc {
 }
 
 func ValidateJsonWithConfig(structType reflect.Type, cfg ValidateJsonConfig) echo.MiddlewareFunc {
-	return func(next echo.HandlerFunc) echo.HandlerFunc {
+	return traceMiddleware("middlewares.ValidateJson", func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			contentType := c.Request().Header.Get(echo.HeaderContentType)
 			if contentType != echo.MIMEApplicationJSON {
@@ -68,14 +88,14 @@ func ValidateJsonWithConfig(structType reflect.Type, cfg ValidateJsonConfig) ech
 			// read in the request body and make sure it is within size limit
 			err = json.Unmarshal(body, i)
 			if err != nil {
-				return err
+				return &RequestBodyError{Err: err}
 			}
 
 			if err := c.Validate(i); err != nil {
 				// this will let the global error handler handle
 				// the ValidationError and get error string for
 				// the each invalid field.
-				return err
+				return &RequestBodyError{Err: err}
 			}
 
 			// allow the remaining handlers in the chain gain access to
@@ -84,7 +104,7 @@ func ValidateJsonWithConfig(structType reflect.Type, cfg ValidateJsonConfig) ech
 
 			return next(c)
 		}
-	}
+	})
 }
 
 func GetJsonBody[T interface{}](c echo.Context) (*T, error) {
@@ -0,0 +1,31 @@
+package middlewares
+
+import (
+	"errors"
+	commonApi "github.com/juancwu/konbini/common/api"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// statusCoder is implemented by errors that know the status code of their response,
+// like the APIError of the handlers.
+type statusCoder interface {
+	StatusCode() int
+}
+
+// ErrorStatus returns the status code the error handler responds with for err.
+func ErrorStatus(err error) int {
+	var sc statusCoder
+	var errRes *commonApi.ErrorResponse
+	var he *echo.HTTPError
+	switch {
+	case errors.As(err, &sc):
+		return sc.StatusCode()
+	case errors.As(err, &errRes):
+		return errRes.Code
+	case errors.As(err, &he):
+		return he.Code
+	}
+	return http.StatusInternalServerError
+}
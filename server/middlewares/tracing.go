@@ -0,0 +1,101 @@
+package middlewares
+
+import (
+	"github.com/juancwu/konbini/server/tracing"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracing starts a server span for every request. The trace context sent by the client
+// in the traceparent header is continued. It should come right after RequestID.
+func Tracing() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			route := c.Path()
+			if route == "" {
+				route = "unmatched"
+			}
+
+			ctx := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+			ctx, span := tracing.Start(ctx, req.Method+" "+route,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					semconv.HTTPRequestMethodKey.String(req.Method),
+					semconv.HTTPRoute(route),
+					semconv.URLPath(req.URL.Path),
+					attribute.String("http.request_id", GetRequestID(c)),
+				),
+			)
+			defer span.End()
+			c.SetRequest(req.WithContext(ctx))
+
+			err := next(c)
+			tracing.RecordError(span, err)
+
+			status := responseStatus(c, err)
+			span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+			if status >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(status))
+			}
+
+			return err
+		}
+	}
+}
+
+// traceMiddleware wraps a middleware in a span that covers the work done by the
+// middleware itself and ends once the middleware calls the next handler.
+func traceMiddleware(name string, mw echo.MiddlewareFunc) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			parent := c.Request().Context()
+			ctx, span := tracing.Start(parent, name)
+			c.SetRequest(c.Request().WithContext(ctx))
+
+			ended := false
+			err := mw(func(c echo.Context) error {
+				ended = true
+				span.End()
+				c.SetRequest(c.Request().WithContext(parent))
+				return next(c)
+			})(c)
+
+			if !ended {
+				// the middleware rejected the request
+				tracing.RecordError(span, err)
+				span.End()
+				c.SetRequest(c.Request().WithContext(parent))
+			}
+			return err
+		}
+	}
+}
+
+// TracedJSONSerializer records a span for every JSON body encoded or decoded by echo.
+type TracedJSONSerializer struct {
+	echo.DefaultJSONSerializer
+}
+
+func (s TracedJSONSerializer) Serialize(c echo.Context, i interface{}, indent string) error {
+	_, span := tracing.Start(c.Request().Context(), "json.encode")
+	defer span.End()
+	err := s.DefaultJSONSerializer.Serialize(c, i, indent)
+	tracing.RecordError(span, err)
+	return err
+}
+
+func (s TracedJSONSerializer) Deserialize(c echo.Context, i interface{}) error {
+	_, span := tracing.Start(c.Request().Context(), "json.decode")
+	defer span.End()
+	err := s.DefaultJSONSerializer.Deserialize(c, i)
+	tracing.RecordError(span, err)
+	return err
+}
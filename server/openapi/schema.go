@@ -0,0 +1,288 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	// PRINTASCII_PATTERN matches the strings accepted by the printascii validation rule.
+	PRINTASCII_PATTERN string = `^[\x20-\x7E]*$`
+)
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// schemaRegistry builds schemas from Go types. Named structs are added to the
+// components and referenced so every type is only described once.
+type schemaRegistry struct {
+	schemas map[string]*Schema
+	names   map[reflect.Type]string
+}
+
+func newSchemaRegistry() *schemaRegistry {
+	return &schemaRegistry{
+		schemas: map[string]*Schema{},
+		names:   map[reflect.Type]string{},
+	}
+}
+
+// SchemaOf builds the schema of t. Named structs are returned as references
+// and their definition is added to the registry.
+func (r *schemaRegistry) SchemaOf(t reflect.Type) *Schema {
+	nullable := false
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+		nullable = true
+	}
+
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time", Nullable: nullable}
+	case t == rawMessageType:
+		return &Schema{Nullable: nullable}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string", Nullable: nullable}
+	case reflect.Bool:
+		return &Schema{Type: "boolean", Nullable: nullable}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32", Nullable: nullable}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64", Nullable: nullable}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number", Nullable: nullable}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte", Nullable: nullable}
+		}
+		return &Schema{Type: "array", Items: r.SchemaOf(t.Elem()), Nullable: nullable}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: r.SchemaOf(t.Elem()), Nullable: nullable}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return r.structSchema(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + r.register(t)}
+	}
+
+	// interfaces can hold any value
+	return &Schema{}
+}
+
+// register adds the definition of a named struct and returns its component name.
+func (r *schemaRegistry) register(t reflect.Type) string {
+	if name, ok := r.names[t]; ok {
+		return name
+	}
+
+	name := exportedName(t.Name())
+	if _, taken := r.schemas[name]; taken {
+		// same type name in another package, i.e. handlers.X and api.X
+		pkg := t.PkgPath()[strings.LastIndex(t.PkgPath(), "/")+1:]
+		name = exportedName(pkg) + name
+	}
+
+	// register before building the fields so recursive types end up as references
+	r.names[t] = name
+	r.schemas[name] = &Schema{}
+	*r.schemas[name] = *r.structSchema(t)
+	return name
+}
+
+// structSchema describes the json fields of a struct. Fields are named after their json
+// tag and the validate tag is translated into the matching schema keywords.
+func (r *schemaRegistry) structSchema(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, omit := jsonFieldName(field)
+		if omit {
+			continue
+		}
+
+		// embedded structs without a json name are flattened by encoding/json
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				inner := r.structSchema(embedded)
+				for k, v := range inner.Properties {
+					schema.Properties[k] = v
+				}
+				schema.Required = append(schema.Required, inner.Required...)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		fieldSchema := r.SchemaOf(field.Type)
+		required := applyRules(fieldSchema, field.Tag.Get("validate"))
+		schema.Properties[name] = fieldSchema
+		if required {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+	return schema
+}
+
+// jsonFieldName gets the name encoding/json uses for the field. omit is true when the field is never encoded.
+func jsonFieldName(field reflect.StructField) (name string, omit bool) {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", true
+	}
+	name, _, _ = strings.Cut(tag, ",")
+	if !field.Anonymous && !field.IsExported() {
+		return "", true
+	}
+	return name, false
+}
+
+// applyRules translates a validate tag into schema keywords and reports whether the field is required.
+// Rules after "dive" apply to the items of the field.
+func applyRules(schema *Schema, tag string) bool {
+	if tag == "" || tag == "-" {
+		return false
+	}
+
+	required := false
+	optional := false
+	target := schema
+	for _, rule := range strings.Split(tag, ",") {
+		if rule == "dive" {
+			switch {
+			case target.Items != nil:
+				target = target.Items
+			case target.AdditionalProperties != nil:
+				target = target.AdditionalProperties
+			default:
+				return required && !optional
+			}
+			continue
+		}
+		if target != schema {
+			applyRule(target, rule)
+			continue
+		}
+
+		switch rule {
+		case "required":
+			required = true
+		case "omitempty", "omitnil":
+			optional = true
+		default:
+			applyRule(target, rule)
+		}
+	}
+	return required && !optional
+}
+
+// applyRule adds the keywords of a single validation rule to the schema.
+// References cannot have sibling keywords so they are left untouched.
+func applyRule(schema *Schema, rule string) {
+	if schema.Ref != "" {
+		return
+	}
+
+	if strings.Contains(rule, "|") {
+		alternatives := strings.Split(rule, "|")
+		appendDescription(schema, "Must satisfy one of: "+strings.Join(alternatives, ", ")+".")
+		return
+	}
+
+	name, param, _ := strings.Cut(rule, "=")
+	switch name {
+	case "email":
+		schema.Format = "email"
+	case "uuid", "uuid4":
+		schema.Format = "uuid"
+	case "url", "uri", "http_url":
+		schema.Format = "uri"
+	case "printascii":
+		schema.Pattern = PRINTASCII_PATTERN
+	case "oneof":
+		schema.Enum = strings.Fields(param)
+	case "min", "gte":
+		setLimit(schema, param, true, false)
+	case "gt":
+		setLimit(schema, param, true, true)
+	case "max", "lte":
+		setLimit(schema, param, false, false)
+	case "lt":
+		setLimit(schema, param, false, true)
+	case "len":
+		setLimit(schema, param, true, false)
+		setLimit(schema, param, false, false)
+	}
+}
+
+// setLimit sets the length, item count or value limit that matches the schema type.
+func setLimit(schema *Schema, param string, lower bool, exclusive bool) {
+	value, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		return
+	}
+
+	switch schema.Type {
+	case "string", "array":
+		n := int(value)
+		if exclusive && lower {
+			n++
+		} else if exclusive {
+			n--
+		}
+		switch {
+		case schema.Type == "string" && lower:
+			schema.MinLength = &n
+		case schema.Type == "string":
+			schema.MaxLength = &n
+		case lower:
+			schema.MinItems = &n
+		default:
+			schema.MaxItems = &n
+		}
+	case "integer", "number":
+		if lower {
+			schema.Minimum = &value
+			schema.ExclusiveMinimum = exclusive
+		} else {
+			schema.Maximum = &value
+			schema.ExclusiveMaximum = exclusive
+		}
+	}
+}
+
+func appendDescription(schema *Schema, description string) {
+	if schema.Description == "" {
+		schema.Description = description
+		return
+	}
+	schema.Description = fmt.Sprintf("%s %s", schema.Description, description)
+}
+
+func exportedName(name string) string {
+	if name == "" {
+		return name
+	}
+	runes := []rune(name)
+	runes[0] = unicode.ToUpper(runes[0])
+	return string(runes)
+}
@@ -0,0 +1,305 @@
+package openapi
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Authentication requirements of a route. They match the Protect middlewares.
+const (
+	AUTH_NONE Auth = iota
+	// AUTH_ANY_TOKEN accepts partial and full tokens, see middlewares.ProtectAll
+	AUTH_ANY_TOKEN
+	// AUTH_FULL_TOKEN only accepts full tokens, see middlewares.ProtectFull
+	AUTH_FULL_TOKEN
+)
+
+const (
+	FULL_TOKEN_SCHEME    string = "fullToken"
+	PARTIAL_TOKEN_SCHEME string = "partialToken"
+	// IDEMPOTENCY_KEY_HEADER is the header documented on idempotent routes.
+	IDEMPOTENCY_KEY_HEADER string = "Idempotency-Key"
+	// IF_MATCH_HEADER is the header documented on conditional routes.
+	IF_MATCH_HEADER string = "If-Match"
+	// ETAG_HEADER is the header documented on responses of routes with an ETag.
+	ETAG_HEADER string = "ETag"
+	// EVENT_STREAM_MIME is the content type of routes that stream server-sent events.
+	EVENT_STREAM_MIME string = "text/event-stream"
+)
+
+type Auth int
+
+// Route describes a route that is registered in Echo.
+type Route struct {
+	Summary     string
+	Description string
+	Tags        []string
+	Auth        Auth
+	// Query lists the query parameters. Path parameters are read from the route path.
+	Query []Parameter
+	// Request is the type of the json body, the same type given to middlewares.ValidateJson.
+	Request reflect.Type
+	// Status is the status of a successful response, defaults to 200.
+	Status int
+	// Response is the type of the json body of a successful response. Leave it nil when there is no body.
+	Response reflect.Type
+	// EventStream is the type of the data of the server-sent events streamed by the route.
+	// The successful response is documented as text/event-stream when it is set.
+	EventStream reflect.Type
+	// Errors lists the error statuses the route responds with besides the ones every route can respond with.
+	Errors []int
+	// Idempotent is true when the route honors the Idempotency-Key header, see middlewares.Idempotency.
+	Idempotent bool
+	// Conditional is true when the route honors the If-Match header.
+	Conditional bool
+	// ETag is true when a successful response has the ETag header.
+	ETag bool
+}
+
+// Spec holds the description of every route under a path prefix and builds
+// the OpenAPI document from the routes that are registered in Echo.
+type Spec struct {
+	info      Info
+	prefix    string
+	errorType reflect.Type
+	routes    map[string]Route
+}
+
+// NewSpec creates a new spec for the routes under prefix. errorType is the body of every error response.
+func NewSpec(info Info, prefix string, errorType reflect.Type) *Spec {
+	return &Spec{
+		info:      info,
+		prefix:    prefix,
+		errorType: errorType,
+		routes:    map[string]Route{},
+	}
+}
+
+// Add describes the route with the given method and path. The path is relative to the spec prefix
+// and uses the Echo syntax for path parameters, i.e. "/group/:id".
+func (s *Spec) Add(method string, path string, route Route) {
+	s.routes[routeKey(method, s.prefix+path)] = route
+}
+
+// Build creates the document for the registered routes that are described in the spec.
+func (s *Spec) Build(registered []*echo.Route) *Document {
+	registry := newSchemaRegistry()
+	errorSchema := registry.SchemaOf(s.errorType)
+
+	doc := &Document{
+		OpenAPI: OPENAPI_VERSION,
+		Info:    s.info,
+		Servers: []Server{{URL: s.prefix}},
+		Paths:   map[string]PathItem{},
+		Components: Components{
+			SecuritySchemes: map[string]SecurityScheme{
+				FULL_TOKEN_SCHEME: {
+					Type:         "http",
+					Scheme:       "bearer",
+					BearerFormat: "Konbini token",
+					Description:  "Token of a user that has completed every step of the login.",
+				},
+				PARTIAL_TOKEN_SCHEME: {
+					Type:         "http",
+					Scheme:       "bearer",
+					BearerFormat: "Konbini token",
+					Description:  "Token of a user that still has to complete a step of the login, i.e. lock the TOTP setup.",
+				},
+			},
+		},
+	}
+
+	for _, r := range s.filter(registered) {
+		route, ok := s.routes[routeKey(r.Method, r.Path)]
+		if !ok {
+			continue
+		}
+
+		path, pathParams := convertPath(strings.TrimPrefix(r.Path, s.prefix))
+		item, ok := doc.Paths[path]
+		if !ok {
+			item = PathItem{}
+			doc.Paths[path] = item
+		}
+		item[strings.ToLower(r.Method)] = s.operation(registry, errorSchema, r.Method, path, pathParams, route)
+	}
+
+	doc.Components.Schemas = registry.schemas
+	return doc
+}
+
+// Undocumented lists the registered routes under the prefix that are not described in the spec.
+func (s *Spec) Undocumented(registered []*echo.Route) []string {
+	missing := []string{}
+	for _, r := range s.filter(registered) {
+		key := routeKey(r.Method, r.Path)
+		if _, ok := s.routes[key]; !ok {
+			missing = append(missing, key)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// Stale lists the routes described in the spec that are not registered.
+func (s *Spec) Stale(registered []*echo.Route) []string {
+	found := map[string]bool{}
+	for _, r := range s.filter(registered) {
+		found[routeKey(r.Method, r.Path)] = true
+	}
+
+	stale := []string{}
+	for key := range s.routes {
+		if !found[key] {
+			stale = append(stale, key)
+		}
+	}
+	sort.Strings(stale)
+	return stale
+}
+
+// filter keeps the routes under the prefix. Echo also lists the not found handlers of groups, they are skipped.
+func (s *Spec) filter(registered []*echo.Route) []*echo.Route {
+	routes := []*echo.Route{}
+	seen := map[string]bool{}
+	for _, r := range registered {
+		if r.Method == echo.RouteNotFound || !strings.HasPrefix(r.Path, s.prefix) {
+			continue
+		}
+		key := routeKey(r.Method, r.Path)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		routes = append(routes, r)
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		return routeKey(routes[i].Method, routes[i].Path) < routeKey(routes[j].Method, routes[j].Path)
+	})
+	return routes
+}
+
+func (s *Spec) operation(registry *schemaRegistry, errorSchema *Schema, method string, path string, pathParams []string, route Route) *Operation {
+	op := &Operation{
+		OperationID: operationID(method, path),
+		Summary:     route.Summary,
+		Description: route.Description,
+		Tags:        route.Tags,
+		Responses:   map[string]Response{},
+	}
+
+	errorStatuses := append([]int{http.StatusInternalServerError}, route.Errors...)
+	for _, name := range pathParams {
+		op.Parameters = append(op.Parameters, Parameter{
+			Name:     name,
+			In:       "path",
+			Required: true,
+			Schema:   &Schema{Type: "string"},
+		})
+	}
+	if route.Idempotent {
+		op.Parameters = append(op.Parameters, Parameter{
+			Name:        IDEMPOTENCY_KEY_HEADER,
+			In:          "header",
+			Description: "Retrying the request with the same key replays the first successful response instead of applying it again.",
+			Schema:      &Schema{Type: "string"},
+		})
+		errorStatuses = append(errorStatuses, http.StatusConflict, http.StatusUnprocessableEntity)
+	}
+	if route.Conditional {
+		op.Parameters = append(op.Parameters, Parameter{
+			Name:        IF_MATCH_HEADER,
+			In:          "header",
+			Description: "ETag of the resource. The request fails with 412 when the resource has changed since.",
+			Schema:      &Schema{Type: "string"},
+		})
+		errorStatuses = append(errorStatuses, http.StatusPreconditionFailed)
+	}
+	for _, param := range route.Query {
+		param.In = "query"
+		if param.Schema == nil {
+			param.Schema = &Schema{Type: "string"}
+		}
+		op.Parameters = append(op.Parameters, param)
+	}
+
+	if route.Request != nil {
+		op.RequestBody = &RequestBody{
+			Required: true,
+			Content:  map[string]MediaType{echo.MIMEApplicationJSON: {Schema: registry.SchemaOf(route.Request)}},
+		}
+		errorStatuses = append(errorStatuses, http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType)
+	}
+
+	switch route.Auth {
+	case AUTH_ANY_TOKEN:
+		op.Security = []map[string][]string{{FULL_TOKEN_SCHEME: {}}, {PARTIAL_TOKEN_SCHEME: {}}}
+		errorStatuses = append(errorStatuses, http.StatusUnauthorized)
+	case AUTH_FULL_TOKEN:
+		op.Security = []map[string][]string{{FULL_TOKEN_SCHEME: {}}}
+		errorStatuses = append(errorStatuses, http.StatusUnauthorized)
+	}
+
+	status := route.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	success := Response{Description: http.StatusText(status)}
+	if route.ETag {
+		success.Headers = map[string]Header{
+			ETAG_HEADER: {Description: "Current version of the resource.", Schema: &Schema{Type: "string"}},
+		}
+	}
+	if route.Response != nil {
+		success.Content = map[string]MediaType{echo.MIMEApplicationJSON: {Schema: registry.SchemaOf(route.Response)}}
+	}
+	if route.EventStream != nil {
+		success.Content = map[string]MediaType{EVENT_STREAM_MIME: {Schema: registry.SchemaOf(route.EventStream)}}
+	}
+	op.Responses[strconv.Itoa(status)] = success
+
+	for _, errStatus := range errorStatuses {
+		op.Responses[strconv.Itoa(errStatus)] = Response{
+			Description: http.StatusText(errStatus),
+			Content:     map[string]MediaType{echo.MIMEApplicationJSON: {Schema: errorSchema}},
+		}
+	}
+
+	return op
+}
+
+func routeKey(method string, path string) string {
+	return fmt.Sprintf("%s %s", method, path)
+}
+
+// convertPath converts Echo path parameters into OpenAPI ones, "/group/:id" becomes "/group/{id}".
+func convertPath(path string) (string, []string) {
+	params := []string{}
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			params = append(params, segment[1:])
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/"), params
+}
+
+// operationID builds an id from the method and the path, "DELETE /group/{id}" becomes "deleteGroupId".
+func operationID(method string, path string) string {
+	words := strings.FieldsFunc(path, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	})
+	var b strings.Builder
+	b.WriteString(strings.ToLower(method))
+	for _, word := range words {
+		b.WriteString(exportedName(word))
+	}
+	return b.String()
+}
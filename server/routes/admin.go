@@ -0,0 +1,32 @@
+package routes
+
+import (
+	commonApi "github.com/juancwu/konbini/common/api"
+	"github.com/juancwu/konbini/server/handlers"
+	"github.com/juancwu/konbini/server/middlewares"
+)
+
+// setupAdminRoutes sets the routes that are only available to server administrators.
+func setupAdminRoutes(routeConfig *RouteConfig) {
+	e := routeConfig.Echo
+
+	e.GET(
+		commonApi.UriEmailJobs,
+		handlers.ListEmailJobs(routeConfig.EmailQueue),
+		middlewares.ProtectFull(routeConfig.DBConnector),
+		middlewares.ProtectAdmin(),
+	)
+	e.POST(
+		commonApi.UriRedriveEmailJob,
+		handlers.RedriveEmailJob(routeConfig.EmailQueue),
+		middlewares.ProtectFull(routeConfig.DBConnector),
+		middlewares.ProtectAdmin(),
+		middlewares.Idempotency(),
+	)
+	e.GET(
+		commonApi.UriAdminBentoReveals,
+		handlers.ListAdminBentoReveals(routeConfig.DBConnector),
+		middlewares.ProtectFull(routeConfig.DBConnector),
+		middlewares.ProtectAdmin(),
+	)
+}
@@ -17,7 +17,7 @@ func setupAuthRoutes(routeConfig *RouteConfig) {
 	routeConfig.Echo.POST(
 		commonApi.UriRegister,
 		handlers.Register(routeConfig.DBConnector),
-		middlewares.ValidateJson(reflect.TypeOf(handlers.RegisterRequest{})),
+		middlewares.ValidateJson(reflect.TypeOf(commonApi.RegisterRequest{})),
 	)
 
 	routeConfig.Echo.POST(
@@ -26,6 +26,12 @@ func setupAuthRoutes(routeConfig *RouteConfig) {
 		middlewares.ValidateJson(reflect.TypeOf(commonApi.CheckAuthTokenRequest{})),
 	)
 
+	routeConfig.Echo.POST(
+		commonApi.UriLogout,
+		handlers.Logout(routeConfig.DBConnector),
+		middlewares.ProtectAll(routeConfig.DBConnector),
+	)
+
 	routeConfig.Echo.POST(
 		commonApi.UriTOTPSetup,
 		handlers.SetupTOTP(routeConfig.DBConnector),
@@ -52,7 +58,7 @@ func setupAuthRoutes(routeConfig *RouteConfig) {
 	totpDeleteRoute := routeConfig.Echo.Group(commonApi.UriTOTPDelete)
 	totpDeleteRoute.Use(
 		middlewares.ProtectFull(routeConfig.DBConnector),
-		middlewares.ValidateJson(reflect.TypeOf(handlers.RemoveTOTPRequest{})),
+		middlewares.ValidateJson(reflect.TypeOf(commonApi.RemoveTOTPRequest{})),
 		func(next echo.HandlerFunc) echo.HandlerFunc {
 			return func(c echo.Context) error {
 				user, err := middlewares.GetUser(c)
@@ -71,5 +77,6 @@ func setupAuthRoutes(routeConfig *RouteConfig) {
 		commonApi.UriResendVerificationEmail,
 		handlers.ResendVerificationEmail(routeConfig.DBConnector),
 		middlewares.ProtectAll(routeConfig.DBConnector),
+		middlewares.Idempotency(),
 	)
 }
@@ -1,8 +1,10 @@
 package routes
 
 import (
+	commonApi "github.com/juancwu/konbini/common/api"
 	"github.com/juancwu/konbini/server/handlers"
 	"github.com/juancwu/konbini/server/middlewares"
+	"github.com/juancwu/konbini/server/services"
 	"reflect"
 )
 
@@ -10,31 +12,61 @@ func setupBentoRoutes(routeConfig *RouteConfig) {
 	e := routeConfig.Echo
 
 	e.GET(
-		"/bento",
+		commonApi.UriBento,
 		handlers.GetBento(routeConfig.DBConnector),
 		middlewares.ProtectFull(routeConfig.DBConnector),
 	)
 	e.GET(
-		"/bentos",
+		commonApi.UriBentos,
 		handlers.ListBentos(routeConfig.DBConnector),
 		middlewares.ProtectFull(routeConfig.DBConnector),
 	)
+	e.GET(
+		commonApi.UriBentoChanges,
+		handlers.GetBentoChanges(routeConfig.DBConnector),
+		middlewares.ProtectFull(routeConfig.DBConnector),
+	)
+	e.GET(
+		commonApi.UriBentoEvents,
+		handlers.WatchBento(routeConfig.DBConnector, services.DefaultBentoNotifier(), handlers.BENTO_WATCH_POLL_INTERVAL),
+		middlewares.ProtectFull(routeConfig.DBConnector),
+	)
+	e.GET(
+		commonApi.UriBentoReveals,
+		handlers.ListBentoReveals(routeConfig.DBConnector),
+		middlewares.ProtectFull(routeConfig.DBConnector),
+	)
+	e.POST(
+		commonApi.UriBentoReveals,
+		handlers.RevealIngredients(routeConfig.DBConnector),
+		middlewares.ProtectFull(routeConfig.DBConnector),
+		middlewares.ValidateJson(reflect.TypeOf(commonApi.RevealIngredientsRequest{})),
+	)
 	e.POST(
-		"/bento/new",
+		commonApi.UriNewBento,
 		handlers.NewBento(routeConfig.DBConnector),
 		middlewares.ProtectFull(routeConfig.DBConnector),
-		middlewares.ValidateJson(reflect.TypeOf(handlers.NewBentoRequest{})),
+		middlewares.Idempotency(),
+		middlewares.ValidateJson(reflect.TypeOf(commonApi.NewBentoRequest{})),
+	)
+	e.DELETE(
+		commonApi.UriBentoByID,
+		handlers.DeleteBento(routeConfig.DBConnector),
+		middlewares.ProtectFull(routeConfig.DBConnector),
+		middlewares.Idempotency(),
 	)
 	e.POST(
-		"/bento/ingredients",
+		commonApi.UriBentoIngredients,
 		handlers.AddIngredientsToBento(routeConfig.DBConnector),
 		middlewares.ProtectFull(routeConfig.DBConnector),
-		middlewares.ValidateJson(reflect.TypeOf(handlers.AddIngredientsToBentoRequest{})),
+		middlewares.Idempotency(),
+		middlewares.ValidateJson(reflect.TypeOf(commonApi.AddIngredientsToBentoRequest{})),
 	)
 	e.DELETE(
-		"/bento/ingredients",
+		commonApi.UriBentoIngredients,
 		handlers.RemoveIngredientsFromBento(routeConfig.DBConnector),
 		middlewares.ProtectFull(routeConfig.DBConnector),
-		middlewares.ValidateJson(reflect.TypeOf(handlers.RemoveIngredientsFromBentoRequest{})),
+		middlewares.Idempotency(),
+		middlewares.ValidateJson(reflect.TypeOf(commonApi.RemoveIngredientsFromBentoRequest{})),
 	)
 }
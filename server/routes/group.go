@@ -1,6 +1,7 @@
 package routes
 
 import (
+	commonApi "github.com/juancwu/konbini/common/api"
 	"github.com/juancwu/konbini/server/handlers"
 	"github.com/juancwu/konbini/server/middlewares"
 	"reflect"
@@ -10,28 +11,31 @@ func setupGroupRoutes(routeConfig *RouteConfig) {
 	e := routeConfig.Echo
 
 	e.POST(
-		"/group/new",
+		commonApi.UriNewGroup,
 		handlers.NewGroup(routeConfig.DBConnector),
 		// only allow request that comes with a full token
 		middlewares.ProtectFull(routeConfig.DBConnector),
-		middlewares.ValidateJson(reflect.TypeOf(handlers.NewGroupRequest{})),
+		middlewares.Idempotency(),
+		middlewares.ValidateJson(reflect.TypeOf(commonApi.NewGroupRequest{})),
 	)
 
 	e.DELETE(
-		"/group/:id",
+		commonApi.UriGroup,
 		handlers.DeleteGroup(routeConfig.DBConnector),
 		middlewares.ProtectFull(routeConfig.DBConnector),
+		middlewares.Idempotency(),
 	)
 
 	e.POST(
-		"/group/invite",
+		commonApi.UriInviteToGroup,
 		handlers.InviteUsersToJoinGroup(routeConfig.DBConnector),
 		middlewares.ProtectFull(routeConfig.DBConnector),
-		middlewares.ValidateJson(reflect.TypeOf(handlers.InviteUsersToJoinGroupRequest{})),
+		middlewares.Idempotency(),
+		middlewares.ValidateJson(reflect.TypeOf(commonApi.InviteUsersToJoinGroupRequest{})),
 	)
 
 	e.GET(
-		"/group/invitation/accept",
+		commonApi.UriAcceptGroupInvitation,
 		handlers.AcceptGroupInvitation(routeConfig.DBConnector),
 	)
 }
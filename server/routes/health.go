@@ -1,8 +1,11 @@
 package routes
 
-import "github.com/juancwu/konbini/server/handlers"
+import (
+	commonApi "github.com/juancwu/konbini/common/api"
+	"github.com/juancwu/konbini/server/handlers"
+)
 
 // setupHealthRoutes sets all the health related routes
 func setupHealthRoutes(routeConfig *RouteConfig) {
-	routeConfig.Echo.GET("/health-check", handlers.HealthCheck(routeConfig.ServerConfig, routeConfig.DBConnector))
+	routeConfig.Echo.GET(commonApi.UriHealthCheck, handlers.HealthCheck(routeConfig.ServerConfig, routeConfig.DBConnector))
 }
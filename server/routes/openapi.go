@@ -0,0 +1,362 @@
+package routes
+
+import (
+	commonApi "github.com/juancwu/konbini/common/api"
+	"github.com/juancwu/konbini/server/handlers"
+	"github.com/juancwu/konbini/server/openapi"
+	"net/http"
+	"reflect"
+)
+
+const (
+	// V1_PREFIX is the path prefix of every v1 route.
+	V1_PREFIX string = "/api/v1"
+)
+
+// setupDocsRoutes sets the route that serves the OpenAPI document of the v1 routes.
+func setupDocsRoutes(routeConfig *RouteConfig) {
+	routeConfig.Echo.GET(commonApi.UriOpenAPI, handlers.OpenAPI(func() *openapi.Document {
+		return NewOpenAPISpecV1(routeConfig.ServerConfig.GetVersion()).Build(routeConfig.Routes())
+	}))
+}
+
+// NewOpenAPISpecV1 describes every v1 route. A route that is registered without
+// being described here is left out of the OpenAPI document.
+func NewOpenAPISpecV1(version string) *openapi.Spec {
+	spec := openapi.NewSpec(
+		openapi.Info{
+			Title:       "Konbini API",
+			Description: "Secret management for individuals and teams.",
+			Version:     version,
+		},
+		V1_PREFIX,
+		reflect.TypeOf(commonApi.ErrorResponse{}),
+	)
+
+	// auth
+	spec.Add(http.MethodPost, commonApi.UriRegister, openapi.Route{
+		Summary:     "Register a new user",
+		Description: "Creates the user and sends a verification email. The token in the response is a partial token until TOTP is setup.",
+		Tags:        []string{"auth"},
+		Request:     reflect.TypeOf(commonApi.RegisterRequest{}),
+		Status:      http.StatusCreated,
+		Response:    reflect.TypeOf(commonApi.RegisterResponse{}),
+	})
+	spec.Add(http.MethodPost, commonApi.UriLogin, openapi.Route{
+		Summary:     "Login with email and password",
+		Description: "The TOTP code or a recovery code is required once TOTP has been setup.",
+		Tags:        []string{"auth"},
+		Request:     reflect.TypeOf(commonApi.LoginRequest{}),
+		Response:    reflect.TypeOf(commonApi.LoginResponse{}),
+		Errors:      []int{http.StatusTooManyRequests, http.StatusServiceUnavailable},
+	})
+	spec.Add(http.MethodPost, commonApi.UriCheckToken, openapi.Route{
+		Summary:  "Check an auth token",
+		Tags:     []string{"auth"},
+		Request:  reflect.TypeOf(commonApi.CheckAuthTokenRequest{}),
+		Response: reflect.TypeOf(commonApi.CheckAuthResponse{}),
+		Errors:   []int{http.StatusUnauthorized},
+	})
+	spec.Add(http.MethodPost, commonApi.UriLogout, openapi.Route{
+		Summary:     "Logout",
+		Description: "Revokes the token of the request, other tokens of the user stay valid.",
+		Tags:        []string{"auth"},
+		Auth:        openapi.AUTH_ANY_TOKEN,
+	})
+	spec.Add(http.MethodPost, commonApi.UriTOTPSetup, openapi.Route{
+		Summary:     "Start the TOTP setup",
+		Description: "Generates a new TOTP secret. The setup is completed by locking it with a valid code.",
+		Tags:        []string{"auth"},
+		Auth:        openapi.AUTH_ANY_TOKEN,
+		Response:    reflect.TypeOf(commonApi.SetupTOTPResponse{}),
+		Errors:      []int{http.StatusBadRequest},
+	})
+	spec.Add(http.MethodPost, commonApi.UriTOTPLock, openapi.Route{
+		Summary:     "Lock the TOTP setup",
+		Description: "Verifies the TOTP code, responds with the recovery codes and a full token.",
+		Tags:        []string{"auth"},
+		Auth:        openapi.AUTH_ANY_TOKEN,
+		Request:     reflect.TypeOf(commonApi.SetupTOTPLockRequest{}),
+		Response:    reflect.TypeOf(commonApi.LockTOTPResponse{}),
+		Errors:      []int{http.StatusTooManyRequests, http.StatusServiceUnavailable},
+	})
+	spec.Add(http.MethodDelete, commonApi.UriTOTPDelete, openapi.Route{
+		Summary:     "Remove the TOTP setup",
+		Description: "Requires a TOTP code or a recovery code.",
+		Tags:        []string{"auth"},
+		Auth:        openapi.AUTH_FULL_TOKEN,
+		Request:     reflect.TypeOf(commonApi.RemoveTOTPRequest{}),
+		Errors:      []int{http.StatusTooManyRequests, http.StatusServiceUnavailable},
+	})
+	spec.Add(http.MethodGet, commonApi.UriVerifyEmail, openapi.Route{
+		Summary:     "Verify an email",
+		Description: "Opened from the link in the verification email.",
+		Tags:        []string{"auth"},
+		Query: []openapi.Parameter{
+			{Name: "token", Required: true, Description: "Token sent in the verification email."},
+		},
+		Errors: []int{http.StatusBadRequest},
+	})
+	spec.Add(http.MethodPost, commonApi.UriResendVerificationEmail, openapi.Route{
+		Summary:    "Resend the verification email",
+		Tags:       []string{"auth"},
+		Auth:       openapi.AUTH_ANY_TOKEN,
+		Idempotent: true,
+		Errors:     []int{http.StatusBadRequest},
+	})
+
+	// health
+	spec.Add(http.MethodGet, commonApi.UriHealthCheck, openapi.Route{
+		Summary:  "Check the health of the server",
+		Tags:     []string{"health"},
+		Response: reflect.TypeOf(commonApi.HealthReport{}),
+		Errors:   []int{http.StatusServiceUnavailable},
+	})
+	spec.Add(http.MethodGet, commonApi.UriOpenAPI, openapi.Route{
+		Summary:  "Get the OpenAPI document of the api",
+		Tags:     []string{"docs"},
+		Response: reflect.TypeOf(map[string]any{}),
+	})
+
+	// groups
+	spec.Add(http.MethodPost, commonApi.UriNewGroup, openapi.Route{
+		Summary:    "Create a group",
+		Tags:       []string{"group"},
+		Auth:       openapi.AUTH_FULL_TOKEN,
+		Idempotent: true,
+		Request:    reflect.TypeOf(commonApi.NewGroupRequest{}),
+		Status:     http.StatusCreated,
+		Response:   reflect.TypeOf(commonApi.NewGroupResponse{}),
+	})
+	spec.Add(http.MethodDelete, commonApi.UriGroup, openapi.Route{
+		Summary:    "Delete a group",
+		Tags:       []string{"group"},
+		Auth:       openapi.AUTH_FULL_TOKEN,
+		Idempotent: true,
+		Errors:     []int{http.StatusBadRequest},
+	})
+	spec.Add(http.MethodPost, commonApi.UriInviteToGroup, openapi.Route{
+		Summary:     "Invite users to join a group",
+		Description: "Sends an invitation email to every address.",
+		Tags:        []string{"group"},
+		Auth:        openapi.AUTH_FULL_TOKEN,
+		Idempotent:  true,
+		Request:     reflect.TypeOf(commonApi.InviteUsersToJoinGroupRequest{}),
+		Status:      http.StatusCreated,
+	})
+	spec.Add(http.MethodGet, commonApi.UriAcceptGroupInvitation, openapi.Route{
+		Summary:     "Accept an invitation to join a group",
+		Description: "Opened from the link in the invitation email.",
+		Tags:        []string{"group"},
+		Query: []openapi.Parameter{
+			{Name: "token", Required: true, Description: "Token sent in the invitation email."},
+		},
+		Errors: []int{http.StatusBadRequest},
+	})
+
+	// bentos
+	spec.Add(http.MethodGet, commonApi.UriBento, openapi.Route{
+		Summary:     "Get a bento and its ingredients",
+		Description: "The values of the ingredients are masked, they are only sent by the reveal endpoint.",
+		Tags:        []string{"bento"},
+		Auth:        openapi.AUTH_FULL_TOKEN,
+		Query: []openapi.Parameter{
+			{Name: "bento_id", Required: true, Schema: &openapi.Schema{Type: "string", Format: "uuid"}},
+		},
+		Response: reflect.TypeOf(commonApi.GetBentoResponse{}),
+		ETag:     true,
+		Errors:   []int{http.StatusBadRequest, http.StatusNotFound},
+	})
+	spec.Add(http.MethodGet, commonApi.UriBentos, openapi.Route{
+		Summary:  "List the bentos of the user",
+		Tags:     []string{"bento"},
+		Auth:     openapi.AUTH_FULL_TOKEN,
+		Response: reflect.TypeOf([]commonApi.ListBentosResponse{}),
+	})
+	spec.Add(http.MethodGet, commonApi.UriBentoChanges, openapi.Route{
+		Summary:     "List the changes of a bento",
+		Description: "Changes have the names of the ingredients that changed, never their values.",
+		Tags:        []string{"bento"},
+		Auth:        openapi.AUTH_FULL_TOKEN,
+		Query: []openapi.Parameter{
+			{Name: "since", Description: "Only list changes after this revision. Defaults to 0.", Schema: &openapi.Schema{Type: "integer"}},
+			{Name: "limit", Description: "Defaults to 100, at most 500.", Schema: &openapi.Schema{Type: "integer"}},
+		},
+		Response: reflect.TypeOf(commonApi.BentoChangesResponse{}),
+		ETag:     true,
+		Errors:   []int{http.StatusBadRequest, http.StatusNotFound},
+	})
+	spec.Add(http.MethodGet, commonApi.UriBentoEvents, openapi.Route{
+		Summary:     "Watch the changes of a bento",
+		Description: "Streams a \"change\" server-sent event for every change, the id of an event is the revision of the bento. Reconnecting clients resume with the Last-Event-ID header.",
+		Tags:        []string{"bento"},
+		Auth:        openapi.AUTH_FULL_TOKEN,
+		Query: []openapi.Parameter{
+			{Name: "since", Description: "Also send the changes after this revision. Defaults to the current revision.", Schema: &openapi.Schema{Type: "integer"}},
+		},
+		EventStream: reflect.TypeOf(commonApi.BentoChange{}),
+		Errors:      []int{http.StatusBadRequest, http.StatusNotFound},
+	})
+	spec.Add(http.MethodGet, commonApi.UriBentoReveals, openapi.Route{
+		Summary:     "List the reveals of a bento",
+		Description: "The audit log of the ingredient values shown to users, newest first. Only the owner and admins of the bento can list it.",
+		Tags:        []string{"bento"},
+		Auth:        openapi.AUTH_FULL_TOKEN,
+		Query: []openapi.Parameter{
+			{Name: "limit", Description: "Defaults to 100, at most 500.", Schema: &openapi.Schema{Type: "integer"}},
+		},
+		Response: reflect.TypeOf(commonApi.BentoRevealsResponse{}),
+		Errors:   []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound},
+	})
+	spec.Add(http.MethodPost, commonApi.UriBentoReveals, openapi.Route{
+		Summary:     "Reveal ingredient values",
+		Description: "Responds with the values of the named ingredients, or of all the ingredients when no name is given. The reveal is added to the audit log of the bento, which is kept when the bento is deleted and can then be listed by server administrators.",
+		Tags:        []string{"bento"},
+		Auth:        openapi.AUTH_FULL_TOKEN,
+		Request:     reflect.TypeOf(commonApi.RevealIngredientsRequest{}),
+		Response:    reflect.TypeOf(commonApi.GetBentoResponse{}),
+		Errors:      []int{http.StatusNotFound},
+	})
+	spec.Add(http.MethodPost, commonApi.UriNewBento, openapi.Route{
+		Summary:    "Create a bento",
+		Tags:       []string{"bento"},
+		Auth:       openapi.AUTH_FULL_TOKEN,
+		Idempotent: true,
+		Request:    reflect.TypeOf(commonApi.NewBentoRequest{}),
+		Status:     http.StatusCreated,
+		Response:   reflect.TypeOf(commonApi.NewBentoResponse{}),
+		ETag:       true,
+	})
+	spec.Add(http.MethodDelete, commonApi.UriBentoByID, openapi.Route{
+		Summary:     "Delete a bento and its ingredients",
+		Description: "Watchers and webhooks of the bento get a change that removes every ingredient.",
+		Tags:        []string{"bento"},
+		Auth:        openapi.AUTH_FULL_TOKEN,
+		Idempotent:  true,
+		Conditional: true,
+		Errors:      []int{http.StatusForbidden, http.StatusNotFound},
+	})
+	spec.Add(http.MethodPost, commonApi.UriBentoIngredients, openapi.Route{
+		Summary:     "Add ingredients to a bento",
+		Tags:        []string{"bento"},
+		Auth:        openapi.AUTH_FULL_TOKEN,
+		Idempotent:  true,
+		Conditional: true,
+		Query: []openapi.Parameter{
+			{Name: "replace", Description: "Replace the value of existing ingredients when true.", Schema: &openapi.Schema{Type: "boolean"}},
+		},
+		Request:  reflect.TypeOf(commonApi.AddIngredientsToBentoRequest{}),
+		Response: reflect.TypeOf(commonApi.AddIngredientsToBentoResponse{}),
+		ETag:     true,
+	})
+	spec.Add(http.MethodDelete, commonApi.UriBentoIngredients, openapi.Route{
+		Summary:     "Remove ingredients from a bento",
+		Tags:        []string{"bento"},
+		Auth:        openapi.AUTH_FULL_TOKEN,
+		Idempotent:  true,
+		Conditional: true,
+		Request:     reflect.TypeOf(commonApi.RemoveIngredientsFromBentoRequest{}),
+		Response:    reflect.TypeOf(commonApi.RemoveIngredientsFromBentoResponse{}),
+		ETag:        true,
+	})
+
+	// webhooks
+	spec.Add(http.MethodPost, commonApi.UriBentoWebhooks, openapi.Route{
+		Summary:     "Subscribe a webhook to the events of a bento",
+		Description: "Only the owner of the bento can manage its webhooks. The url must resolve to a public address. The secret that signs the deliveries is only shown in this response.",
+		Tags:        []string{"webhook"},
+		Auth:        openapi.AUTH_FULL_TOKEN,
+		Idempotent:  true,
+		Request:     reflect.TypeOf(commonApi.NewWebhookRequest{}),
+		Status:      http.StatusCreated,
+		Response:    reflect.TypeOf(commonApi.NewWebhookResponse{}),
+		Errors:      []int{http.StatusBadRequest, http.StatusNotFound},
+	})
+	spec.Add(http.MethodGet, commonApi.UriBentoWebhooks, openapi.Route{
+		Summary:  "List the webhooks of a bento",
+		Tags:     []string{"webhook"},
+		Auth:     openapi.AUTH_FULL_TOKEN,
+		Response: reflect.TypeOf([]commonApi.WebhookResponse{}),
+		Errors:   []int{http.StatusNotFound},
+	})
+	spec.Add(http.MethodPost, commonApi.UriGroupWebhooks, openapi.Route{
+		Summary:     "Subscribe a webhook to the events of a group",
+		Description: "Only the owner of the group can manage its webhooks. The url must resolve to a public address. The secret that signs the deliveries is only shown in this response.",
+		Tags:        []string{"webhook"},
+		Auth:        openapi.AUTH_FULL_TOKEN,
+		Idempotent:  true,
+		Request:     reflect.TypeOf(commonApi.NewWebhookRequest{}),
+		Status:      http.StatusCreated,
+		Response:    reflect.TypeOf(commonApi.NewWebhookResponse{}),
+		Errors:      []int{http.StatusBadRequest, http.StatusNotFound},
+	})
+	spec.Add(http.MethodGet, commonApi.UriGroupWebhooks, openapi.Route{
+		Summary:  "List the webhooks of a group",
+		Tags:     []string{"webhook"},
+		Auth:     openapi.AUTH_FULL_TOKEN,
+		Response: reflect.TypeOf([]commonApi.WebhookResponse{}),
+		Errors:   []int{http.StatusNotFound},
+	})
+	spec.Add(http.MethodDelete, commonApi.UriWebhook, openapi.Route{
+		Summary:    "Delete a webhook and its delivery log",
+		Tags:       []string{"webhook"},
+		Auth:       openapi.AUTH_FULL_TOKEN,
+		Idempotent: true,
+		Errors:     []int{http.StatusNotFound},
+	})
+	spec.Add(http.MethodGet, commonApi.UriWebhookDeliveries, openapi.Route{
+		Summary: "List the deliveries of a webhook",
+		Tags:    []string{"webhook"},
+		Auth:    openapi.AUTH_FULL_TOKEN,
+		Query: []openapi.Parameter{
+			{Name: "limit", Description: "Defaults to 50, at most 500.", Schema: &openapi.Schema{Type: "integer"}},
+		},
+		Response: reflect.TypeOf([]commonApi.WebhookDeliveryResponse{}),
+		Errors:   []int{http.StatusBadRequest, http.StatusNotFound},
+	})
+	spec.Add(http.MethodPost, commonApi.UriWebhookTest, openapi.Route{
+		Summary:     "Send a test event to a webhook",
+		Description: "Queues a webhook.test event, the result shows up in the delivery log.",
+		Tags:        []string{"webhook"},
+		Auth:        openapi.AUTH_FULL_TOKEN,
+		Idempotent:  true,
+		Status:      http.StatusAccepted,
+		Response:    reflect.TypeOf(commonApi.TestWebhookResponse{}),
+		Errors:      []int{http.StatusNotFound},
+	})
+
+	// admin
+	spec.Add(http.MethodGet, commonApi.UriEmailJobs, openapi.Route{
+		Summary: "List email jobs",
+		Tags:    []string{"admin"},
+		Auth:    openapi.AUTH_FULL_TOKEN,
+		Query: []openapi.Parameter{
+			{Name: "status", Description: "Defaults to dead.", Schema: &openapi.Schema{Type: "string", Enum: []string{"pending", "processing", "sent", "dead"}}},
+			{Name: "limit", Description: "Defaults to 50.", Schema: &openapi.Schema{Type: "integer"}},
+		},
+		Response: reflect.TypeOf([]commonApi.EmailJobResponse{}),
+		Errors:   []int{http.StatusBadRequest, http.StatusForbidden},
+	})
+	spec.Add(http.MethodPost, commonApi.UriRedriveEmailJob, openapi.Route{
+		Summary:     "Redrive a dead email job",
+		Description: "Queues the job to be sent again.",
+		Tags:        []string{"admin"},
+		Auth:        openapi.AUTH_FULL_TOKEN,
+		Idempotent:  true,
+		Status:      http.StatusAccepted,
+		Errors:      []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound},
+	})
+	spec.Add(http.MethodGet, commonApi.UriAdminBentoReveals, openapi.Route{
+		Summary:     "List the reveals of any bento",
+		Description: "The audit log of the ingredient values shown to users, newest first. It includes the reveals of deleted bentos.",
+		Tags:        []string{"admin"},
+		Auth:        openapi.AUTH_FULL_TOKEN,
+		Query: []openapi.Parameter{
+			{Name: "limit", Description: "Defaults to 100, at most 500.", Schema: &openapi.Schema{Type: "integer"}},
+		},
+		Response: reflect.TypeOf(commonApi.BentoRevealsResponse{}),
+		Errors:   []int{http.StatusBadRequest, http.StatusForbidden},
+	})
+
+	return spec
+}
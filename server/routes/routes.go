@@ -18,4 +18,7 @@ func SetupRoutesV1(cfg *RouteConfig) {
 	setupHealthRoutes(cfg)
 	setupGroupRoutes(cfg)
 	setupBentoRoutes(cfg)
+	setupWebhookRoutes(cfg)
+	setupAdminRoutes(cfg)
+	setupDocsRoutes(cfg)
 }
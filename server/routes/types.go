@@ -3,6 +3,7 @@ package routes
 import (
 	"github.com/juancwu/konbini/server/config"
 	"github.com/juancwu/konbini/server/db"
+	"github.com/juancwu/konbini/server/services"
 
 	"github.com/labstack/echo/v4"
 )
@@ -27,4 +28,8 @@ type RouteConfig struct {
 	Echo         EchoInstance
 	ServerConfig *config.Config
 	DBConnector  *db.DBConnector
+	EmailQueue   *services.EmailQueue
+	WebhookQueue *services.WebhookQueue
+	// Routes lists every route registered in Echo. It is used to build the OpenAPI document.
+	Routes func() []*echo.Route
 }
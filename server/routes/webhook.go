@@ -0,0 +1,57 @@
+package routes
+
+import (
+	commonApi "github.com/juancwu/konbini/common/api"
+	"github.com/juancwu/konbini/server/handlers"
+	"github.com/juancwu/konbini/server/middlewares"
+	"reflect"
+)
+
+// setupWebhookRoutes sets the routes to manage the webhooks of bentos and groups.
+func setupWebhookRoutes(routeConfig *RouteConfig) {
+	e := routeConfig.Echo
+
+	e.POST(
+		commonApi.UriBentoWebhooks,
+		handlers.NewBentoWebhook(routeConfig.DBConnector),
+		middlewares.ProtectFull(routeConfig.DBConnector),
+		middlewares.Idempotency(),
+		middlewares.ValidateJson(reflect.TypeOf(commonApi.NewWebhookRequest{})),
+	)
+	e.GET(
+		commonApi.UriBentoWebhooks,
+		handlers.ListBentoWebhooks(routeConfig.DBConnector),
+		middlewares.ProtectFull(routeConfig.DBConnector),
+	)
+
+	e.POST(
+		commonApi.UriGroupWebhooks,
+		handlers.NewGroupWebhook(routeConfig.DBConnector),
+		middlewares.ProtectFull(routeConfig.DBConnector),
+		middlewares.Idempotency(),
+		middlewares.ValidateJson(reflect.TypeOf(commonApi.NewWebhookRequest{})),
+	)
+	e.GET(
+		commonApi.UriGroupWebhooks,
+		handlers.ListGroupWebhooks(routeConfig.DBConnector),
+		middlewares.ProtectFull(routeConfig.DBConnector),
+	)
+
+	e.DELETE(
+		commonApi.UriWebhook,
+		handlers.DeleteWebhook(routeConfig.DBConnector),
+		middlewares.ProtectFull(routeConfig.DBConnector),
+		middlewares.Idempotency(),
+	)
+	e.GET(
+		commonApi.UriWebhookDeliveries,
+		handlers.ListWebhookDeliveries(routeConfig.DBConnector),
+		middlewares.ProtectFull(routeConfig.DBConnector),
+	)
+	e.POST(
+		commonApi.UriWebhookTest,
+		handlers.TestWebhook(routeConfig.DBConnector, routeConfig.WebhookQueue),
+		middlewares.ProtectFull(routeConfig.DBConnector),
+		middlewares.Idempotency(),
+	)
+}
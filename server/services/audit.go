@@ -0,0 +1,29 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/juancwu/konbini/server/db"
+	"github.com/juancwu/konbini/server/events"
+	"github.com/juancwu/konbini/server/utils"
+	"time"
+)
+
+// SubscribeAudit records the audit entries of the events published by the handlers. The
+// subscribers are sync, an entry is written in the transaction of the change or the change fails.
+func SubscribeAudit(bus *events.Bus) {
+	events.Subscribe(bus, func(ctx context.Context, q *db.Queries, e events.BentoIngredientsRevealed) error {
+		names, err := json.Marshal(e.Ingredients)
+		if err != nil {
+			return err
+		}
+		return q.NewBentoReveal(ctx, db.NewBentoRevealParams{
+			BentoID:     e.BentoID,
+			UserID:      e.UserID,
+			Ingredients: string(names),
+			Ip:          e.IP,
+			UserAgent:   e.UserAgent,
+			CreatedAt:   utils.FormatRFC3339NanoFixed(time.Now()),
+		})
+	})
+}
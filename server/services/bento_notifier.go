@@ -0,0 +1,78 @@
+package services
+
+import (
+	"sync"
+)
+
+// BentoNotifier fans out the revisions of changed bentos to the watchers in this process.
+// Watchers read the changes from the database, a notification only wakes them up. Changes
+// made by other server instances are picked up when the watchers poll.
+type BentoNotifier struct {
+	mu       sync.Mutex
+	watchers map[string]map[chan int64]struct{}
+}
+
+// NewBentoNotifier creates a notifier without watchers.
+func NewBentoNotifier() *BentoNotifier {
+	return &BentoNotifier{watchers: map[string]map[chan int64]struct{}{}}
+}
+
+var defaultBentoNotifier = NewBentoNotifier()
+
+// DefaultBentoNotifier returns the notifier shared by the bento handlers.
+func DefaultBentoNotifier() *BentoNotifier {
+	return defaultBentoNotifier
+}
+
+// Subscribe watches the changes of a bento. The channel receives the latest revision, a slow
+// watcher only gets the last one. Call the returned function to stop watching.
+func (n *BentoNotifier) Subscribe(bentoID string) (<-chan int64, func()) {
+	ch := make(chan int64, 1)
+
+	n.mu.Lock()
+	if n.watchers[bentoID] == nil {
+		n.watchers[bentoID] = map[chan int64]struct{}{}
+	}
+	n.watchers[bentoID][ch] = struct{}{}
+	n.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			n.mu.Lock()
+			defer n.mu.Unlock()
+			delete(n.watchers[bentoID], ch)
+			if len(n.watchers[bentoID]) == 0 {
+				delete(n.watchers, bentoID)
+			}
+		})
+	}
+}
+
+// Publish notifies the watchers of a bento that it is now at revision. It never blocks.
+func (n *BentoNotifier) Publish(bentoID string, revision int64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for ch := range n.watchers[bentoID] {
+		select {
+		case ch <- revision:
+		default:
+			// replace the pending revision with the latest one
+			select {
+			case <-ch:
+			default:
+			}
+			select {
+			case ch <- revision:
+			default:
+			}
+		}
+	}
+}
+
+// Watchers counts the watchers of a bento.
+func (n *BentoNotifier) Watchers(bentoID string) int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return len(n.watchers[bentoID])
+}
@@ -5,62 +5,23 @@ import (
 	"context"
 	"fmt"
 	"github.com/juancwu/konbini/server/config"
+	"github.com/juancwu/konbini/server/db"
+	"github.com/juancwu/konbini/server/events"
 	"github.com/juancwu/konbini/server/views"
 
-	"github.com/resend/resend-go/v2"
 	"github.com/rs/zerolog/log"
 )
 
-// SendEmail sends an email via the Resend Client. This is the base function and
-// ideally not used directly but instead as the only step where an email is sent.
-func SendEmail(ctx context.Context, params *resend.SendEmailRequest) (*resend.SendEmailResponse, error) {
+// SendVerificationEmail queues an email verification for users to verify their email.
+// It returns the id of the queued email job.
+func SendVerificationEmail(ctx context.Context, to string, token string) (string, error) {
 	c, err := config.Global()
 	if err != nil {
-		return nil, err
-	}
-	// skip sending emails in testing environment
-	if c.IsTesting() {
-		return &resend.SendEmailResponse{Id: ""}, nil
-	}
-	// change the destination email in development to avoid
-	// hurting the domain's reputation.
-	if c.IsDevelopment() {
-		params.To = []string{"delivered@resend.dev"}
+		return "", err
 	}
-	client := resend.NewClient(c.GetResendApiKey())
-	sent, err := client.Emails.SendWithContext(ctx, params)
-	return sent, err
-}
-
-// SendBatchEmails sends a batch of emails at the same time.
-// This function should not be used directly but instead when the batch
-// is ready to send, use it.
-func SendBatchEmails(ctx context.Context, params []*resend.SendEmailRequest) (*resend.BatchEmailResponse, error) {
-	cfg, err := config.Global()
+	queue, err := DefaultEmailQueue()
 	if err != nil {
-		return nil, err
-	}
-
-	if cfg.IsTesting() {
-		return nil, nil
-	}
-
-	if cfg.IsDevelopment() {
-		// change all the destination emails
-		for _, p := range params {
-			p.To = []string{"delivered@resend.dev"}
-		}
-	}
-
-	client := resend.NewClient(cfg.GetResendApiKey())
-	return client.Batch.SendWithContext(ctx, params)
-}
-
-// SendVerificationEmail sends an email verification for users to verify their email.
-func SendVerificationEmail(ctx context.Context, to string, token string) (*resend.SendEmailResponse, error) {
-	c, err := config.Global()
-	if err != nil {
-		return nil, err
+		return "", err
 	}
 
 	url := fmt.Sprintf("%s/api/v1/auth/email/verify?token=%s", c.GetBackendUrl(), token)
@@ -68,10 +29,10 @@ func SendVerificationEmail(ctx context.Context, to string, token string) (*resen
 	var buffer bytes.Buffer
 	err = component.Render(ctx, &buffer)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 
-	params := &resend.SendEmailRequest{
+	msg := &EmailMessage{
 		From:    c.GetVerifyEmailAddress(),
 		To:      []string{to},
 		Subject: "Verify Your Email",
@@ -88,12 +49,7 @@ Do not reply to this email. This email is not monitored.`,
 		),
 	}
 
-	res, err := SendEmail(ctx, params)
-	if err != nil {
-		return nil, err
-	}
-
-	return res, nil
+	return queue.Enqueue(ctx, msg)
 }
 
 type SendGroupInvitationEmailsParams struct {
@@ -106,14 +62,20 @@ type SendGroupInvitationEmailsParams struct {
 	}
 }
 
-func SendGroupInvitationEmails(ctx context.Context, params SendGroupInvitationEmailsParams) (*resend.BatchEmailResponse, error) {
+// SendGroupInvitationEmails queues one invitation email per invited user.
+// It returns the ids of the queued email jobs.
+func SendGroupInvitationEmails(ctx context.Context, params SendGroupInvitationEmailsParams) ([]string, error) {
 	cfg, err := config.Global()
 	if err != nil {
 		return nil, err
 	}
+	queue, err := DefaultEmailQueue()
+	if err != nil {
+		return nil, err
+	}
 
-	batch := make([]*resend.SendEmailRequest, len(params.Users))
-	for i, u := range params.Users {
+	ids := make([]string, 0, len(params.Users))
+	for _, u := range params.Users {
 		url := fmt.Sprintf("%s/api/v1/group/invitation/accept?token=%s", cfg.GetBackendUrl(), u.Token)
 
 		var buf bytes.Buffer
@@ -123,15 +85,60 @@ func SendGroupInvitationEmails(ctx context.Context, params SendGroupInvitationEm
 			continue
 		}
 
-		req := &resend.SendEmailRequest{
+		id, err := queue.Enqueue(ctx, &EmailMessage{
 			From:    cfg.GetGroupInvitationEmailAddress(),
 			To:      []string{u.Email},
 			Subject: fmt.Sprintf("Join Group [%s]", params.GroupName),
 			Html:    buf.String(),
+		})
+		if err != nil {
+			return ids, err
 		}
-
-		batch[i] = req
+		ids = append(ids, id)
 	}
 
-	return SendBatchEmails(ctx, batch)
+	return ids, nil
+}
+
+// SubscribeEmails sends the emails of the events published by the handlers. The emails are only
+// queued once the change that triggered them is committed.
+func SubscribeEmails(bus *events.Bus, connector *db.DBConnector) {
+	events.SubscribeAsync(bus, "emails", func(ctx context.Context, e events.EmailVerificationRequested) error {
+		conn, err := connector.Connect()
+		if err != nil {
+			return err
+		}
+		token, err := NewEmailToken(ctx, db.New(db.Instrument(conn)), e.UserID)
+		conn.Close()
+		if err != nil {
+			return err
+		}
+		tokenStr, err := token.Package()
+		if err != nil {
+			return err
+		}
+		_, err = SendVerificationEmail(ctx, e.Email, tokenStr)
+		return err
+	})
+	events.SubscribeAsync(bus, "emails", func(ctx context.Context, e events.GroupInvitationCreated) error {
+		cfg, err := config.Global()
+		if err != nil {
+			return err
+		}
+		token, err := NewGroupInvitationToken(e.InvitationID, e.ExpiresAt, cfg.GetAesKey())
+		if err != nil {
+			return err
+		}
+		params := SendGroupInvitationEmailsParams{
+			InvitorName: e.InvitorName,
+			GroupName:   e.GroupName,
+			Users: []struct {
+				Name  string
+				Token string
+				Email string
+			}{{Name: e.UserName, Token: token, Email: e.Email}},
+		}
+		_, err = SendGroupInvitationEmails(ctx, params)
+		return err
+	})
 }
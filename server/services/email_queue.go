@@ -0,0 +1,340 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/juancwu/konbini/server/db"
+	"github.com/juancwu/konbini/server/jobs"
+	"github.com/juancwu/konbini/server/metrics"
+	"github.com/juancwu/konbini/server/tracing"
+	"github.com/juancwu/konbini/server/utils"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Email job statuses as stored in the email_jobs table.
+const (
+	EMAIL_JOB_PENDING    string = "pending"
+	EMAIL_JOB_PROCESSING string = "processing"
+	EMAIL_JOB_SENT       string = "sent"
+	EMAIL_JOB_DEAD       string = "dead"
+)
+
+var (
+	ErrEmailQueueNotSet   error = errors.New("Default email queue has not been set. Use services.SetDefaultEmailQueue() to set it.")
+	ErrEmailJobNotRedrive error = errors.New("Only dead email jobs can be re-driven")
+)
+
+// EmailMessage is the payload of an email job. It is stored as JSON so that
+// a job can be picked up again after a restart.
+type EmailMessage struct {
+	From    string   `json:"from"`
+	To      []string `json:"to"`
+	Subject string   `json:"subject"`
+	Html    string   `json:"html,omitempty"`
+	Text    string   `json:"text,omitempty"`
+}
+
+// EmailJobStore persists email jobs. The result of a sent job is the id of the message given by
+// the provider.
+type EmailJobStore interface {
+	jobs.Store[db.EmailJob, string]
+	Enqueue(ctx context.Context, payload string, maxAttempts int, runAt time.Time) (string, error)
+	List(ctx context.Context, status string, limit int) ([]db.EmailJob, error)
+	// Redrive moves a dead job back to pending with a fresh attempt counter.
+	// It returns false if there is no dead job with the given id.
+	Redrive(ctx context.Context, id string, runAt time.Time) (bool, error)
+}
+
+// EmailQueueConfig configures the worker pool of an EmailQueue.
+type EmailQueueConfig struct {
+	Workers      int
+	MaxAttempts  int
+	PollInterval time.Duration
+	Lease        time.Duration
+	SendTimeout  time.Duration
+	BaseBackoff  time.Duration
+	MaxBackoff   time.Duration
+}
+
+// DefaultEmailQueueConfig returns the configuration used by the server.
+func DefaultEmailQueueConfig() EmailQueueConfig {
+	return EmailQueueConfig{
+		Workers:      2,
+		MaxAttempts:  5,
+		PollInterval: time.Second * 5,
+		Lease:        time.Minute * 2,
+		SendTimeout:  time.Minute,
+		BaseBackoff:  time.Second * 30,
+		MaxBackoff:   time.Hour,
+	}
+}
+
+// EmailQueue is a durable outbound email queue backed by an EmailJobStore.
+// Emails are enqueued by the handlers and delivered by a pool of workers that
+// retry with exponential backoff. Jobs that keep failing are moved to the dead state
+// where they can be inspected and re-driven.
+type EmailQueue struct {
+	store  EmailJobStore
+	sender EmailSender
+	cfg    EmailQueueConfig
+	worker *jobs.Worker[db.EmailJob, string]
+}
+
+// NewEmailQueue creates a new email queue. Call Start to begin processing jobs.
+func NewEmailQueue(store EmailJobStore, sender EmailSender, cfg EmailQueueConfig) *EmailQueue {
+	defaults := DefaultEmailQueueConfig()
+	if cfg.Workers <= 0 {
+		cfg.Workers = defaults.Workers
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = defaults.MaxAttempts
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = defaults.PollInterval
+	}
+	if cfg.Lease <= 0 {
+		cfg.Lease = defaults.Lease
+	}
+	if cfg.SendTimeout <= 0 {
+		cfg.SendTimeout = defaults.SendTimeout
+	}
+	if cfg.BaseBackoff <= 0 {
+		cfg.BaseBackoff = defaults.BaseBackoff
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = defaults.MaxBackoff
+	}
+	q := &EmailQueue{
+		store:  store,
+		sender: sender,
+		cfg:    cfg,
+	}
+	q.worker = jobs.NewWorker("email", store, jobs.Config{
+		Workers:      cfg.Workers,
+		PollInterval: cfg.PollInterval,
+		Lease:        cfg.Lease,
+		Timeout:      cfg.SendTimeout,
+		BaseBackoff:  cfg.BaseBackoff,
+		MaxBackoff:   cfg.MaxBackoff,
+	}, q.send)
+	q.worker.Observe = func(job db.EmailJob, messageID string, outcome jobs.Outcome) {
+		switch outcome {
+		case jobs.OUTCOME_DONE:
+			log.Info().Str("job_id", job.ID).Str("email_id", messageID).Msg("Successfully sent email")
+			metrics.EmailSend(metrics.EMAIL_SENT)
+		case jobs.OUTCOME_RETRY:
+			metrics.EmailSend(metrics.EMAIL_RETRY)
+		case jobs.OUTCOME_DEAD:
+			metrics.EmailSend(metrics.EMAIL_DEAD)
+		}
+	}
+	return q
+}
+
+// Enqueue stores the message as a new pending job and returns the job id.
+func (q *EmailQueue) Enqueue(ctx context.Context, msg *EmailMessage) (string, error) {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return "", err
+	}
+	id, err := q.store.Enqueue(ctx, string(payload), q.cfg.MaxAttempts, time.Now())
+	if err != nil {
+		return "", err
+	}
+	q.worker.Nudge()
+	return id, nil
+}
+
+// List returns up to limit jobs with the given status, newest first.
+func (q *EmailQueue) List(ctx context.Context, status string, limit int) ([]db.EmailJob, error) {
+	return q.store.List(ctx, status, limit)
+}
+
+// Redrive moves a dead job back to the queue.
+func (q *EmailQueue) Redrive(ctx context.Context, id string) error {
+	ok, err := q.store.Redrive(ctx, id, time.Now())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrEmailJobNotRedrive
+	}
+	q.worker.Nudge()
+	return nil
+}
+
+// Start launches the worker pool. Workers stop when the context is cancelled or Stop is called.
+func (q *EmailQueue) Start(ctx context.Context) {
+	q.worker.Start(ctx)
+}
+
+// Stop stops all workers and waits for in-flight jobs to finish.
+func (q *EmailQueue) Stop() {
+	q.worker.Stop()
+}
+
+// send delivers the message of a job within a span so slow transports show up in traces.
+func (q *EmailQueue) send(ctx context.Context, job db.EmailJob) (string, error) {
+	var msg EmailMessage
+	if err := json.Unmarshal([]byte(job.Payload), &msg); err != nil {
+		// a malformed payload will never succeed, skip the retries
+		return "", jobs.Permanent(err)
+	}
+
+	ctx, span := tracing.Start(ctx, "email.send",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("email.job_id", job.ID),
+			attribute.Int64("email.attempt", job.Attempts),
+			attribute.Int("email.recipients", len(msg.To)),
+		),
+	)
+	defer span.End()
+
+	messageID, err := q.sender.Send(ctx, &msg)
+	tracing.RecordError(span, err)
+	if err == nil {
+		span.SetAttributes(attribute.String("email.message_id", messageID))
+	}
+	return messageID, err
+}
+
+var defaultEmailQueue *EmailQueue
+
+// SetDefaultEmailQueue sets the queue used by the email helpers in this package.
+// It is not safe for concurrent use and should only be called during server boot.
+func SetDefaultEmailQueue(q *EmailQueue) {
+	defaultEmailQueue = q
+}
+
+// DefaultEmailQueue returns the queue set by SetDefaultEmailQueue.
+func DefaultEmailQueue() (*EmailQueue, error) {
+	if defaultEmailQueue == nil {
+		return nil, ErrEmailQueueNotSet
+	}
+	return defaultEmailQueue, nil
+}
+
+// DBEmailJobStore is an EmailJobStore backed by the email_jobs table.
+type DBEmailJobStore struct {
+	connector *db.DBConnector
+}
+
+// NewDBEmailJobStore creates an EmailJobStore that uses the given connector.
+func NewDBEmailJobStore(connector *db.DBConnector) *DBEmailJobStore {
+	return &DBEmailJobStore{connector: connector}
+}
+
+func (s *DBEmailJobStore) Enqueue(ctx context.Context, payload string, maxAttempts int, runAt time.Time) (string, error) {
+	conn, err := s.connector.Connect()
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	now := utils.FormatRFC3339NanoFixed(time.Now())
+	return db.New(db.Instrument(conn)).NewEmailJob(ctx, db.NewEmailJobParams{
+		Payload:     payload,
+		MaxAttempts: int64(maxAttempts),
+		RunAt:       utils.FormatRFC3339NanoFixed(runAt),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	})
+}
+
+func (s *DBEmailJobStore) Claim(ctx context.Context, now time.Time, lease time.Duration) (db.EmailJob, error) {
+	conn, err := s.connector.Connect()
+	if err != nil {
+		return db.EmailJob{}, err
+	}
+	defer conn.Close()
+
+	lockedUntil := utils.FormatRFC3339NanoFixed(now.Add(lease))
+	return db.New(db.Instrument(conn)).ClaimEmailJob(ctx, db.ClaimEmailJobParams{
+		LockedUntil: &lockedUntil,
+		UpdatedAt:   utils.FormatRFC3339NanoFixed(now),
+		Now:         utils.FormatRFC3339NanoFixed(now),
+	})
+}
+
+func (s *DBEmailJobStore) Complete(ctx context.Context, id string, lease string, messageID string) error {
+	conn, err := s.connector.Connect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return jobs.LeaseHeld(db.New(db.Instrument(conn)).CompleteEmailJob(ctx, db.CompleteEmailJobParams{
+		MessageID:   &messageID,
+		UpdatedAt:   utils.FormatRFC3339NanoFixed(time.Now()),
+		ID:          id,
+		LockedUntil: &lease,
+	}))
+}
+
+func (s *DBEmailJobStore) Retry(ctx context.Context, id string, lease string, runAt time.Time, _ string, lastError string) error {
+	conn, err := s.connector.Connect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return jobs.LeaseHeld(db.New(db.Instrument(conn)).RetryEmailJob(ctx, db.RetryEmailJobParams{
+		LastError:   &lastError,
+		RunAt:       utils.FormatRFC3339NanoFixed(runAt),
+		UpdatedAt:   utils.FormatRFC3339NanoFixed(time.Now()),
+		ID:          id,
+		LockedUntil: &lease,
+	}))
+}
+
+func (s *DBEmailJobStore) Bury(ctx context.Context, id string, lease string, _ string, lastError string) error {
+	conn, err := s.connector.Connect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return jobs.LeaseHeld(db.New(db.Instrument(conn)).BuryEmailJob(ctx, db.BuryEmailJobParams{
+		LastError:   &lastError,
+		UpdatedAt:   utils.FormatRFC3339NanoFixed(time.Now()),
+		ID:          id,
+		LockedUntil: &lease,
+	}))
+}
+
+func (s *DBEmailJobStore) List(ctx context.Context, status string, limit int) ([]db.EmailJob, error) {
+	conn, err := s.connector.Connect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	return db.New(db.Instrument(conn)).ListEmailJobsByStatus(ctx, db.ListEmailJobsByStatusParams{
+		Status: status,
+		Limit:  int64(limit),
+	})
+}
+
+func (s *DBEmailJobStore) Redrive(ctx context.Context, id string, runAt time.Time) (bool, error) {
+	conn, err := s.connector.Connect()
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	n, err := db.New(db.Instrument(conn)).RedriveEmailJob(ctx, db.RedriveEmailJobParams{
+		RunAt:     utils.FormatRFC3339NanoFixed(runAt),
+		UpdatedAt: utils.FormatRFC3339NanoFixed(time.Now()),
+		ID:        id,
+	})
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
@@ -0,0 +1,222 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/juancwu/konbini/server/config"
+	"github.com/juancwu/konbini/server/utils"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/resend/resend-go/v2"
+	"github.com/rs/zerolog/log"
+)
+
+var ErrUnknownEmailTransport error = errors.New("Unknown email transport")
+
+// EmailSender delivers a single email and returns an id that identifies the
+// message with the transport, i.e. the provider message id.
+type EmailSender interface {
+	Send(ctx context.Context, msg *EmailMessage) (string, error)
+}
+
+// NewEmailSender creates the EmailSender selected by the server configuration.
+func NewEmailSender(cfg *config.Config) (EmailSender, error) {
+	switch cfg.GetEmailTransport() {
+	case config.EMAIL_TRANSPORT_RESEND:
+		sender := NewResendEmailSender(cfg.GetResendApiKey())
+		// change the destination email in development to avoid
+		// hurting the domain's reputation.
+		if cfg.IsDevelopment() {
+			sender.RedirectTo = "delivered@resend.dev"
+		}
+		return sender, nil
+	case config.EMAIL_TRANSPORT_SMTP:
+		return NewSMTPEmailSender(cfg.GetSMTPConfig()), nil
+	case config.EMAIL_TRANSPORT_FILE:
+		return NewFileEmailSender(cfg.GetEmailFileDir()), nil
+	case config.EMAIL_TRANSPORT_CONSOLE:
+		return &ConsoleEmailSender{}, nil
+	}
+	return nil, ErrUnknownEmailTransport
+}
+
+// ResendEmailSender sends emails through the Resend API.
+type ResendEmailSender struct {
+	client *resend.Client
+	// RedirectTo replaces the recipients of every email when set.
+	RedirectTo string
+}
+
+// NewResendEmailSender creates a sender that uses the given Resend API key.
+func NewResendEmailSender(apiKey string) *ResendEmailSender {
+	return &ResendEmailSender{client: resend.NewClient(apiKey)}
+}
+
+func (s *ResendEmailSender) Send(ctx context.Context, msg *EmailMessage) (string, error) {
+	params := &resend.SendEmailRequest{
+		From:    msg.From,
+		To:      msg.To,
+		Subject: msg.Subject,
+		Html:    msg.Html,
+		Text:    msg.Text,
+	}
+	if s.RedirectTo != "" {
+		params.To = []string{s.RedirectTo}
+	}
+	sent, err := s.client.Emails.SendWithContext(ctx, params)
+	if err != nil {
+		return "", err
+	}
+	return sent.Id, nil
+}
+
+// FileEmailSender writes every email as an .eml file into a directory so that
+// developers can open them with any mail client.
+type FileEmailSender struct {
+	Dir string
+}
+
+// NewFileEmailSender creates a sender that writes emails into dir.
+func NewFileEmailSender(dir string) *FileEmailSender {
+	return &FileEmailSender{Dir: dir}
+}
+
+func (s *FileEmailSender) Send(ctx context.Context, msg *EmailMessage) (string, error) {
+	messageID, err := newMessageID(msg.From)
+	if err != nil {
+		return "", err
+	}
+	raw, err := buildMimeMessage(msg, messageID, time.Now())
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405"), strings.SplitN(messageID, "@", 2)[0])
+	path := filepath.Join(s.Dir, name)
+	if err := os.WriteFile(path, raw, 0o644); err != nil {
+		return "", err
+	}
+	log.Info().Str("path", path).Strs("to", msg.To).Str("subject", msg.Subject).Msg("Wrote email to file")
+	return messageID, nil
+}
+
+// ConsoleEmailSender logs emails instead of delivering them.
+type ConsoleEmailSender struct{}
+
+func (s *ConsoleEmailSender) Send(ctx context.Context, msg *EmailMessage) (string, error) {
+	messageID, err := newMessageID(msg.From)
+	if err != nil {
+		return "", err
+	}
+	event := log.Info().
+		Str("message_id", messageID).
+		Str("from", msg.From).
+		Strs("to", msg.To).
+		Str("subject", msg.Subject)
+	// emails without a plain text body still show their content
+	if msg.Text != "" {
+		event = event.Str("text", msg.Text)
+	} else {
+		event = event.Str("html", msg.Html)
+	}
+	event.Msg("Email")
+	return messageID, nil
+}
+
+// newMessageID generates a random Message-ID under the domain of the sender address.
+// The angle brackets are not included.
+func newMessageID(from string) (string, error) {
+	b, err := utils.RandomBytes(16)
+	if err != nil {
+		return "", err
+	}
+	domain := "localhost"
+	if addr, err := mail.ParseAddress(from); err == nil {
+		if i := strings.LastIndex(addr.Address, "@"); i >= 0 {
+			domain = addr.Address[i+1:]
+		}
+	}
+	return hex.EncodeToString(b) + "@" + domain, nil
+}
+
+// buildMimeMessage renders the message as an RFC 5322 email. When both the html
+// and text bodies are set, a multipart/alternative message is created.
+func buildMimeMessage(msg *EmailMessage, messageID string, date time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	header := func(key, value string) {
+		buf.WriteString(key + ": " + value + "\r\n")
+	}
+	header("From", msg.From)
+	header("To", strings.Join(msg.To, ", "))
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header("Date", date.Format(time.RFC1123Z))
+	header("Message-ID", "<"+messageID+">")
+	header("MIME-Version", "1.0")
+
+	if msg.Html == "" || msg.Text == "" {
+		contentType := "text/plain; charset=utf-8"
+		body := msg.Text
+		if msg.Html != "" {
+			contentType = "text/html; charset=utf-8"
+			body = msg.Html
+		}
+		header("Content-Type", contentType)
+		header("Content-Transfer-Encoding", "quoted-printable")
+		buf.WriteString("\r\n")
+		if err := writeQuotedPrintable(&buf, body); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	header("Content-Type", "multipart/alternative; boundary="+w.Boundary())
+	buf.WriteString("\r\n")
+	parts := []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.Html},
+	}
+	for _, p := range parts {
+		pw, err := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {p.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeQuotedPrintable(pw, p.content); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	buf.Write(body.Bytes())
+	return buf.Bytes(), nil
+}
+
+func writeQuotedPrintable(w io.Writer, content string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(content)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
@@ -0,0 +1,227 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/juancwu/konbini/server/config"
+	"github.com/juancwu/konbini/server/db"
+	"github.com/juancwu/konbini/server/memcache"
+	"os"
+	"sync"
+	"time"
+)
+
+// Health check statuses.
+const (
+	HEALTH_STATUS_OK    string = "ok"
+	HEALTH_STATUS_ERROR string = "error"
+)
+
+var (
+	ErrMissingResendApiKey error = errors.New("Resend API key is not set")
+	ErrMissingSMTPHost     error = errors.New("SMTP host is not set")
+	ErrEmailFileDirNotDir  error = errors.New("Email file directory is not a directory")
+	ErrSchemaVersionTooLow error = errors.New("Database schema is behind the server")
+)
+
+// ReadinessCheck is a single dependency check run by the HealthChecker.
+type ReadinessCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+// CheckResult is the outcome of a single readiness check.
+type CheckResult struct {
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// ReadinessReport is the outcome of every readiness check.
+type ReadinessReport struct {
+	Status    string        `json:"status"`
+	Version   string        `json:"version"`
+	CheckedAt string        `json:"checked_at"`
+	Checks    []CheckResult `json:"checks"`
+}
+
+// Ready reports whether every check passed.
+func (r *ReadinessReport) Ready() bool {
+	return r.Status == HEALTH_STATUS_OK
+}
+
+// HealthChecker runs the readiness checks and caches the report for a short time
+// so that frequent probes don't hit the database on every request.
+type HealthChecker struct {
+	checks  []ReadinessCheck
+	version string
+	ttl     time.Duration
+	timeout time.Duration
+
+	mu        sync.Mutex
+	report    *ReadinessReport
+	checkedAt time.Time
+}
+
+// NewHealthChecker creates a checker that caches reports for ttl. Every check
+// gets at most timeout to complete.
+func NewHealthChecker(version string, ttl time.Duration, timeout time.Duration, checks ...ReadinessCheck) *HealthChecker {
+	return &HealthChecker{
+		checks:  checks,
+		version: version,
+		ttl:     ttl,
+		timeout: timeout,
+	}
+}
+
+// Check returns the cached report or runs every check if the cached one expired.
+// Concurrent callers wait for a single run instead of starting their own.
+func (h *HealthChecker) Check(ctx context.Context) ReadinessReport {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.report != nil && time.Since(h.checkedAt) < h.ttl {
+		return *h.report
+	}
+
+	// the report is shared, a probe that disconnects must not fail the checks for everyone
+	ctx = context.WithoutCancel(ctx)
+
+	report := ReadinessReport{
+		Status:  HEALTH_STATUS_OK,
+		Version: h.version,
+		Checks:  make([]CheckResult, len(h.checks)),
+	}
+
+	// checks are independent, run them together so the slowest one sets the latency
+	var wg sync.WaitGroup
+	for i, check := range h.checks {
+		wg.Add(1)
+		go func(i int, check ReadinessCheck) {
+			defer wg.Done()
+			report.Checks[i] = h.run(ctx, check)
+		}(i, check)
+	}
+	wg.Wait()
+
+	for _, result := range report.Checks {
+		if result.Status != HEALTH_STATUS_OK {
+			report.Status = HEALTH_STATUS_ERROR
+		}
+	}
+
+	h.checkedAt = time.Now()
+	report.CheckedAt = h.checkedAt.UTC().Format(time.RFC3339)
+	h.report = &report
+	return report
+}
+
+func (h *HealthChecker) run(ctx context.Context, check ReadinessCheck) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check.Check(ctx)
+	result := CheckResult{
+		Name:       check.Name,
+		Status:     HEALTH_STATUS_OK,
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		result.Status = HEALTH_STATUS_ERROR
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// DatabaseCheck pings the database.
+func DatabaseCheck(connector *db.DBConnector) ReadinessCheck {
+	return ReadinessCheck{
+		Name: "database",
+		Check: func(ctx context.Context) error {
+			conn, err := connector.Connect()
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+			return conn.PingContext(ctx)
+		},
+	}
+}
+
+// MigrationCheck verifies that the database has every migration the server expects.
+// A newer schema is accepted so that the previous release keeps serving during a rollout.
+func MigrationCheck(connector *db.DBConnector, expected int64) ReadinessCheck {
+	return ReadinessCheck{
+		Name: "migrations",
+		Check: func(ctx context.Context) error {
+			conn, err := connector.Connect()
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+			version, err := db.GetMigrationVersion(ctx, conn)
+			if err != nil {
+				return err
+			}
+			if version < expected {
+				return fmt.Errorf("%w: applied version %d, expected %d", ErrSchemaVersionTooLow, version, expected)
+			}
+			return nil
+		},
+	}
+}
+
+// CacheCheck pings the cache backend. In-memory stores are always ready.
+func CacheCheck(store memcache.Store) ReadinessCheck {
+	return ReadinessCheck{
+		Name: "cache",
+		Check: func(ctx context.Context) error {
+			pinger, ok := store.(interface {
+				Ping(ctx context.Context) error
+			})
+			if !ok {
+				return nil
+			}
+			return pinger.Ping(ctx)
+		},
+	}
+}
+
+// EmailTransportCheck verifies that the selected email transport has everything
+// it needs to deliver emails. It does not contact the provider.
+func EmailTransportCheck(cfg *config.Config) ReadinessCheck {
+	return ReadinessCheck{
+		Name: "email_transport",
+		Check: func(ctx context.Context) error {
+			switch cfg.GetEmailTransport() {
+			case config.EMAIL_TRANSPORT_RESEND:
+				if cfg.GetResendApiKey() == "" {
+					return ErrMissingResendApiKey
+				}
+			case config.EMAIL_TRANSPORT_SMTP:
+				if cfg.GetSMTPConfig().Host == "" {
+					return ErrMissingSMTPHost
+				}
+			case config.EMAIL_TRANSPORT_FILE:
+				// the directory is created on the first send
+				info, err := os.Stat(cfg.GetEmailFileDir())
+				if err != nil {
+					if os.IsNotExist(err) {
+						return nil
+					}
+					return err
+				}
+				if !info.IsDir() {
+					return ErrEmailFileDirNotDir
+				}
+			case config.EMAIL_TRANSPORT_CONSOLE:
+			default:
+				return ErrUnknownEmailTransport
+			}
+			return nil
+		},
+	}
+}
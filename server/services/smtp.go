@@ -0,0 +1,127 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"github.com/juancwu/konbini/server/config"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+var ErrSMTPStartTLSUnsupported error = errors.New("SMTP server does not support STARTTLS")
+
+// SMTPEmailSender delivers emails through an SMTP relay. Depending on the TLS mode
+// the connection is upgraded with STARTTLS, wrapped in TLS from the start or left
+// in plain text. PLAIN authentication is used when a username is configured.
+type SMTPEmailSender struct {
+	cfg config.SMTPConfig
+	// TLSConfig overrides the TLS settings used to connect to the relay.
+	// By default the relay certificate is verified against the system roots.
+	TLSConfig *tls.Config
+	// LocalName is the host name sent with EHLO, defaults to "localhost".
+	LocalName string
+}
+
+// NewSMTPEmailSender creates a sender for the given SMTP relay.
+func NewSMTPEmailSender(cfg config.SMTPConfig) *SMTPEmailSender {
+	return &SMTPEmailSender{cfg: cfg}
+}
+
+func (s *SMTPEmailSender) Send(ctx context.Context, msg *EmailMessage) (string, error) {
+	from, err := mail.ParseAddress(msg.From)
+	if err != nil {
+		return "", err
+	}
+	messageID, err := newMessageID(msg.From)
+	if err != nil {
+		return "", err
+	}
+	raw, err := buildMimeMessage(msg, messageID, time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(s.cfg.Host, s.cfg.Port))
+	if err != nil {
+		return "", err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if s.cfg.TLS == config.SMTP_TLS_IMPLICIT {
+		conn = tls.Client(conn, s.tlsConfig())
+	}
+
+	client, err := smtp.NewClient(conn, s.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return "", err
+	}
+	defer client.Close()
+
+	localName := s.LocalName
+	if localName == "" {
+		localName = "localhost"
+	}
+	if err := client.Hello(localName); err != nil {
+		return "", err
+	}
+
+	if s.cfg.TLS == config.SMTP_TLS_STARTTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return "", ErrSMTPStartTLSUnsupported
+		}
+		if err := client.StartTLS(s.tlsConfig()); err != nil {
+			return "", err
+		}
+	}
+
+	if s.cfg.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.cfg.Host)); err != nil {
+			return "", err
+		}
+	}
+
+	if err := client.Mail(from.Address); err != nil {
+		return "", err
+	}
+	for _, to := range msg.To {
+		addr, err := mail.ParseAddress(to)
+		if err != nil {
+			return "", err
+		}
+		if err := client.Rcpt(addr.Address); err != nil {
+			return "", err
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return "", err
+	}
+	if _, err := w.Write(raw); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+
+	// the relay accepted the email with the end of DATA, failing now would send it again
+	if err := client.Quit(); err != nil {
+		log.Warn().Err(err).Str("message_id", messageID).Msg("Failed to quit SMTP session after the email was accepted.")
+	}
+	return messageID, nil
+}
+
+func (s *SMTPEmailSender) tlsConfig() *tls.Config {
+	if s.TLSConfig != nil {
+		return s.TLSConfig.Clone()
+	}
+	return &tls.Config{ServerName: s.cfg.Host}
+}
@@ -1,13 +1,16 @@
 package services
 
 import (
+	"context"
 	"encoding/base64"
 	"errors"
 	"github.com/juancwu/konbini/server/config"
+	"github.com/juancwu/konbini/server/db"
 	"github.com/juancwu/konbini/server/utils"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
 )
 
 type TokenType string
@@ -141,18 +144,27 @@ type EmailToken struct {
 	ExpiresAt time.Time
 }
 
-func NewEmailToken(userId string) (*EmailToken, error) {
+// EMAIL_TOKEN_TTL is how long an email verification link stays valid.
+const EMAIL_TOKEN_TTL time.Duration = 10 * time.Minute
+
+// NewEmailToken creates a new single-use email token for the given user and stores it
+// in the database so that any server instance can verify it.
+func NewEmailToken(ctx context.Context, q *db.Queries, userId string) (*EmailToken, error) {
 	if _, err := uuid.Parse(userId); err != nil {
 		return nil, err
 	}
-	emailTokenId, err := uuid.NewRandom()
+	now := time.Now().UTC()
+	exp := now.Add(EMAIL_TOKEN_TTL)
+	row, err := q.NewEmailToken(ctx, db.NewEmailTokenParams{
+		UserID:    userId,
+		CreatedAt: utils.FormatRFC3339NanoFixed(now),
+		ExpiresAt: utils.FormatRFC3339NanoFixed(exp),
+	})
 	if err != nil {
 		return nil, err
 	}
-	now := time.Now().UTC()
-	exp := now.Add(10 * time.Minute)
 	return &EmailToken{
-		Id:        emailTokenId.String(),
+		Id:        row.ID,
 		UserId:    userId,
 		Hmac:      nil,
 		CreatedAt: now,
@@ -197,3 +209,53 @@ func (t *EmailToken) Package() (string, error) {
 
 	return base64.URLEncoding.EncodeToString(encryptedId), nil
 }
+
+// NewGroupInvitationToken packages the id and expiration of a group invitation into the token sent
+// with the invitation. expiresAt is the expiration as it is stored, AcceptGroupInvitation reads back
+// the 36 bytes of the id and the 30 of the time.
+func NewGroupInvitationToken(invitationId string, expiresAt string, key []byte) (string, error) {
+	token := make([]byte, 66)
+	copy(token[:], []byte(invitationId))
+	copy(token[36:], []byte(expiresAt))
+
+	encrypted, err := utils.EncryptAES(token, key)
+	if err != nil {
+		return "", err
+	}
+	return base64.URLEncoding.EncodeToString(encrypted), nil
+}
+
+// StartEmailTokenCleanup periodically deletes email tokens that have expired or
+// have already been used. It stops when the context is cancelled.
+func StartEmailTokenCleanup(ctx context.Context, connector *db.DBConnector, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			n, err := deleteStaleEmailTokens(ctx, connector)
+			if err != nil {
+				log.Error().Err(err).Msg("Failed to delete stale email tokens")
+				continue
+			}
+			if n > 0 {
+				log.Info().Int64("count", n).Msg("Deleted stale email tokens")
+			}
+		}
+	}()
+}
+
+func deleteStaleEmailTokens(ctx context.Context, connector *db.DBConnector) (int64, error) {
+	conn, err := connector.Connect()
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	return db.New(db.Instrument(conn)).DeleteStaleEmailTokens(ctx, utils.FormatRFC3339NanoFixed(time.Now()))
+}
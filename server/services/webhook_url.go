@@ -0,0 +1,117 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// ErrWebhookAddressNotAllowed is returned for webhooks that point to loopback, private,
+// link-local or other non-public addresses, like the metadata service of a cloud provider.
+var ErrWebhookAddressNotAllowed error = errors.New("Webhook address is not public")
+
+// nonPublicPrefixes are the special purpose ranges that are not covered by the netip checks.
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("2001:db8::/32"),
+}
+
+// IsPublicWebhookIP reports whether webhooks may be delivered to ip.
+func IsPublicWebhookIP(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsValid() ||
+		ip.IsUnspecified() ||
+		ip.IsLoopback() ||
+		ip.IsPrivate() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() {
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidateWebhookURL checks that every address the host of rawURL resolves to is public.
+// Deliveries check the address again when they connect, the host could resolve to another
+// address by then.
+func ValidateWebhookURL(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%w: unsupported scheme %q", ErrWebhookAddressNotAllowed, u.Scheme)
+	}
+	host := u.Hostname()
+	if ip, err := netip.ParseAddr(host); err == nil {
+		if !IsPublicWebhookIP(ip) {
+			return fmt.Errorf("%w: %s", ErrWebhookAddressNotAllowed, host)
+		}
+		return nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return fmt.Errorf("Failed to resolve webhook host %s: %w", host, err)
+	}
+	for _, addr := range addrs {
+		if !IsPublicWebhookIP(addr) {
+			return fmt.Errorf("%w: %s resolves to %s", ErrWebhookAddressNotAllowed, host, addr.Unmap())
+		}
+	}
+	return nil
+}
+
+// webhookDialControl refuses connections to non-public addresses. It runs after the host was
+// resolved, so a host that resolves to a public address when the webhook is created and to a
+// private one later is still refused.
+func webhookDialControl(network string, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !IsPublicWebhookIP(addrPort.Addr()) {
+		return fmt.Errorf("%w: %s", ErrWebhookAddressNotAllowed, addrPort.Addr().Unmap())
+	}
+	return nil
+}
+
+// NewWebhookHTTPClient creates the client used to deliver webhooks. It only connects to public
+// addresses, does not use proxies from the environment and does not follow redirects, since a
+// redirect could send the signed payload somewhere the owner did not choose.
+func NewWebhookHTTPClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   time.Second * 10,
+		KeepAlive: time.Second * 30,
+		Control:   webhookDialControl,
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
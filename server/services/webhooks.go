@@ -0,0 +1,504 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	commonApi "github.com/juancwu/konbini/common/api"
+	"github.com/juancwu/konbini/server/db"
+	"github.com/juancwu/konbini/server/events"
+	"github.com/juancwu/konbini/server/jobs"
+	"github.com/juancwu/konbini/server/metrics"
+	"github.com/juancwu/konbini/server/tracing"
+	"github.com/juancwu/konbini/server/utils"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Webhook delivery statuses as stored in the webhook_deliveries table.
+const (
+	WEBHOOK_DELIVERY_PENDING    string = "pending"
+	WEBHOOK_DELIVERY_PROCESSING string = "processing"
+	WEBHOOK_DELIVERY_DELIVERED  string = "delivered"
+	WEBHOOK_DELIVERY_DEAD       string = "dead"
+)
+
+const (
+	// WEBHOOK_SECRET_SIZE is the number of random bytes in the secret of a webhook.
+	WEBHOOK_SECRET_SIZE uint32 = 32
+	// WEBHOOK_USER_AGENT is sent with every delivery.
+	WEBHOOK_USER_AGENT string = "Konbini-Webhook/1.0"
+	// maxWebhookResponseBody is how much of the body of a response is read before closing it.
+	maxWebhookResponseBody int64 = 512
+)
+
+// WebhookDelivery is a claimed delivery with the target of its webhook.
+type WebhookDelivery struct {
+	db.WebhookDelivery
+	URL string
+	// Secret is the decrypted secret of the webhook.
+	Secret []byte
+	// LoadError is set when the delivery was claimed but its webhook could not be loaded,
+	// the delivery is failed without being sent.
+	LoadError error
+}
+
+// WebhookDeliveryStore persists webhook deliveries. The result of an attempt is the status of
+// the response, 0 when there was no response.
+type WebhookDeliveryStore interface {
+	jobs.Store[WebhookDelivery, int]
+	Enqueue(ctx context.Context, webhookID string, eventID string, eventType string, payload string, maxAttempts int, runAt time.Time) (string, error)
+}
+
+// WebhookQueueConfig configures the worker pool of a WebhookQueue.
+type WebhookQueueConfig struct {
+	Workers      int
+	MaxAttempts  int
+	PollInterval time.Duration
+	Lease        time.Duration
+	Timeout      time.Duration
+	BaseBackoff  time.Duration
+	MaxBackoff   time.Duration
+}
+
+// DefaultWebhookQueueConfig returns the configuration used by the server.
+func DefaultWebhookQueueConfig() WebhookQueueConfig {
+	return WebhookQueueConfig{
+		Workers:      2,
+		MaxAttempts:  8,
+		PollInterval: time.Second * 5,
+		Lease:        time.Minute,
+		Timeout:      time.Second * 10,
+		BaseBackoff:  time.Second * 10,
+		MaxBackoff:   time.Hour,
+	}
+}
+
+// WebhookQueue delivers events to webhooks. Deliveries are persisted by a WebhookDeliveryStore
+// and sent by a pool of workers that retry with exponential backoff. Every attempt is kept
+// in the delivery log of the webhook.
+type WebhookQueue struct {
+	store      WebhookDeliveryStore
+	httpClient *http.Client
+	cfg        WebhookQueueConfig
+	worker     *jobs.Worker[WebhookDelivery, int]
+}
+
+// NewWebhookQueue creates a new webhook queue. The client of NewWebhookHTTPClient, that only
+// connects to public addresses, is used when httpClient is nil. Call Start to begin delivering events.
+func NewWebhookQueue(store WebhookDeliveryStore, httpClient *http.Client, cfg WebhookQueueConfig) *WebhookQueue {
+	defaults := DefaultWebhookQueueConfig()
+	if cfg.Workers <= 0 {
+		cfg.Workers = defaults.Workers
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = defaults.MaxAttempts
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = defaults.PollInterval
+	}
+	if cfg.Lease <= 0 {
+		cfg.Lease = defaults.Lease
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaults.Timeout
+	}
+	if cfg.BaseBackoff <= 0 {
+		cfg.BaseBackoff = defaults.BaseBackoff
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = defaults.MaxBackoff
+	}
+	if httpClient == nil {
+		httpClient = NewWebhookHTTPClient()
+	}
+	q := &WebhookQueue{
+		store:      store,
+		httpClient: httpClient,
+		cfg:        cfg,
+	}
+	q.worker = jobs.NewWorker("webhook", store, jobs.Config{
+		Workers:      cfg.Workers,
+		PollInterval: cfg.PollInterval,
+		Lease:        cfg.Lease,
+		Timeout:      cfg.Timeout,
+		BaseBackoff:  cfg.BaseBackoff,
+		MaxBackoff:   cfg.MaxBackoff,
+	}, q.deliver)
+	q.worker.Log = func(delivery WebhookDelivery, logger zerolog.Context) zerolog.Context {
+		return logger.Str("webhook_id", delivery.WebhookID)
+	}
+	q.worker.Observe = func(_ WebhookDelivery, _ int, outcome jobs.Outcome) {
+		switch outcome {
+		case jobs.OUTCOME_DONE:
+			metrics.WebhookDelivery(metrics.WEBHOOK_DELIVERED)
+		case jobs.OUTCOME_RETRY:
+			metrics.WebhookDelivery(metrics.WEBHOOK_RETRY)
+		case jobs.OUTCOME_DEAD:
+			metrics.WebhookDelivery(metrics.WEBHOOK_DEAD)
+		}
+	}
+	return q
+}
+
+// Publish queues an event for every webhook that is subscribed to its type. It returns the number of deliveries queued.
+// The event id is sent in the body so that receivers can ignore an event they got before, a new one is generated when it is empty.
+func (q *WebhookQueue) Publish(ctx context.Context, eventID string, webhooks []db.Webhook, eventType string, data any) (int, error) {
+	subscribed := []db.Webhook{}
+	for _, webhook := range webhooks {
+		events, err := WebhookEvents(webhook)
+		if err != nil {
+			return 0, err
+		}
+		for _, event := range events {
+			if event == eventType {
+				subscribed = append(subscribed, webhook)
+				break
+			}
+		}
+	}
+	if len(subscribed) == 0 {
+		return 0, nil
+	}
+
+	event, payload, err := newWebhookEvent(eventID, eventType, data)
+	if err != nil {
+		return 0, err
+	}
+	for i, webhook := range subscribed {
+		if _, err := q.store.Enqueue(ctx, webhook.ID, event.ID, eventType, payload, q.cfg.MaxAttempts, time.Now()); err != nil {
+			return i, err
+		}
+	}
+	q.worker.Nudge()
+	return len(subscribed), nil
+}
+
+// SendTest queues a test event for a webhook regardless of the events it is subscribed to.
+func (q *WebhookQueue) SendTest(ctx context.Context, webhookID string) (string, error) {
+	event, payload, err := newWebhookEvent("", commonApi.WebhookEventTest, commonApi.WebhookTestData{WebhookID: webhookID})
+	if err != nil {
+		return "", err
+	}
+	id, err := q.store.Enqueue(ctx, webhookID, event.ID, event.Type, payload, q.cfg.MaxAttempts, time.Now())
+	if err != nil {
+		return "", err
+	}
+	q.worker.Nudge()
+	return id, nil
+}
+
+// Start launches the worker pool. Workers stop when the context is cancelled or Stop is called.
+func (q *WebhookQueue) Start(ctx context.Context) {
+	q.worker.Start(ctx)
+}
+
+// Stop stops all workers and waits for in-flight deliveries to finish.
+func (q *WebhookQueue) Stop() {
+	q.worker.Stop()
+}
+
+// deliver sends the signed event to the webhook. It returns the status of the response, 0 if there was none.
+func (q *WebhookQueue) deliver(ctx context.Context, delivery WebhookDelivery) (int, error) {
+	ctx, span := tracing.Start(ctx, "webhook.deliver",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("webhook.id", delivery.WebhookID),
+			attribute.String("webhook.delivery_id", delivery.ID),
+			attribute.String("webhook.event", delivery.EventType),
+			attribute.Int64("webhook.attempt", delivery.Attempts),
+		),
+	)
+	defer span.End()
+
+	if delivery.LoadError != nil {
+		tracing.RecordError(span, delivery.LoadError)
+		return 0, jobs.Permanent(delivery.LoadError)
+	}
+
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(body))
+	if err != nil {
+		tracing.RecordError(span, err)
+		return 0, err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set(commonApi.HeaderContentType, commonApi.MimeApplicationJson)
+	req.Header.Set("User-Agent", WEBHOOK_USER_AGENT)
+	req.Header.Set(commonApi.HeaderWebhookEvent, delivery.EventType)
+	req.Header.Set(commonApi.HeaderWebhookDelivery, delivery.ID)
+	req.Header.Set(commonApi.HeaderWebhookTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(commonApi.HeaderWebhookSignature, SignWebhook(delivery.Secret, timestamp, body))
+
+	res, err := q.httpClient.Do(req)
+	if err != nil {
+		tracing.RecordError(span, err)
+		if errors.Is(err, ErrWebhookAddressNotAllowed) {
+			return 0, ErrWebhookAddressNotAllowed
+		}
+		// the error of the client can have details of the network of the server
+		if os.IsTimeout(err) {
+			return 0, errors.New("Webhook request timed out")
+		}
+		return 0, errors.New("Webhook request failed")
+	}
+	defer res.Body.Close()
+	span.SetAttributes(attribute.Int("http.response.status_code", res.StatusCode))
+
+	// the body is never kept, the delivery log is shown to the owner of the webhook and must
+	// not become a way to read responses of other servers
+	io.Copy(io.Discard, io.LimitReader(res.Body, maxWebhookResponseBody))
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		err := fmt.Errorf("Webhook responded with status %d", res.StatusCode)
+		tracing.RecordError(span, err)
+		return res.StatusCode, err
+	}
+	return res.StatusCode, nil
+}
+
+// SignWebhook signs the body of a delivery with the secret of the webhook. The timestamp is part
+// of the signature so that a captured delivery cannot be replayed later with a new timestamp.
+func SignWebhook(secret []byte, timestamp int64, body []byte) string {
+	message := append([]byte(strconv.FormatInt(timestamp, 10)+"."), body...)
+	return "sha256=" + hex.EncodeToString(utils.CreateHMAC(message, secret))
+}
+
+// VerifyWebhookSignature checks the signature of a delivery and that it was sent within tolerance of now.
+func VerifyWebhookSignature(secret []byte, timestamp string, body []byte, signature string, tolerance time.Duration, now time.Time) bool {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	age := now.Sub(time.Unix(ts, 0))
+	if age > tolerance || age < -tolerance {
+		return false
+	}
+	if len(signature) < len("sha256=") || signature[:len("sha256=")] != "sha256=" {
+		return false
+	}
+	mac, err := hex.DecodeString(signature[len("sha256="):])
+	if err != nil {
+		return false
+	}
+	message := append([]byte(timestamp+"."), body...)
+	return utils.VerifyHMAC(message, secret, mac)
+}
+
+// NewWebhookSecret generates the secret of a new webhook.
+func NewWebhookSecret() (string, error) {
+	b, err := utils.RandomBytes(WEBHOOK_SECRET_SIZE)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// WebhookEvents gets the event types a webhook is subscribed to.
+func WebhookEvents(webhook db.Webhook) ([]string, error) {
+	events := []string{}
+	if err := json.Unmarshal([]byte(webhook.Events), &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func newWebhookEvent(id string, eventType string, data any) (commonApi.WebhookEvent, string, error) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return commonApi.WebhookEvent{}, "", err
+	}
+	if id == "" {
+		id = uuid.NewString()
+	}
+	event := commonApi.WebhookEvent{
+		ID:        id,
+		Type:      eventType,
+		CreatedAt: utils.FormatRFC3339NanoFixed(time.Now()),
+		Data:      b,
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return commonApi.WebhookEvent{}, "", err
+	}
+	return event, string(payload), nil
+}
+
+// SubscribeWebhooks forwards the events of the bus to the webhooks that are subscribed to them.
+// The id of a bus event is reused for the webhook event so a retried dispatch is recognizable.
+func SubscribeWebhooks(bus *events.Bus, connector *db.DBConnector, queue *WebhookQueue) {
+	events.SubscribeAsync(bus, "webhooks", func(ctx context.Context, e events.BentoIngredientChanged) error {
+		return publishWebhookEvent(ctx, connector, queue, commonApi.WebhookEventBentoIngredientsChanged, commonApi.BentoIngredientsChangedData{
+			BentoID:     e.BentoID,
+			Revision:    e.Revision,
+			Action:      e.Action,
+			Ingredients: e.Ingredients,
+			UserID:      e.UserID,
+		}, func(q *db.Queries) ([]db.Webhook, error) {
+			return q.ListBentoWebhooks(ctx, &e.BentoID)
+		})
+	})
+	events.SubscribeAsync(bus, "webhooks", func(ctx context.Context, e events.GroupMemberAdded) error {
+		return publishWebhookEvent(ctx, connector, queue, commonApi.WebhookEventGroupMemberJoined, commonApi.GroupMemberJoinedData{
+			GroupID: e.GroupID,
+			UserID:  e.UserID,
+		}, func(q *db.Queries) ([]db.Webhook, error) {
+			return q.ListGroupWebhooks(ctx, &e.GroupID)
+		})
+	})
+	events.SubscribeAsync(bus, "webhooks", func(ctx context.Context, e events.TOTPRemoved) error {
+		return publishWebhookEvent(ctx, connector, queue, commonApi.WebhookEventTOTPRemoved, commonApi.TOTPRemovedData{
+			UserID: e.UserID,
+		}, func(q *db.Queries) ([]db.Webhook, error) {
+			return q.ListWebhooksOfUserGroups(ctx, e.UserID)
+		})
+	})
+}
+
+func publishWebhookEvent(ctx context.Context, connector *db.DBConnector, queue *WebhookQueue, eventType string, data any, list func(q *db.Queries) ([]db.Webhook, error)) error {
+	conn, err := connector.Connect()
+	if err != nil {
+		return err
+	}
+	webhooks, err := list(db.New(db.Instrument(conn)))
+	conn.Close()
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	_, err = queue.Publish(ctx, events.EventID(ctx), webhooks, eventType, data)
+	return err
+}
+
+// DBWebhookDeliveryStore is a WebhookDeliveryStore backed by the webhook_deliveries table.
+type DBWebhookDeliveryStore struct {
+	connector *db.DBConnector
+	aesKey    []byte
+}
+
+// NewDBWebhookDeliveryStore creates a WebhookDeliveryStore that uses the given connector.
+// The AES key decrypts the secrets of the webhooks.
+func NewDBWebhookDeliveryStore(connector *db.DBConnector, aesKey []byte) *DBWebhookDeliveryStore {
+	return &DBWebhookDeliveryStore{connector: connector, aesKey: aesKey}
+}
+
+func (s *DBWebhookDeliveryStore) Enqueue(ctx context.Context, webhookID string, eventID string, eventType string, payload string, maxAttempts int, runAt time.Time) (string, error) {
+	conn, err := s.connector.Connect()
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	now := utils.FormatRFC3339NanoFixed(time.Now())
+	return db.New(db.Instrument(conn)).NewWebhookDelivery(ctx, db.NewWebhookDeliveryParams{
+		WebhookID:   webhookID,
+		EventID:     eventID,
+		EventType:   eventType,
+		Payload:     payload,
+		MaxAttempts: int64(maxAttempts),
+		RunAt:       utils.FormatRFC3339NanoFixed(runAt),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	})
+}
+
+func (s *DBWebhookDeliveryStore) Claim(ctx context.Context, now time.Time, lease time.Duration) (WebhookDelivery, error) {
+	conn, err := s.connector.Connect()
+	if err != nil {
+		return WebhookDelivery{}, err
+	}
+	defer conn.Close()
+
+	q := db.New(db.Instrument(conn))
+	lockedUntil := utils.FormatRFC3339NanoFixed(now.Add(lease))
+	delivery, err := q.ClaimWebhookDelivery(ctx, db.ClaimWebhookDeliveryParams{
+		LockedUntil: &lockedUntil,
+		UpdatedAt:   utils.FormatRFC3339NanoFixed(now),
+		Now:         utils.FormatRFC3339NanoFixed(now),
+	})
+	if err != nil {
+		return WebhookDelivery{}, err
+	}
+
+	// the delivery is already claimed, it is returned with the error so the worker fails it
+	// instead of leaving it locked until the lease expires
+	webhook, err := q.GetWebhookByID(ctx, delivery.WebhookID)
+	if err != nil {
+		return WebhookDelivery{WebhookDelivery: delivery, LoadError: fmt.Errorf("Failed to get webhook: %w", err)}, nil
+	}
+	secret, err := utils.DecryptAES(webhook.Secret, s.aesKey)
+	if err != nil {
+		return WebhookDelivery{WebhookDelivery: delivery, LoadError: fmt.Errorf("Failed to decrypt webhook secret: %w", err)}, nil
+	}
+	return WebhookDelivery{WebhookDelivery: delivery, URL: webhook.Url, Secret: secret}, nil
+}
+
+func (s *DBWebhookDeliveryStore) Complete(ctx context.Context, id string, lease string, responseStatus int) error {
+	conn, err := s.connector.Connect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	now := utils.FormatRFC3339NanoFixed(time.Now())
+	return jobs.LeaseHeld(db.New(db.Instrument(conn)).CompleteWebhookDelivery(ctx, db.CompleteWebhookDeliveryParams{
+		ResponseStatus: responseStatusParam(responseStatus),
+		DeliveredAt:    &now,
+		UpdatedAt:      now,
+		ID:             id,
+		LockedUntil:    &lease,
+	}))
+}
+
+func (s *DBWebhookDeliveryStore) Retry(ctx context.Context, id string, lease string, runAt time.Time, responseStatus int, lastError string) error {
+	conn, err := s.connector.Connect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return jobs.LeaseHeld(db.New(db.Instrument(conn)).RetryWebhookDelivery(ctx, db.RetryWebhookDeliveryParams{
+		ResponseStatus: responseStatusParam(responseStatus),
+		LastError:      &lastError,
+		RunAt:          utils.FormatRFC3339NanoFixed(runAt),
+		UpdatedAt:      utils.FormatRFC3339NanoFixed(time.Now()),
+		ID:             id,
+		LockedUntil:    &lease,
+	}))
+}
+
+func (s *DBWebhookDeliveryStore) Bury(ctx context.Context, id string, lease string, responseStatus int, lastError string) error {
+	conn, err := s.connector.Connect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return jobs.LeaseHeld(db.New(db.Instrument(conn)).BuryWebhookDelivery(ctx, db.BuryWebhookDeliveryParams{
+		ResponseStatus: responseStatusParam(responseStatus),
+		LastError:      &lastError,
+		UpdatedAt:      utils.FormatRFC3339NanoFixed(time.Now()),
+		ID:             id,
+		LockedUntil:    &lease,
+	}))
+}
+
+// responseStatusParam stores a missing response as NULL.
+func responseStatusParam(status int) *int64 {
+	if status == 0 {
+		return nil
+	}
+	s := int64(status)
+	return &s
+}
@@ -0,0 +1,134 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/juancwu/konbini/common/api"
+	"github.com/juancwu/konbini/server/db"
+	"github.com/juancwu/konbini/server/handlers"
+	"github.com/juancwu/konbini/server/services"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBentoNotifier(t *testing.T) {
+	notifier := services.NewBentoNotifier()
+
+	updates, unsubscribe := notifier.Subscribe("b1")
+	other, unsubscribeOther := notifier.Subscribe("b2")
+	defer unsubscribeOther()
+	require.Equal(t, 1, notifier.Watchers("b1"))
+
+	// a slow watcher only gets the latest revision
+	notifier.Publish("b1", 2)
+	notifier.Publish("b1", 3)
+	require.Equal(t, int64(3), <-updates)
+	select {
+	case <-other:
+		t.Fatal("watcher of another bento was notified")
+	default:
+	}
+
+	unsubscribe()
+	unsubscribe()
+	require.Equal(t, 0, notifier.Watchers("b1"))
+	notifier.Publish("b1", 4)
+}
+
+func TestBentoChangesRejectInvalidRevisions(t *testing.T) {
+	for name, handler := range map[string]echo.HandlerFunc{
+		"changes": handlers.GetBentoChanges(nil),
+		"events":  handlers.WatchBento(nil, services.NewBentoNotifier(), time.Second),
+	} {
+		t.Run(name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodGet, "/bento/b1/changes?since=-1", nil)
+			c := e.NewContext(req, httptest.NewRecorder())
+			c.SetParamNames("id")
+			c.SetParamValues("b1")
+			c.Set("user", db.User{ID: "u1"})
+
+			var apiErr handlers.APIError
+			require.ErrorAs(t, handler(c), &apiErr)
+			require.Equal(t, http.StatusBadRequest, apiErr.Code)
+		})
+	}
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/bento/b1/changes?limit=1000", nil)
+	c := e.NewContext(req, httptest.NewRecorder())
+	c.Set("user", db.User{ID: "u1"})
+	var apiErr handlers.APIError
+	require.ErrorAs(t, handlers.GetBentoChanges(nil)(c), &apiErr)
+	require.Equal(t, http.StatusBadRequest, apiErr.Code)
+}
+
+func TestBentoEventsAreDocumented(t *testing.T) {
+	doc := getOpenAPIDocument(t, newV1Echo())
+
+	events := doc.Paths["/bento/{id}/events"]["get"]
+	require.NotNil(t, events)
+	require.Contains(t, events.Responses["200"].Content, "text/event-stream")
+
+	changes := doc.Paths["/bento/{id}/changes"]["get"]
+	require.NotNil(t, changes)
+	require.Contains(t, changes.Responses["200"].Content, echo.MIMEApplicationJSON)
+}
+
+func TestClientWatchBento(t *testing.T) {
+	t.Run("reconnects after the last event", func(t *testing.T) {
+		var calls int32
+		var lastEventIDs []string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, "/bento/b1/events", r.URL.Path)
+			require.Equal(t, "Bearer token", r.Header.Get(api.HeaderAuthorization))
+			lastEventIDs = append(lastEventIDs, r.Header.Get(api.HeaderLastEventID))
+
+			w.Header().Set(echo.HeaderContentType, api.MimeTextEventStream)
+			if atomic.AddInt32(&calls, 1) == 1 {
+				fmt.Fprint(w, "retry: 10\n\n: keep-alive\n\n")
+				fmt.Fprint(w, "id: 2\nevent: change\ndata: {\"revision\":2,\"action\":\"add\",\"ingredients\":[\"A\"]}\n\n")
+				// the connection drops
+				return
+			}
+			fmt.Fprint(w, "id: 3\nevent: change\ndata: {\"revision\":3,\"action\":\"remove\",\"ingredients\":[\"A\"]}\n\n")
+		}))
+		defer srv.Close()
+
+		stop := errors.New("stop")
+		got := []api.BentoChange{}
+		client := api.NewClient(srv.URL, api.WithToken("token"))
+		err := client.WatchBento(context.Background(), "b1", 1, func(change api.BentoChange) error {
+			got = append(got, change)
+			if change.Revision == 3 {
+				return stop
+			}
+			return nil
+		})
+		require.ErrorIs(t, err, stop)
+		require.Equal(t, []string{"1", "2"}, lastEventIDs)
+		require.Equal(t, []api.BentoChange{
+			{Revision: 2, Action: api.BentoChangeAdd, Ingredients: []string{"A"}},
+			{Revision: 3, Action: api.BentoChangeRemove, Ingredients: []string{"A"}},
+		}, got)
+	})
+
+	t.Run("stops on client errors", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"code":404,"error_code":"bento_not_found","message":"Bento not found"}`)
+		}))
+		defer srv.Close()
+
+		err := api.NewClient(srv.URL).WatchBento(context.Background(), "b1", 0, func(api.BentoChange) error { return nil })
+		require.True(t, api.IsErrorCode(err, api.ErrorCodeBentoNotFound))
+	})
+}
@@ -0,0 +1,167 @@
+package test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/juancwu/konbini/common/api"
+	"github.com/juancwu/konbini/server/db"
+	"github.com/juancwu/konbini/server/events"
+	"github.com/juancwu/konbini/server/handlers"
+	"github.com/juancwu/konbini/server/permission"
+	"github.com/juancwu/konbini/server/services"
+	"github.com/juancwu/konbini/server/utils"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeleteBento(t *testing.T) {
+	connector := newTestDB(t)
+	ctx := context.Background()
+	conn, err := connector.Connect()
+	require.NoError(t, err)
+	defer conn.Close()
+	q := db.New(conn)
+	now := utils.FormatRFC3339NanoFixed(time.Now())
+
+	ownerID := newTestUser(t, connector, "owner@mail.com")
+	readerID := newTestUser(t, connector, "reader@mail.com")
+	strangerID := newTestUser(t, connector, "stranger@mail.com")
+
+	bento, err := q.NewBento(ctx, db.NewBentoParams{UserID: ownerID, Name: "prod", CreatedAt: now, UpdatedAt: now})
+	require.NoError(t, err)
+	for userID, perms := range map[string]uint64{
+		ownerID:  permission.GetBentoOwnerPermissions(),
+		readerID: permission.Read,
+	} {
+		require.NoError(t, q.NewBentoPermission(ctx, db.NewBentoPermissionParams{
+			UserID:    userID,
+			BentoID:   bento.ID,
+			Bytes:     permission.ToBytes(perms),
+			CreatedAt: now,
+			UpdatedAt: now,
+		}))
+	}
+	require.NoError(t, q.AddIngredientToBento(ctx, db.AddIngredientToBentoParams{
+		BentoID:   bento.ID,
+		Name:      "API_KEY",
+		Value:     []byte("secret"),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}))
+	require.NoError(t, q.NewBentoChange(ctx, db.NewBentoChangeParams{
+		BentoID:     bento.ID,
+		Revision:    bento.Revision,
+		UserID:      ownerID,
+		Action:      api.BentoChangeAdd,
+		Ingredients: `["API_KEY"]`,
+		CreatedAt:   now,
+	}))
+
+	require.NoError(t, q.NewBentoReveal(ctx, db.NewBentoRevealParams{
+		BentoID:     bento.ID,
+		UserID:      ownerID,
+		Ingredients: `["API_KEY"]`,
+		Ip:          "127.0.0.1",
+		UserAgent:   "konbi",
+		CreatedAt:   now,
+	}))
+
+	// collect the changes published while the bento is deleted
+	published := []events.BentoIngredientChanged{}
+	bus := events.NewBus(nil, events.DefaultBusConfig())
+	events.Subscribe(bus, func(_ context.Context, _ *db.Queries, e events.BentoIngredientChanged) error {
+		published = append(published, e)
+		return nil
+	})
+	defaultBus := events.DefaultBus()
+	events.SetDefaultBus(bus)
+	t.Cleanup(func() { events.SetDefaultBus(defaultBus) })
+
+	// the user is set like the Protect middleware does
+	e := echo.New()
+	e.HTTPErrorHandler = handlers.ErrorHandler()
+	e.DELETE(api.UriBentoByID, handlers.DeleteBento(connector), func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set("user", db.User{ID: c.Request().Header.Get("X-User")})
+			return next(c)
+		}
+	})
+	deleteBento := func(userID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodDelete, "/bento/"+bento.ID, nil)
+		req.Header.Set("X-User", userID)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	count := func(table string) int {
+		var n int
+		require.NoError(t, conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+table+" WHERE bento_id = ?", bento.ID).Scan(&n))
+		return n
+	}
+
+	t.Run("hides bentos the user cannot read", func(t *testing.T) {
+		rec := deleteBento(strangerID)
+		require.Equal(t, http.StatusNotFound, rec.Code)
+		require.Equal(t, api.ErrorCodeBentoNotFound, errorCode(t, rec))
+	})
+
+	t.Run("requires the delete permission", func(t *testing.T) {
+		rec := deleteBento(readerID)
+		require.Equal(t, http.StatusForbidden, rec.Code)
+		require.Equal(t, api.ErrorCodeForbidden, errorCode(t, rec))
+		require.Equal(t, 1, count("bento_ingredients"))
+	})
+
+	t.Run("deletes the ingredients, permissions and changes", func(t *testing.T) {
+		updates, unsubscribe := services.DefaultBentoNotifier().Subscribe(bento.ID)
+		defer unsubscribe()
+
+		require.Equal(t, http.StatusOK, deleteBento(ownerID).Code)
+
+		// watchers and subscribers see the ingredients removed
+		select {
+		case revision := <-updates:
+			require.Equal(t, bento.Revision+1, revision)
+		default:
+			t.Fatal("watchers were not notified")
+		}
+		require.Equal(t, []events.BentoIngredientChanged{{
+			BentoID:     bento.ID,
+			Revision:    bento.Revision + 1,
+			Action:      api.BentoChangeRemove,
+			Ingredients: []string{"API_KEY"},
+			UserID:      ownerID,
+		}}, published)
+
+		_, err := q.GetBentoWithIDOwnedByUser(ctx, db.GetBentoWithIDOwnedByUserParams{ID: bento.ID, UserID: ownerID})
+		require.ErrorIs(t, err, sql.ErrNoRows)
+		require.Equal(t, 0, count("bento_ingredients"))
+		require.Equal(t, 0, count("bento_permissions"))
+		require.Equal(t, 0, count("bento_changes"))
+
+		rec := deleteBento(ownerID)
+		require.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("keeps the reveals for administrators", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(http.MethodGet, "/admin/bentos/"+bento.ID+"/reveals", nil), rec)
+		c.SetParamNames("id")
+		c.SetParamValues(bento.ID)
+		require.NoError(t, handlers.ListAdminBentoReveals(connector)(c))
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var res api.BentoRevealsResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+		require.Equal(t, bento.ID, res.BentoID)
+		require.Len(t, res.Reveals, 1)
+		require.Equal(t, []string{"API_KEY"}, res.Reveals[0].Ingredients)
+		require.Equal(t, ownerID, res.Reveals[0].UserID)
+	})
+}
@@ -0,0 +1,46 @@
+package test
+
+import (
+	"github.com/juancwu/konbini/common/api"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBentoETag(t *testing.T) {
+	etag := api.BentoETag(42)
+	require.Equal(t, `"42"`, etag)
+
+	revision, err := api.ParseBentoETag(etag)
+	require.NoError(t, err)
+	require.Equal(t, int64(42), revision)
+
+	revision, err = api.ParseBentoETag(`W/"7"`)
+	require.NoError(t, err)
+	require.Equal(t, int64(7), revision)
+
+	for _, invalid := range []string{"", "42", `"abc"`, `"0"`, `"-1"`} {
+		_, err := api.ParseBentoETag(invalid)
+		require.ErrorIs(t, err, api.ErrInvalidETag, invalid)
+	}
+
+	require.Equal(t, api.ErrorCodePreconditionFailed, api.ErrorCodeFromStatus(http.StatusPreconditionFailed))
+}
+
+func TestBentoConditionalRoutesAreDocumented(t *testing.T) {
+	doc := getOpenAPIDocument(t, newV1Echo())
+
+	for _, method := range []string{"post", "delete"} {
+		op := doc.Paths[api.UriBentoIngredients][method]
+		require.Contains(t, op.Responses, "412", method)
+
+		found := false
+		for _, param := range op.Parameters {
+			found = found || (param.Name == api.HeaderIfMatch && param.In == "header")
+		}
+		require.True(t, found, method)
+		require.Contains(t, op.Responses["200"].Headers, api.HeaderETag, method)
+	}
+	require.Contains(t, doc.Paths[api.UriBento]["get"].Responses["200"].Headers, api.HeaderETag)
+}
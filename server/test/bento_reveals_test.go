@@ -0,0 +1,124 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/juancwu/konbini/common/api"
+	"github.com/juancwu/konbini/server/db"
+	"github.com/juancwu/konbini/server/events"
+	"github.com/juancwu/konbini/server/handlers"
+	"github.com/juancwu/konbini/server/services"
+	"github.com/juancwu/konbini/server/utils"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientBentoReveals(t *testing.T) {
+	var got []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Method+" "+r.URL.RequestURI())
+		if r.Method == http.MethodPost {
+			var body api.RevealIngredientsRequest
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			require.Equal(t, []string{"API_KEY"}, body.Ingredients)
+			w.Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			w.Write([]byte(`{"bento_id":"b1","name":"prod","revision":3,"ingredients":[{"id":"i1","name":"API_KEY","value":"secret"}],"masked":false}`))
+			return
+		}
+		w.Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		w.Write([]byte(`{"bento_id":"b1","reveals":[{"id":"r1","ingredients":["API_KEY"],"user_id":"u1","ip":"127.0.0.1","user_agent":"konbi","created_at":"2025-03-14T12:00:00Z"}]}`))
+	}))
+	defer srv.Close()
+
+	client := api.NewClient(srv.URL, api.WithToken("token"))
+	bento, err := client.RevealIngredients(context.Background(), "b1", []string{"API_KEY"})
+	require.NoError(t, err)
+	require.False(t, bento.Masked)
+	require.Equal(t, []api.BentoIngredient{{ID: "i1", Name: "API_KEY", Value: "secret"}}, bento.Ingredients)
+	res, err := client.ListBentoReveals(context.Background(), "b1", 10)
+	require.NoError(t, err)
+	require.Equal(t, []api.BentoReveal{{
+		ID:          "r1",
+		Ingredients: []string{"API_KEY"},
+		UserID:      "u1",
+		IP:          "127.0.0.1",
+		UserAgent:   "konbi",
+		CreatedAt:   "2025-03-14T12:00:00Z",
+	}}, res.Reveals)
+	require.Equal(t, []string{
+		"POST /bento/b1/reveals",
+		"GET /bento/b1/reveals?limit=10",
+	}, got)
+}
+
+func TestBentoReveals(t *testing.T) {
+	t.Run("reveals all the ingredients without names", func(t *testing.T) {
+		code, _ := postValidated(t, reflect.TypeOf(api.RevealIngredientsRequest{}), `{}`)
+		require.Equal(t, http.StatusOK, code)
+		code, _ = postValidated(t, reflect.TypeOf(api.RevealIngredientsRequest{}), `{"ingredients":[]}`)
+		require.Equal(t, http.StatusOK, code)
+
+		code, errRes := postValidated(t, reflect.TypeOf(api.RevealIngredientsRequest{}), `{"ingredients":["API_KEY",""]}`)
+		require.Equal(t, http.StatusBadRequest, code)
+		require.Len(t, errRes.Errors, 1)
+		require.Equal(t, "ingredients[1]", errRes.Errors[0].Field)
+	})
+
+	t.Run("rejects invalid limits", func(t *testing.T) {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/bento/b1/reveals?limit=1000", nil)
+		c := e.NewContext(req, httptest.NewRecorder())
+		c.Set("user", db.User{ID: "u1"})
+		var apiErr handlers.APIError
+		require.ErrorAs(t, handlers.ListBentoReveals(nil)(c), &apiErr)
+		require.Equal(t, http.StatusBadRequest, apiErr.Code)
+	})
+
+	t.Run("records the reveals published to the bus", func(t *testing.T) {
+		connector := newTestDB(t)
+		ctx := context.Background()
+		conn, err := connector.Connect()
+		require.NoError(t, err)
+		defer conn.Close()
+		q := db.New(conn)
+		now := utils.FormatRFC3339NanoFixed(time.Now())
+
+		userID := newTestUser(t, connector, "owner@mail.com")
+		bento, err := q.NewBento(ctx, db.NewBentoParams{UserID: userID, Name: "prod", CreatedAt: now, UpdatedAt: now})
+		require.NoError(t, err)
+
+		bus := events.NewBus(nil, events.DefaultBusConfig())
+		services.SubscribeAudit(bus)
+		tx, err := conn.Begin()
+		require.NoError(t, err)
+		require.NoError(t, bus.Publish(ctx, db.New(tx), events.BentoIngredientsRevealed{
+			BentoID:     bento.ID,
+			Ingredients: []string{"API_KEY"},
+			UserID:      userID,
+			IP:          "127.0.0.1",
+			UserAgent:   "konbi",
+		}))
+		require.NoError(t, tx.Commit())
+
+		reveals, err := q.ListBentoReveals(ctx, db.ListBentoRevealsParams{BentoID: bento.ID, Limit: 10})
+		require.NoError(t, err)
+		require.Len(t, reveals, 1)
+		require.Equal(t, userID, reveals[0].UserID)
+		require.Equal(t, `["API_KEY"]`, reveals[0].Ingredients)
+		require.Equal(t, "127.0.0.1", reveals[0].Ip)
+		require.Equal(t, "konbi", reveals[0].UserAgent)
+	})
+
+	t.Run("is documented", func(t *testing.T) {
+		doc := getOpenAPIDocument(t, newV1Echo())
+		require.NotNil(t, doc.Paths["/bento/{id}/reveals"]["get"])
+		require.NotNil(t, doc.Paths["/bento/{id}/reveals"]["post"])
+		require.NotNil(t, doc.Paths["/admin/bentos/{id}/reveals"]["get"])
+	})
+}
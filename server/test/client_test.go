@@ -0,0 +1,178 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/juancwu/konbini/common/api"
+	"github.com/juancwu/konbini/server/routes"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// rateLimitedServer responds with 429 to the first limited requests and with 204 afterwards.
+func rateLimitedServer(t *testing.T, limited int32, retryAfter string, calls *int32) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(calls, 1) <= limited {
+			w.Header().Set(api.HeaderRetryAfter, retryAfter)
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestClient(t *testing.T) {
+	t.Run("sends the token and decodes the response", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, http.MethodPost, r.Method)
+			require.Equal(t, "/api/v1"+api.UriNewBento, r.URL.Path)
+			require.Equal(t, "Bearer secret-token", r.Header.Get(api.HeaderAuthorization))
+			require.Equal(t, api.MimeApplicationJson, r.Header.Get(api.HeaderContentType))
+
+			var body api.NewBentoRequest
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			require.Equal(t, api.NewBentoRequest{Name: "prod", Ingredients: []api.Ingredient{{Name: "KEY", Value: "value"}}}, body)
+
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"bento_id":"b1"}`))
+		}))
+		defer srv.Close()
+
+		client := api.NewClient(srv.URL+"/api/v1/", api.WithToken("secret-token"))
+		res, err := client.NewBento(context.Background(), api.NewBentoRequest{
+			Name:        "prod",
+			Ingredients: []api.Ingredient{{Name: "KEY", Value: "value"}},
+		})
+		require.NoError(t, err)
+		require.Equal(t, "b1", res.BentoID)
+	})
+
+	t.Run("fills path and query parameters", func(t *testing.T) {
+		var got []string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = append(got, r.Method+" "+r.URL.RequestURI())
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer srv.Close()
+
+		client := api.NewClient(srv.URL)
+		require.NoError(t, client.DeleteGroup(context.Background(), "g/1"))
+		_, err := client.AddIngredientsToBento(context.Background(), api.AddIngredientsToBentoRequest{BentoID: "b1"}, true)
+		require.NoError(t, err)
+		_, err = client.ListEmailJobs(context.Background(), "dead", 10)
+		require.NoError(t, err)
+		require.Equal(t, []string{
+			"DELETE /group/g%2F1",
+			"POST /bento/ingredients?replace=true",
+			"GET /admin/email-jobs?limit=10&status=dead",
+		}, got)
+	})
+
+	t.Run("returns api errors as ErrorResponse", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(api.HeaderRequestID, "req-1")
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"code":404,"error_code":"bento_not_found","message":"Bento not found"}`))
+		}))
+		defer srv.Close()
+
+		_, err := api.NewClient(srv.URL).GetBento(context.Background(), "b1")
+		require.True(t, api.IsErrorCode(err, api.ErrorCodeBentoNotFound))
+
+		var errRes *api.ErrorResponse
+		require.True(t, errors.As(err, &errRes))
+		require.Equal(t, http.StatusNotFound, errRes.Code)
+		require.Equal(t, "req-1", errRes.RequestId)
+		require.Equal(t, "Bento not found (request id: req-1)", err.Error())
+	})
+
+	t.Run("retries rate limited requests", func(t *testing.T) {
+		var calls int32
+		srv := rateLimitedServer(t, 2, "0", &calls)
+
+		require.NoError(t, api.NewClient(srv.URL).RedriveEmailJob(context.Background(), "job"))
+		require.Equal(t, int32(3), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("retries reuse the idempotency key", func(t *testing.T) {
+		var keys []string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			keys = append(keys, r.Header.Get(api.HeaderIdempotencyKey))
+			if len(keys) == 1 {
+				w.Header().Set(api.HeaderRetryAfter, "0")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+		}))
+		defer srv.Close()
+		client := api.NewClient(srv.URL)
+
+		require.NoError(t, client.InviteUsersToJoinGroup(context.Background(), api.InviteUsersToJoinGroupRequest{}))
+		require.Len(t, keys, 2)
+		require.NotEmpty(t, keys[0])
+		require.Equal(t, keys[0], keys[1])
+
+		ctx := api.WithIdempotencyKey(context.Background(), "my-key")
+		require.NoError(t, client.InviteUsersToJoinGroup(ctx, api.InviteUsersToJoinGroupRequest{}))
+		require.Equal(t, "my-key", keys[2])
+
+		_, err := client.ListBentos(context.Background())
+		require.NoError(t, err)
+		require.Empty(t, keys[3], "safe requests do not need a key")
+	})
+
+	t.Run("gives up after the max retries", func(t *testing.T) {
+		var calls int32
+		srv := rateLimitedServer(t, 10, "0", &calls)
+
+		err := api.NewClient(srv.URL, api.WithMaxRetries(2)).RedriveEmailJob(context.Background(), "job")
+		require.True(t, api.IsErrorCode(err, api.ErrorCodeRateLimited))
+		require.Equal(t, int32(3), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("does not wait longer than the max retry wait", func(t *testing.T) {
+		var calls int32
+		srv := rateLimitedServer(t, 1, "600", &calls)
+
+		err := api.NewClient(srv.URL, api.WithMaxRetryWait(time.Second)).RedriveEmailJob(context.Background(), "job")
+		require.True(t, api.IsErrorCode(err, api.ErrorCodeRateLimited))
+		require.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("stops waiting when the context is done", func(t *testing.T) {
+		var calls int32
+		srv := rateLimitedServer(t, 1, "5", &calls)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+		defer cancel()
+		err := api.NewClient(srv.URL).RedriveEmailJob(ctx, "job")
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("works against the api routes", func(t *testing.T) {
+		srv := httptest.NewServer(newV1Echo())
+		defer srv.Close()
+		client := api.NewClient(srv.URL + routes.V1_PREFIX)
+
+		doc, err := client.OpenAPI(context.Background())
+		require.NoError(t, err)
+		require.Contains(t, string(doc), `"openapi":"3.0.3"`)
+
+		_, err = client.Register(context.Background(), api.RegisterRequest{Email: "not-an-email", Password: "long-enough-password", NickName: "user"})
+		require.True(t, api.IsErrorCode(err, api.ErrorCodeValidationFailed))
+		require.Equal(t, map[string]string{"email": "email must be a valid email address"}, err.(*api.ErrorResponse).FieldErrors())
+
+		err = client.Logout(context.Background())
+		require.True(t, api.IsErrorCode(err, api.ErrorCodeUnauthorized), err)
+	})
+}
@@ -0,0 +1,83 @@
+package test
+
+import (
+	"context"
+	"github.com/juancwu/konbini/server/db"
+	"github.com/juancwu/konbini/server/utils"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// uuidExpr generates a random uuid like gen_random_uuid and uuid4 of the libsql server, the embedded
+// libsql used by the tests doesn't have the functions.
+const uuidExpr = `lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || ` +
+	`substr('89ab', 1 + abs(random()) % 4, 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))`
+
+// newTestDB creates a database in a temporary file with every migration of .sqlc/migrations
+// applied, the way goose applies them.
+func newTestDB(t *testing.T) *db.DBConnector {
+	t.Helper()
+	connector := db.NewConnector("file:"+filepath.Join(t.TempDir(), "konbini.db"), "")
+	conn, err := connector.Connect()
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, file, _, _ := runtime.Caller(0)
+	paths, err := filepath.Glob(filepath.Join(filepath.Dir(file), "..", "..", ".sqlc", "migrations", "*.sql"))
+	require.NoError(t, err)
+	require.NotEmpty(t, paths)
+	sort.Strings(paths)
+
+	ctx := context.Background()
+	for _, path := range paths {
+		b, err := os.ReadFile(path)
+		require.NoError(t, err)
+		up, _, _ := strings.Cut(string(b), "-- +goose Down")
+		up = strings.ReplaceAll(up, "gen_random_uuid()", uuidExpr)
+		up = strings.ReplaceAll(up, "uuid4()", uuidExpr)
+		// the embedded libsql only runs the first statement of a query
+		for _, stmt := range strings.Split(up, ";\n") {
+			if strings.TrimSpace(stripSQLComments(stmt)) == "" {
+				continue
+			}
+			_, err = conn.ExecContext(ctx, stmt)
+			require.NoError(t, err, filepath.Base(path))
+		}
+	}
+	return connector
+}
+
+func stripSQLComments(stmt string) string {
+	lines := strings.Split(stmt, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "--") {
+			lines[i] = ""
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// newTestUser creates a user with the email and returns its id.
+func newTestUser(t *testing.T, connector *db.DBConnector, email string) string {
+	t.Helper()
+	conn, err := connector.Connect()
+	require.NoError(t, err)
+	defer conn.Close()
+	now := utils.FormatRFC3339NanoFixed(time.Now())
+	id, err := db.New(conn).CreateUser(context.Background(), db.CreateUserParams{
+		Email:     email,
+		Password:  "password-hash",
+		Nickname:  "user",
+		CreatedAt: now,
+		UpdatedAt: now,
+	})
+	require.NoError(t, err)
+	return id
+}
@@ -0,0 +1,189 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"github.com/juancwu/konbini/server/db"
+	"github.com/juancwu/konbini/server/services"
+	"github.com/juancwu/konbini/server/utils"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// memoryEmailJobStore is an in-memory services.EmailJobStore used to test the queue without a database.
+type memoryEmailJobStore struct {
+	*memoryJobStore[db.EmailJob]
+}
+
+func newMemoryEmailJobStore() *memoryEmailJobStore {
+	statuses := memoryJobStatuses{services.EMAIL_JOB_PENDING, services.EMAIL_JOB_PROCESSING, services.EMAIL_JOB_SENT, services.EMAIL_JOB_DEAD}
+	return &memoryEmailJobStore{newMemoryJobStore(statuses, func(j *db.EmailJob) memoryJobState {
+		return memoryJobState{&j.ID, &j.Status, &j.Attempts, &j.RunAt, &j.LockedUntil, &j.LastError}
+	})}
+}
+
+func (s *memoryEmailJobStore) Enqueue(_ context.Context, payload string, maxAttempts int, runAt time.Time) (string, error) {
+	now := utils.FormatRFC3339NanoFixed(time.Now())
+	return s.insert(db.EmailJob{
+		Payload:     payload,
+		MaxAttempts: int64(maxAttempts),
+		RunAt:       utils.FormatRFC3339NanoFixed(runAt),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}), nil
+}
+
+func (s *memoryEmailJobStore) Complete(_ context.Context, id string, lease string, messageID string) error {
+	return s.complete(id, lease, func(j *db.EmailJob) { j.MessageID = &messageID })
+}
+
+func (s *memoryEmailJobStore) Retry(_ context.Context, id string, lease string, runAt time.Time, _ string, lastError string) error {
+	return s.retry(id, lease, runAt, lastError, nil)
+}
+
+func (s *memoryEmailJobStore) Bury(_ context.Context, id string, lease string, _ string, lastError string) error {
+	return s.bury(id, lease, lastError, nil)
+}
+
+func (s *memoryEmailJobStore) List(_ context.Context, status string, limit int) ([]db.EmailJob, error) {
+	jobs := s.list(func(j db.EmailJob) bool { return j.Status == status })
+	if len(jobs) > limit {
+		jobs = jobs[:limit]
+	}
+	return jobs, nil
+}
+
+func (s *memoryEmailJobStore) Redrive(_ context.Context, id string, runAt time.Time) (bool, error) {
+	return s.redrive(id, runAt), nil
+}
+
+// fakeEmailSender fails the first failures sends and records every delivered message.
+type fakeEmailSender struct {
+	mu       sync.Mutex
+	failures int
+	calls    int
+	sent     []services.EmailMessage
+}
+
+func (f *fakeEmailSender) Send(_ context.Context, msg *services.EmailMessage) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if f.calls <= f.failures {
+		return "", errors.New("provider unavailable")
+	}
+	f.sent = append(f.sent, *msg)
+	return "msg-" + strconv.Itoa(f.calls), nil
+}
+
+func (f *fakeEmailSender) sentCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.sent)
+}
+
+func newTestEmailQueue(store services.EmailJobStore, sender *fakeEmailSender, maxAttempts int) *services.EmailQueue {
+	return services.NewEmailQueue(store, sender, services.EmailQueueConfig{
+		Workers:      2,
+		MaxAttempts:  maxAttempts,
+		PollInterval: time.Millisecond * 10,
+		BaseBackoff:  time.Millisecond,
+		MaxBackoff:   time.Millisecond * 5,
+	})
+}
+
+func TestEmailQueue(t *testing.T) {
+	msg := &services.EmailMessage{
+		From:    "verify@mail.com",
+		To:      []string{"user@mail.com"},
+		Subject: "Verify Your Email",
+		Text:    "hello",
+	}
+
+	t.Run("delivers queued email", func(t *testing.T) {
+		store := newMemoryEmailJobStore()
+		sender := &fakeEmailSender{}
+		queue := newTestEmailQueue(store, sender, 3)
+		queue.Start(context.Background())
+		defer queue.Stop()
+
+		id, err := queue.Enqueue(context.Background(), msg)
+		require.NoError(t, err)
+
+		require.Eventually(t, func() bool {
+			return store.get(id).Status == services.EMAIL_JOB_SENT
+		}, time.Second, time.Millisecond*5)
+		require.Equal(t, 1, sender.sentCount())
+		require.Equal(t, *msg, sender.sent[0])
+		require.Equal(t, "msg-1", *store.get(id).MessageID)
+	})
+
+	t.Run("retries failed sends with backoff", func(t *testing.T) {
+		store := newMemoryEmailJobStore()
+		sender := &fakeEmailSender{failures: 2}
+		queue := newTestEmailQueue(store, sender, 5)
+		queue.Start(context.Background())
+		defer queue.Stop()
+
+		id, err := queue.Enqueue(context.Background(), msg)
+		require.NoError(t, err)
+
+		require.Eventually(t, func() bool {
+			return store.get(id).Status == services.EMAIL_JOB_SENT
+		}, time.Second, time.Millisecond*5)
+		require.Equal(t, int64(3), store.get(id).Attempts)
+		require.Nil(t, store.get(id).LastError)
+	})
+
+	t.Run("dead-letters after max attempts and re-drives", func(t *testing.T) {
+		store := newMemoryEmailJobStore()
+		sender := &fakeEmailSender{failures: 3}
+		queue := newTestEmailQueue(store, sender, 3)
+		queue.Start(context.Background())
+		defer queue.Stop()
+
+		id, err := queue.Enqueue(context.Background(), msg)
+		require.NoError(t, err)
+
+		require.Eventually(t, func() bool {
+			return store.get(id).Status == services.EMAIL_JOB_DEAD
+		}, time.Second, time.Millisecond*5)
+		require.Equal(t, "provider unavailable", *store.get(id).LastError)
+		require.Equal(t, 0, sender.sentCount())
+
+		dead, err := queue.List(context.Background(), services.EMAIL_JOB_DEAD, 10)
+		require.NoError(t, err)
+		require.Len(t, dead, 1)
+
+		require.NoError(t, queue.Redrive(context.Background(), id))
+		require.ErrorIs(t, queue.Redrive(context.Background(), id), services.ErrEmailJobNotRedrive)
+
+		require.Eventually(t, func() bool {
+			return store.get(id).Status == services.EMAIL_JOB_SENT
+		}, time.Second, time.Millisecond*5)
+		require.Equal(t, 1, sender.sentCount())
+	})
+
+	t.Run("resumes jobs left processing by a previous instance", func(t *testing.T) {
+		store := newMemoryEmailJobStore()
+		id, err := store.Enqueue(context.Background(), `{"from":"a@mail.com","to":["b@mail.com"],"subject":"hi"}`, 3, time.Now())
+		require.NoError(t, err)
+		// simulate a crash after the job was claimed, the lease has already expired
+		_, err = store.Claim(context.Background(), time.Now(), -time.Second)
+		require.NoError(t, err)
+
+		sender := &fakeEmailSender{}
+		queue := newTestEmailQueue(store, sender, 3)
+		queue.Start(context.Background())
+		defer queue.Stop()
+
+		require.Eventually(t, func() bool {
+			return store.get(id).Status == services.EMAIL_JOB_SENT
+		}, time.Second, time.Millisecond*5)
+		require.Equal(t, int64(2), store.get(id).Attempts)
+	})
+}
@@ -0,0 +1,90 @@
+package test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/juancwu/konbini/common/api"
+	"github.com/juancwu/konbini/server/handlers"
+	"github.com/juancwu/konbini/server/middlewares"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorCodes(t *testing.T) {
+	e := echo.New()
+	e.HTTPErrorHandler = handlers.ErrorHandler()
+	e.GET("/totp", func(c echo.Context) error {
+		return handlers.APIError{
+			Code:          http.StatusBadRequest,
+			ErrorCode:     api.ErrorCodeTOTPRequired,
+			PublicMessage: "User has TOTP setup, code is required.",
+		}
+	})
+	e.GET("/no-code", func(c echo.Context) error {
+		return handlers.APIError{Code: http.StatusNotFound, PublicMessage: "Not here"}
+	})
+	e.GET("/limited", func(c echo.Context) error {
+		return echo.NewHTTPError(http.StatusTooManyRequests, "Slow down")
+	})
+	e.GET("/panic", func(c echo.Context) error {
+		return errors.New("database exploded")
+	})
+	e.POST("/validate", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}, middlewares.ValidateJson(reflect.TypeOf(api.RegisterRequest{})))
+
+	cases := []struct {
+		method string
+		path   string
+		status int
+		code   api.ErrorCode
+	}{
+		{http.MethodGet, "/totp", http.StatusBadRequest, api.ErrorCodeTOTPRequired},
+		{http.MethodGet, "/no-code", http.StatusNotFound, api.ErrorCodeNotFound},
+		{http.MethodGet, "/limited", http.StatusTooManyRequests, api.ErrorCodeRateLimited},
+		{http.MethodGet, "/panic", http.StatusInternalServerError, api.ErrorCodeInternal},
+		{http.MethodGet, "/missing", http.StatusNotFound, api.ErrorCodeNotFound},
+		{http.MethodPost, "/validate", http.StatusUnsupportedMediaType, api.ErrorCodeUnsupportedMediaType},
+	}
+	for _, tc := range cases {
+		t.Run(tc.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(tc.method, tc.path, nil))
+			require.Equal(t, tc.status, rec.Code)
+
+			var errRes api.ErrorResponse
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &errRes))
+			require.Equal(t, tc.code, errRes.ErrorCode)
+		})
+	}
+
+	t.Run("validation failures", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/validate", strings.NewReader(`{"email":1}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		var errRes api.ErrorResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &errRes))
+		require.Equal(t, api.ErrorCodeValidationFailed, errRes.ErrorCode)
+	})
+
+	t.Run("clients read codes from wrapped errors", func(t *testing.T) {
+		res := &http.Response{StatusCode: http.StatusBadRequest, Header: http.Header{}}
+		err := fmt.Errorf("Login Error: %w", api.ParseErrorResponse(res, []byte(`{"code":400,"error_code":"totp_required","message":"TOTP required"}`)))
+		require.True(t, api.IsErrorCode(err, api.ErrorCodeTOTPRequired))
+		require.False(t, api.IsErrorCode(err, api.ErrorCodeInvalidTOTPCode))
+		require.False(t, api.IsErrorCode(errors.New("network down"), api.ErrorCodeTOTPRequired))
+
+		// responses without a code fall back to the generic code of the status
+		res = &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}}
+		require.Equal(t, api.ErrorCodeRateLimited, api.ParseErrorResponse(res, []byte("too many requests")).ErrorCode)
+	})
+}
@@ -0,0 +1,227 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"github.com/juancwu/konbini/server/db"
+	"github.com/juancwu/konbini/server/events"
+	"github.com/juancwu/konbini/server/utils"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// memoryOutboxStore is an in-memory events.OutboxStore used to test the bus without a database.
+type memoryOutboxStore struct {
+	*memoryJobStore[db.OutboxEvent]
+}
+
+func newMemoryOutboxStore() *memoryOutboxStore {
+	statuses := memoryJobStatuses{events.OUTBOX_PENDING, events.OUTBOX_PROCESSING, events.OUTBOX_DONE, events.OUTBOX_DEAD}
+	return &memoryOutboxStore{newMemoryJobStore(statuses, func(e *db.OutboxEvent) memoryJobState {
+		return memoryJobState{&e.ID, &e.Status, &e.Attempts, &e.RunAt, &e.LockedUntil, &e.LastError}
+	})}
+}
+
+func (s *memoryOutboxStore) Enqueue(_ context.Context, _ *db.Queries, entry events.OutboxEntry) (string, error) {
+	now := utils.FormatRFC3339NanoFixed(time.Now())
+	return s.insert(db.OutboxEvent{
+		EventID:     entry.EventID,
+		Name:        entry.Name,
+		Subscriber:  entry.Subscriber,
+		Payload:     entry.Payload,
+		MaxAttempts: int64(entry.MaxAttempts),
+		RunAt:       utils.FormatRFC3339NanoFixed(entry.RunAt),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}), nil
+}
+
+func (s *memoryOutboxStore) Complete(_ context.Context, id string, lease string, _ struct{}) error {
+	return s.complete(id, lease, nil)
+}
+
+func (s *memoryOutboxStore) Retry(_ context.Context, id string, lease string, runAt time.Time, _ struct{}, lastError string) error {
+	return s.retry(id, lease, runAt, lastError, nil)
+}
+
+func (s *memoryOutboxStore) Bury(_ context.Context, id string, lease string, _ struct{}, lastError string) error {
+	return s.bury(id, lease, lastError, nil)
+}
+
+// bySubscriber returns the entries of a subscriber.
+func (s *memoryOutboxStore) bySubscriber(subscriber string) []db.OutboxEvent {
+	return s.list(func(e db.OutboxEvent) bool { return e.Subscriber == subscriber })
+}
+
+func newTestBus(store events.OutboxStore, maxAttempts int) *events.Bus {
+	return events.NewBus(store, events.BusConfig{
+		Workers:      2,
+		MaxAttempts:  maxAttempts,
+		PollInterval: time.Millisecond * 10,
+		BaseBackoff:  time.Millisecond,
+		MaxBackoff:   time.Millisecond * 5,
+	})
+}
+
+func TestEventBus(t *testing.T) {
+	changed := events.BentoIngredientChanged{
+		BentoID:     "b1",
+		Revision:    2,
+		Action:      "add",
+		Ingredients: []string{"API_KEY"},
+		UserID:      "u1",
+	}
+
+	t.Run("sync subscribers run in publish and can fail it", func(t *testing.T) {
+		store := newMemoryOutboxStore()
+		bus := newTestBus(store, 3)
+		var got []events.BentoIngredientChanged
+		events.Subscribe(bus, func(_ context.Context, _ *db.Queries, e events.BentoIngredientChanged) error {
+			got = append(got, e)
+			return nil
+		})
+		events.Subscribe(bus, func(_ context.Context, _ *db.Queries, e events.TOTPRemoved) error {
+			return errors.New("audit log unavailable")
+		})
+		events.SubscribeAsync(bus, "mailer", func(context.Context, events.TOTPRemoved) error { return nil })
+
+		require.NoError(t, bus.Publish(context.Background(), nil, changed))
+		require.Equal(t, []events.BentoIngredientChanged{changed}, got)
+
+		require.EqualError(t, bus.Publish(context.Background(), nil, events.TOTPRemoved{UserID: "u1"}), "audit log unavailable")
+		// the change is rolled back, nothing is left in the outbox
+		require.Empty(t, store.bySubscriber("mailer"))
+	})
+
+	t.Run("async subscribers get committed events", func(t *testing.T) {
+		store := newMemoryOutboxStore()
+		bus := newTestBus(store, 3)
+
+		var mu sync.Mutex
+		got := map[string]events.BentoIngredientChanged{}
+		ids := map[string]string{}
+		for _, subscriber := range []string{"webhooks", "audit"} {
+			subscriber := subscriber
+			events.SubscribeAsync(bus, subscriber, func(ctx context.Context, e events.BentoIngredientChanged) error {
+				mu.Lock()
+				defer mu.Unlock()
+				got[subscriber] = e
+				ids[subscriber] = events.EventID(ctx)
+				return nil
+			})
+		}
+
+		require.NoError(t, bus.Publish(context.Background(), nil, changed, events.UserLoggedIn{UserID: "u1"}))
+		require.Len(t, store.bySubscriber("webhooks"), 1)
+		require.Len(t, store.bySubscriber("audit"), 1)
+
+		bus.Start(context.Background())
+		defer bus.Stop()
+		bus.Dispatch()
+
+		require.Eventually(t, func() bool {
+			return store.bySubscriber("webhooks")[0].Status == events.OUTBOX_DONE &&
+				store.bySubscriber("audit")[0].Status == events.OUTBOX_DONE
+		}, time.Second, time.Millisecond*5)
+		mu.Lock()
+		defer mu.Unlock()
+		require.Equal(t, changed, got["webhooks"])
+		require.Equal(t, changed, got["audit"])
+		require.NotEmpty(t, ids["webhooks"])
+		require.Equal(t, ids["webhooks"], ids["audit"])
+	})
+
+	t.Run("retries a failing subscriber on its own", func(t *testing.T) {
+		store := newMemoryOutboxStore()
+		bus := newTestBus(store, 5)
+
+		var mu sync.Mutex
+		calls := map[string]int{}
+		ids := map[string]bool{}
+		events.SubscribeAsync(bus, "flaky", func(ctx context.Context, e events.GroupMemberAdded) error {
+			mu.Lock()
+			defer mu.Unlock()
+			calls["flaky"]++
+			ids[events.EventID(ctx)] = true
+			if calls["flaky"] < 3 {
+				return errors.New("unavailable")
+			}
+			return nil
+		})
+		events.SubscribeAsync(bus, "steady", func(ctx context.Context, e events.GroupMemberAdded) error {
+			mu.Lock()
+			defer mu.Unlock()
+			calls["steady"]++
+			return nil
+		})
+		bus.Start(context.Background())
+		defer bus.Stop()
+
+		require.NoError(t, bus.Publish(context.Background(), nil, events.GroupMemberAdded{GroupID: "g1", UserID: "u1"}))
+		bus.Dispatch()
+
+		require.Eventually(t, func() bool {
+			return store.bySubscriber("flaky")[0].Status == events.OUTBOX_DONE
+		}, time.Second, time.Millisecond*5)
+		require.Equal(t, int64(3), store.bySubscriber("flaky")[0].Attempts)
+		require.Nil(t, store.bySubscriber("flaky")[0].LastError)
+		mu.Lock()
+		defer mu.Unlock()
+		require.Equal(t, 1, calls["steady"])
+		require.Len(t, ids, 1)
+	})
+
+	t.Run("dead-letters after max attempts and on panics", func(t *testing.T) {
+		store := newMemoryOutboxStore()
+		bus := newTestBus(store, 2)
+		events.SubscribeAsync(bus, "broken", func(ctx context.Context, e events.TOTPRemoved) error {
+			panic("nil map")
+		})
+		bus.Start(context.Background())
+		defer bus.Stop()
+
+		require.NoError(t, bus.Publish(context.Background(), nil, events.TOTPRemoved{UserID: "u1"}))
+		bus.Dispatch()
+
+		require.Eventually(t, func() bool {
+			return store.bySubscriber("broken")[0].Status == events.OUTBOX_DEAD
+		}, time.Second, time.Millisecond*5)
+		require.Equal(t, int64(2), store.bySubscriber("broken")[0].Attempts)
+		require.Equal(t, "Subscriber panicked: nil map", *store.bySubscriber("broken")[0].LastError)
+	})
+
+	t.Run("buries entries of unknown subscribers", func(t *testing.T) {
+		store := newMemoryOutboxStore()
+		_, err := store.Enqueue(context.Background(), nil, events.OutboxEntry{
+			EventID:     "e1",
+			Name:        events.TOTP_REMOVED,
+			Subscriber:  "removed",
+			Payload:     `{"user_id":"u1"}`,
+			MaxAttempts: 3,
+			RunAt:       time.Now(),
+		})
+		require.NoError(t, err)
+
+		bus := newTestBus(store, 3)
+		bus.Start(context.Background())
+		defer bus.Stop()
+
+		require.Eventually(t, func() bool {
+			return store.bySubscriber("removed")[0].Status == events.OUTBOX_DEAD
+		}, time.Second, time.Millisecond*5)
+	})
+
+	t.Run("requires a store for async subscribers", func(t *testing.T) {
+		bus := events.NewBus(nil, events.DefaultBusConfig())
+		require.NoError(t, bus.Publish(context.Background(), nil, changed))
+
+		events.SubscribeAsync(bus, "webhooks", func(context.Context, events.BentoIngredientChanged) error { return nil })
+		require.ErrorIs(t, bus.Publish(context.Background(), nil, changed), events.ErrOutboxNotSet)
+		require.Panics(t, func() {
+			events.SubscribeAsync(bus, "webhooks", func(context.Context, events.BentoIngredientChanged) error { return nil })
+		})
+	})
+}
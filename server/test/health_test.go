@@ -0,0 +1,189 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	commonApi "github.com/juancwu/konbini/common/api"
+	"github.com/juancwu/konbini/server/config"
+	"github.com/juancwu/konbini/server/db"
+	"github.com/juancwu/konbini/server/handlers"
+	"github.com/juancwu/konbini/server/memcache"
+	"github.com/juancwu/konbini/server/services"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+)
+
+// countingCheck returns a readiness check that counts how many times it ran.
+func countingCheck(name string, calls *int32, err error) services.ReadinessCheck {
+	return services.ReadinessCheck{
+		Name: name,
+		Check: func(ctx context.Context) error {
+			atomic.AddInt32(calls, 1)
+			return err
+		},
+	}
+}
+
+func readyz(t *testing.T, checker *services.HealthChecker) (int, commonApi.ReadinessReport, string) {
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/readyz", nil), rec)
+	require.NoError(t, handlers.Readyz(checker)(c))
+
+	var report commonApi.ReadinessReport
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	return rec.Code, report, rec.Body.String()
+}
+
+func TestHealth(t *testing.T) {
+	t.Run("ready when every check passes", func(t *testing.T) {
+		var calls int32
+		checker := services.NewHealthChecker("v1", time.Minute, time.Second,
+			countingCheck("database", &calls, nil),
+			countingCheck("cache", &calls, nil),
+		)
+
+		status, report, _ := readyz(t, checker)
+		require.Equal(t, http.StatusOK, status)
+		require.Equal(t, services.HEALTH_STATUS_OK, report.Status)
+		require.Equal(t, "v1", report.Version)
+		require.Len(t, report.Checks, 2)
+	})
+
+	t.Run("503 with the status of every check when a check fails", func(t *testing.T) {
+		var calls int32
+		checker := services.NewHealthChecker("v1", time.Minute, time.Second,
+			countingCheck("database", &calls, nil),
+			countingCheck("migrations", &calls, errors.New("no such table: goose_db_version")),
+		)
+
+		status, report, body := readyz(t, checker)
+		require.Equal(t, http.StatusServiceUnavailable, status)
+		require.Equal(t, services.HEALTH_STATUS_ERROR, report.Status)
+		require.Equal(t, []commonApi.ReadinessCheck{
+			{Name: "database", Status: services.HEALTH_STATUS_OK},
+			{Name: "migrations", Status: services.HEALTH_STATUS_ERROR},
+		}, report.Checks)
+		// the error is only logged
+		require.NotContains(t, body, "goose_db_version")
+		require.Equal(t, "no such table: goose_db_version", checker.Check(context.Background()).Checks[1].Error)
+	})
+
+	t.Run("caches results briefly", func(t *testing.T) {
+		var calls int32
+		checker := services.NewHealthChecker("v1", time.Millisecond*50, time.Second,
+			countingCheck("database", &calls, nil),
+		)
+
+		for i := 0; i < 5; i++ {
+			checker.Check(context.Background())
+		}
+		require.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+		time.Sleep(time.Millisecond * 60)
+		checker.Check(context.Background())
+		require.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("slow checks time out", func(t *testing.T) {
+		checker := services.NewHealthChecker("v1", time.Minute, time.Millisecond*20,
+			services.ReadinessCheck{
+				Name: "database",
+				Check: func(ctx context.Context) error {
+					<-ctx.Done()
+					return ctx.Err()
+				},
+			},
+		)
+
+		report := checker.Check(context.Background())
+		require.False(t, report.Ready())
+		require.Equal(t, context.DeadlineExceeded.Error(), report.Checks[0].Error)
+	})
+
+	t.Run("cache check pings redis", func(t *testing.T) {
+		mr := miniredis.RunT(t)
+		store, err := memcache.NewRedisStore("redis://" + mr.Addr())
+		require.NoError(t, err)
+		defer store.Close()
+
+		check := services.CacheCheck(store)
+		require.NoError(t, check.Check(context.Background()))
+
+		mr.Close()
+		require.Error(t, check.Check(context.Background()))
+
+		require.NoError(t, services.CacheCheck(memcache.NewMemoryStore(time.Minute)).Check(context.Background()))
+	})
+
+	t.Run("liveness never checks dependencies", func(t *testing.T) {
+		e := echo.New()
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(http.MethodGet, "/livez", nil), rec)
+		require.NoError(t, handlers.Livez(&config.Config{})(c))
+		require.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("schema version matches the latest migration", func(t *testing.T) {
+		entries, err := os.ReadDir("../../.sqlc/migrations")
+		require.NoError(t, err)
+
+		versions := []int64{}
+		for _, entry := range entries {
+			prefix, _, found := strings.Cut(entry.Name(), "_")
+			if !found {
+				continue
+			}
+			version, err := strconv.ParseInt(prefix, 10, 64)
+			require.NoError(t, err, entry.Name())
+			versions = append(versions, version)
+		}
+		sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+		require.Equal(t, versions[len(versions)-1], db.SchemaVersion, "update db.SchemaVersion after adding a migration")
+	})
+}
+
+func TestMigrationCheck(t *testing.T) {
+	connector := newTestDB(t)
+	conn, err := connector.Connect()
+	require.NoError(t, err)
+	defer conn.Close()
+	ctx := context.Background()
+	check := services.MigrationCheck(connector, 2)
+
+	// goose creates its version table on the first lookup
+	version, err := db.GetMigrationVersion(ctx, conn)
+	require.NoError(t, err)
+	require.Equal(t, int64(0), version)
+	require.ErrorIs(t, check.Check(ctx), services.ErrSchemaVersionTooLow)
+
+	for _, row := range []struct {
+		version int64
+		applied bool
+	}{{1, true}, {2, true}} {
+		_, err = conn.ExecContext(ctx, "INSERT INTO goose_db_version (version_id, is_applied) VALUES (?, ?)", row.version, row.applied)
+		require.NoError(t, err)
+	}
+	require.NoError(t, check.Check(ctx))
+
+	t.Run("ignores rolled back migrations", func(t *testing.T) {
+		_, err = conn.ExecContext(ctx, "INSERT INTO goose_db_version (version_id, is_applied) VALUES (?, ?)", 2, false)
+		require.NoError(t, err)
+		version, err := db.GetMigrationVersion(ctx, conn)
+		require.NoError(t, err)
+		require.Equal(t, int64(1), version)
+		require.ErrorIs(t, check.Check(ctx), services.ErrSchemaVersionTooLow)
+	})
+}
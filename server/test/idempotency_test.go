@@ -0,0 +1,161 @@
+package test
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/juancwu/konbini/common/api"
+	"github.com/juancwu/konbini/server/db"
+	"github.com/juancwu/konbini/server/handlers"
+	"github.com/juancwu/konbini/server/memcache"
+	"github.com/juancwu/konbini/server/middlewares"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+)
+
+// newIdempotentEcho creates a server with an idempotent route that runs handler. The user
+// is read from the X-User header in place of the Protect middlewares.
+func newIdempotentEcho(handler echo.HandlerFunc) *echo.Echo {
+	e := echo.New()
+	e.HTTPErrorHandler = handlers.ErrorHandler()
+	e.POST(
+		"/bento/new",
+		handler,
+		func(next echo.HandlerFunc) echo.HandlerFunc {
+			return func(c echo.Context) error {
+				c.Set("user", db.User{ID: c.Request().Header.Get("X-User")})
+				return next(c)
+			}
+		},
+		middlewares.IdempotencyWithConfig(middlewares.IdempotencyConfig{Store: memcache.NewMemoryStore(time.Minute)}),
+	)
+	return e
+}
+
+func postIdempotent(e *echo.Echo, user string, key string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/bento/new", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set("X-User", user)
+	if key != "" {
+		req.Header.Set(api.HeaderIdempotencyKey, key)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func errorCode(t *testing.T, rec *httptest.ResponseRecorder) api.ErrorCode {
+	var errRes api.ErrorResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &errRes))
+	return errRes.ErrorCode
+}
+
+func TestIdempotency(t *testing.T) {
+	var calls int32
+	createBento := func(c echo.Context) error {
+		n := atomic.AddInt32(&calls, 1)
+		return c.JSON(http.StatusCreated, api.NewBentoResponse{BentoID: "bento-" + string(rune('0'+n))})
+	}
+
+	t.Run("replays the first response", func(t *testing.T) {
+		atomic.StoreInt32(&calls, 0)
+		e := newIdempotentEcho(createBento)
+
+		first := postIdempotent(e, "u1", "key-1", `{"name":"prod"}`)
+		require.Equal(t, http.StatusCreated, first.Code)
+		require.Empty(t, first.Header().Get(api.HeaderIdempotentReplayed))
+
+		replay := postIdempotent(e, "u1", "key-1", `{"name":"prod"}`)
+		require.Equal(t, http.StatusCreated, replay.Code)
+		require.Equal(t, first.Body.String(), replay.Body.String())
+		require.Equal(t, echo.MIMEApplicationJSON, replay.Header().Get(echo.HeaderContentType))
+		require.Equal(t, "true", replay.Header().Get(api.HeaderIdempotentReplayed))
+		require.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("rejects a key reused with a different payload", func(t *testing.T) {
+		atomic.StoreInt32(&calls, 0)
+		e := newIdempotentEcho(createBento)
+
+		require.Equal(t, http.StatusCreated, postIdempotent(e, "u1", "key-1", `{"name":"prod"}`).Code)
+		rec := postIdempotent(e, "u1", "key-1", `{"name":"dev"}`)
+		require.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		require.Equal(t, api.ErrorCodeIdempotencyKeyReused, errorCode(t, rec))
+		require.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("keys are scoped per user", func(t *testing.T) {
+		atomic.StoreInt32(&calls, 0)
+		e := newIdempotentEcho(createBento)
+
+		require.Equal(t, http.StatusCreated, postIdempotent(e, "u1", "key-1", `{"name":"prod"}`).Code)
+		rec := postIdempotent(e, "u2", "key-1", `{"name":"prod"}`)
+		require.Equal(t, http.StatusCreated, rec.Code)
+		require.Empty(t, rec.Header().Get(api.HeaderIdempotentReplayed))
+		require.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("requests without a key are not deduplicated", func(t *testing.T) {
+		atomic.StoreInt32(&calls, 0)
+		e := newIdempotentEcho(createBento)
+
+		postIdempotent(e, "u1", "", `{"name":"prod"}`)
+		postIdempotent(e, "u1", "", `{"name":"prod"}`)
+		require.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("failed requests can be retried with the same key", func(t *testing.T) {
+		var attempts int32
+		e := newIdempotentEcho(func(c echo.Context) error {
+			if atomic.AddInt32(&attempts, 1) == 1 {
+				return errors.New("database is down")
+			}
+			return c.JSON(http.StatusCreated, api.NewBentoResponse{BentoID: "bento"})
+		})
+
+		require.Equal(t, http.StatusInternalServerError, postIdempotent(e, "u1", "key-1", `{"name":"prod"}`).Code)
+		require.Equal(t, http.StatusCreated, postIdempotent(e, "u1", "key-1", `{"name":"prod"}`).Code)
+		require.Equal(t, int32(2), atomic.LoadInt32(&attempts))
+	})
+
+	t.Run("rejects concurrent requests with the same key", func(t *testing.T) {
+		started := make(chan struct{})
+		release := make(chan struct{})
+		e := newIdempotentEcho(func(c echo.Context) error {
+			close(started)
+			<-release
+			return c.NoContent(http.StatusCreated)
+		})
+
+		done := make(chan *httptest.ResponseRecorder)
+		go func() {
+			done <- postIdempotent(e, "u1", "key-1", `{"name":"prod"}`)
+		}()
+		<-started
+
+		rec := postIdempotent(e, "u1", "key-1", `{"name":"prod"}`)
+		require.Equal(t, http.StatusConflict, rec.Code)
+		require.Equal(t, api.ErrorCodeIdempotencyKeyInUse, errorCode(t, rec))
+
+		close(release)
+		require.Equal(t, http.StatusCreated, (<-done).Code)
+
+		// responses without a body are replayed too
+		replay := postIdempotent(e, "u1", "key-1", `{"name":"prod"}`)
+		require.Equal(t, http.StatusCreated, replay.Code)
+		require.Equal(t, "true", replay.Header().Get(api.HeaderIdempotentReplayed))
+	})
+
+	t.Run("rejects keys that are too long", func(t *testing.T) {
+		e := newIdempotentEcho(createBento)
+		rec := postIdempotent(e, "u1", strings.Repeat("k", middlewares.MAX_IDEMPOTENCY_KEY_LENGTH+1), `{"name":"prod"}`)
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+		require.Equal(t, api.ErrorCodeInvalidIdempotencyKey, errorCode(t, rec))
+	})
+}
@@ -0,0 +1,342 @@
+package test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/juancwu/konbini/server/db"
+	"github.com/juancwu/konbini/server/jobs"
+	"github.com/juancwu/konbini/server/services"
+	"github.com/juancwu/konbini/server/utils"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// memoryJobState points to the columns every job table has.
+type memoryJobState struct {
+	ID          *string
+	Status      *string
+	Attempts    *int64
+	RunAt       *string
+	LockedUntil **string
+	LastError   **string
+}
+
+// memoryJobStatuses are the values of the status column of a job table.
+type memoryJobStatuses struct {
+	pending    string
+	processing string
+	done       string
+	dead       string
+}
+
+// memoryJobStore keeps the rows of a job table in memory, the stores of the queues wrap it to
+// test them without a database.
+type memoryJobStore[T any] struct {
+	mu       sync.Mutex
+	nextId   int
+	rows     map[string]*T
+	state    func(row *T) memoryJobState
+	statuses memoryJobStatuses
+}
+
+func newMemoryJobStore[T any](statuses memoryJobStatuses, state func(row *T) memoryJobState) *memoryJobStore[T] {
+	return &memoryJobStore[T]{rows: make(map[string]*T), state: state, statuses: statuses}
+}
+
+// insert adds a pending row and returns its id.
+func (s *memoryJobStore[T]) insert(row T) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextId++
+	id := strconv.Itoa(s.nextId)
+	state := s.state(&row)
+	*state.ID = id
+	*state.Status = s.statuses.pending
+	s.rows[id] = &row
+	return id
+}
+
+func (s *memoryJobStore[T]) Claim(_ context.Context, now time.Time, lease time.Duration) (T, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	nowStr := utils.FormatRFC3339NanoFixed(now)
+	var candidates []memoryJobState
+	rows := map[string]*T{}
+	for id, row := range s.rows {
+		state := s.state(row)
+		runnable := *state.Status == s.statuses.pending && *state.RunAt <= nowStr
+		expired := *state.Status == s.statuses.processing && *state.LockedUntil != nil && **state.LockedUntil <= nowStr
+		if runnable || expired {
+			candidates = append(candidates, state)
+			rows[id] = row
+		}
+	}
+	if len(candidates) == 0 {
+		var zero T
+		return zero, sql.ErrNoRows
+	}
+	sort.Slice(candidates, func(i, j int) bool { return *candidates[i].RunAt < *candidates[j].RunAt })
+	state := candidates[0]
+	lockedUntil := utils.FormatRFC3339NanoFixed(now.Add(lease))
+	*state.Status = s.statuses.processing
+	*state.Attempts++
+	*state.LockedUntil = &lockedUntil
+	return *rows[*state.ID], nil
+}
+
+// finish records the outcome of an attempt while the lease is held, update sets the columns of the result.
+func (s *memoryJobStore[T]) finish(id string, lease string, status string, runAt *time.Time, lastError *string, update func(row *T)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	row := s.rows[id]
+	state := s.state(row)
+	if *state.Status != s.statuses.processing || *state.LockedUntil == nil || **state.LockedUntil != lease {
+		return jobs.ErrLeaseLost
+	}
+	*state.Status = status
+	*state.LastError = lastError
+	*state.LockedUntil = nil
+	if runAt != nil {
+		*state.RunAt = utils.FormatRFC3339NanoFixed(*runAt)
+	}
+	if update != nil {
+		update(row)
+	}
+	return nil
+}
+
+func (s *memoryJobStore[T]) complete(id string, lease string, update func(row *T)) error {
+	return s.finish(id, lease, s.statuses.done, nil, nil, update)
+}
+
+func (s *memoryJobStore[T]) retry(id string, lease string, runAt time.Time, lastError string, update func(row *T)) error {
+	return s.finish(id, lease, s.statuses.pending, &runAt, &lastError, update)
+}
+
+func (s *memoryJobStore[T]) bury(id string, lease string, lastError string, update func(row *T)) error {
+	return s.finish(id, lease, s.statuses.dead, nil, &lastError, update)
+}
+
+// redrive moves a dead row back to pending with a fresh attempt counter.
+func (s *memoryJobStore[T]) redrive(id string, runAt time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	row, ok := s.rows[id]
+	if !ok || *s.state(row).Status != s.statuses.dead {
+		return false
+	}
+	state := s.state(row)
+	*state.Status = s.statuses.pending
+	*state.Attempts = 0
+	*state.LastError = nil
+	*state.RunAt = utils.FormatRFC3339NanoFixed(runAt)
+	return true
+}
+
+func (s *memoryJobStore[T]) get(id string) T {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return *s.rows[id]
+}
+
+// list returns the rows that match, ordered by id.
+func (s *memoryJobStore[T]) list(match func(row T) bool) []T {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]string, 0, len(s.rows))
+	for id := range s.rows {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	rows := []T{}
+	for _, id := range ids {
+		if match == nil || match(*s.rows[id]) {
+			rows = append(rows, *s.rows[id])
+		}
+	}
+	return rows
+}
+
+func TestJobWorker(t *testing.T) {
+	newWorker := func(store services.EmailJobStore, run func(ctx context.Context, job db.EmailJob) (string, error)) *jobs.Worker[db.EmailJob, string] {
+		return jobs.NewWorker("test", store, jobs.Config{
+			Workers:      2,
+			PollInterval: time.Millisecond * 10,
+			Lease:        time.Minute,
+			Timeout:      time.Second,
+			BaseBackoff:  time.Millisecond,
+			MaxBackoff:   time.Millisecond * 5,
+		}, run)
+	}
+
+	t.Run("buries permanent errors without retries", func(t *testing.T) {
+		store := newMemoryEmailJobStore()
+		id, err := store.Enqueue(context.Background(), "{}", 5, time.Now())
+		require.NoError(t, err)
+
+		var outcomes []jobs.Outcome
+		var mu sync.Mutex
+		worker := newWorker(store, func(ctx context.Context, job db.EmailJob) (string, error) {
+			return "", jobs.Permanent(errors.New("malformed"))
+		})
+		worker.Observe = func(_ db.EmailJob, _ string, outcome jobs.Outcome) {
+			mu.Lock()
+			defer mu.Unlock()
+			outcomes = append(outcomes, outcome)
+		}
+		worker.Start(context.Background())
+		defer worker.Stop()
+
+		require.Eventually(t, func() bool {
+			return store.get(id).Status == services.EMAIL_JOB_DEAD
+		}, time.Second, time.Millisecond*5)
+		require.Equal(t, int64(1), store.get(id).Attempts)
+		require.Equal(t, "malformed", *store.get(id).LastError)
+		mu.Lock()
+		require.Equal(t, []jobs.Outcome{jobs.OUTCOME_DEAD}, outcomes)
+		mu.Unlock()
+	})
+
+	t.Run("retries panics and timeouts", func(t *testing.T) {
+		store := newMemoryEmailJobStore()
+		id, err := store.Enqueue(context.Background(), "{}", 5, time.Now())
+		require.NoError(t, err)
+
+		var calls atomic.Int32
+		worker := newWorker(store, func(ctx context.Context, job db.EmailJob) (string, error) {
+			switch calls.Add(1) {
+			case 1:
+				panic("boom")
+			case 2:
+				<-ctx.Done()
+				return "", ctx.Err()
+			}
+			return "msg", nil
+		})
+		worker.Start(context.Background())
+		defer worker.Stop()
+
+		require.Eventually(t, func() bool {
+			return store.get(id).Status == services.EMAIL_JOB_SENT
+		}, time.Second*5, time.Millisecond*5)
+		require.Equal(t, int64(3), store.get(id).Attempts)
+		require.Equal(t, "msg", *store.get(id).MessageID)
+	})
+
+	t.Run("lets the jobs in flight finish when stopped", func(t *testing.T) {
+		store := newMemoryEmailJobStore()
+		id, err := store.Enqueue(context.Background(), "{}", 5, time.Now())
+		require.NoError(t, err)
+
+		started := make(chan struct{})
+		release := make(chan struct{})
+		var cancelled atomic.Bool
+		worker := newWorker(store, func(ctx context.Context, job db.EmailJob) (string, error) {
+			close(started)
+			<-release
+			cancelled.Store(ctx.Err() != nil)
+			return "msg", nil
+		})
+		worker.Start(context.Background())
+		<-started
+
+		stopped := make(chan struct{})
+		go func() {
+			worker.Stop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+			t.Fatal("Stop returned before the job finished")
+		case <-time.After(time.Millisecond * 50):
+		}
+		close(release)
+		<-stopped
+
+		require.False(t, cancelled.Load())
+		require.Equal(t, services.EMAIL_JOB_SENT, store.get(id).Status)
+		require.Equal(t, "msg", *store.get(id).MessageID)
+	})
+
+	t.Run("drops the outcome of a job claimed again", func(t *testing.T) {
+		store := newMemoryEmailJobStore()
+		id, err := store.Enqueue(context.Background(), "{}", 5, time.Now())
+		require.NoError(t, err)
+
+		// the first attempt outlives its lease and the job is claimed by the other goroutine
+		firstDone := make(chan struct{})
+		worker := jobs.NewWorker("test", store, jobs.Config{
+			Workers:      2,
+			PollInterval: time.Millisecond * 5,
+			Lease:        time.Millisecond * 20,
+			Timeout:      time.Second,
+			BaseBackoff:  time.Millisecond,
+			MaxBackoff:   time.Millisecond * 5,
+		}, func(ctx context.Context, job db.EmailJob) (string, error) {
+			if job.Attempts == 1 {
+				defer close(firstDone)
+				time.Sleep(time.Millisecond * 200)
+				return "", errors.New("too late")
+			}
+			return "second", nil
+		})
+		var outcomes []jobs.Outcome
+		var mu sync.Mutex
+		worker.Observe = func(_ db.EmailJob, _ string, outcome jobs.Outcome) {
+			mu.Lock()
+			defer mu.Unlock()
+			outcomes = append(outcomes, outcome)
+		}
+		worker.Start(context.Background())
+		defer worker.Stop()
+
+		<-firstDone
+		require.Eventually(t, func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return len(outcomes) == 1
+		}, time.Second, time.Millisecond*5)
+		job := store.get(id)
+		require.Equal(t, services.EMAIL_JOB_SENT, job.Status)
+		require.Equal(t, "second", *job.MessageID)
+		require.Nil(t, job.LastError)
+		mu.Lock()
+		require.Equal(t, []jobs.Outcome{jobs.OUTCOME_DONE}, outcomes)
+		mu.Unlock()
+	})
+
+	t.Run("db stores only finish jobs that hold the lease", func(t *testing.T) {
+		store := services.NewDBEmailJobStore(newTestDB(t))
+		ctx := context.Background()
+		// the driver drops the trailing zeros of the lease when it is read back
+		now := time.Now().Truncate(time.Millisecond)
+		id, err := store.Enqueue(ctx, "{}", 5, now)
+		require.NoError(t, err)
+
+		stale, err := store.Claim(ctx, now, time.Millisecond)
+		require.NoError(t, err)
+		job, err := store.Claim(ctx, now.Add(time.Second), time.Minute)
+		require.NoError(t, err)
+		require.Equal(t, id, job.ID)
+		require.NotEqual(t, stale.JobLease(), job.JobLease())
+
+		require.ErrorIs(t, store.Complete(ctx, id, stale.JobLease(), "stale"), jobs.ErrLeaseLost)
+		require.ErrorIs(t, store.Retry(ctx, id, stale.JobLease(), now, "", "stale"), jobs.ErrLeaseLost)
+		require.ErrorIs(t, store.Bury(ctx, id, stale.JobLease(), "", "stale"), jobs.ErrLeaseLost)
+		require.NoError(t, store.Complete(ctx, id, job.JobLease(), "msg"))
+		require.ErrorIs(t, store.Complete(ctx, id, job.JobLease(), "msg"), jobs.ErrLeaseLost)
+	})
+
+	t.Run("backoff doubles up to the max", func(t *testing.T) {
+		require.Equal(t, time.Second, jobs.Backoff(time.Second, time.Minute, 1))
+		require.Equal(t, time.Second*4, jobs.Backoff(time.Second, time.Minute, 3))
+		require.Equal(t, time.Minute, jobs.Backoff(time.Second, time.Minute, 20))
+	})
+}
@@ -0,0 +1,180 @@
+package test
+
+import (
+	"context"
+	"github.com/juancwu/konbini/server/memcache"
+	"github.com/juancwu/konbini/server/middlewares"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestRedisStore starts an in-process redis server and returns a store connected to it.
+func newTestRedisStore(t *testing.T) (*memcache.RedisStore, *miniredis.Miniredis) {
+	server := miniredis.RunT(t)
+	store, err := memcache.NewRedisStore("redis://" + server.Addr())
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+	require.NoError(t, store.Ping(context.Background()))
+	return store, server
+}
+
+// testStore runs the behaviour every memcache.Store must share.
+func testStore(t *testing.T, store memcache.Store) {
+	ctx := context.Background()
+
+	t.Run("get missing key", func(t *testing.T) {
+		_, err := store.Get(ctx, "missing")
+		require.ErrorIs(t, err, memcache.ErrNotFound)
+		_, err = store.TTL(ctx, "missing")
+		require.ErrorIs(t, err, memcache.ErrNotFound)
+	})
+
+	t.Run("set get delete", func(t *testing.T) {
+		require.NoError(t, store.Set(ctx, "key", []byte("value"), time.Minute))
+		value, err := store.Get(ctx, "key")
+		require.NoError(t, err)
+		require.Equal(t, []byte("value"), value)
+
+		ttl, err := store.TTL(ctx, "key")
+		require.NoError(t, err)
+		require.InDelta(t, time.Minute, ttl, float64(time.Second))
+
+		require.NoError(t, store.Delete(ctx, "key"))
+		_, err = store.Get(ctx, "key")
+		require.ErrorIs(t, err, memcache.ErrNotFound)
+		require.NoError(t, store.Delete(ctx, "key"))
+	})
+
+	t.Run("add only once", func(t *testing.T) {
+		require.NoError(t, store.Add(ctx, "add", []byte("first"), time.Minute))
+		require.ErrorIs(t, store.Add(ctx, "add", []byte("second"), time.Minute), memcache.ErrExists)
+		value, err := store.Get(ctx, "add")
+		require.NoError(t, err)
+		require.Equal(t, []byte("first"), value)
+	})
+
+	t.Run("incr is atomic", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := store.Incr(ctx, "counter", 1, time.Minute)
+				require.NoError(t, err)
+			}()
+		}
+		wg.Wait()
+
+		n, err := store.Incr(ctx, "counter", 2, time.Minute)
+		require.NoError(t, err)
+		require.Equal(t, int64(52), n)
+
+		value, err := store.Get(ctx, "counter")
+		require.NoError(t, err)
+		require.Equal(t, []byte("52"), value)
+
+		ttl, err := store.TTL(ctx, "counter")
+		require.NoError(t, err)
+		require.InDelta(t, time.Minute, ttl, float64(time.Second))
+	})
+
+	t.Run("incr without ttl keeps the key", func(t *testing.T) {
+		_, err := store.Incr(ctx, "forever", 1, time.Minute)
+		require.NoError(t, err)
+		n, err := store.Incr(ctx, "forever", 1, 0)
+		require.NoError(t, err)
+		require.Equal(t, int64(2), n)
+
+		value, err := store.Get(ctx, "forever")
+		require.NoError(t, err)
+		require.Equal(t, []byte("2"), value)
+
+		// zero means no expiration
+		ttl, err := store.TTL(ctx, "forever")
+		require.NoError(t, err)
+		require.Equal(t, time.Duration(0), ttl)
+	})
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := memcache.NewMemoryStore(time.Minute)
+	testStore(t, store)
+
+	t.Run("expires keys", func(t *testing.T) {
+		ctx := context.Background()
+		require.NoError(t, store.Set(ctx, "short", []byte("value"), time.Millisecond*10))
+		require.Eventually(t, func() bool {
+			_, err := store.Get(ctx, "short")
+			return err == memcache.ErrNotFound
+		}, time.Second, time.Millisecond*5)
+	})
+}
+
+func TestRedisStore(t *testing.T) {
+	store, server := newTestRedisStore(t)
+	testStore(t, store)
+
+	t.Run("expires keys", func(t *testing.T) {
+		ctx := context.Background()
+		_, err := store.Incr(ctx, "short", 1, time.Second)
+		require.NoError(t, err)
+		server.FastForward(time.Second * 2)
+		_, err = store.Get(ctx, "short")
+		require.ErrorIs(t, err, memcache.ErrNotFound)
+	})
+}
+
+func TestTOTPAttemptsSharedCache(t *testing.T) {
+	store, server := newTestRedisStore(t)
+	memcache.SetCache(store)
+	defer memcache.SetCache(nil)
+
+	ctx := context.Background()
+	userID := "a6d1c1ad-5e0c-4d55-9b0a-2c1c3d2c0e6e"
+
+	_, found, err := middlewares.GetTOTPAttempts(ctx, userID)
+	require.NoError(t, err)
+	require.False(t, found)
+
+	for i := 1; i <= middlewares.MaxTOTPAttempts; i++ {
+		n, err := middlewares.RecordFailedTOTPAttempt(ctx, userID)
+		require.NoError(t, err)
+		require.Equal(t, i, n)
+	}
+
+	// a second replica connected to the same redis sees the attempts
+	replica, err := memcache.NewRedisStore("redis://" + server.Addr())
+	require.NoError(t, err)
+	defer replica.Close()
+	memcache.SetCache(replica)
+
+	attempts, found, err := middlewares.GetTOTPAttempts(ctx, userID)
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, middlewares.MaxTOTPAttempts, attempts.Attempts)
+	require.WithinDuration(t, time.Now(), attempts.LastAttempt, time.Second*2)
+
+	// the lockout ends once the cooldown has passed
+	server.FastForward(middlewares.TOTPCooldownDuration)
+	_, found, err = middlewares.GetTOTPAttempts(ctx, userID)
+	require.NoError(t, err)
+	require.False(t, found)
+
+	_, err = middlewares.RecordFailedTOTPAttempt(ctx, userID)
+	require.NoError(t, err)
+	middlewares.ResetTOTPAttempts(ctx, userID)
+	_, found, err = middlewares.GetTOTPAttempts(ctx, userID)
+	require.NoError(t, err)
+	require.False(t, found)
+
+	// an unreachable redis must not read as no attempts
+	server.Close()
+	_, _, err = middlewares.GetTOTPAttempts(ctx, userID)
+	require.Error(t, err)
+	_, err = middlewares.RecordFailedTOTPAttempt(ctx, userID)
+	require.Error(t, err)
+}
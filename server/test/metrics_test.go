@@ -0,0 +1,206 @@
+package test
+
+import (
+	"context"
+	"database/sql"
+	"github.com/juancwu/konbini/server/db"
+	"github.com/juancwu/konbini/server/handlers"
+	"github.com/juancwu/konbini/server/memcache"
+	"github.com/juancwu/konbini/server/metrics"
+	"github.com/juancwu/konbini/server/middlewares"
+	"github.com/juancwu/konbini/server/services"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+)
+
+// metricValue returns the value of a counter or the sample count of a histogram
+// with the given name and labels. It returns 0 if the series does not exist yet.
+func metricValue(t *testing.T, name string, labels map[string]string) float64 {
+	families, err := metrics.Registry.Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+	next:
+		for _, m := range family.GetMetric() {
+			pairs := make(map[string]string)
+			for _, l := range m.GetLabel() {
+				pairs[l.GetName()] = l.GetValue()
+			}
+			for k, v := range labels {
+				if pairs[k] != v {
+					continue next
+				}
+			}
+			if m.GetHistogram() != nil {
+				return float64(m.GetHistogram().GetSampleCount())
+			}
+			return m.GetCounter().GetValue()
+		}
+	}
+	return 0
+}
+
+// fakeDBTX accepts every query without touching a database.
+type fakeDBTX struct{}
+
+func (fakeDBTX) ExecContext(context.Context, string, ...interface{}) (sql.Result, error) {
+	return nil, nil
+}
+
+func (fakeDBTX) PrepareContext(context.Context, string) (*sql.Stmt, error) {
+	return nil, nil
+}
+
+func (fakeDBTX) QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error) {
+	return nil, sql.ErrConnDone
+}
+
+func (fakeDBTX) QueryRowContext(context.Context, string, ...interface{}) *sql.Row {
+	return &sql.Row{}
+}
+
+func TestMetrics(t *testing.T) {
+	t.Run("records http requests by route and status", func(t *testing.T) {
+		e := echo.New()
+		e.HTTPErrorHandler = handlers.ErrorHandler()
+		e.Use(middlewares.RequestID())
+		e.Use(middlewares.Metrics())
+		e.GET("/metrics-test/:id", func(c echo.Context) error {
+			if c.Param("id") == "bad" {
+				return handlers.APIError{Code: http.StatusBadRequest, PublicMessage: "Bad id"}
+			}
+			return c.NoContent(http.StatusOK)
+		})
+		e.GET("/metrics", echo.WrapHandler(metrics.Handler()))
+
+		okLabels := map[string]string{"method": "GET", "route": "/metrics-test/:id", "status": "200"}
+		badLabels := map[string]string{"method": "GET", "route": "/metrics-test/:id", "status": "400"}
+		okBefore := metricValue(t, "konbini_http_request_duration_seconds", okLabels)
+		badBefore := metricValue(t, "konbini_http_request_duration_seconds", badLabels)
+
+		for _, path := range []string{"/metrics-test/1", "/metrics-test/2", "/metrics-test/bad"} {
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		}
+
+		// the error handler runs once so the error body is not written twice
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics-test/bad", nil))
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+		require.JSONEq(t, `{"code":400,"error_code":"bad_request","message":"Bad id","request_id":"`+rec.Header().Get(echo.HeaderXRequestID)+`"}`, rec.Body.String())
+
+		require.Equal(t, okBefore+2, metricValue(t, "konbini_http_request_duration_seconds", okLabels))
+		require.Equal(t, badBefore+2, metricValue(t, "konbini_http_request_duration_seconds", badLabels))
+
+		rec = httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+		body, err := io.ReadAll(rec.Body)
+		require.NoError(t, err)
+		require.Contains(t, string(body), `konbini_http_request_duration_seconds_count{method="GET",route="/metrics-test/:id",status="400"}`)
+	})
+
+	t.Run("returns errors to the outer middlewares", func(t *testing.T) {
+		apiErr := handlers.APIError{Code: http.StatusConflict, PublicMessage: "Conflict"}
+		var returned error
+		e := echo.New()
+		e.HTTPErrorHandler = handlers.ErrorHandler()
+		e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+			return func(c echo.Context) error {
+				returned = next(c)
+				return returned
+			}
+		})
+		e.Use(middlewares.Metrics())
+		e.GET("/metrics-test-error", func(c echo.Context) error {
+			return apiErr
+		})
+
+		labels := map[string]string{"method": "GET", "route": "/metrics-test-error", "status": "409"}
+		before := metricValue(t, "konbini_http_request_duration_seconds", labels)
+		unmatched := map[string]string{"method": "GET", "route": "unmatched", "status": "404"}
+		unmatchedBefore := metricValue(t, "konbini_http_request_duration_seconds", unmatched)
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics-test-error", nil))
+		require.Equal(t, http.StatusConflict, rec.Code)
+		require.Equal(t, apiErr, returned)
+		require.Equal(t, before+1, metricValue(t, "konbini_http_request_duration_seconds", labels))
+
+		rec = httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics-test-missing", nil))
+		require.Equal(t, http.StatusNotFound, rec.Code)
+		require.Equal(t, unmatchedBefore+1, metricValue(t, "konbini_http_request_duration_seconds", unmatched))
+	})
+
+	t.Run("records db queries by sqlc name", func(t *testing.T) {
+		require.Equal(t, "GetUserByEmail", db.QueryName("-- name: GetUserByEmail :one\nSELECT * FROM users"))
+		require.Equal(t, "unknown", db.QueryName("SELECT 1"))
+
+		labels := map[string]string{"query": "RemoveGroupByID", "result": metrics.RESULT_SUCCESS}
+		before := metricValue(t, "konbini_db_query_duration_seconds", labels)
+
+		q := db.New(db.Instrument(fakeDBTX{}))
+		require.NoError(t, q.RemoveGroupByID(context.Background(), "group"))
+
+		require.Equal(t, before+1, metricValue(t, "konbini_db_query_duration_seconds", labels))
+	})
+
+	t.Run("records cache hits and misses", func(t *testing.T) {
+		store := memcache.NewMemoryStore(time.Minute)
+		hits := metricValue(t, "konbini_cache_requests_total", map[string]string{"result": metrics.CACHE_HIT})
+		misses := metricValue(t, "konbini_cache_requests_total", map[string]string{"result": metrics.CACHE_MISS})
+
+		ctx := context.Background()
+		_, err := store.Get(ctx, "metrics")
+		require.ErrorIs(t, err, memcache.ErrNotFound)
+		require.NoError(t, store.Set(ctx, "metrics", []byte("1"), time.Minute))
+		_, err = store.Get(ctx, "metrics")
+		require.NoError(t, err)
+
+		require.Equal(t, hits+1, metricValue(t, "konbini_cache_requests_total", map[string]string{"result": metrics.CACHE_HIT}))
+		require.Equal(t, misses+1, metricValue(t, "konbini_cache_requests_total", map[string]string{"result": metrics.CACHE_MISS}))
+	})
+
+	t.Run("records TOTP lockouts", func(t *testing.T) {
+		memcache.SetCache(memcache.NewMemoryStore(time.Minute))
+		defer memcache.SetCache(nil)
+
+		before := metricValue(t, "konbini_auth_totp_lockouts_total", nil)
+		for i := 0; i < middlewares.MaxTOTPAttempts+2; i++ {
+			_, err := middlewares.RecordFailedTOTPAttempt(context.Background(), "metrics-user")
+			require.NoError(t, err)
+		}
+		require.Equal(t, before+1, metricValue(t, "konbini_auth_totp_lockouts_total", nil))
+	})
+
+	t.Run("records email send outcomes", func(t *testing.T) {
+		sent := metricValue(t, "konbini_email_sends_total", map[string]string{"outcome": metrics.EMAIL_SENT})
+		retries := metricValue(t, "konbini_email_sends_total", map[string]string{"outcome": metrics.EMAIL_RETRY})
+
+		store := newMemoryEmailJobStore()
+		queue := newTestEmailQueue(store, &fakeEmailSender{failures: 1}, 3)
+		queue.Start(context.Background())
+		defer queue.Stop()
+
+		_, err := queue.Enqueue(context.Background(), &services.EmailMessage{
+			From:    "verify@mail.com",
+			To:      []string{"user@mail.com"},
+			Subject: "Metrics",
+			Text:    "hello",
+		})
+		require.NoError(t, err)
+		require.Eventually(t, func() bool {
+			return metricValue(t, "konbini_email_sends_total", map[string]string{"outcome": metrics.EMAIL_SENT}) == sent+1
+		}, time.Second, time.Millisecond*5)
+		require.Equal(t, retries+1, metricValue(t, "konbini_email_sends_total", map[string]string{"outcome": metrics.EMAIL_RETRY}))
+	})
+}
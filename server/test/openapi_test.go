@@ -0,0 +1,107 @@
+package test
+
+import (
+	"encoding/json"
+	"github.com/juancwu/konbini/server/config"
+	"github.com/juancwu/konbini/server/handlers"
+	"github.com/juancwu/konbini/server/openapi"
+	"github.com/juancwu/konbini/server/routes"
+	inner_validator "github.com/juancwu/konbini/server/validator"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+)
+
+// newV1Echo registers the v1 routes the same way the server does.
+func newV1Echo() *echo.Echo {
+	e := echo.New()
+	e.Validator = inner_validator.New()
+	e.HTTPErrorHandler = handlers.ErrorHandler()
+	routes.SetupRoutesV1(&routes.RouteConfig{
+		Echo:         e.Group(routes.V1_PREFIX),
+		ServerConfig: &config.Config{},
+		Routes:       e.Routes,
+	})
+	return e
+}
+
+func getOpenAPIDocument(t *testing.T, e *echo.Echo) openapi.Document {
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, routes.V1_PREFIX+"/openapi.json", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var doc openapi.Document
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &doc))
+	return doc
+}
+
+func TestOpenAPI(t *testing.T) {
+	t.Run("every route is documented", func(t *testing.T) {
+		e := newV1Echo()
+		spec := routes.NewOpenAPISpecV1("")
+		require.Empty(t, spec.Undocumented(e.Routes()), "describe the new routes in routes.NewOpenAPISpecV1")
+		require.Empty(t, spec.Stale(e.Routes()), "remove the routes that no longer exist from routes.NewOpenAPISpecV1")
+	})
+
+	t.Run("detects undocumented routes", func(t *testing.T) {
+		e := newV1Echo()
+		e.Group(routes.V1_PREFIX).PATCH("/bento/:id", func(c echo.Context) error { return nil })
+		require.Equal(t, []string{"PATCH /api/v1/bento/:id"}, routes.NewOpenAPISpecV1("").Undocumented(e.Routes()))
+	})
+
+	t.Run("serves the document", func(t *testing.T) {
+		doc := getOpenAPIDocument(t, newV1Echo())
+		require.Equal(t, openapi.OPENAPI_VERSION, doc.OpenAPI)
+		require.Equal(t, routes.V1_PREFIX, doc.Servers[0].URL)
+
+		deleteGroup := doc.Paths["/group/{id}"]["delete"]
+		require.NotNil(t, deleteGroup)
+		require.Equal(t, "deleteGroupId", deleteGroup.OperationID)
+		require.Len(t, deleteGroup.Parameters, 2)
+		require.Equal(t, openapi.Parameter{Name: "id", In: "path", Required: true, Schema: &openapi.Schema{Type: "string"}}, deleteGroup.Parameters[0])
+		require.Equal(t, openapi.IDEMPOTENCY_KEY_HEADER, deleteGroup.Parameters[1].Name)
+		require.Equal(t, "header", deleteGroup.Parameters[1].In)
+		require.Contains(t, deleteGroup.Responses, "422")
+		require.Equal(t, []map[string][]string{{openapi.FULL_TOKEN_SCHEME: {}}}, deleteGroup.Security)
+		require.Contains(t, deleteGroup.Responses, "401")
+
+		login := doc.Paths["/auth/login"]["post"]
+		require.NotNil(t, login)
+		require.Equal(t, "#/components/schemas/LoginRequest", login.RequestBody.Content[echo.MIMEApplicationJSON].Schema.Ref)
+		require.Equal(t, "#/components/schemas/LoginResponse", login.Responses["200"].Content[echo.MIMEApplicationJSON].Schema.Ref)
+		require.Equal(t, "#/components/schemas/ErrorResponse", login.Responses["400"].Content[echo.MIMEApplicationJSON].Schema.Ref)
+		require.Empty(t, login.Security)
+	})
+
+	t.Run("schemas follow the json and validate tags", func(t *testing.T) {
+		schemas := getOpenAPIDocument(t, newV1Echo()).Components.Schemas
+
+		register := schemas["RegisterRequest"]
+		require.Equal(t, []string{"email", "password", "nickname"}, register.Required)
+		require.Equal(t, "email", register.Properties["email"].Format)
+		require.Equal(t, 12, *register.Properties["password"].MinLength)
+		require.Equal(t, 32, *register.Properties["password"].MaxLength)
+
+		login := schemas["LoginRequest"]
+		require.Equal(t, []string{"email", "password"}, login.Required)
+		require.True(t, login.Properties["totp_code"].Nullable)
+
+		bento := schemas["NewBentoRequest"]
+		require.Equal(t, []string{"name"}, bento.Required)
+		require.Equal(t, openapi.PRINTASCII_PATTERN, bento.Properties["name"].Pattern)
+		require.Equal(t, "#/components/schemas/Ingredient", bento.Properties["ingredients"].Items.Ref)
+		require.Equal(t, []string{"name"}, schemas["Ingredient"].Required)
+
+		invite := schemas["InviteUsersToJoinGroupRequest"]
+		require.Equal(t, 1, *invite.Properties["emails"].MinItems)
+		require.Equal(t, "email", invite.Properties["emails"].Items.Format)
+		require.Equal(t, "uuid", invite.Properties["group_id"].Format)
+
+		errRes := schemas["ErrorResponse"]
+		require.Equal(t, "#/components/schemas/FieldError", errRes.Properties["errors"].Items.Ref)
+		require.Equal(t, "string", errRes.Properties["error_code"].Type)
+	})
+}
@@ -0,0 +1,116 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"github.com/juancwu/konbini/common/api"
+	"github.com/juancwu/konbini/server/handlers"
+	"github.com/juancwu/konbini/server/memcache"
+	"github.com/juancwu/konbini/server/middlewares"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+)
+
+// failingStore is a memory store whose reads or increments fail, like a redis that is down.
+type failingStore struct {
+	*memcache.MemoryStore
+	failGet  bool
+	failIncr bool
+}
+
+var errCacheDown = errors.New("cache is down")
+
+func (s *failingStore) Get(ctx context.Context, key string) ([]byte, error) {
+	if s.failGet {
+		return nil, errCacheDown
+	}
+	return s.MemoryStore.Get(ctx, key)
+}
+
+func (s *failingStore) Incr(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	if s.failIncr {
+		return 0, errCacheDown
+	}
+	return s.MemoryStore.Incr(ctx, key, delta, ttl)
+}
+
+// newTOTPLimitedEcho creates a server with a TOTP route that accepts only the code "123456".
+func newTOTPLimitedEcho(calls *int) *echo.Echo {
+	e := echo.New()
+	e.HTTPErrorHandler = handlers.ErrorHandler()
+	e.POST("/totp", func(c echo.Context) error {
+		*calls++
+		if c.QueryParam("code") != "123456" {
+			return handlers.APIError{
+				Code:          http.StatusBadRequest,
+				PublicMessage: "Invalid code.",
+				ErrorCode:     api.ErrorCodeInvalidTOTPCode,
+			}
+		}
+		return c.NoContent(http.StatusOK)
+	}, middlewares.LimitTOTPAttempts("totp-user"))
+	return e
+}
+
+func postTOTP(e *echo.Echo, code string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/totp?code="+code, nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestLimitTOTPAttempts(t *testing.T) {
+	t.Run("locks out after the maximum failed attempts", func(t *testing.T) {
+		memcache.SetCache(memcache.NewMemoryStore(time.Minute))
+		defer memcache.SetCache(nil)
+
+		calls := 0
+		e := newTOTPLimitedEcho(&calls)
+		for i := 1; i < middlewares.MaxTOTPAttempts; i++ {
+			rec := postTOTP(e, "000000")
+			require.Equal(t, http.StatusBadRequest, rec.Code)
+			require.Equal(t, api.ErrorCodeInvalidTOTPCode, errorCode(t, rec))
+		}
+		rec := postTOTP(e, "000000")
+		require.Equal(t, http.StatusTooManyRequests, rec.Code)
+		require.NotEmpty(t, rec.Header().Get("Retry-After"))
+
+		// the correct code is rejected too until the cooldown ends
+		rec = postTOTP(e, "123456")
+		require.Equal(t, http.StatusTooManyRequests, rec.Code)
+		require.Equal(t, api.ErrorCodeRateLimited, errorCode(t, rec))
+		require.Equal(t, middlewares.MaxTOTPAttempts, calls)
+	})
+
+	t.Run("fails closed when the attempts can't be read", func(t *testing.T) {
+		memcache.SetCache(&failingStore{MemoryStore: memcache.NewMemoryStore(time.Minute), failGet: true})
+		defer memcache.SetCache(nil)
+
+		calls := 0
+		rec := postTOTP(newTOTPLimitedEcho(&calls), "123456")
+		require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+		require.Equal(t, api.ErrorCodeUnavailable, errorCode(t, rec))
+		require.Zero(t, calls)
+	})
+
+	t.Run("fails closed when a failed attempt can't be recorded", func(t *testing.T) {
+		memcache.SetCache(&failingStore{MemoryStore: memcache.NewMemoryStore(time.Minute), failIncr: true})
+		defer memcache.SetCache(nil)
+
+		calls := 0
+		e := newTOTPLimitedEcho(&calls)
+		for i := 0; i <= middlewares.MaxTOTPAttempts; i++ {
+			rec := postTOTP(e, "000000")
+			require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+			require.Equal(t, api.ErrorCodeUnavailable, errorCode(t, rec))
+		}
+
+		rec := postTOTP(e, "123456")
+		require.Equal(t, http.StatusOK, rec.Code)
+	})
+}
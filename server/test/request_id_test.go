@@ -0,0 +1,110 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	commonApi "github.com/juancwu/konbini/common/api"
+	"github.com/juancwu/konbini/server/handlers"
+	"github.com/juancwu/konbini/server/middlewares"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func newRequestIdTestServer(logs *bytes.Buffer) *echo.Echo {
+	e := echo.New()
+	e.HTTPErrorHandler = handlers.ErrorHandler()
+	e.Use(middlewares.RequestID())
+	e.Use(middlewares.LoggerWithConfig(middlewares.LoggerConfig{
+		Logger: zerolog.New(logs),
+	}))
+	e.GET("/ok", func(c echo.Context) error {
+		middlewares.GetLogger(c).Info().Msg("from handler")
+		return c.NoContent(http.StatusOK)
+	})
+	e.GET("/fail", func(c echo.Context) error {
+		return handlers.APIError{
+			Code:          http.StatusBadRequest,
+			PublicMessage: "Bad input",
+		}
+	})
+	return e
+}
+
+func TestRequestID(t *testing.T) {
+	t.Run("generates an id when missing", func(t *testing.T) {
+		var logs bytes.Buffer
+		e := newRequestIdTestServer(&logs)
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ok", nil))
+
+		id := rec.Header().Get(commonApi.HeaderRequestID)
+		_, err := uuid.Parse(id)
+		require.NoError(t, err)
+		require.Contains(t, logs.String(), `"request_id":"`+id+`"`)
+	})
+
+	t.Run("accepts the id sent by the client", func(t *testing.T) {
+		var logs bytes.Buffer
+		e := newRequestIdTestServer(&logs)
+
+		req := httptest.NewRequest(http.MethodGet, "/ok", nil)
+		req.Header.Set(commonApi.HeaderRequestID, "cli-1234")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		require.Equal(t, "cli-1234", rec.Header().Get(commonApi.HeaderRequestID))
+		for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+			require.Contains(t, line, `"request_id":"cli-1234"`)
+		}
+	})
+
+	t.Run("replaces invalid ids", func(t *testing.T) {
+		var logs bytes.Buffer
+		e := newRequestIdTestServer(&logs)
+
+		req := httptest.NewRequest(http.MethodGet, "/ok", nil)
+		req.Header.Set(commonApi.HeaderRequestID, `bad"id with spaces`)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		_, err := uuid.Parse(rec.Header().Get(commonApi.HeaderRequestID))
+		require.NoError(t, err)
+	})
+
+	t.Run("error responses include the id", func(t *testing.T) {
+		var logs bytes.Buffer
+		e := newRequestIdTestServer(&logs)
+
+		for _, path := range []string{"/fail", "/not-found"} {
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+			var body commonApi.ErrorResponse
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+			require.NotEmpty(t, body.RequestId)
+			require.Equal(t, rec.Header().Get(commonApi.HeaderRequestID), body.RequestId)
+
+			errRes := commonApi.ParseErrorResponse(rec.Result(), rec.Body.Bytes())
+			require.Equal(t, rec.Code, errRes.Code)
+			require.Contains(t, errRes.Error(), "(request id: "+body.RequestId+")")
+		}
+	})
+
+	t.Run("parses responses without an error body", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		rec.Header().Set(commonApi.HeaderRequestID, "abc")
+		rec.WriteHeader(http.StatusBadGateway)
+
+		errRes := commonApi.ParseErrorResponse(rec.Result(), []byte("<html>bad gateway</html>"))
+		require.Equal(t, http.StatusBadGateway, errRes.Code)
+		require.Equal(t, "Bad Gateway (request id: abc)", errRes.Error())
+	})
+}
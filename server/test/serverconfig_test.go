@@ -1,6 +1,7 @@
 package test
 
 import (
+	"encoding/hex"
 	"github.com/juancwu/konbini/server/config"
 	"os"
 	"testing"
@@ -28,10 +29,17 @@ func TestConfig(t *testing.T) {
 		require.Equal(t, os.Getenv("PORT"), c.GetRawPort())
 		require.Equal(t, ":"+os.Getenv("PORT"), c.GetPort())
 		require.Equal(t, os.Getenv("RESEND_API_KEY"), c.GetResendApiKey())
+		require.Equal(t, config.EMAIL_TRANSPORT_CONSOLE, c.GetEmailTransport())
+		require.Equal(t, config.TRACING_EXPORTER_NONE, c.GetTracingExporter())
+		require.Equal(t, "konbini", c.GetServiceName())
+		require.Equal(t, os.Getenv("METRICS_ADDRESS"), c.GetMetricsAddress())
 		require.Equal(t, os.Getenv("VERIFY_EMAIL_ADDRESS"), c.GetVerifyEmailAddress())
-		require.Equal(t, []byte(os.Getenv("AUTH_TOKEN_KEY")), c.GetAuthTokenKey())
-		require.Equal(t, []byte(os.Getenv("BENTO_TOKEN_KEY")), c.GetBentoTokenKey())
-		require.Equal(t, []byte(os.Getenv("EMAIL_TOKEN_KEY")), c.GetEmailTokenKey())
+		require.Equal(t, os.Getenv("GROUP_INVITATION_EMAIL_ADDRESS"), c.GetGroupInvitationEmailAddress())
+		require.Equal(t, decodeHex(t, os.Getenv("AUTH_TOKEN_KEY")), c.GetAuthTokenKey())
+		require.Equal(t, decodeHex(t, os.Getenv("BENTO_TOKEN_KEY")), c.GetBentoTokenKey())
+		require.Equal(t, decodeHex(t, os.Getenv("EMAIL_TOKEN_KEY")), c.GetEmailTokenKey())
+		require.Equal(t, 2, c.GetEmailQueueWorkers())
+		require.Equal(t, 5, c.GetEmailMaxAttempts())
 		require.True(t, c.IsTesting())
 	})
 
@@ -119,3 +127,9 @@ func TestConfig(t *testing.T) {
 		require.Equal(t, os.Getenv("DATABASE_AUTH_TOKEN"), token)
 	})
 }
+
+func decodeHex(t *testing.T, value string) []byte {
+	decoded, err := hex.DecodeString(value)
+	require.NoError(t, err)
+	return decoded
+}
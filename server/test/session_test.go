@@ -0,0 +1,158 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/juancwu/konbini/common/api"
+	"github.com/juancwu/konbini/server/config"
+	"github.com/juancwu/konbini/server/db"
+	"github.com/juancwu/konbini/server/handlers"
+	"github.com/juancwu/konbini/server/middlewares"
+	"github.com/juancwu/konbini/server/services"
+	"github.com/juancwu/konbini/server/utils"
+	inner_validator "github.com/juancwu/konbini/server/validator"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+)
+
+// newSessionEcho is a server instance with the routes that check and revoke auth tokens.
+func newSessionEcho(connector *db.DBConnector) *echo.Echo {
+	e := echo.New()
+	e.Validator = inner_validator.New()
+	e.HTTPErrorHandler = handlers.ErrorHandler()
+	e.POST(
+		api.UriCheckToken,
+		handlers.CheckAuthToken(connector),
+		middlewares.ValidateJson(reflect.TypeOf(api.CheckAuthTokenRequest{})),
+	)
+	e.POST(
+		api.UriLogout,
+		handlers.Logout(connector),
+		middlewares.ProtectAll(connector),
+	)
+	return e
+}
+
+// newTestAuthToken stores a full auth token of the user and returns it packaged like after a login.
+func newTestAuthToken(t *testing.T, connector *db.DBConnector, userID string) string {
+	conn, err := connector.Connect()
+	require.NoError(t, err)
+	defer conn.Close()
+	now := time.Now()
+	exp := now.Add(time.Hour)
+	row, err := db.New(conn).NewAuthToken(context.Background(), db.NewAuthTokenParams{
+		UserID:    userID,
+		TokenType: services.FULL_USER_TOKEN_TYPE.String(),
+		CreatedAt: utils.FormatRFC3339NanoFixed(now),
+		ExpiresAt: utils.FormatRFC3339NanoFixed(exp),
+	})
+	require.NoError(t, err)
+	authToken, err := services.NewAuthToken(row.ID, userID, services.FULL_USER_TOKEN_TYPE, exp)
+	require.NoError(t, err)
+	token, err := authToken.Package()
+	require.NoError(t, err)
+	return token
+}
+
+func TestLogout(t *testing.T) {
+	_, err := config.New()
+	require.NoError(t, err)
+	connector := newTestDB(t)
+	e := newSessionEcho(connector)
+
+	logout := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, api.UriLogout, nil)
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	checkToken := func(token string) *httptest.ResponseRecorder {
+		body, err := json.Marshal(api.CheckAuthTokenRequest{AuthToken: token})
+		require.NoError(t, err)
+		req := httptest.NewRequest(http.MethodPost, api.UriCheckToken, bytes.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	userID := newTestUser(t, connector, "logout@mail.com")
+	current := newTestAuthToken(t, connector, userID)
+	other := newTestAuthToken(t, connector, userID)
+	require.Equal(t, http.StatusOK, checkToken(current).Code)
+
+	require.Equal(t, http.StatusOK, logout(current).Code)
+
+	t.Run("revokes the token of the request", func(t *testing.T) {
+		rec := checkToken(current)
+		require.Equal(t, http.StatusUnauthorized, rec.Code)
+		require.Equal(t, api.ErrorCodeInvalidToken, errorCode(t, rec))
+		require.Equal(t, http.StatusUnauthorized, logout(current).Code)
+	})
+
+	t.Run("keeps the other tokens of the user", func(t *testing.T) {
+		require.Equal(t, http.StatusOK, checkToken(other).Code)
+	})
+}
+
+func TestProtectAdmin(t *testing.T) {
+	t.Setenv("ADMIN_EMAILS", "admin@mail.com")
+	_, err := config.New()
+	require.NoError(t, err)
+	// reload the configuration without the admin emails for the next tests
+	t.Cleanup(func() {
+		os.Unsetenv("ADMIN_EMAILS")
+		_, err := config.New()
+		require.NoError(t, err)
+	})
+
+	// the user is set like the Protect middleware does
+	e := echo.New()
+	e.HTTPErrorHandler = handlers.ErrorHandler()
+	e.GET("/admin", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}, func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set("user", db.User{
+				ID:            "user-1",
+				Email:         c.Request().Header.Get("X-Email"),
+				EmailVerified: c.Request().Header.Get("X-Verified") == "true",
+			})
+			return next(c)
+		}
+	}, middlewares.ProtectAdmin())
+	request := func(email string, verified bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+		req.Header.Set("X-Email", email)
+		req.Header.Set("X-Verified", strconv.FormatBool(verified))
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("allows verified admins", func(t *testing.T) {
+		require.Equal(t, http.StatusOK, request("ADMIN@mail.com", true).Code)
+	})
+
+	t.Run("rejects admins with an unverified email", func(t *testing.T) {
+		rec := request("admin@mail.com", false)
+		require.Equal(t, http.StatusForbidden, rec.Code)
+		require.Equal(t, api.ErrorCodeForbidden, errorCode(t, rec))
+	})
+
+	t.Run("rejects other users", func(t *testing.T) {
+		rec := request("user@mail.com", true)
+		require.Equal(t, http.StatusForbidden, rec.Code)
+		require.Equal(t, api.ErrorCodeForbidden, errorCode(t, rec))
+	})
+}
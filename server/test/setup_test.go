@@ -51,6 +51,7 @@ func setupEnvironmentVariables() error {
 
 	os.Setenv("RESEND_API_KEY", "key")
 	os.Setenv("VERIFY_EMAIL_ADDRESS", "verify@mail.com")
+	os.Setenv("GROUP_INVITATION_EMAIL_ADDRESS", "invitation@mail.com")
 
 	os.Setenv("AUTH_TOKEN_KEY", "f1d850bbac1d076100a12ef50be2020d8d8eb4888c174124af66148e34d3c160")
 	os.Setenv("BENTO_TOKEN_KEY", "f1d850bbac1d076100a12ef50be2020d8d8eb4888c174124af66148e34d3c160")
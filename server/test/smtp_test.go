@@ -0,0 +1,449 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/juancwu/konbini/server/config"
+	"github.com/juancwu/konbini/server/services"
+	"io"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/require"
+)
+
+// receivedEmail is an email accepted by the smtpStandIn.
+type receivedEmail struct {
+	From     string
+	To       []string
+	Data     []byte
+	TLS      bool
+	AuthUser string
+}
+
+// smtpStandIn is a minimal SMTP server that accepts every email and keeps it in memory.
+// It supports STARTTLS when a tls config is given and AUTH PLAIN when a username is set.
+type smtpStandIn struct {
+	listener  net.Listener
+	tlsConfig *tls.Config
+	username  string
+	password  string
+	// dropOnQuit closes the connection without replying to QUIT.
+	dropOnQuit bool
+
+	mu       sync.Mutex
+	messages []receivedEmail
+}
+
+func newSMTPStandIn(t *testing.T, tlsConfig *tls.Config, username, password string) *smtpStandIn {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &smtpStandIn{
+		listener:  l,
+		tlsConfig: tlsConfig,
+		username:  username,
+		password:  password,
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { l.Close() })
+	return s
+}
+
+func (s *smtpStandIn) smtpConfig(tlsMode string) config.SMTPConfig {
+	host, port, _ := net.SplitHostPort(s.listener.Addr().String())
+	return config.SMTPConfig{
+		Host:     host,
+		Port:     port,
+		Username: s.username,
+		Password: s.password,
+		TLS:      tlsMode,
+	}
+}
+
+func (s *smtpStandIn) received() []receivedEmail {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]receivedEmail(nil), s.messages...)
+}
+
+func (s *smtpStandIn) serve(conn net.Conn) {
+	defer func() { conn.Close() }()
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 konbini-test ESMTP")
+
+	var tlsOn bool
+	var authUser string
+	var current receivedEmail
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			tp.PrintfLine("250-konbini-test")
+			if s.tlsConfig != nil && !tlsOn {
+				tp.PrintfLine("250-STARTTLS")
+			}
+			if s.username != "" {
+				tp.PrintfLine("250-AUTH PLAIN")
+			}
+			tp.PrintfLine("250 8BITMIME")
+		case "STARTTLS":
+			if s.tlsConfig == nil || tlsOn {
+				tp.PrintfLine("502 STARTTLS not available")
+				continue
+			}
+			tp.PrintfLine("220 Ready to start TLS")
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn = tlsConn
+			tp = textproto.NewConn(conn)
+			tlsOn = true
+		case "AUTH":
+			mechanism, initial, _ := strings.Cut(arg, " ")
+			decoded, err := base64.StdEncoding.DecodeString(initial)
+			parts := bytes.Split(decoded, []byte{0})
+			if strings.ToUpper(mechanism) != "PLAIN" || err != nil || len(parts) != 3 ||
+				string(parts[1]) != s.username || string(parts[2]) != s.password {
+				tp.PrintfLine("535 Authentication failed")
+				continue
+			}
+			authUser = s.username
+			tp.PrintfLine("235 Authentication successful")
+		case "MAIL":
+			if s.username != "" && authUser == "" {
+				tp.PrintfLine("530 Authentication required")
+				continue
+			}
+			current = receivedEmail{From: smtpPath(arg), TLS: tlsOn, AuthUser: authUser}
+			tp.PrintfLine("250 OK")
+		case "RCPT":
+			current.To = append(current.To, smtpPath(arg))
+			tp.PrintfLine("250 OK")
+		case "DATA":
+			tp.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			current.Data = data
+			s.mu.Lock()
+			s.messages = append(s.messages, current)
+			s.mu.Unlock()
+			tp.PrintfLine("250 OK")
+		case "RSET", "NOOP":
+			tp.PrintfLine("250 OK")
+		case "QUIT":
+			if s.dropOnQuit {
+				return
+			}
+			tp.PrintfLine("221 Bye")
+			return
+		default:
+			tp.PrintfLine("502 Command not implemented")
+		}
+	}
+}
+
+// smtpPath extracts the address from "FROM:<a@b.com>" or "TO:<a@b.com>".
+func smtpPath(arg string) string {
+	start := strings.Index(arg, "<")
+	end := strings.Index(arg, ">")
+	if start < 0 || end < start {
+		return ""
+	}
+	return arg[start+1 : end]
+}
+
+// newTestTLSConfigs creates a self-signed certificate for 127.0.0.1 and returns
+// the server config and a client config that trusts it.
+func newTestTLSConfigs(t *testing.T) (*tls.Config, *tls.Config) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "konbini-test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	server := &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+	client := &tls.Config{RootCAs: pool, ServerName: "127.0.0.1"}
+	return server, client
+}
+
+// readEmailBodies parses a raw email and returns the decoded bodies by content type.
+func readEmailBodies(t *testing.T, raw []byte) (*mail.Message, map[string]string) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	require.NoError(t, err)
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	require.NoError(t, err)
+
+	bodies := make(map[string]string)
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		var body io.Reader = msg.Body
+		if strings.EqualFold(msg.Header.Get("Content-Transfer-Encoding"), "quoted-printable") {
+			body = quotedprintable.NewReader(body)
+		}
+		b, err := io.ReadAll(body)
+		require.NoError(t, err)
+		bodies[mediaType] = string(b)
+		return msg, bodies
+	}
+	r := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := r.NextPart()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		partType, _, err := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		require.NoError(t, err)
+		// quoted-printable parts are decoded by the multipart reader
+		b, err := io.ReadAll(part)
+		require.NoError(t, err)
+		bodies[partType] = string(b)
+	}
+	return msg, bodies
+}
+
+func TestSMTPEmailSender(t *testing.T) {
+	_, err := config.New()
+	require.NoError(t, err)
+
+	serverTLS, clientTLS := newTestTLSConfigs(t)
+
+	startQueue := func(t *testing.T, sender services.EmailSender) {
+		queue := services.NewEmailQueue(newMemoryEmailJobStore(), sender, services.EmailQueueConfig{
+			Workers:      1,
+			MaxAttempts:  1,
+			PollInterval: time.Millisecond * 10,
+		})
+		queue.Start(context.Background())
+		services.SetDefaultEmailQueue(queue)
+		t.Cleanup(func() {
+			queue.Stop()
+			services.SetDefaultEmailQueue(nil)
+		})
+	}
+
+	t.Run("delivers verification email over STARTTLS with auth", func(t *testing.T) {
+		standIn := newSMTPStandIn(t, serverTLS, "konbini", "secret")
+		sender := services.NewSMTPEmailSender(standIn.smtpConfig(config.SMTP_TLS_STARTTLS))
+		sender.TLSConfig = clientTLS
+		startQueue(t, sender)
+
+		_, err := services.SendVerificationEmail(context.Background(), "user@mail.com", "verify-token")
+		require.NoError(t, err)
+
+		require.Eventually(t, func() bool {
+			return len(standIn.received()) == 1
+		}, time.Second*5, time.Millisecond*10)
+
+		received := standIn.received()[0]
+		require.True(t, received.TLS)
+		require.Equal(t, "konbini", received.AuthUser)
+		require.Equal(t, "verify@mail.com", received.From)
+		require.Equal(t, []string{"user@mail.com"}, received.To)
+
+		msg, bodies := readEmailBodies(t, received.Data)
+		require.Equal(t, "Verify Your Email", msg.Header.Get("Subject"))
+		url := "http://127.0.0.1:3000/api/v1/auth/email/verify?token=verify-token"
+		require.Contains(t, bodies["text/plain"], url)
+		require.Contains(t, bodies["text/html"], url)
+	})
+
+	t.Run("delivers group invitations", func(t *testing.T) {
+		standIn := newSMTPStandIn(t, nil, "", "")
+		sender := services.NewSMTPEmailSender(standIn.smtpConfig(config.SMTP_TLS_NONE))
+		startQueue(t, sender)
+
+		params := services.SendGroupInvitationEmailsParams{
+			InvitorName: "Juan",
+			GroupName:   "devs",
+		}
+		params.Users = append(params.Users,
+			struct {
+				Name  string
+				Token string
+				Email string
+			}{Name: "Ana", Token: "token-ana", Email: "ana@mail.com"},
+			struct {
+				Name  string
+				Token string
+				Email string
+			}{Name: "Bo", Token: "token-bo", Email: "bo@mail.com"},
+		)
+		ids, err := services.SendGroupInvitationEmails(context.Background(), params)
+		require.NoError(t, err)
+		require.Len(t, ids, 2)
+
+		require.Eventually(t, func() bool {
+			return len(standIn.received()) == 2
+		}, time.Second*5, time.Millisecond*10)
+
+		tokens := make(map[string]string)
+		for _, received := range standIn.received() {
+			require.False(t, received.TLS)
+			require.Equal(t, "invitation@mail.com", received.From)
+			require.Len(t, received.To, 1)
+			msg, bodies := readEmailBodies(t, received.Data)
+			require.Equal(t, "Join Group [devs]", msg.Header.Get("Subject"))
+			tokens[received.To[0]] = bodies["text/html"]
+		}
+		require.Contains(t, tokens["ana@mail.com"], "/api/v1/group/invitation/accept?token=token-ana")
+		require.Contains(t, tokens["bo@mail.com"], "/api/v1/group/invitation/accept?token=token-bo")
+	})
+
+	t.Run("fails when STARTTLS is not offered", func(t *testing.T) {
+		standIn := newSMTPStandIn(t, nil, "", "")
+		sender := services.NewSMTPEmailSender(standIn.smtpConfig(config.SMTP_TLS_STARTTLS))
+
+		_, err := sender.Send(context.Background(), &services.EmailMessage{
+			From:    "verify@mail.com",
+			To:      []string{"user@mail.com"},
+			Subject: "hi",
+			Text:    "hello",
+		})
+		require.ErrorIs(t, err, services.ErrSMTPStartTLSUnsupported)
+		require.Empty(t, standIn.received())
+	})
+
+	t.Run("accepts the email when QUIT fails", func(t *testing.T) {
+		standIn := newSMTPStandIn(t, nil, "", "")
+		standIn.dropOnQuit = true
+		sender := services.NewSMTPEmailSender(standIn.smtpConfig(config.SMTP_TLS_NONE))
+
+		messageID, err := sender.Send(context.Background(), &services.EmailMessage{
+			From:    "verify@mail.com",
+			To:      []string{"user@mail.com"},
+			Subject: "Hello",
+			Text:    "Hello",
+		})
+		require.NoError(t, err)
+		require.NotEmpty(t, messageID)
+		require.Len(t, standIn.received(), 1)
+	})
+
+	t.Run("rejects wrong credentials", func(t *testing.T) {
+		standIn := newSMTPStandIn(t, serverTLS, "konbini", "secret")
+		cfg := standIn.smtpConfig(config.SMTP_TLS_STARTTLS)
+		cfg.Password = "wrong"
+		sender := services.NewSMTPEmailSender(cfg)
+		sender.TLSConfig = clientTLS
+
+		_, err := sender.Send(context.Background(), &services.EmailMessage{
+			From:    "verify@mail.com",
+			To:      []string{"user@mail.com"},
+			Subject: "hi",
+			Text:    "hello",
+		})
+		require.Error(t, err)
+		require.Empty(t, standIn.received())
+	})
+}
+
+func TestFileEmailSender(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "emails")
+	sender := services.NewFileEmailSender(dir)
+
+	id, err := sender.Send(context.Background(), &services.EmailMessage{
+		From:    "Konbini <verify@mail.com>",
+		To:      []string{"user@mail.com"},
+		Subject: "Verify Your Email",
+		Html:    "<p>hello</p>",
+		Text:    "hello",
+	})
+	require.NoError(t, err)
+	require.True(t, strings.HasSuffix(id, "@mail.com"))
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, ".eml", filepath.Ext(entries[0].Name()))
+
+	raw, err := os.ReadFile(filepath.Join(dir, entries[0].Name()))
+	require.NoError(t, err)
+	msg, bodies := readEmailBodies(t, raw)
+	require.Equal(t, "<"+id+">", msg.Header.Get("Message-ID"))
+	require.Equal(t, "user@mail.com", msg.Header.Get("To"))
+	require.Equal(t, "hello", bodies["text/plain"])
+	require.Equal(t, "<p>hello</p>", bodies["text/html"])
+}
+
+func TestConsoleEmailSender(t *testing.T) {
+	var logs bytes.Buffer
+	logger := log.Logger
+	log.Logger = zerolog.New(&logs)
+	t.Cleanup(func() { log.Logger = logger })
+
+	send := func(msg *services.EmailMessage) map[string]interface{} {
+		logs.Reset()
+		_, err := (&services.ConsoleEmailSender{}).Send(context.Background(), msg)
+		require.NoError(t, err)
+		// goroutines of other tests may log too
+		for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+			var entry map[string]interface{}
+			require.NoError(t, json.Unmarshal([]byte(line), &entry))
+			if entry["message"] == "Email" {
+				return entry
+			}
+		}
+		t.Fatal("email was not logged")
+		return nil
+	}
+
+	t.Run("logs the text body", func(t *testing.T) {
+		entry := send(&services.EmailMessage{From: "verify@mail.com", To: []string{"user@mail.com"}, Html: "<p>hello</p>", Text: "hello"})
+		require.Equal(t, "hello", entry["text"])
+		require.NotContains(t, entry, "html")
+	})
+
+	t.Run("logs the html body when there is no text body", func(t *testing.T) {
+		entry := send(&services.EmailMessage{From: "verify@mail.com", To: []string{"user@mail.com"}, Html: "<p>hello</p>"})
+		require.Equal(t, "<p>hello</p>", entry["html"])
+		require.NotContains(t, entry, "text")
+	})
+}
@@ -0,0 +1,156 @@
+package test
+
+import (
+	"context"
+	"github.com/juancwu/konbini/cli/telemetry"
+	"github.com/juancwu/konbini/server/db"
+	"github.com/juancwu/konbini/server/handlers"
+	"github.com/juancwu/konbini/server/middlewares"
+	"github.com/juancwu/konbini/server/services"
+	inner_validator "github.com/juancwu/konbini/server/validator"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// useSpanRecorder installs a tracer provider that keeps every finished span in memory.
+func useSpanRecorder(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+	})
+	return recorder
+}
+
+// findSpan returns the first finished span with the given name.
+func findSpan(t *testing.T, recorder *tracetest.SpanRecorder, name string) sdktrace.ReadOnlySpan {
+	for _, span := range recorder.Ended() {
+		if span.Name() == name {
+			return span
+		}
+	}
+	names := []string{}
+	for _, span := range recorder.Ended() {
+		names = append(names, span.Name())
+	}
+	require.Failf(t, "span not found", "no span named %q in [%s]", name, strings.Join(names, ", "))
+	return nil
+}
+
+type traceTestRequest struct {
+	Name string `json:"name" validate:"required"`
+}
+
+func newTracingTestServer() *echo.Echo {
+	e := echo.New()
+	e.Validator = inner_validator.New()
+	e.JSONSerializer = middlewares.TracedJSONSerializer{}
+	e.HTTPErrorHandler = handlers.ErrorHandler()
+	e.Use(middlewares.RequestID())
+	e.Use(middlewares.Tracing())
+	e.Use(middlewares.Metrics())
+	e.POST(
+		"/trace-test/:id",
+		func(c echo.Context) error {
+			q := db.New(db.Instrument(fakeDBTX{}))
+			if err := q.RemoveGroupByID(c.Request().Context(), c.Param("id")); err != nil {
+				return err
+			}
+			return c.JSON(http.StatusOK, map[string]string{"id": c.Param("id")})
+		},
+		middlewares.ValidateJson(reflect.TypeOf(traceTestRequest{})),
+	)
+	return e
+}
+
+func TestTracing(t *testing.T) {
+	t.Run("continues the trace sent by the cli", func(t *testing.T) {
+		recorder := useSpanRecorder(t)
+		server := httptest.NewServer(newTracingTestServer())
+		defer server.Close()
+
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/trace-test/abc", strings.NewReader(`{"name":"bento"}`))
+		require.NoError(t, err)
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		res, err := telemetry.NewHTTPClient(time.Second * 5).Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		client := findSpan(t, recorder, "HTTP POST")
+		root := findSpan(t, recorder, "POST /trace-test/:id")
+		require.Equal(t, client.SpanContext().TraceID(), root.SpanContext().TraceID())
+		require.Equal(t, client.SpanContext().SpanID(), root.Parent().SpanID())
+
+		// middleware, database and encoding spans are children of the request span
+		for _, name := range []string{"middlewares.ValidateJson", "RemoveGroupByID", "json.encode"} {
+			span := findSpan(t, recorder, name)
+			require.Equal(t, root.SpanContext().SpanID(), span.Parent().SpanID(), name)
+		}
+	})
+
+	t.Run("records rejected requests", func(t *testing.T) {
+		recorder := useSpanRecorder(t)
+		e := newTracingTestServer()
+
+		req := httptest.NewRequest(http.MethodPost, "/trace-test/abc", strings.NewReader(""))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+
+		validate := findSpan(t, recorder, "middlewares.ValidateJson")
+		require.Equal(t, codes.Error, validate.Status().Code)
+		for _, span := range recorder.Ended() {
+			require.NotEqual(t, "RemoveGroupByID", span.Name())
+		}
+	})
+
+	t.Run("records email sends", func(t *testing.T) {
+		recorder := useSpanRecorder(t)
+
+		store := newMemoryEmailJobStore()
+		queue := newTestEmailQueue(store, &fakeEmailSender{failures: 1}, 3)
+		queue.Start(context.Background())
+		defer queue.Stop()
+
+		id, err := queue.Enqueue(context.Background(), &services.EmailMessage{
+			From:    "verify@mail.com",
+			To:      []string{"user@mail.com"},
+			Subject: "Tracing",
+			Text:    "hello",
+		})
+		require.NoError(t, err)
+		require.Eventually(t, func() bool {
+			return store.get(id).Status == services.EMAIL_JOB_SENT
+		}, time.Second, time.Millisecond*5)
+
+		var failed, sent int
+		for _, span := range recorder.Ended() {
+			if span.Name() != "email.send" {
+				continue
+			}
+			if span.Status().Code == codes.Error {
+				failed++
+			} else {
+				sent++
+			}
+		}
+		require.Equal(t, 1, failed)
+		require.Equal(t, 1, sent)
+	})
+}
@@ -0,0 +1,113 @@
+package test
+
+import (
+	"encoding/json"
+	"github.com/juancwu/konbini/common/api"
+	"github.com/juancwu/konbini/server/handlers"
+	"github.com/juancwu/konbini/server/middlewares"
+	inner_validator "github.com/juancwu/konbini/server/validator"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+)
+
+// postValidated sends body to a route that only validates it against structType.
+func postValidated(t *testing.T, structType reflect.Type, body string) (int, api.ErrorResponse) {
+	e := echo.New()
+	e.Validator = inner_validator.New()
+	e.HTTPErrorHandler = handlers.ErrorHandler()
+	e.POST("/validate", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}, middlewares.ValidateJson(structType))
+
+	req := httptest.NewRequest(http.MethodPost, "/validate", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	var errRes api.ErrorResponse
+	if rec.Code != http.StatusOK {
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &errRes))
+	}
+	return rec.Code, errRes
+}
+
+func TestValidationErrors(t *testing.T) {
+	t.Run("reports every invalid field by its json name", func(t *testing.T) {
+		code, errRes := postValidated(t, reflect.TypeOf(api.RegisterRequest{}), `{"email":"not-an-email","password":"short"}`)
+		require.Equal(t, http.StatusBadRequest, code)
+		require.Equal(t, "Request body failed validation.", errRes.Message)
+		require.Equal(t, []api.FieldError{
+			{Field: "email", Rule: "email", Message: "email must be a valid email address"},
+			{Field: "password", Rule: "min", Param: "12", Message: "password must be at least 12 characters long"},
+			{Field: "nickname", Rule: "required", Message: "nickname is required"},
+		}, errRes.Errors)
+		require.Equal(t, map[string]string{
+			"email":    "email must be a valid email address",
+			"password": "password must be at least 12 characters long",
+			"nickname": "nickname is required",
+		}, errRes.FieldErrors())
+	})
+
+	t.Run("reports nested fields with their path", func(t *testing.T) {
+		code, errRes := postValidated(t, reflect.TypeOf(api.NewBentoRequest{}), `{"name":"bento","ingredients":[{"name":"KEY"},{"name":""}]}`)
+		require.Equal(t, http.StatusBadRequest, code)
+		require.Len(t, errRes.Errors, 1)
+		require.Equal(t, "ingredients[1].name", errRes.Errors[0].Field)
+		require.Equal(t, "required", errRes.Errors[0].Rule)
+	})
+
+	t.Run("reports json type mismatches", func(t *testing.T) {
+		code, errRes := postValidated(t, reflect.TypeOf(api.RegisterRequest{}), `{"email":42}`)
+		require.Equal(t, http.StatusBadRequest, code)
+		require.Equal(t, []api.FieldError{
+			{Field: "email", Rule: "type", Param: "string", Message: "email must be of type string"},
+		}, errRes.Errors)
+	})
+
+	t.Run("valid body passes", func(t *testing.T) {
+		code, _ := postValidated(t, reflect.TypeOf(api.RegisterRequest{}), `{"email":"user@mail.com","password":"long-enough-password","nickname":"user"}`)
+		require.Equal(t, http.StatusOK, code)
+	})
+
+	t.Run("only request body errors are validation errors", func(t *testing.T) {
+		// a handler decoding stored json or validating something else fails with a server error
+		e := echo.New()
+		e.HTTPErrorHandler = handlers.ErrorHandler()
+		e.GET("/type", func(c echo.Context) error {
+			var n int
+			return json.Unmarshal([]byte(`"text"`), &n)
+		})
+		e.GET("/validate", func(c echo.Context) error {
+			return inner_validator.New().Validate(api.RegisterRequest{})
+		})
+		for _, path := range []string{"/type", "/validate"} {
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+			require.Equal(t, http.StatusInternalServerError, rec.Code, path)
+			var errRes api.ErrorResponse
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &errRes))
+			require.Empty(t, errRes.Errors, path)
+		}
+
+		err := &middlewares.RequestBodyError{Err: json.Unmarshal([]byte(`"text"`), new(int))}
+		require.Equal(t, http.StatusBadRequest, middlewares.ErrorStatus(err))
+	})
+
+	t.Run("error message lists the invalid fields", func(t *testing.T) {
+		errRes := api.ErrorResponse{
+			Message:   "Request body failed validation.",
+			RequestId: "abc",
+			Errors: []api.FieldError{
+				{Field: "email", Rule: "required", Message: "email is required"},
+				{Field: "password", Rule: "required", Message: "password is required"},
+			},
+		}
+		require.Equal(t, "Request body failed validation: email is required; password is required (request id: abc)", errRes.Error())
+	})
+}
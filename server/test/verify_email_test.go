@@ -0,0 +1,169 @@
+package test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/juancwu/konbini/common/api"
+	"github.com/juancwu/konbini/server/config"
+	"github.com/juancwu/konbini/server/db"
+	"github.com/juancwu/konbini/server/events"
+	"github.com/juancwu/konbini/server/handlers"
+	"github.com/juancwu/konbini/server/services"
+	"github.com/juancwu/konbini/server/utils"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+)
+
+// newVerifyEmailEcho is a server instance that only verifies emails.
+func newVerifyEmailEcho(connector *db.DBConnector) *echo.Echo {
+	e := echo.New()
+	e.HTTPErrorHandler = handlers.ErrorHandler()
+	e.GET(api.UriVerifyEmail, handlers.VerifyEmail(connector))
+	return e
+}
+
+func verifyEmail(t *testing.T, e *echo.Echo, token string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, api.UriVerifyEmail+"?"+url.Values{"token": {token}}.Encode(), nil))
+	return rec
+}
+
+// newTestEmailToken stores an email token of the user and returns it packaged like in the email.
+func newTestEmailToken(t *testing.T, connector *db.DBConnector, userID string, createdAt time.Time, ttl time.Duration) (string, string) {
+	conn, err := connector.Connect()
+	require.NoError(t, err)
+	defer conn.Close()
+	row, err := db.New(conn).NewEmailToken(context.Background(), db.NewEmailTokenParams{
+		UserID:    userID,
+		CreatedAt: utils.FormatRFC3339NanoFixed(createdAt),
+		ExpiresAt: utils.FormatRFC3339NanoFixed(createdAt.Add(ttl)),
+	})
+	require.NoError(t, err)
+	token, err := (&services.EmailToken{Id: row.ID}).Package()
+	require.NoError(t, err)
+	return row.ID, token
+}
+
+func TestEmailTokens(t *testing.T) {
+	_, err := config.New()
+	require.NoError(t, err)
+	connector := newTestDB(t)
+	ctx := context.Background()
+
+	t.Run("expires after ten minutes", func(t *testing.T) {
+		userID := newTestUser(t, connector, "ttl@mail.com")
+		conn, err := connector.Connect()
+		require.NoError(t, err)
+		defer conn.Close()
+
+		token, err := services.NewEmailToken(ctx, db.New(conn), userID)
+		require.NoError(t, err)
+		require.Equal(t, 10*time.Minute, token.ExpiresAt.Sub(token.CreatedAt))
+	})
+
+	t.Run("is single use", func(t *testing.T) {
+		userID := newTestUser(t, connector, "single@mail.com")
+		_, token := newTestEmailToken(t, connector, userID, time.Now(), services.EMAIL_TOKEN_TTL)
+		e := newVerifyEmailEcho(connector)
+
+		require.Equal(t, http.StatusOK, verifyEmail(t, e, token).Code)
+		rec := verifyEmail(t, e, token)
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+		require.Equal(t, api.ErrorCodeInvalidToken, errorCode(t, rec))
+
+		conn, err := connector.Connect()
+		require.NoError(t, err)
+		defer conn.Close()
+		verified, err := db.New(conn).IsUserEmailVerified(ctx, userID)
+		require.NoError(t, err)
+		require.True(t, verified)
+	})
+
+	t.Run("is rejected after it expires", func(t *testing.T) {
+		userID := newTestUser(t, connector, "expired@mail.com")
+		_, token := newTestEmailToken(t, connector, userID, time.Now().Add(-services.EMAIL_TOKEN_TTL-time.Second), services.EMAIL_TOKEN_TTL)
+
+		rec := verifyEmail(t, newVerifyEmailEcho(connector), token)
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+		require.Equal(t, api.ErrorCodeTokenExpired, errorCode(t, rec))
+	})
+
+	t.Run("is verified by another instance", func(t *testing.T) {
+		// the token is created by one server and the link opened on another one
+		userID := newTestUser(t, connector, "instances@mail.com")
+		conn, err := connector.Connect()
+		require.NoError(t, err)
+		defer conn.Close()
+		emailToken, err := services.NewEmailToken(ctx, db.New(conn), userID)
+		require.NoError(t, err)
+		token, err := emailToken.Package()
+		require.NoError(t, err)
+
+		require.Equal(t, http.StatusOK, verifyEmail(t, newVerifyEmailEcho(connector), token).Code)
+		rec := verifyEmail(t, newVerifyEmailEcho(connector), token)
+		require.Equal(t, api.ErrorCodeInvalidToken, errorCode(t, rec))
+	})
+
+	t.Run("is sent once the request commits", func(t *testing.T) {
+		userID := newTestUser(t, connector, "subscriber@mail.com")
+		sender := &fakeEmailSender{}
+		queue := newTestEmailQueue(newMemoryEmailJobStore(), sender, 1)
+		queue.Start(ctx)
+		services.SetDefaultEmailQueue(queue)
+		t.Cleanup(func() {
+			queue.Stop()
+			services.SetDefaultEmailQueue(nil)
+		})
+
+		store := newMemoryOutboxStore()
+		bus := newTestBus(store, 3)
+		services.SubscribeEmails(bus, connector)
+		require.NoError(t, bus.Publish(ctx, nil, events.EmailVerificationRequested{UserID: userID, Email: "subscriber@mail.com"}))
+		require.Len(t, store.bySubscriber("emails"), 1)
+
+		bus.Start(ctx)
+		defer bus.Stop()
+		bus.Dispatch()
+
+		require.Eventually(t, func() bool { return sender.sentCount() == 1 }, time.Second*5, time.Millisecond*10)
+		require.Equal(t, []string{"subscriber@mail.com"}, sender.sent[0].To)
+		require.Equal(t, "Verify Your Email", sender.sent[0].Subject)
+	})
+
+	t.Run("cleanup removes used and expired tokens", func(t *testing.T) {
+		userID := newTestUser(t, connector, "cleanup@mail.com")
+		usedID, used := newTestEmailToken(t, connector, userID, time.Now(), services.EMAIL_TOKEN_TTL)
+		require.Equal(t, http.StatusOK, verifyEmail(t, newVerifyEmailEcho(connector), used).Code)
+		expiredID, _ := newTestEmailToken(t, connector, userID, time.Now().Add(-time.Hour), services.EMAIL_TOKEN_TTL)
+		validID, _ := newTestEmailToken(t, connector, userID, time.Now(), services.EMAIL_TOKEN_TTL)
+
+		cleanupCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		services.StartEmailTokenCleanup(cleanupCtx, connector, time.Millisecond*10)
+
+		conn, err := connector.Connect()
+		require.NoError(t, err)
+		defer conn.Close()
+		q := db.New(conn)
+		// the cleanup writes while the test reads, a locked database is not a missing token
+		deleted := func(id string) bool {
+			_, err := q.GetEmailTokenByID(ctx, id)
+			return errors.Is(err, sql.ErrNoRows)
+		}
+		require.Eventually(t, func() bool {
+			return deleted(usedID) && deleted(expiredID)
+		}, time.Second*5, time.Millisecond*10)
+		cancel()
+		require.Eventually(t, func() bool {
+			_, err := q.GetEmailTokenByID(ctx, validID)
+			return err == nil
+		}, time.Second*5, time.Millisecond*10)
+	})
+}
@@ -0,0 +1,485 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/juancwu/konbini/common/api"
+	"github.com/juancwu/konbini/server/db"
+	"github.com/juancwu/konbini/server/handlers"
+	"github.com/juancwu/konbini/server/middlewares"
+	"github.com/juancwu/konbini/server/services"
+	"github.com/juancwu/konbini/server/utils"
+	inner_validator "github.com/juancwu/konbini/server/validator"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryWebhookDeliveryStore is an in-memory services.WebhookDeliveryStore used to test the queue without a database.
+type memoryWebhookDeliveryStore struct {
+	*memoryJobStore[db.WebhookDelivery]
+
+	mu       sync.Mutex
+	webhooks map[string]db.Webhook
+	secrets  map[string][]byte
+}
+
+func newMemoryWebhookDeliveryStore() *memoryWebhookDeliveryStore {
+	statuses := memoryJobStatuses{services.WEBHOOK_DELIVERY_PENDING, services.WEBHOOK_DELIVERY_PROCESSING, services.WEBHOOK_DELIVERY_DELIVERED, services.WEBHOOK_DELIVERY_DEAD}
+	return &memoryWebhookDeliveryStore{
+		memoryJobStore: newMemoryJobStore(statuses, func(d *db.WebhookDelivery) memoryJobState {
+			return memoryJobState{&d.ID, &d.Status, &d.Attempts, &d.RunAt, &d.LockedUntil, &d.LastError}
+		}),
+		webhooks: make(map[string]db.Webhook),
+		secrets:  make(map[string][]byte),
+	}
+}
+
+// addWebhook registers a webhook subscribed to events and returns it.
+func (s *memoryWebhookDeliveryStore) addWebhook(id string, url string, secret string, events ...string) db.Webhook {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, _ := json.Marshal(events)
+	webhook := db.Webhook{ID: id, Url: url, Events: string(b)}
+	s.webhooks[id] = webhook
+	s.secrets[id] = []byte(secret)
+	return webhook
+}
+
+func (s *memoryWebhookDeliveryStore) Enqueue(_ context.Context, webhookID string, eventID string, eventType string, payload string, maxAttempts int, runAt time.Time) (string, error) {
+	now := utils.FormatRFC3339NanoFixed(time.Now())
+	return s.insert(db.WebhookDelivery{
+		WebhookID:   webhookID,
+		EventID:     eventID,
+		EventType:   eventType,
+		Payload:     payload,
+		MaxAttempts: int64(maxAttempts),
+		RunAt:       utils.FormatRFC3339NanoFixed(runAt),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}), nil
+}
+
+func (s *memoryWebhookDeliveryStore) Claim(ctx context.Context, now time.Time, lease time.Duration) (services.WebhookDelivery, error) {
+	d, err := s.memoryJobStore.Claim(ctx, now, lease)
+	if err != nil {
+		return services.WebhookDelivery{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return services.WebhookDelivery{
+		WebhookDelivery: d,
+		URL:             s.webhooks[d.WebhookID].Url,
+		Secret:          s.secrets[d.WebhookID],
+	}, nil
+}
+
+func (s *memoryWebhookDeliveryStore) Complete(_ context.Context, id string, lease string, responseStatus int) error {
+	return s.complete(id, lease, func(d *db.WebhookDelivery) { d.ResponseStatus = statusPtr(responseStatus) })
+}
+
+func (s *memoryWebhookDeliveryStore) Retry(_ context.Context, id string, lease string, runAt time.Time, responseStatus int, lastError string) error {
+	return s.retry(id, lease, runAt, lastError, func(d *db.WebhookDelivery) { d.ResponseStatus = statusPtr(responseStatus) })
+}
+
+func (s *memoryWebhookDeliveryStore) Bury(_ context.Context, id string, lease string, responseStatus int, lastError string) error {
+	return s.bury(id, lease, lastError, func(d *db.WebhookDelivery) { d.ResponseStatus = statusPtr(responseStatus) })
+}
+
+func (s *memoryWebhookDeliveryStore) ids() []string {
+	ids := []string{}
+	for _, d := range s.list(nil) {
+		ids = append(ids, d.ID)
+	}
+	return ids
+}
+
+func statusPtr(status int) *int64 {
+	if status == 0 {
+		return nil
+	}
+	s := int64(status)
+	return &s
+}
+
+// webhookReceiver is an httptest server that verifies the signature of every delivery. It
+// responds with the statuses in order and then with 204.
+type webhookReceiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	statuses []int
+	received []*http.Request
+	events   []api.WebhookEvent
+	invalid  int
+}
+
+func newWebhookReceiver(t *testing.T, secret string, statuses ...int) *webhookReceiver {
+	r := &webhookReceiver{statuses: statuses}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, err := io.ReadAll(req.Body)
+		require.NoError(t, err)
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if !services.VerifyWebhookSignature(
+			[]byte(secret),
+			req.Header.Get(api.HeaderWebhookTimestamp),
+			body,
+			req.Header.Get(api.HeaderWebhookSignature),
+			time.Minute,
+			time.Now(),
+		) {
+			r.invalid++
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var event api.WebhookEvent
+		require.NoError(t, json.Unmarshal(body, &event))
+		r.received = append(r.received, req)
+		r.events = append(r.events, event)
+
+		status := http.StatusNoContent
+		if len(r.statuses) > 0 {
+			status = r.statuses[0]
+			r.statuses = r.statuses[1:]
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *webhookReceiver) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.events)
+}
+
+// newTestWebhookQueue creates a queue that can deliver to the loopback receivers of the tests,
+// the default client of the queue refuses them.
+func newTestWebhookQueue(store services.WebhookDeliveryStore, maxAttempts int) *services.WebhookQueue {
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return services.NewWebhookQueue(store, client, services.WebhookQueueConfig{
+		Workers:      2,
+		MaxAttempts:  maxAttempts,
+		PollInterval: time.Millisecond * 10,
+		BaseBackoff:  time.Millisecond,
+		MaxBackoff:   time.Millisecond * 5,
+	})
+}
+
+func TestWebhookQueue(t *testing.T) {
+	data := api.BentoIngredientsChangedData{
+		BentoID:     "b1",
+		Revision:    2,
+		Action:      api.BentoChangeAdd,
+		Ingredients: []string{"API_KEY"},
+		UserID:      "u1",
+	}
+
+	t.Run("delivers signed events", func(t *testing.T) {
+		receiver := newWebhookReceiver(t, "secret")
+		store := newMemoryWebhookDeliveryStore()
+		webhook := store.addWebhook("w1", receiver.URL, "secret", api.WebhookEventBentoIngredientsChanged)
+		queue := newTestWebhookQueue(store, 3)
+		queue.Start(context.Background())
+		defer queue.Stop()
+
+		n, err := queue.Publish(context.Background(), "e1", []db.Webhook{webhook}, api.WebhookEventBentoIngredientsChanged, data)
+		require.NoError(t, err)
+		require.Equal(t, 1, n)
+
+		require.Eventually(t, func() bool {
+			return store.get("1").Status == services.WEBHOOK_DELIVERY_DELIVERED
+		}, time.Second, time.Millisecond*5)
+		require.Equal(t, int64(http.StatusNoContent), *store.get("1").ResponseStatus)
+
+		require.Zero(t, receiver.invalid)
+		req := receiver.received[0]
+		require.Equal(t, api.WebhookEventBentoIngredientsChanged, req.Header.Get(api.HeaderWebhookEvent))
+		require.Equal(t, "1", req.Header.Get(api.HeaderWebhookDelivery))
+		require.Equal(t, services.WEBHOOK_USER_AGENT, req.Header.Get("User-Agent"))
+
+		event := receiver.events[0]
+		require.Equal(t, "e1", event.ID)
+		require.Equal(t, "e1", store.get("1").EventID)
+		require.Equal(t, api.WebhookEventBentoIngredientsChanged, event.Type)
+		var got api.BentoIngredientsChangedData
+		require.NoError(t, json.Unmarshal(event.Data, &got))
+		require.Equal(t, data, got)
+	})
+
+	t.Run("only queues events the webhooks are subscribed to", func(t *testing.T) {
+		store := newMemoryWebhookDeliveryStore()
+		bento := store.addWebhook("w1", "http://localhost", "secret", api.WebhookEventBentoIngredientsChanged)
+		security := store.addWebhook("w2", "http://localhost", "secret", api.WebhookEventTOTPRemoved, api.WebhookEventGroupMemberJoined)
+		queue := newTestWebhookQueue(store, 3)
+
+		n, err := queue.Publish(context.Background(), "", []db.Webhook{bento, security}, api.WebhookEventTOTPRemoved, api.TOTPRemovedData{UserID: "u1"})
+		require.NoError(t, err)
+		require.Equal(t, 1, n)
+		require.Equal(t, []string{"1"}, store.ids())
+		require.Equal(t, "w2", store.get("1").WebhookID)
+
+		n, err = queue.Publish(context.Background(), "", []db.Webhook{bento}, api.WebhookEventGroupMemberJoined, api.GroupMemberJoinedData{})
+		require.NoError(t, err)
+		require.Equal(t, 0, n)
+	})
+
+	t.Run("retries failed deliveries and records the responses", func(t *testing.T) {
+		receiver := newWebhookReceiver(t, "secret", http.StatusInternalServerError, http.StatusBadGateway)
+		store := newMemoryWebhookDeliveryStore()
+		webhook := store.addWebhook("w1", receiver.URL, "secret", api.WebhookEventBentoIngredientsChanged)
+		queue := newTestWebhookQueue(store, 5)
+		queue.Start(context.Background())
+		defer queue.Stop()
+
+		_, err := queue.Publish(context.Background(), "", []db.Webhook{webhook}, api.WebhookEventBentoIngredientsChanged, data)
+		require.NoError(t, err)
+
+		require.Eventually(t, func() bool {
+			return store.get("1").Status == services.WEBHOOK_DELIVERY_DELIVERED
+		}, time.Second, time.Millisecond*5)
+		require.Equal(t, int64(3), store.get("1").Attempts)
+		require.Nil(t, store.get("1").LastError)
+		// every attempt carries the same event
+		require.Equal(t, receiver.events[0].ID, receiver.events[2].ID)
+	})
+
+	t.Run("dead-letters after max attempts", func(t *testing.T) {
+		receiver := newWebhookReceiver(t, "secret", http.StatusInternalServerError, http.StatusInternalServerError, http.StatusServiceUnavailable)
+		store := newMemoryWebhookDeliveryStore()
+		webhook := store.addWebhook("w1", receiver.URL, "secret", api.WebhookEventBentoIngredientsChanged)
+		queue := newTestWebhookQueue(store, 3)
+		queue.Start(context.Background())
+		defer queue.Stop()
+
+		_, err := queue.Publish(context.Background(), "", []db.Webhook{webhook}, api.WebhookEventBentoIngredientsChanged, data)
+		require.NoError(t, err)
+
+		require.Eventually(t, func() bool {
+			return store.get("1").Status == services.WEBHOOK_DELIVERY_DEAD
+		}, time.Second, time.Millisecond*5)
+		require.Equal(t, int64(http.StatusServiceUnavailable), *store.get("1").ResponseStatus)
+		// only the status is kept, never the body of the response
+		require.Equal(t, "Webhook responded with status 503", *store.get("1").LastError)
+		require.Equal(t, 3, receiver.count())
+	})
+
+	t.Run("sends test events to any webhook", func(t *testing.T) {
+		receiver := newWebhookReceiver(t, "secret")
+		store := newMemoryWebhookDeliveryStore()
+		store.addWebhook("w1", receiver.URL, "secret", api.WebhookEventTOTPRemoved)
+		queue := newTestWebhookQueue(store, 3)
+		queue.Start(context.Background())
+		defer queue.Stop()
+
+		id, err := queue.SendTest(context.Background(), "w1")
+		require.NoError(t, err)
+
+		require.Eventually(t, func() bool {
+			return store.get(id).Status == services.WEBHOOK_DELIVERY_DELIVERED
+		}, time.Second, time.Millisecond*5)
+		require.Equal(t, api.WebhookEventTest, receiver.events[0].Type)
+		require.JSONEq(t, `{"webhook_id":"w1"}`, string(receiver.events[0].Data))
+	})
+
+	t.Run("does not follow redirects", func(t *testing.T) {
+		target := newWebhookReceiver(t, "secret")
+		redirect := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusTemporaryRedirect))
+		defer redirect.Close()
+
+		store := newMemoryWebhookDeliveryStore()
+		store.addWebhook("w1", redirect.URL, "secret", api.WebhookEventTOTPRemoved)
+		queue := newTestWebhookQueue(store, 1)
+		queue.Start(context.Background())
+		defer queue.Stop()
+
+		id, err := queue.SendTest(context.Background(), "w1")
+		require.NoError(t, err)
+
+		require.Eventually(t, func() bool {
+			return store.get(id).Status == services.WEBHOOK_DELIVERY_DEAD
+		}, time.Second, time.Millisecond*5)
+		require.Equal(t, int64(http.StatusTemporaryRedirect), *store.get(id).ResponseStatus)
+		require.Equal(t, 0, target.count())
+	})
+}
+
+func TestDBWebhookDeliveryStore(t *testing.T) {
+	connector := newTestDB(t)
+	conn, err := connector.Connect()
+	require.NoError(t, err)
+	defer conn.Close()
+	ctx := context.Background()
+	now := utils.FormatRFC3339NanoFixed(time.Now())
+	userID := newTestUser(t, connector, "webhooks@mail.com")
+	bento, err := db.New(conn).NewBento(ctx, db.NewBentoParams{UserID: userID, Name: "prod", CreatedAt: now, UpdatedAt: now})
+	require.NoError(t, err)
+
+	t.Run("buries deliveries whose webhook can't be loaded", func(t *testing.T) {
+		// the secret was not encrypted with the key of the store
+		webhookID, err := db.New(conn).NewWebhook(ctx, db.NewWebhookParams{
+			UserID:    userID,
+			BentoID:   &bento.ID,
+			Url:       "https://93.184.216.34/hook",
+			Secret:    []byte("not encrypted"),
+			Events:    `["` + api.WebhookEventTest + `"]`,
+			CreatedAt: now,
+			UpdatedAt: now,
+		})
+		require.NoError(t, err)
+		store := services.NewDBWebhookDeliveryStore(connector, make([]byte, 32))
+		queue := newTestWebhookQueue(store, 5)
+		queue.Start(ctx)
+		defer queue.Stop()
+
+		id, err := queue.SendTest(ctx, webhookID)
+		require.NoError(t, err)
+
+		var status string
+		var attempts int
+		var lastError *string
+		require.Eventually(t, func() bool {
+			err := conn.QueryRowContext(ctx, "SELECT status, attempts, last_error FROM webhook_deliveries WHERE id = ?", id).Scan(&status, &attempts, &lastError)
+			return err == nil && status == services.WEBHOOK_DELIVERY_DEAD
+		}, time.Second*5, time.Millisecond*10)
+		require.Equal(t, 1, attempts)
+		require.NotNil(t, lastError)
+		require.Contains(t, *lastError, "Failed to decrypt webhook secret")
+	})
+}
+
+func TestWebhookAddresses(t *testing.T) {
+	t.Run("only accepts public addresses", func(t *testing.T) {
+		for _, url := range []string{
+			"http://127.0.0.1:8080/hook",
+			"http://localhost/hook",
+			"http://169.254.169.254/latest/meta-data/",
+			"http://10.0.0.1/hook",
+			"http://192.168.1.10/hook",
+			"http://100.64.0.1/hook",
+			"http://0.0.0.0/hook",
+			"http://[::1]/hook",
+			"http://[fd00:ec2::254]/hook",
+			"http://[::ffff:127.0.0.1]/hook",
+			"ftp://93.184.216.34/hook",
+		} {
+			err := services.ValidateWebhookURL(context.Background(), url)
+			require.ErrorIs(t, err, services.ErrWebhookAddressNotAllowed, url)
+		}
+		require.NoError(t, services.ValidateWebhookURL(context.Background(), "https://93.184.216.34/hook"))
+	})
+
+	t.Run("rejects webhooks to private addresses", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = inner_validator.New()
+		e.HTTPErrorHandler = handlers.ErrorHandler()
+		e.POST(api.UriBentoWebhooks, handlers.NewBentoWebhook(nil), func(next echo.HandlerFunc) echo.HandlerFunc {
+			return func(c echo.Context) error {
+				c.Set("user", db.User{ID: "u1"})
+				return next(c)
+			}
+		}, middlewares.ValidateJson(reflect.TypeOf(api.NewWebhookRequest{})))
+
+		for _, url := range []string{"http://127.0.0.1:9000/hook", "http://169.254.169.254/latest/meta-data/"} {
+			body := `{"url":"` + url + `","events":["security.totp_removed"]}`
+			req := httptest.NewRequest(http.MethodPost, "/bento/b1/webhooks", strings.NewReader(body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			require.Equal(t, http.StatusBadRequest, rec.Code, url)
+			var errRes api.ErrorResponse
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &errRes))
+			require.Equal(t, api.ErrorCodeWebhookURLNotAllowed, errRes.ErrorCode)
+		}
+	})
+
+	t.Run("refuses private addresses when connecting", func(t *testing.T) {
+		// the receiver listens on 127.0.0.1, like a host that resolves to a private address
+		// after the webhook was created
+		receiver := newWebhookReceiver(t, "secret")
+		store := newMemoryWebhookDeliveryStore()
+		store.addWebhook("w1", receiver.URL, "secret", api.WebhookEventTOTPRemoved)
+		queue := services.NewWebhookQueue(store, nil, services.WebhookQueueConfig{MaxAttempts: 1, PollInterval: time.Millisecond * 10})
+		queue.Start(context.Background())
+		defer queue.Stop()
+
+		id, err := queue.SendTest(context.Background(), "w1")
+		require.NoError(t, err)
+		require.Eventually(t, func() bool {
+			return store.get(id).Status == services.WEBHOOK_DELIVERY_DEAD
+		}, time.Second, time.Millisecond*5)
+		require.Equal(t, services.ErrWebhookAddressNotAllowed.Error(), *store.get(id).LastError)
+		require.Equal(t, 0, receiver.count())
+
+		_, err = services.NewWebhookHTTPClient().Post("http://169.254.169.254/latest/meta-data/", api.MimeApplicationJson, nil)
+		require.ErrorIs(t, err, services.ErrWebhookAddressNotAllowed)
+	})
+}
+
+func TestWebhookSignature(t *testing.T) {
+	secret := []byte("secret")
+	body := []byte(`{"id":"e1"}`)
+	now := time.Unix(1700000000, 0)
+	ts := strconv.FormatInt(now.Unix(), 10)
+	sig := services.SignWebhook(secret, now.Unix(), body)
+
+	require.True(t, services.VerifyWebhookSignature(secret, ts, body, sig, time.Minute, now))
+	require.True(t, services.VerifyWebhookSignature(secret, ts, body, sig, time.Minute, now.Add(time.Second*30)))
+
+	require.False(t, services.VerifyWebhookSignature(secret, ts, body, sig, time.Minute, now.Add(time.Minute*2)), "replayed")
+	require.False(t, services.VerifyWebhookSignature(secret, ts, []byte(`{"id":"e2"}`), sig, time.Minute, now), "tampered body")
+	require.False(t, services.VerifyWebhookSignature(secret, strconv.FormatInt(now.Unix()+1, 10), body, sig, time.Minute, now), "tampered timestamp")
+	require.False(t, services.VerifyWebhookSignature([]byte("other"), ts, body, sig, time.Minute, now), "other secret")
+	require.False(t, services.VerifyWebhookSignature(secret, ts, body, sig[len("sha256="):], time.Minute, now), "missing prefix")
+}
+
+func TestNewWebhookValidation(t *testing.T) {
+	structType := reflect.TypeOf(api.NewWebhookRequest{})
+
+	code, _ := postValidated(t, structType, `{"url":"https://example.com/hook","events":["bento.ingredients_changed"]}`)
+	require.Equal(t, http.StatusOK, code)
+
+	code, errRes := postValidated(t, structType, `{"url":"not a url","events":[]}`)
+	require.Equal(t, http.StatusBadRequest, code)
+	require.Contains(t, errRes.FieldErrors(), "url")
+	require.Contains(t, errRes.FieldErrors(), "events")
+
+	code, errRes = postValidated(t, structType, `{"url":"https://example.com/hook","events":["webhook.test"]}`)
+	require.Equal(t, http.StatusBadRequest, code)
+	require.Equal(t, "oneof", errRes.Errors[0].Rule)
+}
+
+func TestWebhookRoutesAreDocumented(t *testing.T) {
+	doc := getOpenAPIDocument(t, newV1Echo())
+
+	for path, methods := range map[string][]string{
+		"/bento/{id}/webhooks":     {"get", "post"},
+		"/group/{id}/webhooks":     {"get", "post"},
+		"/webhook/{id}":            {"delete"},
+		"/webhook/{id}/deliveries": {"get"},
+		"/webhook/{id}/test":       {"post"},
+	} {
+		for _, method := range methods {
+			require.NotNil(t, doc.Paths[path][method], "%s %s", method, path)
+		}
+	}
+	require.Contains(t, doc.Paths["/bento/{id}/webhooks"]["post"].Responses, "201")
+	require.Contains(t, doc.Paths["/webhook/{id}/test"]["post"].Responses, "202")
+}
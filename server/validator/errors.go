@@ -0,0 +1,112 @@
+package validator
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/juancwu/konbini/common/api"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// FieldErrors translates the errors returned by go-playground validator into
+// field errors that can be sent to the client.
+func FieldErrors(errs validator.ValidationErrors) []api.FieldError {
+	fieldErrors := make([]api.FieldError, len(errs))
+	for i, fe := range errs {
+		field := fieldPath(fe.Namespace())
+		fieldErrors[i] = api.FieldError{
+			Field:   field,
+			Rule:    fe.Tag(),
+			Param:   fe.Param(),
+			Message: field + " " + ruleMessage(fe),
+		}
+	}
+	return fieldErrors
+}
+
+// TypeFieldError translates a json type mismatch, i.e. a number sent for a string field.
+func TypeFieldError(err *json.UnmarshalTypeError) api.FieldError {
+	field := err.Field
+	if field == "" {
+		field = "body"
+	}
+	return api.FieldError{
+		Field:   field,
+		Rule:    "type",
+		Param:   jsonTypeName(err.Type),
+		Message: fmt.Sprintf("%s must be of type %s", field, jsonTypeName(err.Type)),
+	}
+}
+
+// fieldPath removes the struct name from the namespace, "LoginRequest.email" becomes "email".
+func fieldPath(namespace string) string {
+	_, path, found := strings.Cut(namespace, ".")
+	if !found {
+		return namespace
+	}
+	return path
+}
+
+// ruleMessage builds a human message for the failed rule. It does not include the field name.
+func ruleMessage(fe validator.FieldError) string {
+	param := fe.Param()
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "uuid", "uuid4":
+		return "must be a valid UUID"
+	case "url":
+		return "must be a valid URL"
+	case "printascii":
+		return "must only contain printable ASCII characters"
+	case "oneof":
+		return "must be one of: " + strings.Join(strings.Fields(param), ", ")
+	case "min", "gte":
+		return sizeMessage(fe, "at least", param)
+	case "max", "lte":
+		return sizeMessage(fe, "at most", param)
+	case "gt":
+		return sizeMessage(fe, "more than", param)
+	case "lt":
+		return sizeMessage(fe, "less than", param)
+	case "len":
+		return sizeMessage(fe, "exactly", param)
+	case "eqfield":
+		return "must match " + param
+	}
+	if strings.Contains(fe.Tag(), "|") {
+		return "must satisfy one of: " + strings.ReplaceAll(fe.Tag(), "|", ", ")
+	}
+	return fmt.Sprintf("failed the '%s' rule", fe.Tag())
+}
+
+// sizeMessage describes a size limit using the unit that matches the field kind.
+func sizeMessage(fe validator.FieldError, comparison string, param string) string {
+	switch fe.Kind() {
+	case reflect.String:
+		return fmt.Sprintf("must be %s %s characters long", comparison, param)
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return fmt.Sprintf("must contain %s %s items", comparison, param)
+	}
+	return fmt.Sprintf("must be %s %s", comparison, param)
+}
+
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	}
+	return "object"
+}
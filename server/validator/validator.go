@@ -1,6 +1,9 @@
 package validator
 
 import (
+	"reflect"
+	"strings"
+
 	"github.com/go-playground/validator/v10"
 )
 
@@ -8,6 +11,27 @@ type Validator struct {
 	Validator *validator.Validate
 }
 
+// New creates a validator that reports fields by their json name so that
+// validation errors match the request body sent by the client.
+func New() *Validator {
+	v := validator.New()
+	v.RegisterTagNameFunc(jsonFieldName)
+	return &Validator{Validator: v}
+}
+
 func (v *Validator) Validate(i interface{}) error {
 	return v.Validator.Struct(i)
 }
+
+// jsonFieldName gets the name of the field in the json tag. It falls back to
+// the struct field name when the field has no json tag.
+func jsonFieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	switch name {
+	case "-":
+		return ""
+	case "":
+		return field.Name
+	}
+	return name
+}